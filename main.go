@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"syscall"
 
@@ -11,11 +12,11 @@ import (
 
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
-	cmd := cmd.NewObsctlCmd(ctx)
+	root := cmd.NewObsctlCmd(ctx)
 
 	var g run.Group
 	g.Add(func() error {
-		return cmd.Execute()
+		return cmd.Execute(ctx, root)
 	}, func(err error) {
 		cancel()
 	})
@@ -24,7 +25,10 @@ func main() {
 	g.Add(run.SignalHandler(ctx, os.Interrupt, syscall.SIGINT, syscall.SIGTERM))
 
 	if err := g.Run(); err != nil {
+		var serr run.SignalError
+		if errors.As(err, &serr) {
+			os.Exit(cmd.ExitCodeCancelled)
+		}
 		os.Exit(1)
-
 	}
 }
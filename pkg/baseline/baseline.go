@@ -0,0 +1,167 @@
+// Package baseline stores snapshots of query results and compares fresh results against them.
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Directions of changes considered regressions.
+const (
+	Any      = "any"
+	Increase = "increase"
+	Decrease = "decrease"
+)
+
+// Statuses of compared series.
+const (
+	OK         = "ok"
+	Regression = "regression"
+	// Missing series are in the baseline, but not in the current result.
+	Missing = "missing"
+	// New series are in the current result, but not in the baseline.
+	New = "new"
+)
+
+// Baseline is a snapshot of the results of queries.
+type Baseline struct {
+	Context string    `json:"context"`
+	Time    time.Time `json:"time"`
+	Queries []Query   `json:"queries"`
+}
+
+// Query is the result of a query, one sample per series.
+type Query struct {
+	Query  string   `json:"query"`
+	Series []Sample `json:"series"`
+}
+
+// Sample is the value of a series, keyed by its label set in PromQL notation.
+type Sample struct {
+	Series string `json:"series"`
+	// Value is kept as returned by the API, as JSON has no representation of NaN and infinities.
+	Value string `json:"value"`
+}
+
+// Load reads a baseline from a file.
+func Load(path string) (*Baseline, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading baseline: %w", err)
+	}
+
+	var bl Baseline
+	if err := json.Unmarshal(b, &bl); err != nil {
+		return nil, fmt.Errorf("parsing baseline %s: %w", path, err)
+	}
+	return &bl, nil
+}
+
+// Save writes the baseline to a file, replacing an existing one.
+func (b *Baseline) Save(path string) error {
+	out, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding baseline: %w", err)
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing baseline: %w", err)
+	}
+	return nil
+}
+
+// Tolerance is the change of a value allowed before it is considered a regression. A change is
+// tolerated if it is within Absolute or within Relative times the baseline value, whichever is larger.
+type Tolerance struct {
+	Relative float64
+	Absolute float64
+	// Direction of changes considered regressions, one of Any, Increase or Decrease.
+	Direction string
+}
+
+// Result is the comparison of a series with its baseline.
+type Result struct {
+	Query    string `json:"query"`
+	Series   string `json:"series"`
+	Baseline string `json:"baseline,omitempty"`
+	Current  string `json:"current,omitempty"`
+	// Change is the relative change of the value, NaN if the baseline value is zero.
+	Change float64 `json:"-"`
+	Status string  `json:"status"`
+}
+
+// Compare compares the current result of a query with its baseline, series by series. Missing
+// series are reported, new series only with the status New, which is no regression.
+func Compare(baseline Query, current []Sample, tol Tolerance) []Result {
+	values := make(map[string]string, len(current))
+	for _, s := range current {
+		values[s.Series] = s.Value
+	}
+
+	var results []Result
+	seen := map[string]bool{}
+	for _, s := range baseline.Series {
+		seen[s.Series] = true
+		r := Result{Query: baseline.Query, Series: s.Series, Baseline: s.Value, Change: math.NaN()}
+
+		cur, ok := values[s.Series]
+		if !ok {
+			r.Status = Missing
+			results = append(results, r)
+			continue
+		}
+
+		r.Current = cur
+		old, now := parseFloat(s.Value), parseFloat(cur)
+		if old != 0 {
+			r.Change = (now - old) / math.Abs(old)
+		}
+		r.Status = OK
+		if regressed(old, now, tol) {
+			r.Status = Regression
+		}
+		results = append(results, r)
+	}
+
+	for _, s := range current {
+		if !seen[s.Series] {
+			results = append(results, Result{Query: baseline.Query, Series: s.Series, Current: s.Value, Change: math.NaN(), Status: New})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Series < results[j].Series })
+	return results
+}
+
+// regressed reports whether the change from old to now is a regression beyond the tolerance.
+func regressed(old, now float64, tol Tolerance) bool {
+	if math.IsNaN(old) || math.IsNaN(now) {
+		// A value becoming (or stopping to be) undefined is a change in any direction.
+		return math.IsNaN(old) != math.IsNaN(now)
+	}
+
+	delta := now - old
+	switch tol.Direction {
+	case Increase:
+		if delta <= 0 {
+			return false
+		}
+	case Decrease:
+		if delta >= 0 {
+			return false
+		}
+	}
+	return math.Abs(delta) > math.Max(tol.Absolute, tol.Relative*math.Abs(old))
+}
+
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
@@ -0,0 +1,99 @@
+// Package cache stores API responses on disk for a short time, so that repeating a request is cheap.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// Cache is a directory of responses, each stored in a file named after the hash of its key.
+type Cache struct {
+	dir    string
+	ttl    time.Duration
+	logger log.Logger
+}
+
+// New returns a cache in the user's cache directory, whose entries expire after ttl.
+func New(logger log.Logger, ttl time.Duration) (*Cache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("getting cache directory: %w", err)
+	}
+
+	return &Cache{dir: filepath.Join(dir, "obsctl", "queries"), ttl: ttl, logger: logger}, nil
+}
+
+// Key returns a cache key identifying the given parts, e.g. context, query and time range.
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the response stored for key, if there is one that has not expired yet.
+// Expired responses are removed.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	file := filepath.Join(c.dir, key)
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "reading cache entry", "err", err)
+		}
+		return nil, false
+	}
+
+	if time.Since(fi.ModTime()) > c.ttl {
+		if err := os.Remove(file); err != nil {
+			level.Debug(c.logger).Log("msg", "removing expired cache entry", "err", err)
+		}
+		return nil, false
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "reading cache entry", "err", err)
+		return nil, false
+	}
+
+	level.Debug(c.logger).Log("msg", "using cached response", "age", time.Since(fi.ModTime()).Round(time.Millisecond))
+	return b, true
+}
+
+// Put stores the response for key.
+func (c *Cache) Put(key string, b []byte) error {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	// Write to a temporary file first, so that concurrent readers never see partial responses.
+	tmp, err := os.CreateTemp(c.dir, key+".tmp")
+	if err != nil {
+		return fmt.Errorf("creating cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, key)); err != nil {
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/spf13/cobra"
+)
+
+// assertOps are the comparison operators of assertions.
+var assertOps = map[string]func(a, b float64) bool{
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// assertion is the outcome of an assertion for a single series.
+type assertion struct {
+	series string
+	// sample is the first sample violating the assertion, or the latest sample if there is none.
+	sample fetcher.SamplePair
+	ok     bool
+}
+
+func NewMetricsAssertCmd(ctx context.Context) *cobra.Command {
+	var query, op, at string
+	var value float64
+	var holdFor time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "assert",
+		Short: "Check that the result of a query satisfies a threshold.",
+		Long: `Check that the result of a query satisfies a threshold, exiting nonzero if it does not. Meant for
+deployment gates and smoke tests in CI.
+
+The query is evaluated as instant query and every resulting series has to satisfy the assertion
+'<value of series> --op --value'. With --for, the query is evaluated as range query over the
+duration before --time instead, and every sample has to satisfy the assertion, like the for clause
+of alerting rules.
+
+Queries returning no data fail the assertion. Append 'or vector(0)' to the query if no data is
+acceptable. Query results are never answered from the cache, see --cache.ttl.`,
+		Example: `obsctl metrics assert --query 'sum(rate(http_requests_total{code=~"5.."}[5m])) / sum(rate(http_requests_total[5m]))' --op '<' --value 0.01
+obsctl metrics assert --query 'min(up{job="api"})' --op '==' --value 1 --for 10m`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmp, ok := assertOps[op]
+			if !ok {
+				return fmt.Errorf("invalid --op %q, expected one of <, <=, >, >=, ==, !=", op)
+			}
+			if err := validateQuery(query); err != nil {
+				return err
+			}
+
+			end, err := parseTime(at, time.Now())
+			if err != nil {
+				return fmt.Errorf("parsing --time: %w", err)
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			recordHistory(ctx, f, fetcher.Metrics, query)
+
+			results, err := evaluateAssertion(ctx, f, query, end, holdFor, func(v float64) bool { return cmp(v, value) })
+			if err != nil {
+				return err
+			}
+			if len(results) == 0 {
+				return fmt.Errorf("assertion failed: query returned no data")
+			}
+
+			if err := printAssertions(cmd.OutOrStdout(), results); err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, r := range results {
+				if !r.ok {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("assertion failed for %d of %d series: value %s %s", failed, len(results), op, strconv.FormatFloat(value, 'g', -1, 64))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&query, "query", "", "PromQL query to evaluate.")
+	cmd.Flags().StringVar(&op, "op", "", "Comparison operator of the assertion. One of: <|<=|>|>=|==|!=.")
+	cmd.Flags().Float64Var(&value, "value", 0, "Threshold the values of the query are compared to.")
+	cmd.Flags().Var(duration.NewValue(&holdFor, 0), "for", "Duration for which the assertion has to hold, e.g. 5m. By default, only the latest value is checked.")
+	cmd.Flags().StringVar(&at, "time", "", "Time at which the assertion is checked, as RFC3339 or Unix timestamp, or relative to now like -1h. Defaults to now.")
+	_ = cmd.MarkFlagRequired("query")
+	_ = cmd.MarkFlagRequired("op")
+	_ = cmd.MarkFlagRequired("value")
+
+	return cmd
+}
+
+// evaluateAssertion evaluates the query at end, or over the holdFor duration before end if positive,
+// and checks every sample of the result with ok.
+func evaluateAssertion(ctx context.Context, f *fetcher.Fetcher, query string, end time.Time, holdFor time.Duration, ok func(float64) bool) ([]assertion, error) {
+	var (
+		data *fetcher.QueryData
+		err  error
+	)
+
+	// Gates have to see current data, so the cache is bypassed.
+	indicator.Start("Running query", 0)
+	if holdFor > 0 {
+		start := end.Add(-holdFor)
+		data, err = f.Query(ctx, fetcher.Metrics, "/query_range", url.Values{
+			"query": []string{query},
+			"start": []string{formatUnix(start)},
+			"end":   []string{formatUnix(end)},
+			"step":  []string{strconv.FormatFloat(autoStep(start, end).Seconds(), 'f', -1, 64)},
+		})
+	} else {
+		var params url.Values
+		if params, err = instantQueryParams(query, formatUnix(end)); err == nil {
+			data, err = f.Query(ctx, fetcher.Metrics, "/query", params)
+		}
+	}
+	indicator.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("querying metrics: %w", err)
+	}
+
+	if data.ResultType == "scalar" {
+		var s fetcher.SamplePair
+		if err := s.UnmarshalJSON(data.Result); err != nil {
+			return nil, fmt.Errorf("decoding scalar result: %w", err)
+		}
+		return []assertion{checkSamples("scalar", []fetcher.SamplePair{s}, ok)}, nil
+	}
+
+	series, err := data.Series()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []assertion
+	for _, s := range series {
+		samples := s.Values
+		if s.Value != nil {
+			samples = []fetcher.SamplePair{*s.Value}
+		}
+		if len(samples) == 0 {
+			// Native histograms have no single value to compare.
+			continue
+		}
+		results = append(results, checkSamples(fetcher.FormatMetric(s.Metric), samples, ok))
+	}
+	return results, nil
+}
+
+// checkSamples returns the assertion of a series, failing at its first sample that is not ok.
+// NaN values never satisfy an assertion.
+func checkSamples(series string, samples []fetcher.SamplePair, ok func(float64) bool) assertion {
+	for _, s := range samples {
+		if v := s.Float(); math.IsNaN(v) || !ok(v) {
+			return assertion{series: series, sample: s}
+		}
+	}
+	return assertion{series: series, sample: samples[len(samples)-1], ok: true}
+}
+
+func printAssertions(w io.Writer, results []assertion) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERIES\tVALUE\tTIME\tRESULT")
+	for _, r := range results {
+		result := "ok"
+		if !r.ok {
+			result = "FAILED"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.series, r.sample.Value, formatTime(r.sample.Time()), result)
+	}
+	return tw.Flush()
+}
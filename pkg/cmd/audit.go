@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// auditFile is the path of the audit log, auditing is disabled if empty.
+var auditFile string
+
+// auditEntry is a single invocation of obsctl recorded in the audit log. Args are the SHA-256 hashes of
+// the positional arguments, which may hold secrets, but can still be matched against known arguments.
+type auditEntry struct {
+	Time     time.Time         `json:"time"`
+	User     string            `json:"user"`
+	Host     string            `json:"host"`
+	Command  string            `json:"command"`
+	Args     []string          `json:"args,omitempty"`
+	Flags    map[string]string `json:"flags,omitempty"`
+	Context  string            `json:"context,omitempty"`
+	Status   string            `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Duration float64           `json:"durationSeconds"`
+}
+
+// sensitiveFlag reports whether a flag may hold a secret, whose value must never be recorded.
+func sensitiveFlag(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"secret", "token", "password", "key"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditFlagValue returns the value of a flag as recorded in the audit log. Values of sensitive flags
+// are redacted, as are values of key=value pairs of repeated flags with sensitive keys, e.g.
+// --api.param access_token=....
+func auditFlagValue(f *pflag.Flag) string {
+	if sensitiveFlag(f.Name) {
+		return "<redacted>"
+	}
+	sv, ok := f.Value.(pflag.SliceValue)
+	if !ok {
+		return f.Value.String()
+	}
+
+	vals := sv.GetSlice()
+	redacted := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if i := strings.Index(v, "="); i >= 0 && sensitiveFlag(v[:i]) {
+			v = v[:i+1] + "<redacted>"
+		}
+		redacted = append(redacted, v)
+	}
+	return "[" + strings.Join(redacted, ",") + "]"
+}
+
+// hashArgs returns the hex-encoded SHA-256 hashes of args.
+func hashArgs(args []string) []string {
+	hashes := make([]string, 0, len(args))
+	for _, a := range args {
+		h := sha256.Sum256([]byte(a))
+		hashes = append(hashes, "sha256:"+hex.EncodeToString(h[:]))
+	}
+	return hashes
+}
+
+// Execute executes the root command and, if enabled, records the invocation in the audit log.
+func Execute(ctx context.Context, root *cobra.Command) error {
+	start := time.Now()
+	c, err := root.ExecuteC()
+	if oerr := finishOutput(err); oerr != nil {
+		fmt.Fprintln(root.ErrOrStderr(), "Error:", oerr)
+		err = oerr
+	}
+	stopProfiling()
+	if err != nil {
+		printLoginHint(ctx, root.ErrOrStderr(), err)
+	}
+
+	if auditFile != "" && c != nil && !strings.HasPrefix(c.Name(), cobra.ShellCompRequestCmd) {
+		if aerr := audit(c, start, err); aerr != nil {
+			level.Warn(logger).Log("msg", "failed to write audit log", "file", auditFile, "err", aerr)
+		}
+	}
+
+	return err
+}
+
+func audit(c *cobra.Command, start time.Time, cmdErr error) error {
+	e := auditEntry{
+		Time:     start,
+		Command:  c.CommandPath(),
+		Args:     hashArgs(c.Flags().Args()),
+		Status:   "success",
+		Duration: time.Since(start).Seconds(),
+	}
+
+	if u, err := user.Current(); err == nil {
+		e.User = u.Username
+	}
+	if h, err := os.Hostname(); err == nil {
+		e.Host = h
+	}
+	if cmdErr != nil {
+		e.Status, e.Error = "error", cmdErr.Error()
+	}
+
+	c.Flags().Visit(func(f *pflag.Flag) {
+		if e.Flags == nil {
+			e.Flags = map[string]string{}
+		}
+		e.Flags[f.Name] = auditFlagValue(f)
+	})
+
+	// The context is read after execution, so that commands switching it are recorded with their target.
+	if cfg, err := config.Read(logger); err == nil && cfg.Current.API != "" {
+		e.Context = cfg.Current.String()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(e); err != nil {
+		return fmt.Errorf("marshaling audit entry: %w", err)
+	}
+
+	f, err := os.OpenFile(auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/cache"
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+)
+
+// cacheTTL is the time query responses are cached for. Caching is disabled if zero.
+var cacheTTL time.Duration
+
+// noCache bypasses cached query responses, responses are still cached for later invocations.
+var noCache bool
+
+// defaultCacheTTL returns the cache TTL configured with $OBSCTL_CACHE_TTL, or zero.
+func defaultCacheTTL() time.Duration {
+	d, _ := duration.Parse(os.Getenv("OBSCTL_CACHE_TTL"))
+	return d
+}
+
+// cachedQuery performs a GET request against an endpoint of the signal's API, answering it from
+// the query cache if an unexpired response for the same context, tenant, endpoint and parameters exists.
+func cachedQuery(ctx context.Context, f *fetcher.Fetcher, signal fetcher.Signal, endpoint string, params url.Values) ([]byte, error) {
+	if cacheTTL <= 0 {
+		b, err := f.Do(ctx, http.MethodGet, signal, endpoint, params, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		return b, f.CheckWarnings(endpoint, b)
+	}
+
+	c, err := cache.New(logger, cacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cache.Key(f.Context().String(), f.Tenant(), string(signal), endpoint, params.Encode(), f.Params.Encode())
+	if !noCache {
+		if b, ok := c.Get(key); ok {
+			return b, f.CheckWarnings(endpoint, b)
+		}
+	}
+
+	b, err := f.Do(ctx, http.MethodGet, signal, endpoint, params, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.CheckWarnings(endpoint, b); err != nil {
+		return nil, err
+	}
+
+	// Partial responses are not cached, so that the complete response is fetched next time.
+	if len(fetcher.Warnings(b)) == 0 {
+		if err := c.Put(key, b); err != nil {
+			level.Warn(logger).Log("msg", "caching query response", "err", err)
+		}
+	}
+	return b, nil
+}
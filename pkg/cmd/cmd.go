@@ -2,11 +2,21 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/bwplotka/mdox/pkg/clilog"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/progress"
+	"github.com/observatorium/obsctl/pkg/units"
 	"github.com/observatorium/obsctl/pkg/version"
 	"github.com/spf13/cobra"
 )
@@ -18,9 +28,57 @@ const (
 )
 
 var logLevel, logFormat string
-var logger log.Logger
 
-func setupLogger(*cobra.Command, []string) {
+// logger logs to stderr until it is configured with the logging flags by setupLogger, e.g. for
+// errors of the flags themselves.
+var logger = level.NewFilter(clilog.New(log.NewSyncWriter(os.Stderr)), level.AllowInfo())
+
+// quiet suppresses everything but errors and the primary output of commands.
+var quiet bool
+
+// indicator shows the progress of long running operations on stderr.
+var indicator = progress.Disabled()
+
+const (
+	progressAuto = "auto"
+	progressNone = "none"
+	progressJSON = "json"
+)
+
+var progressFormat string
+
+func setupProgress(*cobra.Command, []string) error {
+	switch progressFormat {
+	case progressJSON:
+		indicator = progress.NewJSON(os.Stderr)
+	case progressNone:
+	case progressAuto:
+		// Re-executed commands redraw the whole screen, a progress line would only get in the way.
+		if !watch && !quiet {
+			indicator = progress.New(os.Stderr)
+		}
+	default:
+		return fmt.Errorf("unsupported progress format %q, expected one of: auto|none|json", progressFormat)
+	}
+	return nil
+}
+
+// memoryBudget is the maximum size of responses processed in memory, see fetcher.MemoryBudget.
+var memoryBudget string
+
+func setupMemoryBudget(*cobra.Command, []string) error {
+	b, err := units.ParseBytes(memoryBudget)
+	if err != nil {
+		return fmt.Errorf("parsing --memory.budget: %w", err)
+	}
+	fetcher.MemoryBudget = b
+	return nil
+}
+
+// logFile is the path of a file logs are appended to instead of stderr.
+var logFile string
+
+func setupLogger(*cobra.Command, []string) error {
 	var lvl level.Option
 	switch logLevel {
 	case "error":
@@ -32,38 +90,187 @@ func setupLogger(*cobra.Command, []string) {
 	case "debug":
 		lvl = level.AllowDebug()
 	default:
-		panic("unexpected log level")
+		return fmt.Errorf("unsupported log level %q, expected one of: debug|info|warn|error", logLevel)
+	}
+	if quiet {
+		lvl = level.AllowError()
+	}
+
+	w := io.Writer(os.Stderr)
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("opening log file: %w", err)
+		}
+		// The file is written until obsctl exits.
+		w = f
 	}
+
 	switch logFormat {
 	case logFormatJson:
-		logger = level.NewFilter(log.NewJSONLogger(log.NewSyncWriter(os.Stderr)), lvl)
+		logger = log.With(log.NewJSONLogger(log.NewSyncWriter(w)), "ts", log.DefaultTimestampUTC)
 	case logFormatLogfmt:
-		logger = level.NewFilter(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)), lvl)
+		logger = log.With(log.NewLogfmtLogger(log.NewSyncWriter(w)), "ts", log.DefaultTimestampUTC)
 	case logFormatCLILog:
-		fallthrough
+		logger = clilog.New(log.NewSyncWriter(w))
 	default:
-		logger = level.NewFilter(clilog.New(log.NewSyncWriter(os.Stderr)), lvl)
+		return fmt.Errorf("unsupported log format %q, expected one of: clilog|logfmt|json", logFormat)
+	}
+	logger = level.NewFilter(logger, lvl)
+	return nil
+}
+
+// newFetcher returns a fetcher for the current context, showing progress while a token is acquired.
+func newFetcher(ctx context.Context) (*fetcher.Fetcher, error) {
+	indicator.Start("Authenticating", 0)
+	defer indicator.Stop()
+
+	f, err := fetcher.NewCustomFetcher(ctx, logger)
+	if err != nil {
+		return nil, err
+	}
+	if asTenant != "" {
+		f.Impersonate(asTenant)
+	}
+	return configureFetcher(f), nil
+}
+
+// configureFetcher applies the flags concerning all requests to f.
+func configureFetcher(f *fetcher.Fetcher) *fetcher.Fetcher {
+	f.Params = extraParams
+	return handleWarnings(f)
+}
+
+// apiParams are the key=value pairs of --api.param, parsed into extraParams by setupExtraParams.
+var (
+	apiParams   []string
+	extraParams url.Values
+)
+
+func setupExtraParams(*cobra.Command, []string) error {
+	for _, kv := range apiParams {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("invalid --api.param %q, expected key=value", kv)
+		}
+		if extraParams == nil {
+			extraParams = url.Values{}
+		}
+		extraParams.Add(parts[0], parts[1])
+	}
+	return nil
+}
+
+// asTenant is the tenant requests are made for instead of the tenant of the current context.
+var asTenant string
+
+// currentContext is the context used instead of the current context, see config.CurrentOverride.
+var currentContext string
+
+// setupCurrentContext overrides the current context with --context.
+func setupCurrentContext(*cobra.Command, []string) error {
+	if currentContext == "" {
+		return nil
 	}
+	c, err := parseContext(currentContext)
+	if err != nil {
+		return fmt.Errorf("invalid --context: %w", err)
+	}
+	config.CurrentOverride = c
+	return nil
 }
 
 func NewObsctlCmd(ctx context.Context) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:              "obsctl",
-		Short:            "CLI to interact with Observatorium",
-		Long:             `CLI to interact with Observatorium`,
-		Version:          version.Version,
-		PersistentPreRun: setupLogger,
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "run called")
+		Use:     "obsctl",
+		Short:   "CLI to interact with Observatorium",
+		Long:    `CLI to interact with Observatorium`,
+		Version: version.Version,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupLogger(cmd, args); err != nil {
+				return err
+			}
+			if err := setupProgress(cmd, args); err != nil {
+				return err
+			}
+			if err := startProfiling(cmd, args); err != nil {
+				return err
+			}
+			if err := setupMemoryBudget(cmd, args); err != nil {
+				return err
+			}
+			if err := setupCurrentContext(cmd, args); err != nil {
+				return err
+			}
+			if err := setupTimeDefaults(cmd, args); err != nil {
+				return err
+			}
+			if err := setupExtraParams(cmd, args); err != nil {
+				return err
+			}
+			if err := setupOutput(cmd, args); err != nil {
+				return err
+			}
+			return setupTimezone(cmd, args)
 		},
+		SilenceUsage: true,
 	}
 
 	cmd.AddCommand(NewMetricsCmd(ctx))
+	cmd.AddCommand(NewLogsCmd(ctx))
+	cmd.AddCommand(NewTracesCmd(ctx))
 	cmd.AddCommand(NewContextCommand(ctx))
 	cmd.AddCommand(NewLoginCmd(ctx))
+	cmd.AddCommand(NewLogoutCmd(ctx))
+	cmd.AddCommand(NewDashboardCmd(ctx))
+	cmd.AddCommand(NewTUICmd(ctx))
+	cmd.AddCommand(NewHistoryCmd(ctx))
+	cmd.AddCommand(NewQueryCmd(ctx))
+	cmd.AddCommand(NewPromQLCmd(ctx))
+	cmd.AddCommand(NewLogQLCmd(ctx))
+	cmd.AddCommand(NewConfigCmd(ctx))
+	cmd.AddCommand(NewGetCmd(ctx))
+	cmd.AddCommand(NewVersionCmd(ctx))
+	cmd.AddCommand(NewSelfUpdateCmd(ctx))
+	cmd.AddCommand(NewStatusCmd(ctx))
+	cmd.AddCommand(NewCompareCmd(ctx))
+	cmd.AddCommand(NewSLOCmd(ctx))
+	cmd.AddCommand(NewTenantCmd(ctx))
+	cmd.AddCommand(NewProxyCmd(ctx))
+	cmd.AddCommand(NewServeCmd(ctx))
+
+	cmd.PersistentFlags().StringArrayVar(&config.Files, "config", nil, "Path of a config file. Can be repeated to merge several files, e.g. API definitions shared by a team and a personal file with credentials, the first file taking precedence and receiving all changes. Defaults to the files in $"+config.EnvFiles+", separated like PATH, or the config file in the user config directory. Values can contain ${VAR} and ${VAR:-default} placeholders replaced by environment variables.")
+	cmd.PersistentFlags().StringVar(&logLevel, "log.level", "info", "Log filtering level. One of: debug|info|warn|error.")
+	cmd.PersistentFlags().StringVar(&logFormat, "log.format", logFormatCLILog, "Log format to use. One of: clilog|logfmt|json. The logfmt and json formats add a timestamp to every line, to ingest the logs of long running commands.")
+	cmd.PersistentFlags().StringVar(&logFile, "log.file", "", "Path of a file logs are appended to, instead of stderr.")
+	cmd.PersistentFlags().StringVar(&auditFile, "audit.file", os.Getenv("OBSCTL_AUDIT_FILE"), "Path of a file to which every invocation (command, context, status and duration, never secrets) is appended. Defaults to $OBSCTL_AUDIT_FILE, auditing is disabled if empty.")
+	cmd.PersistentFlags().StringVar(&outFile, "out", "", "Path of a file to write the primary output of commands to, instead of stdout. The file is replaced only once the command succeeded, the output of failed commands is kept in <file>.partial. Compressed with gzip if the path ends in .gz.")
+	cmd.PersistentFlags().BoolVar(&outGzip, "out.gzip", false, "Compress the file of --out with gzip, whatever its name.")
+	cmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only print errors and the primary output of commands, e.g. for use in shell pipelines. Overrides --log.level.")
+	cmd.PersistentFlags().StringVar(&progressFormat, "progress", progressAuto, "How to report progress of long running operations on stderr. One of: auto|none|json. With auto, progress is shown on terminals only, json emits one event object per line.")
+	cmd.PersistentFlags().StringVar(&timezone, "timezone", "", "Time zone to display timestamps in, e.g. UTC, local or Europe/Berlin. Defaults to the time zone of the current context, see 'obsctl context timezone'.")
+	cmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false, "Apply changes of mutating commands without asking for confirmation.")
+	cmd.PersistentFlags().StringVar(&currentContext, "context", os.Getenv("OBSCTL_CONTEXT_OVERRIDE"), "Context to use as <api>/<tenant> instead of the current context, for this invocation only. The config file is not changed, so that scripts can address several contexts concurrently. Defaults to $OBSCTL_CONTEXT_OVERRIDE. $OBSCTL_CONTEXT, as exported by 'obsctl context env', is not read.")
+	cmd.PersistentFlags().StringVar(&asTenant, "as-tenant", "", "Make requests for this tenant instead of the tenant of the current context, using the credentials of the current context. Lets operators with gateway-level access debug the view of a tenant without adding a context for it.")
+	cmd.PersistentFlags().StringArrayVar(&apiParams, "api.param", nil, "Query parameter as key=value added to every request, e.g. to try backend features obsctl has no flags for yet. Can be repeated.")
+	cmd.PersistentFlags().IntVar(&concurrency, "concurrency", 10, "Number of tenants operated on at the same time by --all-tenants operations.")
+	cmd.PersistentFlags().Var(duration.NewValue(&tenantTimeout, 30*time.Second), "tenant.timeout", "Timeout of the operation against a single tenant in --all-tenants operations. 0 disables the timeout.")
+	cmd.PersistentFlags().Var(duration.NewValue(&config.TokenRefreshWindow, config.TokenRefreshWindow), "auth.refresh-window", "Time before their expiry at which tokens are refreshed, so that long running operations don't fail when a token expires between requests.")
+	cmd.PersistentFlags().Var(duration.NewValue(&cacheTTL, defaultCacheTTL()), "cache.ttl", "Time for which query responses are cached on disk, keyed by context, query and time range, e.g. to format the same result repeatedly. Defaults to $OBSCTL_CACHE_TTL, caching is disabled if zero.")
+	cmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Do not answer queries from the cache, see --cache.ttl.")
+	cmd.PersistentFlags().IntVar(&breakAfter, "breaker.failures", 3, "Number of consecutive failures against an API after which --all-tenants operations skip its remaining tenants. 0 disables skipping.")
+	cmd.PersistentFlags().StringVar(&memoryBudget, "memory.budget", "1GiB", "Maximum size of responses processed in memory, e.g. 512MiB. Commands abort with guidance instead of exhausting memory on larger responses. Streamed output is not limited. 0 disables the limit.")
+	cmd.PersistentFlags().BoolVar(&failOnPartial, "fail-on-partial", false, "Fail if a query response is partial, e.g. because some Thanos stores are down, instead of only warning about it.")
+	cmd.PersistentFlags().BoolVar(&failOnWarnings, "fail-on-warnings", false, "Fail if a query response has any warnings, instead of printing them to stderr. Useful in CI.")
+	cmd.PersistentFlags().BoolVar(&validateQueries, "promql.validate", true, "Check the syntax of PromQL queries before sending them, for errors pointing at the mistake. Disable for queries using functions unknown to obsctl.")
+	cmd.PersistentFlags().BoolVarP(&watch, "watch", "w", false, "Re-execute read commands every --interval, highlighting changes in their output.")
+	cmd.PersistentFlags().Var(duration.NewValue(&watchInterval, 2*time.Second), "interval", "Interval at which read commands are re-executed with --watch.")
 
-	cmd.PersistentFlags().StringVar(&logLevel, "log.level", "info", "Log filtering level.")
-	cmd.PersistentFlags().StringVar(&logFormat, "log.format", logFormatCLILog, "Log format to use.")
+	// Profiling is meant for diagnosing performance issues, not for everyday use.
+	cmd.PersistentFlags().StringVar(&cpuProfile, "profile.cpu", "", "Path of a file to write a pprof CPU profile of the run to.")
+	cmd.PersistentFlags().StringVar(&memProfile, "profile.mem", "", "Path of a file to write a pprof memory profile to at the end of the run.")
+	_ = cmd.PersistentFlags().MarkHidden("profile.cpu")
+	_ = cmd.PersistentFlags().MarkHidden("profile.mem")
 
 	return cmd
 }
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/baseline"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/spf13/cobra"
+)
+
+func NewCompareCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compare",
+		Short: "Compare query results of a tenant over time.",
+		Long:  "Compare query results of a tenant over time.",
+	}
+
+	cmd.AddCommand(NewCompareBaselineCmd(ctx))
+
+	return cmd
+}
+
+func NewCompareBaselineCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "baseline",
+		Short: "Save snapshots of query results and check fresh results against them.",
+		Long: `Save snapshots of query results and check fresh results against them, e.g. to flag regressions in
+performance testing pipelines. A baseline is a JSON file holding the value of every series of
+every query, which can be committed next to the tests.`,
+	}
+
+	var file, at string
+
+	var queries []string
+	saveCmd := &cobra.Command{
+		Use:   "save",
+		Short: "Save the results of queries as baseline.",
+		Long: `Save the results of instant queries against the current context as baseline, replacing an existing
+baseline file. Aggregate over the time range of interest in the queries themselves, e.g. with
+avg_over_time or quantile_over_time.`,
+		Example: `obsctl compare baseline save --file=baseline.json \
+  --query='histogram_quantile(0.99, sum by (le) (rate(http_request_duration_seconds_bucket[30m])))' \
+  --query='sum(rate(http_requests_total[30m]))'`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(queries) == 0 {
+				return fmt.Errorf("at least one --query is required")
+			}
+			for _, q := range queries {
+				if err := validateQuery(q); err != nil {
+					return err
+				}
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			bl := baseline.Baseline{Context: f.Context().String(), Time: time.Now()}
+			for _, q := range queries {
+				samples, err := instantSamples(ctx, f, q, at)
+				if err != nil {
+					return err
+				}
+				bl.Queries = append(bl.Queries, baseline.Query{Query: q, Series: samples})
+			}
+
+			if err := bl.Save(file); err != nil {
+				return err
+			}
+			level.Info(logger).Log("msg", "saved baseline", "file", file, "queries", len(bl.Queries))
+			return nil
+		},
+	}
+	saveCmd.Flags().StringArrayVar(&queries, "query", nil, "PromQL query whose result is saved. Can be repeated.")
+
+	var tolerance, output string
+	var tol baseline.Tolerance
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check the results of queries against a baseline.",
+		Long: `Run the queries of a baseline against the current context and compare their results with the
+baseline, series by series, exiting nonzero on regressions.
+
+A value is a regression if it changed by more than --tolerance relative to the baseline value and
+by more than --tolerance.abs, in the --regression direction. Series of the baseline missing from
+the current results fail the check too, series not in the baseline are only reported.`,
+		Example: `obsctl compare baseline check --file=baseline.json --tolerance=10% --regression=increase`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if tol.Relative, err = parseTolerance(tolerance); err != nil {
+				return err
+			}
+			switch tol.Direction {
+			case baseline.Any, baseline.Increase, baseline.Decrease:
+			default:
+				return fmt.Errorf("invalid --regression %q, expected any, increase or decrease", tol.Direction)
+			}
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("unsupported output format %q", output)
+			}
+
+			bl, err := baseline.Load(file)
+			if err != nil {
+				return err
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+			if c := f.Context().String(); c != bl.Context {
+				level.Warn(logger).Log("msg", "checking baseline of another context", "baseline", bl.Context, "context", c)
+			}
+
+			var results []baseline.Result
+			for _, q := range bl.Queries {
+				samples, err := instantSamples(ctx, f, q.Query, at)
+				if err != nil {
+					return err
+				}
+				results = append(results, baseline.Compare(q, samples, tol)...)
+			}
+
+			if output == outputJSON {
+				if err := json.NewEncoder(cmd.OutOrStdout()).Encode(results); err != nil {
+					return err
+				}
+			} else if err := printComparison(cmd.OutOrStdout(), results); err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, r := range results {
+				if r.Status == baseline.Regression || r.Status == baseline.Missing {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d series regressed or are missing", failed, len(results))
+			}
+			return nil
+		},
+	}
+	checkCmd.Flags().StringVar(&tolerance, "tolerance", "0", "Change relative to the baseline value tolerated, as fraction like 0.1 or percentage like 10%.")
+	checkCmd.Flags().Float64Var(&tol.Absolute, "tolerance.abs", 0, "Absolute change tolerated, e.g. to ignore noise around values close to zero.")
+	checkCmd.Flags().StringVar(&tol.Direction, "regression", baseline.Any, "Direction of changes considered regressions. One of: any|increase|decrease. E.g. increase for latencies, decrease for throughput.")
+	checkCmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format. One of: table|json.")
+
+	for _, c := range []*cobra.Command{saveCmd, checkCmd} {
+		c.Flags().StringVar(&file, "file", "", "Path of the baseline file.")
+		c.Flags().StringVar(&at, "time", "", "Evaluation time of the queries, as RFC3339 or Unix timestamp, or relative to now like -1h. Defaults to now.")
+		_ = c.MarkFlagRequired("file")
+		cmd.AddCommand(c)
+	}
+
+	return cmd
+}
+
+// instantSamples evaluates an instant query, bypassing the cache, and returns the value of each series.
+func instantSamples(ctx context.Context, f *fetcher.Fetcher, query, at string) ([]baseline.Sample, error) {
+	params, err := instantQueryParams(query, at)
+	if err != nil {
+		return nil, err
+	}
+
+	recordHistory(ctx, f, fetcher.Metrics, query)
+
+	indicator.Start("Running query", 0)
+	data, err := f.Query(ctx, fetcher.Metrics, "/query", params)
+	indicator.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("querying metrics: %w", err)
+	}
+
+	if data.ResultType == "scalar" {
+		var s fetcher.SamplePair
+		if err := s.UnmarshalJSON(data.Result); err != nil {
+			return nil, fmt.Errorf("decoding scalar result: %w", err)
+		}
+		return []baseline.Sample{{Series: "scalar", Value: s.Value}}, nil
+	}
+
+	series, err := data.Series()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]baseline.Sample, 0, len(series))
+	for _, s := range series {
+		if s.Value == nil {
+			// Native histograms have no single value to compare.
+			continue
+		}
+		samples = append(samples, baseline.Sample{Series: fetcher.FormatMetric(s.Metric), Value: s.Value.Value})
+	}
+	return samples, nil
+}
+
+// parseTolerance parses a relative tolerance given as fraction like 0.1 or as percentage like 10%.
+func parseTolerance(s string) (float64, error) {
+	num, scale := s, 1.0
+	if strings.HasSuffix(s, "%") {
+		num, scale = strings.TrimSuffix(s, "%"), 100
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid --tolerance %q, expected a fraction like 0.1 or a percentage like 10%%", s)
+	}
+	return f / scale, nil
+}
+
+// printComparison prints the results of a baseline check, one table per query.
+func printComparison(w io.Writer, results []baseline.Result) error {
+	for i := 0; i < len(results); {
+		query := results[i].Query
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "# %s\n", query)
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "SERIES\tBASELINE\tCURRENT\tCHANGE\tSTATUS")
+		for ; i < len(results) && results[i].Query == query; i++ {
+			r := results[i]
+			change := "-"
+			if !math.IsNaN(r.Change) && !math.IsInf(r.Change, 0) {
+				change = fmt.Sprintf("%+.1f%%", r.Change*100)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Series, orDash(r.Baseline), orDash(r.Current), change, r.Status)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/observatorium/obsctl/pkg/cache"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/spf13/cobra"
+)
+
+// completionCacheTTL is the time label names and values fetched for shell completion are cached for,
+// so that completing a selector piece by piece doesn't request the same values on every keystroke.
+const completionCacheTTL = time.Minute
+
+// completionTimeout bounds the API requests of shell completion, so that the shell never hangs.
+const completionTimeout = 5 * time.Second
+
+// completionValues returns the label names (name is empty) or the values of a label of the signal
+// for shell completion, from the completion cache if possible. Errors yield no values, as there is
+// no way to report them during completion.
+func completionValues(ctx context.Context, signal fetcher.Signal, name string) []string {
+	// Pre-runs are not executed for completion, nothing may be logged to the terminal.
+	nop := log.NewNopLogger()
+
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+
+	f, err := fetcher.NewCustomFetcher(ctx, nop)
+	if err != nil {
+		return nil
+	}
+	if asTenant != "" {
+		f.Impersonate(asTenant)
+	}
+
+	c, err := cache.New(nop, completionCacheTTL)
+	if err != nil {
+		return nil
+	}
+	key := cache.Key("completion", f.Context().String(), f.Tenant(), string(signal), name)
+	var values []string
+	if b, ok := c.Get(key); ok && json.Unmarshal(b, &values) == nil {
+		return values
+	}
+
+	if name == "" {
+		values, err = f.LabelNames(ctx, signal, nil)
+	} else {
+		values, err = f.LabelValues(ctx, signal, name, nil)
+	}
+	if err != nil {
+		return nil
+	}
+	if b, err := json.Marshal(values); err == nil {
+		_ = c.Put(key, b)
+	}
+	return values
+}
+
+// withPrefix returns the values starting with toComplete, sorted.
+func withPrefix(values []string, toComplete string) []string {
+	var res []string
+	for _, v := range values {
+		if strings.HasPrefix(v, toComplete) {
+			res = append(res, v)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// completeLabelNames completes the label names of the signal returned by signal for the first argument.
+func completeLabelNames(ctx context.Context, signal func() (fetcher.Signal, error)) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		s, err := signal()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return withPrefix(completionValues(ctx, s, ""), toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeSelector completes series selectors piece by piece: metric names first (for metrics),
+// then label names after { or a comma, and quoted label values after a matcher operator.
+func completeSelector(ctx context.Context, signal func() (fetcher.Signal, error)) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		s, err := signal()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return selectorCompletions(toComplete, func(name string) []string { return completionValues(ctx, s, name) }, s == fetcher.Metrics), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+	}
+}
+
+// selectorCompletions returns the completions of a partial selector, using values to get the label
+// names (for an empty name) or the values of a label.
+func selectorCompletions(toComplete string, values func(name string) []string, metricNames bool) []string {
+	brace := strings.LastIndex(toComplete, "{")
+	if brace < 0 {
+		if !metricNames {
+			return []string{"{"}
+		}
+		var res []string
+		for _, n := range withPrefix(values("__name__"), toComplete) {
+			res = append(res, n, n+"{")
+		}
+		return res
+	}
+
+	// The matcher being typed starts after the brace or the last comma.
+	start := brace + 1
+	if comma := strings.LastIndex(toComplete, ","); comma > brace {
+		start = comma + 1
+	}
+	matcher := strings.TrimLeft(toComplete[start:], " ")
+	prefix := toComplete[:len(toComplete)-len(matcher)]
+
+	op := strings.IndexAny(matcher, "=!")
+	if op < 0 {
+		var res []string
+		for _, n := range withPrefix(values(""), matcher) {
+			if n != "__name__" || !metricNames {
+				res = append(res, prefix+n+"=")
+			}
+		}
+		return res
+	}
+
+	name := matcher[:op]
+	rest := matcher[op:]
+	opLen := 1
+	if len(rest) > 1 && (rest[1] == '=' || rest[1] == '~') {
+		opLen = 2
+	}
+	partial := strings.TrimPrefix(rest[opLen:], `"`)
+
+	var res []string
+	for _, v := range withPrefix(values(name), partial) {
+		res = append(res, prefix+name+rest[:opLen]+strconv.Quote(v))
+	}
+	return res
+}
+
+// registerSelectorCompletion registers completion of series selectors for the --match flag of cmd.
+func registerSelectorCompletion(ctx context.Context, cmd *cobra.Command, signal func() (fetcher.Signal, error)) {
+	_ = cmd.RegisterFlagCompletionFunc("match", completeSelector(ctx, signal))
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+func NewConfigCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect and change settings of the obsctl configuration file.",
+		Long:  "Inspect and change settings of the obsctl configuration file.",
+	}
+
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration file for problems.",
+		Long: `Check the configuration file for problems and report all of them at once.
+
+Checks for unknown fields, placeholders of unset environment variables, a current context
+referencing a missing API or tenant, malformed URLs, incomplete OIDC settings and tokens that
+cannot be refreshed, as well as invalid per-context defaults and saved queries. No API or OIDC
+provider is contacted. Exits non-zero if problems are found.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			problems, err := config.Validate()
+			if err != nil {
+				return err
+			}
+
+			if len(problems) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No problems found.")
+				return nil
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "PATH\tPROBLEM")
+			for _, p := range problems {
+				fmt.Fprintf(tw, "%s\t%s\n", p.Path, p.Msg)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			return fmt.Errorf("found %d problems in the config file", len(problems))
+		},
+	}
+
+	setCredentialStoreCmd := &cobra.Command{
+		Use:   "set-credential-store <file|keyring>",
+		Short: "Set where client secrets and tokens are saved.",
+		Long: `Set where the client secrets and tokens of OIDC contexts are saved.
+
+With file, the default, they are saved in plaintext in the config file. With keyring, they are
+saved in the keyring of the OS, i.e. the macOS Keychain, the Windows Credential Manager or the
+Secret Service of libsecret on Linux, and the config file only keeps references to them. Existing
+credentials are moved to the new store right away. Client secrets given with environment variable
+placeholders stay in the config file. The credentials of config files other than the default
+one, see --config, are kept apart from those of the default one.`,
+		Example:   `obsctl config set-credential-store keyring`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: config.CredentialStores,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.Update(ctx, logger, func(cfg *config.Config) error {
+				return cfg.SetCredentialStore(args[0])
+			})
+			if err != nil {
+				return err
+			}
+
+			level.Info(logger).Log("msg", "set credential store", "store", args[0])
+			return nil
+		},
+	}
+
+	cmd.AddCommand(validateCmd)
+	cmd.AddCommand(setCredentialStoreCmd)
+
+	return cmd
+}
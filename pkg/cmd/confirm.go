@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// assumeYes skips confirmation prompts of mutating commands.
+var assumeYes bool
+
+var errNotConfirmed = errors.New("changes were not confirmed")
+
+// confirm shows a summary of what a mutating command is about to change and asks the user to
+// confirm it. With --yes it returns immediately. Without a terminal to ask on, it refuses, so
+// that automation has to opt in to mutations explicitly.
+func confirm(cmd *cobra.Command, summary string) error {
+	if assumeYes {
+		return nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("refusing to apply changes without confirmation, pass --yes to confirm non-interactively")
+	}
+
+	fmt.Fprintln(cmd.ErrOrStderr(), summary)
+	if !ask(cmd.ErrOrStderr(), "Apply these changes?") {
+		return errNotConfirmed
+	}
+	return nil
+}
+
+// ask asks the user a yes or no question on w and reports whether it was answered with yes.
+func ask(w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s [y/N]: ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// confirmTenant asks the user to confirm an irreversible change of a tenant, like deleting its data,
+// by typing the name of the tenant. Unlike confirm, --yes doesn't confirm it, as it is often passed
+// out of habit; automation has to name the tenant with the given flag, e.g. --confirm-delete=<tenant>.
+func confirmTenant(cmd *cobra.Command, summary, tenant, flag, confirmed string) error {
+	if confirmed != "" {
+		if confirmed != tenant {
+			return fmt.Errorf("--%s=%s doesn't match tenant %s", flag, confirmed, tenant)
+		}
+		return nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("refusing to apply changes without confirmation, pass --%s=%s to confirm non-interactively", flag, tenant)
+	}
+
+	fmt.Fprintln(cmd.ErrOrStderr(), summary)
+	fmt.Fprintf(cmd.ErrOrStderr(), "Type the name of the tenant (%s) to confirm: ", tenant)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil || strings.TrimSpace(answer) != tenant {
+		return errNotConfirmed
+	}
+	return nil
+}
@@ -2,9 +2,22 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/tui"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 )
 
 func NewContextCommand(ctx context.Context) *cobra.Command {
@@ -12,39 +25,364 @@ func NewContextCommand(ctx context.Context) *cobra.Command {
 		Use:   "context",
 		Short: "View/Add/Edit context configuration.",
 		Long:  "View/Add/Edit context configuration.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "context called")
-		},
 	}
 
+	var apiName, apiURL, grafanaURL, flavor, apiCA string
+	var apiPaths []string
 	apiCmd := &cobra.Command{
 		Use:   "api",
 		Short: "Add/edit API configuration.",
-		Long:  "Add/edit API configuration.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "api called")
+		Long: `Add/edit API configuration. A new API is added if no API with the given name exists, otherwise the given fields are updated.
+
+By default, the API of a signal is expected at ` + config.DefaultPath + `. For gateways mounted under other
+prefixes or behind path-rewriting proxies, set the path of a signal with --path, where {signal} and {tenant}
+are replaced by the names of the signal and tenant. An empty path resets the signal to the default.
+
+For Cortex and Mimir, set --flavor=cortex: the tenant is then sent in the X-Scope-OrgID header, and
+rules are managed with the ruler API in namespaces of rule groups, see 'obsctl metrics set'.
+
+For APIs behind an internal CA, set the PEM bundle of CAs their certificate is verified against with
+--ca. An empty --ca resets it to the system certificates.`,
+		Example: `obsctl context api --name prod --url https://observatorium.example.com --grafana-url https://grafana.example.com
+obsctl context api --name prod --path metrics=/gateway/api/metrics/v1/{tenant} --path logs=/gateway/api/logs/v1/{tenant}
+obsctl context api --name mimir --flavor cortex --path metrics=/prometheus
+obsctl context api --name prod --ca /etc/pki/internal-ca.pem`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paths := map[string]string{}
+			for _, sp := range apiPaths {
+				parts := strings.SplitN(sp, "=", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("invalid --path %q, expected <signal>=<path>", sp)
+				}
+				if _, err := fetcher.ParseSignal(parts[0]); err != nil && parts[0] != string(fetcher.Traces) {
+					return fmt.Errorf("invalid --path %q: %w", sp, err)
+				}
+				paths[parts[0]] = parts[1]
+			}
+			if cmd.Flags().Changed("ca") && apiCA != "" {
+				// The config is used from other directories later on.
+				var err error
+				if apiCA, err = filepath.Abs(apiCA); err != nil {
+					return fmt.Errorf("resolving --ca: %w", err)
+				}
+			}
+
+			err := config.Update(ctx, logger, func(cfg *config.Config) error {
+				if _, ok := cfg.APIs[apiName]; !ok {
+					if apiURL == "" {
+						return fmt.Errorf("api with name %s doesn't exist, --url is required to add it", apiName)
+					}
+					if err := cfg.AddAPI(logger, apiName, apiURL); err != nil {
+						return err
+					}
+				}
+
+				if err := cfg.UpdateAPI(logger, apiName, apiURL, grafanaURL, flavor, paths); err != nil {
+					return err
+				}
+				if cmd.Flags().Changed("ca") {
+					return cfg.SetAPICA(logger, apiName, apiCA)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			level.Info(logger).Log("msg", "saved api configuration", "api", apiName)
+			return nil
 		},
 	}
+	apiCmd.Flags().StringVar(&apiName, "name", "", "The name of the Observatorium API.")
+	apiCmd.Flags().StringVar(&apiURL, "url", "", "The URL of the Observatorium API.")
+	apiCmd.Flags().StringVar(&grafanaURL, "grafana-url", "", "The URL of a Grafana instance using the API as datasource, used to generate Explore links.")
+	apiCmd.Flags().StringVar(&flavor, "flavor", "", "The kind of backend serving the API. One of: "+strings.Join(config.Flavors, "|")+". Defaults to "+config.FlavorObservatorium+".")
+	apiCmd.Flags().StringArrayVar(&apiPaths, "path", nil, "Path of the API of a signal as <signal>=<path>, e.g. metrics=/prefix/api/metrics/v1/{tenant}. Can be repeated.")
+	apiCmd.Flags().StringVar(&apiCA, "ca", "", "Path to the TLS CA bundle against which to verify the API, instead of the system certificates.")
+	_ = apiCmd.MarkFlagRequired("name")
+
 	switchCmd := &cobra.Command{
-		Use:   "switch",
+		Use:   "switch [<api>/<tenant>]",
 		Short: "Switch to another context.",
-		Long:  "View/Add/Edit context configuration.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "switch called")
+		Long:  "Switch to another context. Without arguments, an interactive fuzzy finder over all configured contexts is shown.",
+		Example: `obsctl context switch prod/team-a
+obsctl context switch`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			var name string
+			if len(args) == 1 {
+				name = args[0]
+			} else {
+				if !term.IsTerminal(int(os.Stdin.Fd())) {
+					return errors.New("no context given and stdin is not a terminal, pass the context as <api>/<tenant>")
+				}
+				if name, err = pickContext(cfg); err != nil {
+					return err
+				}
+			}
+
+			c, err := parseContext(name)
+			if err != nil {
+				return err
+			}
+
+			err = config.Update(ctx, logger, func(cfg *config.Config) error {
+				return cfg.SetCurrent(logger, c.API, c.Tenant)
+			})
+			if err != nil {
+				return err
+			}
+
+			level.Info(logger).Log("msg", "switched context", "context", c)
+			if config.CurrentOverride != (config.Context{}) && config.CurrentOverride != c {
+				level.Warn(logger).Log("msg", "current context is overridden by --context or $OBSCTL_CONTEXT_OVERRIDE, the switched context applies once it is unset", "override", config.CurrentOverride)
+			}
+			return nil
 		},
 	}
 	currentCmd := &cobra.Command{
 		Use:   "current",
 		Short: "View current context configuration.",
-		Long:  "View current context configuration.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "current called")
+		Long:  "View current context configuration: the context, the URL of its API, its tenant and whether a valid token is stored. Secrets are never printed.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			api, tenant, err := cfg.GetCurrent()
+			if err != nil {
+				return err
+			}
+
+			auth := tokenStatus(tenant)
+			if tenant.TokenFile != "" {
+				auth = "token file " + tenant.TokenFile
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintf(tw, "context:\t%s\n", cfg.Current)
+			fmt.Fprintf(tw, "api:\t%s\n", api.URL)
+			fmt.Fprintf(tw, "tenant:\t%s\n", tenant.Tenant)
+			if tenant.OIDC != nil {
+				fmt.Fprintf(tw, "issuer:\t%s\n", tenant.OIDC.IssuerURL)
+			}
+			fmt.Fprintf(tw, "auth:\t%s\n", auth)
+			return tw.Flush()
+		},
+	}
+
+	var output string
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all contexts.",
+		Long: `List all configured contexts with the name and URL of their API, their tenant, how they
+authenticate and when their token expires, marking the current context with *. Switch between them
+with 'obsctl context switch'.
+
+The auth type is the OIDC grant type of the context, see 'obsctl login --oidc.grant-type',
+token-file for contexts reading their token from a file, or none. Contexts presenting a client
+certificate have +mtls appended, or are mtls if they don't authenticate otherwise.`,
+		Example: `obsctl context list
+obsctl context list -o json | jq -r '.[] | select(.auth == "none") | .context'
+obsctl context list -o name`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch output {
+			case outputTable, outputJSON, outputYAML, outputName:
+			default:
+				return fmt.Errorf("unsupported output format %q", output)
+			}
+
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			infos := make([]contextInfo, 0, len(cfg.Contexts()))
+			for _, c := range cfg.Contexts() {
+				api, t, err := cfg.GetContext(c)
+				if err != nil {
+					return err
+				}
+				info := contextInfo{
+					Context: c.String(),
+					Current: c == cfg.Current,
+					API:     c.API,
+					URL:     api.URL,
+					Tenant:  t.Tenant,
+					Auth:    authType(t),
+				}
+				if t.OIDC != nil && t.OIDC.Token != nil && !t.OIDC.Token.Expiry.IsZero() {
+					expiry := t.OIDC.Token.Expiry
+					info.TokenExpiry = &expiry
+				}
+				infos = append(infos, info)
+			}
+
+			w := cmd.OutOrStdout()
+			switch output {
+			case outputJSON:
+				enc := json.NewEncoder(w)
+				enc.SetIndent("", "  ")
+				return enc.Encode(infos)
+			case outputYAML:
+				enc := yaml.NewEncoder(w)
+				enc.SetIndent(2)
+				if err := enc.Encode(infos); err != nil {
+					return err
+				}
+				return enc.Close()
+			case outputName:
+				for _, i := range infos {
+					fmt.Fprintln(w, i.Context)
+				}
+				return nil
+			}
+
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "CURRENT\tAPI\tURL\tTENANT\tAUTH\tTOKEN EXPIRY")
+			for _, i := range infos {
+				var current string
+				if i.Current {
+					current = "*"
+				}
+				expiry := "-"
+				if i.TokenExpiry != nil {
+					expiry = formatTime(*i.TokenExpiry)
+					if i.TokenExpiry.Before(time.Now()) {
+						expiry += " (expired)"
+					}
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", current, i.API, i.URL, i.Tenant, i.Auth, expiry)
+			}
+			return tw.Flush()
 		},
 	}
+	listCmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format. One of: table|json|yaml|name. The name format prints only the contexts, one per line.")
+
+	switchCmd.ValidArgsFunction = completeContexts
 
 	cmd.AddCommand(apiCmd)
 	cmd.AddCommand(switchCmd)
 	cmd.AddCommand(currentCmd)
+	cmd.AddCommand(listCmd)
+	cmd.AddCommand(newContextTimezoneCmd(ctx))
+	cmd.AddCommand(newContextDefaultsCmd(ctx))
+	cmd.AddCommand(newContextEnvCmd(ctx))
+	cmd.AddCommand(newContextRulesPolicyCmd(ctx))
 
 	return cmd
 }
+
+// contextInfo describes a context in the output of context list. Secrets are never part of it.
+type contextInfo struct {
+	Context     string     `json:"context" yaml:"context"`
+	Current     bool       `json:"current" yaml:"current"`
+	API         string     `json:"api" yaml:"api"`
+	URL         string     `json:"url" yaml:"url"`
+	Tenant      string     `json:"tenant" yaml:"tenant"`
+	Auth        string     `json:"auth" yaml:"auth"`
+	TokenExpiry *time.Time `json:"tokenExpiry,omitempty" yaml:"tokenExpiry,omitempty"`
+}
+
+// authType describes how a tenant authenticates, see context list.
+func authType(t config.TenantConfig) string {
+	var auth string
+	switch {
+	case t.TokenFile != "":
+		auth = "token-file"
+	case t.OIDC == nil:
+		auth = "none"
+	case t.OIDC.GrantType == "":
+		auth = config.GrantClientCredentials
+	default:
+		auth = t.OIDC.GrantType
+	}
+	if t.TLSCert != "" {
+		if auth == "none" {
+			return "mtls"
+		}
+		auth += "+mtls"
+	}
+	return auth
+}
+
+// completeContexts completes the configured contexts for the first argument.
+func completeContexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, err := config.Read(logger)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, c := range cfg.Contexts() {
+		names = append(names, c.String())
+	}
+	return withPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// parseContext parses a context in the api/tenant notation.
+func parseContext(s string) (config.Context, error) {
+	i := strings.LastIndex(s, "/")
+	if i <= 0 || i == len(s)-1 {
+		return config.Context{}, fmt.Errorf("invalid context %q, expected <api>/<tenant>", s)
+	}
+	return config.Context{API: s[:i], Tenant: s[i+1:]}, nil
+}
+
+// tokenStatus describes whether a tenant has a valid token stored.
+func tokenStatus(t config.TenantConfig) string {
+	switch {
+	case t.OIDC == nil:
+		return "no auth"
+	case t.OIDC.Token == nil:
+		return "no token"
+	case !t.OIDC.Token.Valid():
+		return "token expired"
+	case t.OIDC.Token.Expiry.IsZero():
+		return "token valid"
+	default:
+		return "token valid until " + formatTime(t.OIDC.Token.Expiry)
+	}
+}
+
+// pickContext lets the user choose one of the configured contexts in a fuzzy finder.
+func pickContext(cfg *config.Config) (string, error) {
+	contexts := cfg.Contexts()
+	if len(contexts) == 0 {
+		return "", errors.New("no contexts configured, use 'obsctl login' to add one")
+	}
+
+	items := make([]tui.PickerItem, 0, len(contexts))
+	for _, c := range contexts {
+		_, t, err := cfg.GetContext(c)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, tui.PickerItem{Text: c.String(), Detail: tokenStatus(t)})
+	}
+
+	return tui.Pick("Switch context", items, cfg.Current.String())
+}
+
+// updateCurrentTenant applies fn to the latest config of the tenant of the current context and
+// saves it, see config.Update.
+func updateCurrentTenant(ctx context.Context, fn func(t *config.TenantConfig)) error {
+	return config.Update(ctx, logger, func(cfg *config.Config) error {
+		_, t, err := cfg.GetCurrent()
+		if err != nil {
+			return fmt.Errorf("getting current context: %w", err)
+		}
+		fn(&t)
+		return cfg.UpdateTenant(cfg.Current.API, t)
+	})
+}
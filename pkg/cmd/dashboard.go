@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/dashboard"
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/spf13/cobra"
+)
+
+func NewDashboardValidateCmd(ctx context.Context) *cobra.Command {
+	var file string
+	var vars []string
+	var lookback time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the queries of a Grafana dashboard against a tenant.",
+		Long: `Validate the queries of a Grafana dashboard against a tenant.
+
+Extracts all PromQL and LogQL queries from the panels of a Grafana dashboard JSON model,
+executes each of them against the current tenant and reports which queries fail or return
+no data. Template variables are resolved from their current values in the dashboard,
+which can be overridden with --var.`,
+		Example: `obsctl dashboard validate -f dashboard.json --var namespace=monitoring`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("reading dashboard file: %w", err)
+			}
+
+			d, err := dashboard.Parse(b)
+			if err != nil {
+				return err
+			}
+
+			for _, v := range vars {
+				kv := strings.SplitN(v, "=", 2)
+				if len(kv) != 2 {
+					return fmt.Errorf("invalid variable %q, expected name=value", v)
+				}
+				d.Variables[kv[0]] = kv[1]
+			}
+
+			if len(d.Queries) == 0 {
+				level.Info(logger).Log("msg", "dashboard has no queries", "dashboard", d.Title)
+				return nil
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "PANEL\tREF\tSTATUS\tDETAIL")
+
+			var broken int
+			indicator.Start("Validating queries", len(d.Queries))
+			for _, q := range d.Queries {
+				status, detail := validateDashboardQuery(ctx, f, q, d.Variables, lookback)
+				if status == "failed" || status == "no data" {
+					broken++
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", q.Panel, q.RefID, status, detail)
+				indicator.Increment(q.Panel+"/"+q.RefID, status)
+			}
+			indicator.Stop()
+
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			if broken > 0 {
+				return fmt.Errorf("%d of %d queries of dashboard %q failed or returned no data", broken, len(d.Queries), d.Title)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Path to the Grafana dashboard JSON file.")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "Value of a dashboard template variable as name=value. Can be repeated.")
+	cmd.Flags().Var(duration.NewValue(&lookback, time.Hour), "lookback", "Time range over which LogQL queries are evaluated.")
+
+	_ = cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+// validateDashboardQuery executes a dashboard query and returns its status and a detail message.
+func validateDashboardQuery(ctx context.Context, f *fetcher.Fetcher, q dashboard.Query, vars map[string]string, lookback time.Duration) (string, string) {
+	expr, missing := dashboard.Resolve(q.Expr, vars)
+	if len(missing) > 0 {
+		return "skipped", "unresolved variables: " + strings.Join(missing, ", ")
+	}
+
+	var (
+		data *fetcher.QueryData
+		err  error
+	)
+	if q.Loki {
+		// Loki rejects log queries as instant queries, so always evaluate over a range.
+		now := time.Now()
+		data, err = f.Query(ctx, fetcher.Logs, "/query_range", url.Values{
+			"query": []string{expr},
+			"start": []string{strconv.FormatInt(now.Add(-lookback).UnixNano(), 10)},
+			"end":   []string{strconv.FormatInt(now.UnixNano(), 10)},
+			"limit": []string{"1"},
+		})
+	} else {
+		data, err = f.Query(ctx, fetcher.Metrics, "/query", url.Values{"query": []string{expr}})
+	}
+
+	if err != nil {
+		return "failed", err.Error()
+	}
+	if data.Empty() {
+		return "no data", expr
+	}
+	return "ok", ""
+}
+
+func NewDashboardCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dashboard",
+		Short: "Grafana dashboard based operations for Observatorium.",
+		Long:  "Grafana dashboard based operations for Observatorium.",
+	}
+
+	cmd.AddCommand(NewDashboardValidateCmd(ctx))
+
+	return cmd
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// defaultRange is the time range queried when no start is given, see setupTimeDefaults.
+	defaultRange = time.Hour
+	// lookbackDelta is the lookback delta of instant queries. The API's default is used if zero.
+	lookbackDelta time.Duration
+)
+
+// setupTimeDefaults sets the default time range and lookback delta from the current context, if configured.
+func setupTimeDefaults(*cobra.Command, []string) error {
+	cfg, err := config.Read(logger)
+	if err != nil {
+		return nil
+	}
+	_, t, err := cfg.GetCurrent()
+	if err != nil {
+		return nil
+	}
+
+	if t.DefaultRange != "" {
+		if defaultRange, err = duration.Parse(t.DefaultRange); err != nil {
+			return fmt.Errorf("parsing default range of the current context: %w", err)
+		}
+	}
+	if t.LookbackDelta != "" {
+		if lookbackDelta, err = duration.Parse(t.LookbackDelta); err != nil {
+			return fmt.Errorf("parsing lookback delta of the current context: %w", err)
+		}
+	}
+	return nil
+}
+
+// instantQueryParams returns the parameters of an instant query evaluated at the given time, now if empty.
+func instantQueryParams(query, at string) (url.Values, error) {
+	params := url.Values{"query": []string{query}}
+	if at != "" {
+		t, err := parseTime(at, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("parsing --time: %w", err)
+		}
+		params.Set("time", formatUnix(t))
+	}
+	if lookbackDelta > 0 {
+		params.Set("lookback_delta", strconv.FormatFloat(lookbackDelta.Seconds(), 'f', -1, 64))
+	}
+	return params, nil
+}
+
+// rangeQueryParams returns the parameters of a range query between start and end, see
+// parseTimeRange. A zero step is chosen with autoStep.
+func rangeQueryParams(query, start, end string, step time.Duration) (url.Values, error) {
+	s, e, err := parseTimeRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+	if step == 0 {
+		step = autoStep(s, e)
+	}
+
+	params := url.Values{
+		"query": []string{query},
+		"start": []string{formatUnix(s)},
+		"end":   []string{formatUnix(e)},
+		"step":  []string{strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+	if lookbackDelta > 0 {
+		params.Set("lookback_delta", strconv.FormatFloat(lookbackDelta.Seconds(), 'f', -1, 64))
+	}
+	return params, nil
+}
+
+func newContextDefaultsCmd(ctx context.Context) *cobra.Command {
+	var rng, lookback string
+
+	cmd := &cobra.Command{
+		Use:   "defaults",
+		Short: "View or set the default time range and lookback delta of the current context.",
+		Long: `View or set the default time range and lookback delta of the current context.
+
+The default range is queried by commands given no --start, e.g. the last hour with 1h. The lookback
+delta is sent with instant queries, so that series with samples up to that long ago are considered
+current. Pass an empty value to reset a default.`,
+		Example: `obsctl context defaults --range=6h --lookback-delta=10m`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			_, t, err := cfg.GetCurrent()
+			if err != nil {
+				return fmt.Errorf("getting current context: %w", err)
+			}
+
+			if !cmd.Flags().Changed("range") && !cmd.Flags().Changed("lookback-delta") {
+				return printTimeDefaults(cmd.OutOrStdout(), t)
+			}
+
+			if cmd.Flags().Changed("range") && rng != "" {
+				if d, err := duration.Parse(rng); err != nil || d <= 0 {
+					return fmt.Errorf("invalid --range %q, expected a positive duration like 1h", rng)
+				}
+			}
+			if cmd.Flags().Changed("lookback-delta") && lookback != "" {
+				if d, err := duration.Parse(lookback); err != nil || d <= 0 {
+					return fmt.Errorf("invalid --lookback-delta %q, expected a positive duration like 5m", lookback)
+				}
+			}
+
+			return updateCurrentTenant(ctx, func(t *config.TenantConfig) {
+				if cmd.Flags().Changed("range") {
+					t.DefaultRange = rng
+				}
+				if cmd.Flags().Changed("lookback-delta") {
+					t.LookbackDelta = lookback
+				}
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&rng, "range", "", "Default time range, e.g. 1h or 7d.")
+	cmd.Flags().StringVar(&lookback, "lookback-delta", "", "Lookback delta of instant queries, e.g. 5m.")
+
+	return cmd
+}
+
+func printTimeDefaults(w io.Writer, t config.TenantConfig) error {
+	rng, lookback := t.DefaultRange, t.LookbackDelta
+	if rng == "" {
+		rng = "1h"
+	}
+	if lookback == "" {
+		lookback = "API default"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "range:\t%s\n", rng)
+	fmt.Fprintf(tw, "lookback-delta:\t%s\n", lookback)
+	return tw.Flush()
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/spf13/cobra"
+)
+
+func NewMetricsDeleteCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete metrics data of a tenant.",
+		Long:  "Delete metrics data of a tenant.",
+	}
+
+	var matchers []string
+	var start, end, confirmDelete string
+
+	seriesCmd := &cobra.Command{
+		Use:   "series",
+		Short: "Delete series of a tenant.",
+		Long: `Delete the data of series of a tenant matching the given selectors, e.g. for GDPR or cleanup
+requests. Requires a backend exposing the TSDB admin API (delete_series) through the API.
+
+The number of matching series is shown and the deletion has to be confirmed by typing the name
+of the tenant. --yes doesn't confirm it, pass --confirm-delete with the name of the tenant to
+delete non-interactively. Without --start and --end, all data of the series is deleted. Deleted data is only
+marked as deleted and disappears from query results right away, it is removed from storage
+when the backend compacts it.`,
+		Example: `obsctl metrics delete series --match='{job="test"}'
+obsctl metrics delete series --match='http_requests_total{user_id="42"}' --start=2022-01-01 --end=2022-02-01
+obsctl metrics delete series --match='{job="test"}' --confirm-delete=team-a`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(matchers) == 0 {
+				return fmt.Errorf("at least one --match is required")
+			}
+
+			params := url.Values{"match[]": matchers}
+			var from, to string
+			now := time.Now()
+			if start != "" {
+				s, err := parseTime(start, now)
+				if err != nil {
+					return fmt.Errorf("parsing --start: %w", err)
+				}
+				params.Set("start", formatUnix(s))
+				from = formatTime(s)
+			}
+			if end != "" {
+				e, err := parseTime(end, now)
+				if err != nil {
+					return fmt.Errorf("parsing --end: %w", err)
+				}
+				params.Set("end", formatUnix(e))
+				to = formatTime(e)
+			}
+
+			between := "of all time"
+			switch {
+			case from != "" && to != "":
+				between = fmt.Sprintf("between %s and %s", from, to)
+			case from != "":
+				between = "since " + from
+			case to != "":
+				between = "until " + to
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			indicator.Start("Counting series", 0)
+			series, err := f.Series(ctx, fetcher.Metrics, params)
+			indicator.Stop()
+			if err != nil {
+				return fmt.Errorf("getting series: %w", err)
+			}
+			if len(series) == 0 {
+				level.Info(logger).Log("msg", "no series match, nothing to delete")
+				return nil
+			}
+
+			if err := confirmTenant(cmd, fmt.Sprintf("Data %s of %d series of tenant %s matching %s will be deleted.", between, len(series), f.Tenant(), strings.Join(matchers, ", ")), f.Tenant(), "confirm-delete", confirmDelete); err != nil {
+				return err
+			}
+
+			if err := f.DeleteSeries(ctx, params); err != nil {
+				var serr *fetcher.StatusError
+				if errors.As(err, &serr) && serr.StatusCode == http.StatusNotFound {
+					return fmt.Errorf("deleting series: the metrics backend of the current context does not expose the admin API: %w", err)
+				}
+				return fmt.Errorf("deleting series: %w", err)
+			}
+
+			level.Info(logger).Log("msg", "deleted series", "series", len(series))
+			return nil
+		},
+	}
+
+	seriesCmd.Flags().StringArrayVar(&matchers, "match", nil, "Series selector of the series to delete. Can be repeated.")
+	seriesCmd.Flags().StringVar(&start, "start", "", "Start of the time range to delete, as RFC3339 or Unix timestamp, or relative to now like -24h. Defaults to the beginning of time.")
+	seriesCmd.Flags().StringVar(&end, "end", "", "End of the time range to delete, as RFC3339 or Unix timestamp, or relative to now. Defaults to the end of time.")
+	seriesCmd.Flags().StringVar(&confirmDelete, "confirm-delete", "", "Name of the tenant whose data is deleted, to confirm the deletion non-interactively. --yes doesn't confirm deletions.")
+	registerSelectorCompletion(ctx, seriesCmd, func() (fetcher.Signal, error) { return fetcher.Metrics, nil })
+	cmd.AddCommand(seriesCmd)
+
+	return cmd
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/spf13/cobra"
+)
+
+const (
+	shellBash       = "bash"
+	shellFish       = "fish"
+	shellPowerShell = "powershell"
+)
+
+// envVar is an environment variable describing the current context.
+type envVar struct {
+	name, value string
+}
+
+func newContextEnvCmd(ctx context.Context) *cobra.Command {
+	var shell string
+
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Print the current context as environment variables for other tools.",
+		Long: `Print statements setting environment variables with the API URL, tenant and a fresh access token
+of the current context, so that curl scripts, promtool, logcli and other tools can reuse the
+authentication of obsctl. The token is refreshed first if it expired, but it is not refreshed
+in the environment, run the command again when it expires.
+
+The variables are:
+
+  OBSCTL_CONTEXT        the current context, as <api>/<tenant>, for information only, obsctl
+                        reads $OBSCTL_CONTEXT_OVERRIDE to override the current context
+  OBSCTL_API_URL        the URL of the Observatorium API
+  OBSCTL_TENANT         the tenant
+  OBSCTL_METRICS_URL    the URL of the Prometheus API of the tenant
+  OBSCTL_LOGS_URL       the URL of the Loki API of the tenant
+  OBSCTL_TOKEN          the access token, if the context has credentials
+  OBSCTL_TOKEN_EXPIRY   the expiry of the token, as RFC3339, if it expires
+  LOKI_ADDR             the URL of the Loki API of the tenant, for logcli
+  LOKI_BEARER_TOKEN     the access token, for logcli
+
+The shell is detected from $SHELL unless given with --shell.`,
+		Example: `eval "$(obsctl context env)"
+curl -H "Authorization: Bearer $OBSCTL_TOKEN" "$OBSCTL_METRICS_URL/api/v1/query?query=up"
+obsctl context env --shell fish | source
+obsctl context env --shell powershell | Invoke-Expression`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if shell == "" {
+				shell = detectShell()
+			}
+			switch shell {
+			case shellBash, shellFish, shellPowerShell:
+			default:
+				return fmt.Errorf("unsupported shell %q, expected one of: bash|fish|powershell", shell)
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			vars := []envVar{
+				{"OBSCTL_CONTEXT", f.Context().String()},
+				{"OBSCTL_API_URL", f.APIURL()},
+				{"OBSCTL_TENANT", f.Tenant()},
+				{"OBSCTL_METRICS_URL", f.URL(fetcher.Metrics, "", nil)},
+				{"OBSCTL_LOGS_URL", f.URL(fetcher.Logs, "", nil)},
+				{"LOKI_ADDR", f.URL(fetcher.Logs, "", nil)},
+			}
+
+			token, err := f.Token()
+			if err != nil {
+				return fmt.Errorf("getting token: %w", err)
+			}
+			if token != nil {
+				vars = append(vars, envVar{"OBSCTL_TOKEN", token.AccessToken}, envVar{"LOKI_BEARER_TOKEN", token.AccessToken})
+				if !token.Expiry.IsZero() {
+					vars = append(vars, envVar{"OBSCTL_TOKEN_EXPIRY", token.Expiry.UTC().Format(time.RFC3339)})
+				}
+			}
+
+			return printEnv(cmd.OutOrStdout(), shell, vars)
+		},
+	}
+
+	cmd.Flags().StringVar(&shell, "shell", "", "Shell to print the statements for. One of: bash|fish|powershell. The bash statements work in all POSIX shells. Defaults to the shell in $SHELL.")
+
+	return cmd
+}
+
+// detectShell returns the shell of the user, falling back to bash, or PowerShell on Windows.
+func detectShell() string {
+	if filepath.Base(os.Getenv("SHELL")) == shellFish {
+		return shellFish
+	}
+	if runtime.GOOS == "windows" && os.Getenv("SHELL") == "" {
+		return shellPowerShell
+	}
+	return shellBash
+}
+
+// printEnv prints statements setting the variables in the given shell.
+func printEnv(w io.Writer, shell string, vars []envVar) error {
+	for _, v := range vars {
+		var err error
+		switch shell {
+		case shellFish:
+			_, err = fmt.Fprintf(w, "set -gx %s '%s';\n", v.name, strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v.value))
+		case shellPowerShell:
+			_, err = fmt.Fprintf(w, "$Env:%s = '%s'\n", v.name, strings.ReplaceAll(v.value, "'", "''"))
+		default:
+			_, err = fmt.Fprintf(w, "export %s='%s'\n", v.name, strings.ReplaceAll(v.value, "'", `'\''`))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
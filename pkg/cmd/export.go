@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/spf13/cobra"
+)
+
+// exportProgress is persisted next to the output file of an export, so that an interrupted export
+// can be resumed after the last completed chunk.
+type exportProgress struct {
+	Context string        `json:"context"`
+	Tenant  string        `json:"tenant"`
+	Query   string        `json:"query"`
+	Start   time.Time     `json:"start"`
+	End     time.Time     `json:"end"`
+	Step    time.Duration `json:"step"`
+	Chunk   time.Duration `json:"chunk"`
+
+	// Next is the start of the first chunk that was not exported yet.
+	Next time.Time `json:"next"`
+	// Offset is the size of the output file after the last completed chunk.
+	Offset int64 `json:"offset"`
+}
+
+// sameExport reports whether p describes the same export as o, ignoring its progress and time range,
+// as relative time ranges resolve differently with every invocation.
+func (p exportProgress) sameExport(o exportProgress) bool {
+	return p.Context == o.Context && p.Tenant == o.Tenant && p.Query == o.Query && p.Step == o.Step && p.Chunk == o.Chunk
+}
+
+func NewMetricsExportCmd(ctx context.Context) *cobra.Command {
+	var start, end string
+	var step, chunk time.Duration
+	var retries int
+	var resume bool
+
+	cmd := &cobra.Command{
+		Use:   "export <query>",
+		Short: "Export the samples of a range query.",
+		Long: `Export the samples of a range query, one series per line as JSON.
+
+With --chunk, the time range is split into chunks that are queried one after another, each retried
+independently on failure, so that even weeks of raw samples can be exported. When writing to a file
+with --out, completed chunks are recorded in <file>.progress, and running the same export again
+with --resume continues after the last completed chunk, using the time range of the first run.
+Exports compressed with gzip are not resumable.`,
+		Example: `obsctl metrics export 'up{job="prometheus"}' --start=-7d --step=30s --chunk=24h --out=up.jsonl
+obsctl metrics export 'up{job="prometheus"}' --start=-7d --step=30s --chunk=24h --out=up.jsonl --resume`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateQuery(args[0]); err != nil {
+				return err
+			}
+
+			s, e, err := parseTimeRange(start, end)
+			if err != nil {
+				return err
+			}
+
+			if step < 0 {
+				return fmt.Errorf("--step must not be negative, got %s", step)
+			}
+			if step == 0 {
+				step = autoStep(s, e)
+			}
+			if chunk < 0 || (chunk > 0 && chunk < step) {
+				return fmt.Errorf("--chunk must be zero or at least --step, got %s", chunk)
+			}
+
+			if resume && (output == nil || output.gzip) {
+				return errors.New("--resume requires --out with an uncompressed file")
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			p := exportProgress{Context: f.Context().String(), Tenant: f.Tenant(), Query: args[0], Start: s, End: e, Step: step, Chunk: chunk, Next: s}
+			// Compressed files can't be appended to after the last completed chunk.
+			if output == nil || output.gzip {
+				return withOutput(ctx, cmd, func(w io.Writer) error {
+					return exportChunks(ctx, f, &p, retries, w, nil)
+				})
+			}
+			return exportToFile(ctx, f, p, retries, output.claim(), resume)
+		},
+	}
+
+	cmd.Flags().StringVar(&start, "start", "", "Start of the time range, as RFC3339 or Unix timestamp, or relative to now like -7d. Defaults to the default range of the current context before --end, see 'obsctl context defaults'.")
+	cmd.Flags().StringVar(&end, "end", "now", "End of the time range, as RFC3339 or Unix timestamp, or relative to now.")
+	cmd.Flags().Var(duration.NewValue(&step, 0), "step", "Resolution of the exported samples. Defaults to a step resulting in about 250 samples per series.")
+	cmd.Flags().Var(duration.NewValue(&chunk, 0), "chunk", "Length of the chunks the time range is exported in, e.g. 24h. 0 exports the whole range at once.")
+	cmd.Flags().IntVar(&retries, "chunk.retries", 3, "Number of times a failed chunk is retried.")
+	cmd.Flags().BoolVar(&resume, "resume", false, "Continue an interrupted export to --out after its last completed chunk. Starts a new export if there is none.")
+
+	return cmd
+}
+
+// exportToFile exports to a file. With resume, a previous export of the same query is continued if
+// its progress file exists.
+func exportToFile(ctx context.Context, f *fetcher.Fetcher, p exportProgress, retries int, file string, resume bool) error {
+	progressFile := file + ".progress"
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if b, err := os.ReadFile(progressFile); err == nil {
+		if !resume {
+			return fmt.Errorf("%s has an interrupted export, pass --resume to continue it or remove %s to start over", file, progressFile)
+		}
+
+		var prev exportProgress
+		if err := json.Unmarshal(b, &prev); err != nil {
+			return fmt.Errorf("reading export progress %s: %w", progressFile, err)
+		}
+		if !prev.sameExport(p) {
+			return fmt.Errorf("%s belongs to a different export, remove it to start over", progressFile)
+		}
+
+		level.Info(logger).Log("msg", "resuming export", "file", file, "from", formatTime(prev.Next))
+		p = prev
+		flags = os.O_WRONLY
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading export progress: %w", err)
+	}
+
+	out, err := os.OpenFile(file, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("opening output file: %w", err)
+	}
+	defer out.Close()
+
+	// Drop anything written after the last completed chunk.
+	if err := out.Truncate(p.Offset); err != nil {
+		return fmt.Errorf("truncating output file: %w", err)
+	}
+	if _, err := out.Seek(p.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking output file: %w", err)
+	}
+
+	w := bufio.NewWriter(out)
+	err = exportChunks(ctx, f, &p, retries, w, func() error {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if err := out.Sync(); err != nil {
+			return err
+		}
+		if p.Offset, err = out.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(progressFile, b, 0644)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	return os.Remove(progressFile)
+}
+
+// exportChunks exports the chunks of p from p.Next on, calling checkpoint after each completed chunk.
+func exportChunks(ctx context.Context, f *fetcher.Fetcher, p *exportProgress, retries int, w io.Writer, checkpoint func() error) error {
+	chunks := 1
+	if p.Chunk > 0 {
+		chunks = int(p.End.Sub(p.Next)/p.Chunk) + 1
+	}
+
+	indicator.Start("Exporting", chunks)
+	defer indicator.Stop()
+
+	for !p.Next.After(p.End) {
+		chunkEnd := p.End
+		if p.Chunk > 0 && p.Next.Add(p.Chunk-p.Step).Before(p.End) {
+			chunkEnd = p.Next.Add(p.Chunk - p.Step)
+		}
+
+		if err := exportChunk(ctx, f, p, chunkEnd, retries, w); err != nil {
+			return err
+		}
+
+		p.Next = chunkEnd.Add(p.Step)
+		if checkpoint != nil {
+			if err := checkpoint(); err != nil {
+				return fmt.Errorf("saving export progress: %w", err)
+			}
+		}
+		indicator.Increment(formatTime(chunkEnd), "ok")
+	}
+	return nil
+}
+
+// exportChunk exports the samples from p.Next to end, retrying failed queries with a linear backoff.
+func exportChunk(ctx context.Context, f *fetcher.Fetcher, p *exportProgress, end time.Time, retries int, w io.Writer) error {
+	params := url.Values{
+		"query": []string{p.Query},
+		"start": []string{formatUnix(p.Next)},
+		"end":   []string{formatUnix(end)},
+		"step":  []string{formatUnix(time.Unix(0, 0).Add(p.Step))},
+	}
+
+	var (
+		data *fetcher.QueryData
+		err  error
+	)
+	for attempt := 0; ; attempt++ {
+		if data, err = f.Query(ctx, fetcher.Metrics, "/query_range", params); err == nil {
+			break
+		}
+
+		// Invalid queries won't succeed when retried.
+		var serr *fetcher.StatusError
+		if attempt >= retries || ctx.Err() != nil || (errors.As(err, &serr) && serr.StatusCode/100 == 4 && serr.StatusCode != http.StatusTooManyRequests) {
+			return fmt.Errorf("exporting %s to %s: %w", formatTime(p.Next), formatTime(end), err)
+		}
+
+		level.Warn(logger).Log("msg", "exporting chunk failed, retrying", "start", formatTime(p.Next), "attempt", attempt+1, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * time.Second):
+		}
+	}
+
+	series, err := data.Series()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, s := range series {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/fanout"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+)
+
+// concurrency is the number of tenants operated on at the same time by --all-tenants operations.
+var concurrency int
+
+// tenantTimeout limits the duration of the operation against each tenant of --all-tenants operations.
+var tenantTimeout time.Duration
+
+// breakAfter is the number of consecutive failures against an API after which --all-tenants
+// operations skip its remaining tenants.
+var breakAfter int
+
+// newPool returns a pool for fanout operations, reporting the result of each task to the indicator.
+func newPool(workers int, timeout time.Duration) fanout.Pool {
+	return fanout.Pool{
+		Concurrency: workers,
+		Timeout:     timeout,
+		BreakAfter:  breakAfter,
+		OnDone: func(r fanout.Result) {
+			status := "ok"
+			var berr *fanout.BreakerError
+			if errors.As(r.Err, &berr) {
+				status = "skipped"
+			} else if r.Err != nil {
+				status = "failed"
+			}
+			indicator.Increment(r.Name, status)
+		},
+	}
+}
+
+// forEachContext runs fn against a fetcher for every configured context, with --concurrency
+// workers and --tenant.timeout per context. After --breaker.failures consecutive failures
+// against an API, its remaining contexts are skipped. It returns the results in the order of contexts.
+func forEachContext(ctx context.Context, operation string, fn func(ctx context.Context, f *fetcher.Fetcher) error) ([]fanout.Result, error) {
+	if asTenant != "" {
+		return nil, fmt.Errorf("--as-tenant can't be combined with operations on all tenants")
+	}
+
+	cfg, err := config.Read(logger)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	contexts := cfg.Contexts()
+	if len(contexts) == 0 {
+		return nil, fmt.Errorf("no contexts configured, use 'obsctl login' to add one")
+	}
+
+	tasks := make([]fanout.Task, 0, len(contexts))
+	for _, c := range contexts {
+		c := c
+		tasks = append(tasks, fanout.Task{
+			Name:  c.String(),
+			Group: c.API,
+			Run: func(ctx context.Context) error {
+				f, err := fetcher.NewContextFetcher(ctx, logger, cfg, c)
+				if err != nil {
+					return err
+				}
+				return fn(ctx, configureFetcher(f))
+			},
+		})
+	}
+
+	indicator.Start(operation, len(tasks))
+	results := newPool(concurrency, tenantTimeout).Run(ctx, tasks)
+	indicator.Stop()
+
+	return results, nil
+}
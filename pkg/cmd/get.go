@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/printer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// resource is a kind of object of a tenant that is read the same way for every signal having it,
+// so that commands work for all signals without duplicating their logic.
+type resource struct {
+	use, short, long, example string
+	args                      cobra.PositionalArgs
+	// signals are the signals having the resource.
+	signals []fetcher.Signal
+	// flags registers the flags of the resource, if any. A --match flag is completed with series selectors.
+	flags func(*pflag.FlagSet)
+	// labelArg completes the first argument with label names.
+	labelArg bool
+	// get prints the resource of the signal.
+	get func(ctx context.Context, cmd *cobra.Command, signal fetcher.Signal, args []string) error
+}
+
+// resources returns the resources readable with 'obsctl get'. Every call returns new resources
+// with their own flag values.
+func resources() []resource {
+	var matchers []string
+
+	return []resource{
+		{
+			use:     "rules",
+			short:   "Get the rules of a tenant with their state.",
+			long:    "Get the rule groups of a tenant as evaluated by the rules API, with the state and health of every rule.",
+			args:    cobra.NoArgs,
+			signals: fetcher.Signals,
+			get: func(ctx context.Context, cmd *cobra.Command, signal fetcher.Signal, args []string) error {
+				p, err := newPrinter(cmd)
+				if err != nil {
+					return err
+				}
+				f, err := newFetcher(ctx)
+				if err != nil {
+					return err
+				}
+
+				indicator.Start("Fetching rules", 0)
+				groups, err := f.Rules(ctx, signal)
+				indicator.Stop()
+				if err != nil {
+					return fmt.Errorf("getting rules: %w", err)
+				}
+
+				v := struct {
+					Groups []fetcher.RuleGroup `json:"groups"`
+				}{Groups: groups}
+				return p.Print(cmd.OutOrStdout(), v, func() ([]string, [][]string) {
+					var rows [][]string
+					for _, g := range groups {
+						for _, r := range g.Rules {
+							rows = append(rows, []string{g.Name, r.Name, r.Type, orDash(r.State), orDash(r.Health)})
+						}
+					}
+					return []string{"GROUP", "RULE", "TYPE", "STATE", "HEALTH"}, rows
+				})
+			},
+		},
+		{
+			use:     "rules.raw",
+			short:   "Get the configured rules of a tenant.",
+			long:    "Get the rules configured for a tenant as they were set, as YAML, or converted to JSON with -o json.",
+			args:    cobra.NoArgs,
+			signals: fetcher.Signals,
+			get: func(ctx context.Context, cmd *cobra.Command, signal fetcher.Signal, args []string) error {
+				p, err := newPrinter(cmd)
+				if err != nil {
+					return err
+				}
+				f, err := newFetcher(ctx)
+				if err != nil {
+					return err
+				}
+
+				indicator.Start("Fetching rules", 0)
+				b, err := f.RawRules(ctx, signal)
+				indicator.Stop()
+				if err != nil {
+					return fmt.Errorf("getting rules: %w", err)
+				}
+
+				// Rules are printed as they were set, with their comments, unless decoded rules are needed.
+				if p.Format() == printer.Table || p.Format() == printer.YAML {
+					_, err = cmd.OutOrStdout().Write(b)
+					return err
+				}
+				var v interface{}
+				if err := yaml.Unmarshal(b, &v); err != nil {
+					return fmt.Errorf("decoding rules: %w", err)
+				}
+				return p.Print(cmd.OutOrStdout(), v, nil)
+			},
+		},
+		{
+			use:     "labels",
+			short:   "Get labels of a tenant.",
+			long:    "Get label names of a tenant, one per line.",
+			args:    cobra.NoArgs,
+			signals: fetcher.Signals,
+			get: func(ctx context.Context, cmd *cobra.Command, signal fetcher.Signal, args []string) error {
+				return streamList(ctx, cmd, signal, "/labels", nil, decodeString)
+			},
+		},
+		{
+			use:      "labelvalues <label>",
+			short:    "Get label values of a tenant.",
+			long:     "Get the values of a label of a tenant, one per line.",
+			example:  `obsctl get labelvalues namespace --signal=logs`,
+			args:     cobra.ExactArgs(1),
+			signals:  fetcher.Signals,
+			labelArg: true,
+			get: func(ctx context.Context, cmd *cobra.Command, signal fetcher.Signal, args []string) error {
+				return streamList(ctx, cmd, signal, "/label/"+url.PathEscape(args[0])+"/values", nil, decodeString)
+			},
+		},
+		{
+			use:     "series",
+			short:   "Get series of a tenant.",
+			long:    "Get series of a tenant matching the given selectors, one label set per line.",
+			example: `obsctl get series --signal=logs --match='{namespace="default"}'`,
+			args:    cobra.NoArgs,
+			signals: fetcher.Signals,
+			flags: func(fs *pflag.FlagSet) {
+				fs.StringArrayVar(&matchers, "match", nil, "Series selector of the series to get. Can be repeated.")
+			},
+			get: func(ctx context.Context, cmd *cobra.Command, signal fetcher.Signal, args []string) error {
+				if len(matchers) == 0 {
+					return fmt.Errorf("at least one --match is required")
+				}
+				return streamList(ctx, cmd, signal, "/series", url.Values{"match[]": matchers}, func(raw json.RawMessage) (interface{}, string, bool, error) {
+					lset, err := decodeSeries(raw)
+					if err != nil {
+						return nil, "", false, err
+					}
+					return lset, fetcher.FormatMetric(lset), true, nil
+				})
+			},
+		},
+	}
+}
+
+// resourceByName returns the resource whose command is named name.
+func resourceByName(name string) resource {
+	for _, r := range resources() {
+		if strings.Fields(r.use)[0] == name {
+			return r
+		}
+	}
+	panic("unknown resource " + name)
+}
+
+// newResourceCmd returns a command printing the resource of the signal returned by signal.
+func newResourceCmd(ctx context.Context, r resource, signal func() (fetcher.Signal, error)) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     r.use,
+		Short:   r.short,
+		Long:    r.long,
+		Example: r.example,
+		Args:    r.args,
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			s, err := signal()
+			if err != nil {
+				return err
+			}
+			if !hasSignal(r.signals, s) {
+				return fmt.Errorf("%s are not available for signal %s", cmd.Name(), s)
+			}
+			return r.get(ctx, cmd, s, args)
+		}),
+	}
+	if r.flags != nil {
+		r.flags(cmd.Flags())
+	}
+	if cmd.Flags().Lookup("match") != nil {
+		registerSelectorCompletion(ctx, cmd, signal)
+	}
+	if r.labelArg {
+		cmd.ValidArgsFunction = completeLabelNames(ctx, signal)
+	}
+	return cmd
+}
+
+// addOutputFlag registers the -o flag choosing the format of the printer of read commands, usually
+// as persistent flag of a group of get commands.
+func addOutputFlag(fs *pflag.FlagSet) {
+	fs.StringP("output", "o", printer.Table, "Output format. One of: "+strings.Join(printer.Formats, "|")+". Go templates get the JSON output as data, and are executed for every label, label value or series.")
+}
+
+// newPrinter returns the printer of the format chosen with the -o flag of cmd.
+func newPrinter(cmd *cobra.Command) (*printer.Printer, error) {
+	format, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return nil, err
+	}
+	return printer.New(format)
+}
+
+func hasSignal(signals []fetcher.Signal, s fetcher.Signal) bool {
+	for _, o := range signals {
+		if o == s {
+			return true
+		}
+	}
+	return false
+}
+
+func NewGetCmd(ctx context.Context) *cobra.Command {
+	var signal string
+
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "Read rules, labels & series of a tenant for any signal.",
+		Long: `Read rules, labels & series of a tenant for any signal.
+
+Works the same for all signals, chosen with --signal, so that scripts handling several signals
+don't need to use the commands of each signal's group.`,
+		Example: `obsctl get rules --signal=logs
+obsctl get labels --signal=metrics
+obsctl get series --match='{namespace="default"}' -o json
+obsctl get rules -o go-template='{{range .groups}}{{.name}}{{"\n"}}{{end}}'`,
+	}
+
+	cmd.PersistentFlags().StringVar(&signal, "signal", string(fetcher.Metrics), "Signal to read. One of: metrics|logs.")
+	addOutputFlag(cmd.PersistentFlags())
+
+	for _, r := range resources() {
+		cmd.AddCommand(newResourceCmd(ctx, r, func() (fetcher.Signal, error) { return fetcher.ParseSignal(signal) }))
+	}
+
+	return cmd
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/units"
+)
+
+// heatmapColumns is the number of time steps aimed for in heatmaps, so that they fit on a terminal.
+const heatmapColumns = 60
+
+// shades are the characters used to draw heatmap cells, from lowest to highest.
+var shades = []rune(" ░▒▓█")
+
+// heatmap is the distribution of histogram observations over time, with one row per bucket.
+type heatmap struct {
+	// les are the upper bounds of the buckets, ascending.
+	les []float64
+	// times are the timestamps of the columns, ascending.
+	times []float64
+	// values are the values of the buckets by bucket and column, non-cumulative.
+	values [][]float64
+}
+
+// runMetricsHeatmap runs a range query over classic histogram buckets and prints it as heatmap or CSV.
+// Without --range, it covers the default range up to --time in about heatmapColumns steps.
+func runMetricsHeatmap(ctx context.Context, w io.Writer, query string, out queryOutput) error {
+	if err := validateQuery(query); err != nil {
+		return err
+	}
+
+	var start, end time.Time
+	var err error
+	if out.rng {
+		if start, end, err = parseTimeRange(out.start, out.end); err != nil {
+			return err
+		}
+	} else {
+		if end, err = parseTime(out.at, time.Now()); err != nil {
+			return fmt.Errorf("parsing --time: %w", err)
+		}
+		start = end.Add(-defaultRange)
+	}
+	step := out.step
+	if step == 0 {
+		step = stepFor(start, end, heatmapColumns)
+	}
+
+	f, err := newFetcher(ctx)
+	if err != nil {
+		return err
+	}
+
+	recordHistory(ctx, f, fetcher.Metrics, query)
+
+	params := url.Values{
+		"query": []string{query},
+		"start": []string{formatUnix(start)},
+		"end":   []string{formatUnix(end)},
+		"step":  []string{strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+
+	indicator.Start("Running query", 0)
+	b, err := cachedQuery(ctx, f, fetcher.Metrics, "/api/v1/query_range", params)
+	indicator.Stop()
+	if err != nil {
+		return fmt.Errorf("querying metrics: %w", err)
+	}
+
+	var data fetcher.QueryData
+	if err := fetcher.DecodeData(b, &data); err != nil {
+		return err
+	}
+	if len(out.dedupBy) > 0 {
+		if err := data.Dedup(out.dedupBy); err != nil {
+			return err
+		}
+	}
+	series, err := data.Series()
+	if err != nil {
+		return err
+	}
+
+	h, err := newHeatmap(series)
+	if err != nil {
+		return err
+	}
+
+	if out.format == outputHeatmapCSV {
+		return h.writeCSV(w)
+	}
+
+	unit := out.unit
+	if unit == units.Auto {
+		unit = units.Guess(query)
+	}
+	return h.render(w, unit)
+}
+
+// newHeatmap sums the series by their le label and turns the cumulative bucket values into
+// the values of the individual buckets.
+func newHeatmap(series []fetcher.Series) (*heatmap, error) {
+	byLe := map[float64]map[float64]float64{}
+	timestamps := map[float64]struct{}{}
+	for _, s := range series {
+		le, ok := s.Metric["le"]
+		if !ok {
+			return nil, fmt.Errorf("series %s has no le label, the heatmap formats require classic histogram _bucket series", fetcher.FormatMetric(s.Metric))
+		}
+		bound, err := strconv.ParseFloat(le, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid le label %q of series %s", le, fetcher.FormatMetric(s.Metric))
+		}
+
+		if byLe[bound] == nil {
+			byLe[bound] = map[float64]float64{}
+		}
+		for _, v := range s.Values {
+			if f := v.Float(); !math.IsNaN(f) {
+				byLe[bound][v.Timestamp] += f
+				timestamps[v.Timestamp] = struct{}{}
+			}
+		}
+	}
+	if len(byLe) == 0 {
+		return nil, fmt.Errorf("query returned no series")
+	}
+	if len(timestamps) == 0 {
+		return nil, fmt.Errorf("query returned no samples, only NaN values")
+	}
+
+	h := &heatmap{}
+	for le := range byLe {
+		h.les = append(h.les, le)
+	}
+	sort.Float64s(h.les)
+	for ts := range timestamps {
+		h.times = append(h.times, ts)
+	}
+	sort.Float64s(h.times)
+
+	h.values = make([][]float64, len(h.les))
+	for i, le := range h.les {
+		h.values[i] = make([]float64, len(h.times))
+		for j, ts := range h.times {
+			h.values[i][j] = byLe[le][ts]
+			if i > 0 {
+				// Buckets are cumulative, reset-induced negative differences are clamped.
+				h.values[i][j] = math.Max(0, byLe[le][ts]-byLe[h.les[i-1]][ts])
+			}
+		}
+	}
+	return h, nil
+}
+
+// render draws the heatmap with the largest bucket at the top, shading cells relative to the maximum value.
+func (h *heatmap) render(w io.Writer, unit string) error {
+	var max float64
+	for _, row := range h.values {
+		for _, v := range row {
+			max = math.Max(max, v)
+		}
+	}
+
+	labels := make([]string, len(h.les))
+	width := 0
+	for i, le := range h.les {
+		labels[i] = "le " + units.Format(le, unit)
+		if math.IsInf(le, 1) {
+			labels[i] = "le +Inf"
+		}
+		if len(labels[i]) > width {
+			width = len(labels[i])
+		}
+	}
+
+	for i := len(h.les) - 1; i >= 0; i-- {
+		var sb strings.Builder
+		for _, v := range h.values[i] {
+			idx := 0
+			if max > 0 {
+				idx = int(math.Ceil(v / max * float64(len(shades)-1)))
+			}
+			sb.WriteRune(shades[idx])
+		}
+		if _, err := fmt.Fprintf(w, "%*s │%s│\n", width, labels[i], sb.String()); err != nil {
+			return err
+		}
+	}
+
+	from, to := fetcher.SamplePair{Timestamp: h.times[0]}, fetcher.SamplePair{Timestamp: h.times[len(h.times)-1]}
+	_, err := fmt.Fprintf(w, "%*s  %s … %s, max %s per bucket\n", width, "", formatTime(from.Time()), formatTime(to.Time()), strconv.FormatFloat(max, 'g', 4, 64))
+	return err
+}
+
+// writeCSV writes the heatmap as CSV with one row per timestamp and one column per bucket.
+func (h *heatmap) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"time"}
+	for _, le := range h.les {
+		header = append(header, strconv.FormatFloat(le, 'g', -1, 64))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for j, ts := range h.times {
+		row := []string{formatTime(fetcher.SamplePair{Timestamp: ts}.Time())}
+		for i := range h.les {
+			row = append(row, strconv.FormatFloat(h.values[i][j], 'g', -1, 64))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
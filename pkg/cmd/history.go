@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/history"
+	"github.com/spf13/cobra"
+)
+
+// recordHistory records a query about to be executed. Failing to do so is not fatal for the query.
+func recordHistory(ctx context.Context, f *fetcher.Fetcher, signal fetcher.Signal, query string) {
+	if err := history.Append(ctx, logger, history.Entry{
+		Time:    time.Now(),
+		Context: f.Context().String(),
+		Signal:  string(signal),
+		Query:   query,
+	}); err != nil {
+		level.Warn(logger).Log("msg", "failed to record query in history", "err", err)
+	}
+}
+
+// completeQueryFromHistory returns a completion function suggesting queries of the signal
+// previously executed against the current context, most recent first.
+func completeQueryFromHistory(signal fetcher.Signal) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		cfg, err := config.Read(logger)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		entries, err := history.Read(logger)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		seen := map[string]struct{}{}
+		var queries []string
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			if e.Context != cfg.Current.String() || e.Signal != string(signal) || !strings.HasPrefix(e.Query, toComplete) {
+				continue
+			}
+			if _, ok := seen[e.Query]; ok {
+				continue
+			}
+			seen[e.Query] = struct{}{}
+			queries = append(queries, e.Query)
+		}
+
+		return queries, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+func NewHistoryCmd(ctx context.Context) *cobra.Command {
+	var all bool
+	var rerun int
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show and re-run previously executed queries.",
+		Long: `Show and re-run previously executed queries.
+
+Lists the queries executed against the current context, or against all contexts with --all.
+Pass the ID of an entry to --rerun to execute it again against the current context.`,
+		Example: `obsctl history
+obsctl history --rerun 42`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			entries, err := history.Read(logger)
+			if err != nil {
+				return err
+			}
+
+			if cmd.Flags().Changed("rerun") {
+				i := sort.Search(len(entries), func(i int) bool { return entries[i].ID >= rerun })
+				if i == len(entries) || entries[i].ID != rerun {
+					return fmt.Errorf("no history entry with ID %d", rerun)
+				}
+
+				e := entries[i]
+				if e.Signal != string(fetcher.Metrics) {
+					return fmt.Errorf("re-running %s queries is not supported", e.Signal)
+				}
+				return runMetricsQuery(ctx, cmd.OutOrStdout(), e.Query, queryOutput{format: outputJSON})
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tTIME\tCONTEXT\tSIGNAL\tQUERY")
+			for _, e := range entries {
+				if !all && e.Context != cfg.Current.String() {
+					continue
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", strconv.Itoa(e.ID), formatTime(e.Time), e.Context, e.Signal, e.Query)
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Show the queries executed against all contexts.")
+	cmd.Flags().IntVar(&rerun, "rerun", 0, "ID of a history entry to execute again against the current context.")
+
+	return cmd
+}
@@ -2,28 +2,378 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/fetcher"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func NewLoginCmd(ctx context.Context) *cobra.Command {
+	var tenant, api, ca string
+	var force bool
+	var endpointParams []string
+	var tokenFile, webListen, tlsCert, tlsKey string
+	var web bool
+	oidcCfg := config.OIDCConfig{}
+
 	cmd := &cobra.Command{
 		Use:   "login",
 		Short: "Login as a tenant. Will also save tenant details locally.",
-		Long:  "Login as a tenant. Will also save tenant details locally.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "login called")
+		Long: `Login as a tenant. Will also save tenant details locally.
+
+Logging in to a tenant that was logged in to before replaces its credentials, e.g. after they
+were rotated.
+
+With --force, the stored token of the tenant is discarded and a new one fetched, even if the
+stored one is still valid, e.g. after it was revoked. Without --oidc.* flags, the stored
+credentials of the tenant are used to do so. If a new client secret is given, it is also set for
+all other contexts using the same OIDC client, discarding their tokens, as rotating the secret
+of a client invalidates it for all of them.
+
+By default, obsctl authenticates itself with the client credentials grant, which needs a client
+secret. With --oidc.grant-type=device-code, a user logs in instead: obsctl prints a URL and a code
+to confirm in a browser, on this or any other device, and waits until the login is confirmed. No
+client secret is needed for public clients. Tokens are then renewed with the refresh token, until
+it expires and logging in again with --force is needed.
+
+For gateways authenticating tenants with client certificates (mTLS), pass the certificate and key
+with --tls.cert and --tls.key, with or without OIDC or a token file.
+
+With --web, a user logs in with the browser of this machine instead, using the authorization code
+grant with PKCE: obsctl opens the login page of the issuer and receives the result on a local
+listener, see --web.listen. It is the same as --oidc.grant-type=authorization-code.`,
+		Example: `obsctl login --api=https://observatorium.example.com --tenant=team-a --oidc.issuer-url=https://sso.example.com --oidc.client-id=obsctl --oidc.client-secret=...
+obsctl login --api=https://observatorium.example.com --tenant=team-a --oidc.issuer-url=https://sso.example.com --oidc.client-id=obsctl --oidc.grant-type=device-code
+obsctl login --api=https://observatorium.example.com --tenant=team-a --oidc.issuer-url=https://sso.example.com --oidc.client-id=obsctl --web
+obsctl login --api=observatorium.example.com --tenant=team-a --force
+obsctl login --api=https://observatorium.example.com --tenant=team-a --tls.cert=team-a.crt --tls.key=team-a.key
+obsctl login --api=https://observatorium.example.com --tenant=team-a --token-file=/var/run/secrets/tokens/observatorium`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			apiName, err := ensureAPI(cfg, api)
+			if err != nil {
+				return err
+			}
+			if ca != "" {
+				// The config is used from other directories later on.
+				if ca, err = filepath.Abs(ca); err != nil {
+					return fmt.Errorf("resolving --ca: %w", err)
+				}
+				if err := cfg.SetAPICA(logger, apiName, ca); err != nil {
+					return err
+				}
+			}
+
+			if tokenFile != "" {
+				if oidcCfg.IssuerURL != "" {
+					return fmt.Errorf("--token-file and --oidc.issuer-url are mutually exclusive")
+				}
+				if tokenFile, err = filepath.Abs(tokenFile); err != nil {
+					return fmt.Errorf("resolving --token-file: %w", err)
+				}
+			}
+			if (tlsCert == "") != (tlsKey == "") {
+				return fmt.Errorf("--tls.cert and --tls.key must be given together")
+			}
+			if tlsCert != "" {
+				// The config is used from other directories later on.
+				if tlsCert, err = filepath.Abs(tlsCert); err != nil {
+					return fmt.Errorf("resolving --tls.cert: %w", err)
+				}
+				if tlsKey, err = filepath.Abs(tlsKey); err != nil {
+					return fmt.Errorf("resolving --tls.key: %w", err)
+				}
+			}
+			if oidcCfg.IssuerCAFile != "" {
+				// The config is used from other directories later on.
+				if oidcCfg.IssuerCAFile, err = filepath.Abs(oidcCfg.IssuerCAFile); err != nil {
+					return fmt.Errorf("resolving --oidc.issuer-ca: %w", err)
+				}
+			}
+
+			if web {
+				if cmd.Flags().Changed("oidc.grant-type") && oidcCfg.GrantType != config.GrantAuthorizationCode {
+					return fmt.Errorf("--web and --oidc.grant-type=%s are mutually exclusive", oidcCfg.GrantType)
+				}
+				oidcCfg.GrantType = config.GrantAuthorizationCode
+			}
+			switch oidcCfg.GrantType {
+			case config.GrantClientCredentials:
+				// The default, which is not stored.
+				oidcCfg.GrantType = ""
+			case config.GrantDeviceCode, config.GrantAuthorizationCode:
+			default:
+				return fmt.Errorf("unsupported --oidc.grant-type %q, expected one of: %s", oidcCfg.GrantType, strings.Join(config.GrantTypes, "|"))
+			}
+
+			for _, kv := range endpointParams {
+				parts := strings.SplitN(kv, "=", 2)
+				if len(parts) != 2 || parts[0] == "" {
+					return fmt.Errorf("invalid --oidc.endpoint-param %q, expected key=value", kv)
+				}
+				if oidcCfg.EndpointParams == nil {
+					oidcCfg.EndpointParams = url.Values{}
+				}
+				oidcCfg.EndpointParams.Add(parts[0], parts[1])
+			}
+
+			tc := config.TenantConfig{Tenant: tenant, TokenFile: tokenFile, TLSCert: tlsCert, TLSKey: tlsKey}
+			if oidcCfg.IssuerURL != "" {
+				tc.OIDC = &oidcCfg
+			}
+
+			_, existing, existsErr := cfg.GetContext(config.Context{API: apiName, Tenant: tenant})
+			if force && tc.OIDC == nil && tc.TokenFile == "" && existsErr == nil {
+				switch {
+				case existing.OIDC != nil:
+					// Reuse the stored credentials, without the token, so that a new one is fetched.
+					stored := *existing.OIDC
+					stored.Token = nil
+					tc.OIDC = &stored
+				case existing.TokenFile != "":
+					// The token file is read anew on every request, so it only needs to be kept.
+					tc.TokenFile = existing.TokenFile
+				}
+			}
+			if force && tc.TLSCert == "" && existsErr == nil {
+				tc.TLSCert, tc.TLSKey = existing.TLSCert, existing.TLSKey
+			}
+
+			if cmd.Flags().Changed("web.listen") {
+				if err := config.CheckWebListen(webListen); err != nil {
+					return fmt.Errorf("invalid --web.listen: %w", err)
+				}
+				if tc.OIDC != nil && tc.OIDC.GrantType == config.GrantAuthorizationCode {
+					tc.OIDC.WebListen = webListen
+				}
+			}
+
+			// Fail on unreadable certificates before the config is saved rather than on the next request.
+			if _, err := cfg.APIs[apiName].Transport(tc); err != nil {
+				return err
+			}
+
+			if tc.OIDC != nil && tc.OIDC.Interactive() && tc.OIDC.Token == nil {
+				if tc.OIDC.GrantType == config.GrantAuthorizationCode {
+					err = tc.OIDC.WebLogin(ctx, cmd.ErrOrStderr(), openBrowser)
+				} else {
+					err = tc.OIDC.DeviceLogin(ctx, cmd.ErrOrStderr())
+				}
+				if err != nil {
+					return fmt.Errorf("logging in: %w", err)
+				}
+			}
+
+			// Fetch a token upfront, so that invalid credentials are not saved.
+			indicator.Start("Authenticating", 0)
+			_, err = tc.Client(ctx, logger)
+			indicator.Stop()
+			if err != nil {
+				return fmt.Errorf("logging in: %w", err)
+			}
+
+			// Save to the latest config, so that changes of other processes while logging in are kept.
+			err = config.Update(ctx, logger, func(cfg *config.Config) error {
+				var err error
+				if apiName, err = ensureAPI(cfg, api); err != nil {
+					return err
+				}
+				if ca != "" {
+					if err := cfg.SetAPICA(logger, apiName, ca); err != nil {
+						return err
+					}
+				}
+
+				// Logging in again replaces the credentials of an existing tenant, keeping its other settings.
+				if _, existing, err := cfg.GetContext(config.Context{API: apiName, Tenant: tenant}); err == nil {
+					existing.OIDC, existing.TokenFile = tc.OIDC, tc.TokenFile
+					existing.TLSCert, existing.TLSKey = tc.TLSCert, tc.TLSKey
+					if err := cfg.UpdateTenant(apiName, existing); err != nil {
+						return err
+					}
+				} else {
+					if err := cfg.AddTenant(logger, apiName, tenant, tc.OIDC); err != nil {
+						return err
+					}
+					if err := cfg.UpdateTenant(apiName, tc); err != nil {
+						return err
+					}
+				}
+
+				if force && oidcCfg.IssuerURL != "" {
+					for _, c := range cfg.RotateClientSecret(tc.OIDC.IssuerURL, tc.OIDC.ClientID, tc.OIDC.ClientSecret) {
+						level.Info(logger).Log("msg", "updated client secret and discarded token", "context", c)
+					}
+				}
+
+				return cfg.SetCurrent(logger, apiName, tenant)
+			})
+			if err != nil {
+				return err
+			}
+
+			level.Info(logger).Log("msg", "logged in", "api", apiName, "tenant", tenant)
+			return nil
 		},
 	}
 
-	cmd.Flags().String("tenant", "", "The name of the tenant.")
-	cmd.Flags().String("api", "", "The URL or name of the Observatorium API.")
-	cmd.Flags().String("ca", "", "Path to the TLS CA against which to verify the Observatorium API. If no server CA is specified, the client will use the system certificates.")
-	cmd.Flags().String("oidc.issuer-url", "", "The OIDC issuer URL, see https://openid.net/specs/openid-connect-discovery-1_0.html#IssuerDiscovery.")
-	cmd.Flags().String("oidc.client-secret", "", "The OIDC client secret, see https://tools.ietf.org/html/rfc6749#section-2.3.")
-	cmd.Flags().String("oidc.client-id", "", "The OIDC client ID, see https://tools.ietf.org/html/rfc6749#section-2.3.")
-	cmd.Flags().String("oidc.audience", "", "The audience for whom the access token is intended, see https://openid.net/specs/openid-connect-core-1_0.html#IDToken.")
+	cmd.Flags().StringVar(&tenant, "tenant", "", "The name of the tenant.")
+	cmd.Flags().StringVar(&api, "api", "", "The URL or name of the Observatorium API.")
+	cmd.Flags().StringVar(&ca, "ca", "", "Path to the TLS CA bundle against which to verify the Observatorium API, stored for all tenants of the API, see 'obsctl context api --ca'. If no server CA is specified, the client will use the system certificates.")
+	cmd.Flags().StringVar(&tokenFile, "token-file", "", "Path of a file to read the bearer token from, instead of fetching one with OIDC, e.g. a projected service account token. The file is read again whenever it changes, so that tokens rotated by other processes are picked up.")
+	cmd.Flags().StringVar(&tlsCert, "tls.cert", "", "Path of the PEM-encoded client certificate presented to the API, for gateways authenticating tenants with mTLS. Requires --tls.key.")
+	cmd.Flags().StringVar(&tlsKey, "tls.key", "", "Path of the PEM-encoded key of --tls.cert.")
+	cmd.Flags().BoolVar(&force, "force", false, "Discard stored tokens and fetch a new one, see above.")
+	cmd.Flags().StringVar(&oidcCfg.IssuerURL, "oidc.issuer-url", "", "The OIDC issuer URL, see https://openid.net/specs/openid-connect-discovery-1_0.html#IssuerDiscovery.")
+	cmd.Flags().StringVar(&oidcCfg.ClientSecret, "oidc.client-secret", "", "The OIDC client secret, see https://tools.ietf.org/html/rfc6749#section-2.3.")
+	cmd.Flags().StringVar(&oidcCfg.ClientID, "oidc.client-id", "", "The OIDC client ID, see https://tools.ietf.org/html/rfc6749#section-2.3.")
+	cmd.Flags().StringVar(&oidcCfg.IssuerCAFile, "oidc.issuer-ca", "", "Path to the TLS CA bundle against which to verify the OIDC issuer, e.g. if it is behind an internal CA other than the Observatorium API. Only used for requests to the issuer. If not specified, the system certificates are used.")
+	cmd.Flags().BoolVar(&oidcCfg.IssuerInsecureSkipVerify, "oidc.issuer-insecure-skip-verify", false, "Do not verify the TLS certificate of the OIDC issuer. Insecure, meant for testing only.")
+	cmd.Flags().StringArrayVar((*[]string)(&oidcCfg.Audience), "oidc.audience", nil, "The audience for whom the access token is intended, see https://openid.net/specs/openid-connect-core-1_0.html#IDToken. Can be repeated for issuers requiring several audiences.")
+	cmd.Flags().StringVar(&oidcCfg.GrantType, "oidc.grant-type", config.GrantClientCredentials, "The OAuth 2.0 grant type tokens are obtained with. One of: "+strings.Join(config.GrantTypes, "|")+". With device-code and authorization-code, a user logs in interactively, see above.")
+	cmd.Flags().BoolVar(&web, "web", false, "Log in with the browser, see above.")
+	cmd.Flags().StringVar(&webListen, "web.listen", config.DefaultWebListen, "Loopback address of the local listener receiving the result of --web logins. The redirect URL registered for the OIDC client must be http://<address>/callback, issuers usually allow any port of loopback addresses. It is kept for logging in again.")
+	cmd.Flags().StringArrayVar(&endpointParams, "oidc.endpoint-param", nil, "Additional parameter of token requests as key=value, e.g. resource=https://observatorium.example.com. Can be repeated.")
+
+	_ = cmd.MarkFlagRequired("tenant")
+	_ = cmd.MarkFlagRequired("api")
 
 	return cmd
 }
+
+// openBrowser opens url in the default browser of the user.
+func openBrowser(url string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("open", url)
+	case "windows":
+		c = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		c = exec.Command("xdg-open", url)
+	}
+	return c.Start()
+}
+
+// printLoginHint explains how to log in again, if err was caused by rejected credentials or an
+// expired login and the user is at a terminal to do so. The hint depends on the credentials of the
+// context, and users of interactive grants are offered to log in again right away.
+func printLoginHint(ctx context.Context, w io.Writer, err error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return
+	}
+
+	var c config.Context
+	var aerr *fetcher.AuthError
+	switch {
+	case errors.As(err, &aerr):
+		c = aerr.Context
+		fmt.Fprintf(w, "The credentials of context %s were rejected, even after fetching a new token.\n", c)
+	case errors.Is(err, config.ErrLoginRequired):
+		fmt.Fprintln(w, "The login expired and can't be renewed without logging in again.")
+	default:
+		return
+	}
+
+	cfg, err := config.Read(logger)
+	if err != nil {
+		return
+	}
+	if c == (config.Context{}) {
+		c = cfg.Current
+	}
+	_, t, err := cfg.GetContext(c)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case t.OIDC != nil && t.OIDC.Interactive():
+		if !ask(w, fmt.Sprintf("Log in to context %s again now?", c)) {
+			fmt.Fprintf(w, "To log in again, run:\n  obsctl login --api %s --tenant %s --force\n", c.API, c.Tenant)
+			return
+		}
+		if err := relogin(ctx, w, c, *t.OIDC); err != nil {
+			level.Error(logger).Log("msg", "failed to log in again", "context", c, "err", err)
+			return
+		}
+		fmt.Fprintln(w, "Logged in again, run the command again.")
+	case t.OIDC != nil:
+		// The client secret was likely rotated.
+		fmt.Fprintf(w, "To log in again with a new client secret, run:\n  obsctl login --api %s --tenant %s --oidc.issuer-url=%s --oidc.client-id=%s --oidc.client-secret=... --force\n",
+			c.API, c.Tenant, t.OIDC.IssuerURL, t.OIDC.ClientID)
+	case t.TokenFile != "":
+		fmt.Fprintf(w, "Check the token in %s, which is read again on every request, or log in with other credentials, see 'obsctl login --help'.\n", t.TokenFile)
+	case t.TLSCert != "":
+		fmt.Fprintf(w, "Check the client certificate %s, or log in with another one, run:\n  obsctl login --api %s --tenant %s --tls.cert=... --tls.key=...\n", t.TLSCert, c.API, c.Tenant)
+	default:
+		fmt.Fprintf(w, "To log in, run:\n  obsctl login --api %s --tenant %s --oidc.issuer-url=... --oidc.client-id=... --oidc.client-secret=...\n", c.API, c.Tenant)
+	}
+}
+
+// relogin logs in to the context again with the interactive grant of o, its stored OIDC config, and
+// saves the new token.
+func relogin(ctx context.Context, w io.Writer, c config.Context, o config.OIDCConfig) error {
+	o.Token = nil
+	var err error
+	if o.GrantType == config.GrantAuthorizationCode {
+		err = o.WebLogin(ctx, w, openBrowser)
+	} else {
+		err = o.DeviceLogin(ctx, w)
+	}
+	if err != nil {
+		return err
+	}
+
+	return config.Update(ctx, logger, func(cfg *config.Config) error {
+		_, t, err := cfg.GetContext(c)
+		if err != nil {
+			return err
+		}
+		if t.OIDC == nil {
+			return fmt.Errorf("context %s no longer uses OIDC", c)
+		}
+		t.OIDC.Token = o.Token
+		return cfg.UpdateTenant(c.API, t)
+	})
+}
+
+// ensureAPI returns the name of the API referenced by nameOrURL, adding it to the config if it's a new URL.
+// APIs added by URL are named after their host.
+func ensureAPI(cfg *config.Config, nameOrURL string) (string, error) {
+	if _, ok := cfg.APIs[nameOrURL]; ok {
+		return nameOrURL, nil
+	}
+
+	u, err := url.Parse(nameOrURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%s is neither a configured API name nor a valid URL", nameOrURL)
+	}
+
+	for name, a := range cfg.APIs {
+		if a.URL == nameOrURL {
+			return name, nil
+		}
+	}
+
+	if err := cfg.AddAPI(logger, u.Host, nameOrURL); err != nil {
+		return "", err
+	}
+
+	return u.Host, nil
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+func NewLogoutCmd(ctx context.Context) *cobra.Command {
+	var deleteContext bool
+
+	cmd := &cobra.Command{
+		Use:   "logout [<api>/<tenant>]",
+		Short: "Logout of a tenant, revoking and removing its token.",
+		Long: `Logout of a tenant, the current context unless another one is given. The stored token is revoked
+at the OIDC issuer if it supports token revocation, the refresh token if there is one, and removed
+from the config file, along with the tokens of all contexts sharing it.
+
+Contexts authenticating with client credentials fetch a new token when they are used again, as
+their client secret is kept. Remove the context entirely, with its secret, with --delete-context.`,
+		Example: `obsctl logout
+obsctl logout prod/team-a --delete-context`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeContexts,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var c config.Context
+			// Don't race other processes refreshing the token being removed.
+			err := config.Update(ctx, logger, func(cfg *config.Config) error {
+				c = cfg.Current
+				if len(args) == 1 {
+					var err error
+					if c, err = parseContext(args[0]); err != nil {
+						return err
+					}
+				} else if _, _, err := cfg.GetCurrent(); err != nil {
+					return err
+				}
+
+				_, t, err := cfg.GetContext(c)
+				if err != nil {
+					return err
+				}
+
+				if t.OIDC != nil && t.OIDC.Token != nil {
+					if err := t.OIDC.Revoke(ctx); errors.Is(err, config.ErrRevocationUnsupported) {
+						level.Warn(logger).Log("msg", "the OIDC issuer does not support token revocation, the token stays valid until it expires", "context", c)
+					} else if err != nil {
+						level.Warn(logger).Log("msg", "revoking token failed, the token stays valid until it expires", "context", c, "err", err)
+					} else {
+						level.Info(logger).Log("msg", "revoked token", "context", c)
+					}
+					cfg.ShareToken(t.OIDC, nil)
+				}
+
+				if deleteContext {
+					return cfg.RemoveTenant(logger, c.API, c.Tenant)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if deleteContext {
+				level.Info(logger).Log("msg", "logged out and deleted context", "context", c)
+			} else {
+				level.Info(logger).Log("msg", "logged out", "context", c)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&deleteContext, "delete-context", false, "Also remove the context from the config file, with its credentials.")
+
+	return cmd
+}
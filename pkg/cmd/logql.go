@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/observatorium/obsctl/pkg/logql"
+	"github.com/spf13/cobra"
+)
+
+func NewLogQLCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logql",
+		Short: "Format, check and explain LogQL expressions offline.",
+		Long:  "Format, check and explain LogQL expressions offline. No context is needed.",
+	}
+
+	fmtCmd := &cobra.Command{
+		Use:     "fmt <expr>",
+		Short:   "Pretty-print a LogQL expression.",
+		Long:    "Pretty-print a LogQL expression, splitting long expressions and pipelines over multiple lines.",
+		Example: `obsctl logql fmt 'sum by(app)(rate({namespace="prod"}|="error"|json|status>=500[5m]))'`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := logql.Format(args[0])
+			if err != nil {
+				return promqlError(err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), s)
+			return nil
+		},
+	}
+
+	checkCmd := &cobra.Command{
+		Use:     "check <expr>",
+		Short:   "Check the syntax of a LogQL expression.",
+		Long:    "Check the syntax of a LogQL expression, reporting errors with their position.",
+		Example: `obsctl logql check '{app="api"} |= "error" | json'`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := logql.Parse(args[0]); err != nil {
+				return promqlError(err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "ok")
+			return nil
+		},
+	}
+
+	explainCmd := &cobra.Command{
+		Use:   "explain <expr>",
+		Short: "Explain the structure of a LogQL expression.",
+		Long: `Explain the structure of a LogQL expression: whether it is a log query returning streams or a
+metric query returning samples, its syntax tree, and the stream selectors it queries with their
+line filters, parsers, label filters and ranges.`,
+		Example: `obsctl logql explain 'sum by(app)(count_over_time({namespace="prod"} |= "error" | logfmt | level="error" [5m]))'`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return promqlError(logql.Explain(cmd.OutOrStdout(), args[0]))
+		},
+	}
+
+	cmd.AddCommand(fmtCmd)
+	cmd.AddCommand(checkCmd)
+	cmd.AddCommand(explainCmd)
+
+	return cmd
+}
@@ -0,0 +1,514 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/logpattern"
+	"github.com/observatorium/obsctl/pkg/logql"
+	"github.com/observatorium/obsctl/pkg/units"
+	"github.com/spf13/cobra"
+)
+
+func NewLogsCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Logs based operations for Observatorium.",
+		Long:  "Logs based operations for Observatorium.",
+	}
+
+	cmd.AddCommand(NewLogsGetCmd(ctx))
+	cmd.AddCommand(NewLogsQueryCmd(ctx))
+	cmd.AddCommand(NewLogsTailCmd(ctx))
+
+	return cmd
+}
+
+func NewLogsGetCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "Read labels, series, rules & the structure of logs of a tenant.",
+		Long:  "Read labels, series, rules & the structure of logs of a tenant.",
+	}
+	addOutputFlag(cmd.PersistentFlags())
+
+	logs := func() (fetcher.Signal, error) { return fetcher.Logs, nil }
+	for _, r := range resources() {
+		cmd.AddCommand(newResourceCmd(ctx, r, logs))
+	}
+
+	var start, end string
+
+	patternsCmd := &cobra.Command{
+		Use:   "patterns <selector>",
+		Short: "Get the patterns of log lines of a tenant.",
+		Long: `Get the patterns detected in the log lines matching a LogQL stream selector, with the number of
+matching lines, most frequent first. Useful to discover the structure of logs before writing LogQL.
+Requires a Loki with pattern ingestion enabled.`,
+		Example: `obsctl logs get patterns '{app="api"}' --start=-6h`,
+		Args:    cobra.ExactArgs(1),
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+			params, err := logsRangeParams(args[0], start, end)
+			if err != nil {
+				return err
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			indicator.Start("Fetching patterns", 0)
+			patterns, err := f.Patterns(ctx, params)
+			indicator.Stop()
+			if err != nil {
+				return unsupportedLogsEndpoint(err, "patterns")
+			}
+
+			sort.SliceStable(patterns, func(i, j int) bool { return patterns[i].Total() > patterns[j].Total() })
+			return p.Print(cmd.OutOrStdout(), patterns, func() ([]string, [][]string) {
+				rows := make([][]string, 0, len(patterns))
+				for _, p := range patterns {
+					rows = append(rows, []string{strconv.FormatInt(p.Total(), 10), p.Pattern})
+				}
+				return []string{"LINES", "PATTERN"}, rows
+			})
+		}),
+	}
+
+	detectedFieldsCmd := &cobra.Command{
+		Use:   "detected-fields <query>",
+		Short: "Get the fields detected in log lines of a tenant.",
+		Long: `Get the fields Loki detects in the log lines matching a LogQL query, e.g. logfmt keys or JSON
+attributes, with their type, cardinality and the parsers extracting them. Useful to discover the
+structure of logs before writing LogQL. Requires Loki 3.0 or later.`,
+		Example: `obsctl logs get detected-fields '{app="api"}' --start=-1h`,
+		Args:    cobra.ExactArgs(1),
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+			params, err := logsRangeParams(args[0], start, end)
+			if err != nil {
+				return err
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			indicator.Start("Fetching detected fields", 0)
+			fields, err := f.DetectedFields(ctx, params)
+			indicator.Stop()
+			if err != nil {
+				return unsupportedLogsEndpoint(err, "detected fields")
+			}
+
+			sort.SliceStable(fields, func(i, j int) bool { return fields[i].Label < fields[j].Label })
+			return p.Print(cmd.OutOrStdout(), fields, func() ([]string, [][]string) {
+				rows := make([][]string, 0, len(fields))
+				for _, f := range fields {
+					rows = append(rows, []string{f.Label, f.Type, strconv.FormatUint(f.Cardinality, 10), strings.Join(f.Parsers, ",")})
+				}
+				return []string{"FIELD", "TYPE", "CARDINALITY", "PARSERS"}, rows
+			})
+		}),
+	}
+
+	for _, c := range []*cobra.Command{patternsCmd, detectedFieldsCmd} {
+		c.Flags().StringVar(&start, "start", "", "Start of the time range, as RFC3339 or Unix timestamp, or relative to now like -6h. Defaults to the default range of the current context before --end.")
+		c.Flags().StringVar(&end, "end", "now", "End of the time range, as RFC3339 or Unix timestamp, or relative to now.")
+		cmd.AddCommand(c)
+	}
+
+	return cmd
+}
+
+// logsQueryOutput configures how the result of a log query is printed.
+type logsQueryOutput struct {
+	// format is one of the output formats, json, jsonl or table.
+	format string
+	// dedup collapses runs of consecutive lines sharing a pattern, see logpattern.Dedup.
+	dedup bool
+	// patterns aggregates lines by pattern, see logpattern.Aggregate.
+	patterns bool
+}
+
+func NewLogsQueryCmd(ctx context.Context) *cobra.Command {
+	var start, end, at, direction string
+	var limit int
+	var out logsQueryOutput
+
+	cmd := &cobra.Command{
+		Use:   "query <logql>",
+		Short: "Query logs for a tenant.",
+		Long: `Query logs for a tenant. Pass a single valid LogQL log query to fetch the lines of, at most
+--limit lines over the time range between --start and --end.
+
+LogQL metric queries, e.g. sum by (level) (count_over_time({app="api"}[5m])), return series
+instead of lines, with a value per step over the time range. With --time, a metric query is
+evaluated at a single point in time instead, as instant query.
+
+Noisy output can be condensed by grouping near-identical lines, i.e. lines only differing in
+timestamps, UUIDs, IP addresses, hex IDs or numbers, which are replaced by <_> in patterns:
+
+  --dedup collapses runs of consecutive near-identical lines into their first line and a count,
+  keeping the order of lines, like uniq -c.
+  --patterns prints the number of lines per pattern instead of the lines, most frequent first.
+
+The jsonl format prints one JSON object per line and log entry, with its timestamp, stream labels
+and line, to pipe the output into jq or other stream processors. With --dedup or --patterns, one
+object per group of lines is printed instead.`,
+		Example: `obsctl logs query '{app="api"} |= "error"' --start=-30m -o table
+obsctl logs query '{app="api"}' --limit=5000 --patterns
+obsctl logs query '{app="api"}' -o jsonl | jq -r 'select(.labels.level == "error") | .line'
+obsctl logs query 'sum by (level) (count_over_time({app="api"}[5m]))' --time=now`,
+		Args: cobra.ExactArgs(1),
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			if out.dedup && out.patterns {
+				return fmt.Errorf("--dedup and --patterns are mutually exclusive")
+			}
+			switch out.format {
+			case outputJSON, outputJSONL, outputTable:
+			default:
+				return fmt.Errorf("unsupported output format %q", out.format)
+			}
+			if direction != "backward" && direction != "forward" {
+				return fmt.Errorf("invalid --direction %q, expected backward or forward", direction)
+			}
+
+			endpoint := "/query_range"
+			var params url.Values
+			var err error
+			if at != "" {
+				if cmd.Flags().Changed("start") || cmd.Flags().Changed("end") {
+					return errors.New("--time and --start or --end are mutually exclusive")
+				}
+				t, err := parseTime(at, time.Now())
+				if err != nil {
+					return fmt.Errorf("invalid --time: %w", err)
+				}
+				endpoint = "/query"
+				params = url.Values{"query": []string{args[0]}, "time": []string{fmt.Sprint(t.UnixNano())}}
+			} else if params, err = logsRangeParams(args[0], start, end); err != nil {
+				return err
+			}
+			params.Set("limit", strconv.Itoa(limit))
+			params.Set("direction", direction)
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			recordHistory(ctx, f, fetcher.Logs, args[0])
+
+			indicator.Start("Running query", 0)
+			data, err := f.Query(ctx, fetcher.Logs, endpoint, params)
+			indicator.Stop()
+			if err != nil {
+				return fmt.Errorf("querying logs: %w", err)
+			}
+
+			if data.ResultType != "streams" {
+				return printLogsMetrics(cmd.OutOrStdout(), data, args[0], out)
+			}
+			return printLogs(cmd.OutOrStdout(), data, out)
+		}),
+		ValidArgsFunction: completeQueryFromHistory(fetcher.Logs),
+	}
+
+	cmd.Flags().StringVar(&start, "start", "", "Start of the time range, as RFC3339 or Unix timestamp, or relative to now like -6h. Defaults to the default range of the current context before --end.")
+	cmd.Flags().StringVar(&end, "end", "now", "End of the time range, as RFC3339 or Unix timestamp, or relative to now.")
+	cmd.Flags().StringVar(&at, "time", "", "Evaluate a metric query at this time instead of over a time range, as RFC3339 or Unix timestamp, or relative to now.")
+	cmd.Flags().IntVar(&limit, "limit", 100, "Maximum number of lines to fetch, or of series returned by metric queries.")
+	cmd.Flags().StringVar(&direction, "direction", "backward", "Which lines to fetch if there are more than --limit. One of: backward|forward. With backward, the most recent lines are fetched.")
+	cmd.Flags().StringVarP(&out.format, "output", "o", outputTable, "Output format. One of: table|json|jsonl. The jsonl format prints one object per log entry, see above.")
+	cmd.Flags().BoolVar(&out.dedup, "dedup", false, "Collapse runs of consecutive near-identical lines into their first line and a count.")
+	cmd.Flags().BoolVar(&out.patterns, "patterns", false, "Print the number of lines per pattern of near-identical lines instead of the lines.")
+
+	return cmd
+}
+
+func NewLogsTailCmd(ctx context.Context) *cobra.Command {
+	var since time.Duration
+	var limit int
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "tail <logql>",
+		Short: "Follow the logs of a tenant live.",
+		Long: `Follow the logs of a tenant live, printing the lines matching a LogQL log query as they arrive
+until interrupted. Tailing starts with at most --limit of the lines of the last --since.
+
+If the connection to the API is lost, obsctl reconnects with an exponential backoff and resumes
+after the last line printed.
+
+The jsonl format prints one JSON object per line and log entry, with its timestamp, stream labels
+and line, like 'obsctl logs query -o jsonl'.`,
+		Example: `obsctl logs tail '{app="api"} |= "error"'
+obsctl logs tail '{namespace="prod"}' --since=5m --limit=10 -o jsonl`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != outputTable && output != outputJSONL {
+				return fmt.Errorf("unsupported output format %q", output)
+			}
+			if limit < 1 {
+				return fmt.Errorf("--limit must be at least 1, got %d", limit)
+			}
+			n, err := logql.Parse(args[0])
+			if err != nil {
+				return promqlError(err)
+			}
+			if logql.Type(n) != "streams" {
+				return errors.New("only log queries can be tailed, not metric queries")
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			recordHistory(ctx, f, fetcher.Logs, args[0])
+
+			return tailLogs(ctx, cmd.OutOrStdout(), f, args[0], time.Now().Add(-since), limit, output)
+		},
+		ValidArgsFunction: completeQueryFromHistory(fetcher.Logs),
+	}
+
+	cmd.Flags().Var(duration.NewValue(&since, time.Hour), "since", "How far back to start tailing, e.g. 5m.")
+	cmd.Flags().IntVar(&limit, "limit", 100, "Maximum number of lines from before tailing started to print.")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format. One of: table|jsonl.")
+
+	return cmd
+}
+
+// Backoff of reconnects of tailLogs.
+const (
+	minTailBackoff = time.Second
+	maxTailBackoff = 30 * time.Second
+)
+
+// tailLogs prints the lines of the log query from start on as they arrive, until ctx is done.
+// Lost connections are reestablished, resuming after the last line printed. Failing to connect
+// initially is an error, so that e.g. invalid credentials or queries are reported right away.
+func tailLogs(ctx context.Context, w io.Writer, f *fetcher.Fetcher, query string, start time.Time, limit int, output string) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	backoff := minTailBackoff
+	connected := false
+	for {
+		params := url.Values{
+			"query": []string{query},
+			"start": []string{fmt.Sprint(start.UnixNano())},
+			"limit": []string{strconv.Itoa(limit)},
+		}
+		// Errors printing lines are not retried.
+		var printErr error
+		err := f.Tail(ctx, params, func(msg fetcher.TailResponse) error {
+			backoff = minTailBackoff
+
+			if len(msg.DroppedEntries) > 0 {
+				level.Warn(logger).Log("msg", "lines were dropped by the API, as they arrived faster than they were received", "dropped", len(msg.DroppedEntries))
+			}
+
+			entries, err := msg.Entries()
+			if err != nil {
+				printErr = err
+				return err
+			}
+			for _, e := range entries {
+				if output == outputJSONL {
+					err = enc.Encode(e)
+				} else {
+					_, err = fmt.Fprintf(w, "%s  %s  %s\n", formatTime(e.Time), fetcher.FormatMetric(e.Labels), e.Line)
+				}
+				if err != nil {
+					printErr = err
+					return err
+				}
+				if e.Time.After(start) {
+					// Resume after the last line on reconnects.
+					start = e.Time.Add(time.Nanosecond)
+				}
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if printErr != nil {
+			return printErr
+		}
+		// Only lost connections and failures to reconnect are retried. Errors setting up connections,
+		// e.g. of credentials or certificates, won't go away by retrying.
+		var rerr *fetcher.ReceiveError
+		var cerr *fetcher.ConnectError
+		switch {
+		case errors.As(err, &rerr):
+			connected = true
+		case errors.As(err, &cerr) && connected:
+		default:
+			return fmt.Errorf("tailing logs: %w", err)
+		}
+
+		level.Warn(logger).Log("msg", "tailing logs failed, reconnecting", "in", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxTailBackoff {
+			backoff = maxTailBackoff
+		}
+	}
+}
+
+// printLogs prints the result of a log query, ordered by time.
+func printLogs(w io.Writer, data *fetcher.QueryData, out logsQueryOutput) error {
+	entries, err := data.Entries()
+	if err != nil {
+		return err
+	}
+
+	if !out.dedup && !out.patterns {
+		switch out.format {
+		case outputJSON:
+			return json.NewEncoder(w).Encode(data)
+		case outputJSONL:
+			enc := json.NewEncoder(w)
+			// Log lines are printed as they are, not escaped for embedding in HTML.
+			enc.SetEscapeHTML(false)
+			for _, e := range entries {
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tSTREAM\tLINE")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", formatTime(e.Time), fetcher.FormatMetric(e.Labels), e.Line)
+		}
+		return tw.Flush()
+	}
+
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		lines = append(lines, e.Line)
+	}
+
+	if out.patterns {
+		groups := logpattern.Aggregate(lines)
+		switch out.format {
+		case outputJSON:
+			return json.NewEncoder(w).Encode(groups)
+		case outputJSONL:
+			return writeGroupsJSONL(w, groups)
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "LINES\tPATTERN")
+		for _, g := range groups {
+			fmt.Fprintf(tw, "%d\t%s\n", g.Count, g.Pattern)
+		}
+		return tw.Flush()
+	}
+
+	groups := logpattern.Dedup(lines)
+	switch out.format {
+	case outputJSON:
+		return json.NewEncoder(w).Encode(groups)
+	case outputJSONL:
+		return writeGroupsJSONL(w, groups)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tCOUNT\tSTREAM\tLINE")
+	// The runs are consecutive, so the first entry of each run follows the entries of all previous runs.
+	first := 0
+	for _, g := range groups {
+		e := entries[first]
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", formatTime(e.Time), g.Count, fetcher.FormatMetric(e.Labels), e.Line)
+		first += g.Count
+	}
+	return tw.Flush()
+}
+
+// printLogsMetrics prints the series returned by a LogQL metric query.
+func printLogsMetrics(w io.Writer, data *fetcher.QueryData, query string, out logsQueryOutput) error {
+	if out.dedup || out.patterns {
+		return errors.New("--dedup and --patterns are only supported for log queries, not metric queries")
+	}
+
+	switch out.format {
+	case outputJSON:
+		return json.NewEncoder(w).Encode(data)
+	case outputJSONL:
+		series, err := data.Series()
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		for _, s := range series {
+			if err := enc.Encode(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return printQueryDataTable(w, data, query, units.None)
+}
+
+// writeGroupsJSONL writes each group of lines as JSON object on its own line.
+func writeGroupsJSONL(w io.Writer, groups []logpattern.Group) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, g := range groups {
+		if err := enc.Encode(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logsRangeParams returns the parameters of a LogQL query over a time range, in Unix nanoseconds as preferred by Loki.
+func logsRangeParams(query, start, end string) (url.Values, error) {
+	s, e, err := parseTimeRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"query": []string{query},
+		"start": []string{fmt.Sprint(s.UnixNano())},
+		"end":   []string{fmt.Sprint(e.UnixNano())},
+	}, nil
+}
+
+// unsupportedLogsEndpoint explains errors of backends not serving an endpoint of newer Loki versions.
+func unsupportedLogsEndpoint(err error, what string) error {
+	var serr *fetcher.StatusError
+	if errors.As(err, &serr) && serr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("getting %s: the logs backend of the current context does not support %s: %w", what, what, err)
+	}
+	return fmt.Errorf("getting %s: %w", what, err)
+}
@@ -2,8 +2,31 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/diff"
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/fanout"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/grafana"
+	"github.com/observatorium/obsctl/pkg/printer"
+	"github.com/observatorium/obsctl/pkg/promql"
+	"github.com/observatorium/obsctl/pkg/tui"
+	"github.com/observatorium/obsctl/pkg/units"
 	"github.com/spf13/cobra"
 )
 
@@ -12,56 +35,119 @@ func NewMetricsGetCmd(ctx context.Context) *cobra.Command {
 		Use:   "get",
 		Short: "Read series, labels & rules (JSON/YAML) of a tenant.",
 		Long:  "Read series, labels & rules (JSON/YAML) of a tenant.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "get called")
-		},
 	}
+	addOutputFlag(cmd.PersistentFlags())
+
+	var matchers, dedupBy []string
+	var start, end string
 
 	seriesCmd := &cobra.Command{
 		Use:   "series",
 		Short: "Get series of a tenant.",
-		Long:  "Get series of a tenant..",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "series called")
-		},
+		Long: `Get series of a tenant matching the given selectors, one label set per line. Series are printed as they are received, so even millions of them can be exported.
+
+Only series with samples between --start and --end are returned. Without them, the API's default
+time range is used, which may be all data it has.`,
+		Example: `obsctl metrics get series --match='up{job="prometheus"}' --out series.txt
+obsctl metrics get series --match='{namespace="prod"}' --start=-1h
+obsctl metrics get series --match='{namespace="prod"}' -o json`,
+		Args: cobra.NoArgs,
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			params := url.Values{"match[]": matchers}
+			if err := timeBoundParams(params, start, end); err != nil {
+				return err
+			}
+
+			seen := map[string]struct{}{}
+			return streamList(ctx, cmd, fetcher.Metrics, "/series", params, func(raw json.RawMessage) (interface{}, string, bool, error) {
+				lset, err := decodeSeries(raw)
+				if err != nil {
+					return nil, "", false, err
+				}
+				if len(dedupBy) == 0 {
+					return lset, fetcher.FormatMetric(lset), true, nil
+				}
+
+				lset = fetcher.WithoutLabels(lset, dedupBy)
+				s := fetcher.FormatMetric(lset)
+				if _, ok := seen[s]; ok {
+					return nil, "", false, nil
+				}
+				seen[s] = struct{}{}
+				return lset, s, true, nil
+			})
+		}),
+	}
+	seriesCmd.Flags().StringArrayVar(&matchers, "match", nil, "Series selector of the series to get. Can be repeated.")
+	seriesCmd.Flags().StringSliceVar(&dedupBy, "dedup-by", nil, "Replica labels by which to deduplicate series client-side, e.g. replica,prometheus_replica.")
+	seriesCmd.Flags().StringVar(&start, "start", "", "Start of the time range of the series, as RFC3339 or Unix timestamp, or relative to now like -1h.")
+	seriesCmd.Flags().StringVar(&end, "end", "", "End of the time range of the series, in the same formats as --start.")
+	_ = seriesCmd.MarkFlagRequired("match")
+
+	// labelParams returns the parameters of the labels and label values endpoints.
+	labelParams := func() (url.Values, error) {
+		params := url.Values{}
+		if len(matchers) > 0 {
+			params["match[]"] = matchers
+		}
+		if err := timeBoundParams(params, start, end); err != nil {
+			return nil, err
+		}
+		return params, nil
 	}
 
 	labelsCmd := &cobra.Command{
 		Use:   "labels",
 		Short: "Get labels of a tenant.",
-		Long:  "Get labels of a tenant.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "labels called")
-		},
+		Long: `Get label names of a tenant, one per line.
+
+With --match, only the labels of series matching any of the selectors are returned, and with
+--start and --end only those of series with samples in that time range.`,
+		Example: `obsctl metrics get labels --match='{job="prometheus"}' --start=-1h`,
+		Args:    cobra.NoArgs,
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			params, err := labelParams()
+			if err != nil {
+				return err
+			}
+			return streamList(ctx, cmd, fetcher.Metrics, "/labels", params, decodeString)
+		}),
 	}
 
 	labelValuesCmd := &cobra.Command{
-		Use:   "labelvalues",
+		Use:   "labelvalues <label>",
 		Short: "Get label values of a tenant.",
-		Long:  "Get label values of a tenant.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "label values called")
-		},
-	}
+		Long: `Get the values of a label of a tenant, one per line. Values are printed as they are received, so even millions of them can be exported.
 
-	rulesCmd := &cobra.Command{
-		Use:   "rules",
-		Short: "Get rules of a tenant.",
-		Long:  "Get rules of a tenant.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "rules called")
-		},
+With --match, only the values of series matching any of the selectors are returned, and with
+--start and --end only those of series with samples in that time range.`,
+		Example: `obsctl metrics get labelvalues pod --out pods.txt
+obsctl metrics get labelvalues pod --match='{namespace="prod"}' --start=-1h`,
+		Args: cobra.ExactArgs(1),
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			params, err := labelParams()
+			if err != nil {
+				return err
+			}
+			return streamList(ctx, cmd, fetcher.Metrics, "/label/"+url.PathEscape(args[0])+"/values", params, decodeString)
+		}),
 	}
 
-	rulesRawCmd := &cobra.Command{
-		Use:   "rules.raw",
-		Short: "Get configured rules of a tenant.",
-		Long:  "Get configured rules of a tenant.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "rules.raw called")
-		},
+	for _, c := range []*cobra.Command{labelsCmd, labelValuesCmd} {
+		c.Flags().StringArrayVar(&matchers, "match", nil, "Series selector restricting the series whose labels are returned. Can be repeated.")
+		c.Flags().StringVar(&start, "start", "", "Start of the time range of the series, as RFC3339 or Unix timestamp, or relative to now like -1h.")
+		c.Flags().StringVar(&end, "end", "", "End of the time range of the series, in the same formats as --start.")
 	}
 
+	metrics := func() (fetcher.Signal, error) { return fetcher.Metrics, nil }
+	registerSelectorCompletion(ctx, seriesCmd, metrics)
+	registerSelectorCompletion(ctx, labelsCmd, metrics)
+	registerSelectorCompletion(ctx, labelValuesCmd, metrics)
+	labelValuesCmd.ValidArgsFunction = completeLabelNames(ctx, metrics)
+
+	rulesCmd := newResourceCmd(ctx, resourceByName("rules"), metrics)
+	rulesRawCmd := newResourceCmd(ctx, resourceByName("rules.raw"), metrics)
+
 	cmd.AddCommand(seriesCmd)
 	cmd.AddCommand(labelsCmd)
 	cmd.AddCommand(labelValuesCmd)
@@ -72,48 +158,866 @@ func NewMetricsGetCmd(ctx context.Context) *cobra.Command {
 }
 
 func NewMetricsSetCmd(ctx context.Context) *cobra.Command {
+	var ruleFiles []string
+	var workers int
+	var verifyKey, namespace string
+	var dryRun bool
+
 	cmd := &cobra.Command{
 		Use:   "set",
 		Short: "Write Prometheus Rules configuration for a tenant.",
-		Long:  "Write Prometheus Rules configuration for a tenant.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "set called")
+		Long: `Write Prometheus Rules configuration for a tenant.
+
+The given rules replace all rules currently configured for the tenant. The changes are shown
+and have to be confirmed before they are applied, unless --yes is given.
+
+Every file has to be valid Prometheus rule groups, with valid PromQL expressions, labels and
+annotation templates. Nothing is uploaded if any file is invalid. Problems are reported with the
+file and line they are found at. With --dry-run, the files are only validated, without contacting
+the API.
+
+--rule.file can be repeated and also accepts directories, in which case all *.yaml and *.yml
+files in them are uploaded. As Observatorium APIs replace all rules of a tenant at once, the rule
+groups of multiple files are merged into a single rule file, whose group names have to be unique,
+and set in one request.
+
+With --verify.key, or if the rules policy of the current context requires signatures, see
+'obsctl context rules-policy', every rule file needs a valid detached signature in <file>.sig or
+<file>.minisig. Nothing is uploaded if any file is unsigned or wrongly signed.
+
+For Cortex and Mimir APIs, see 'obsctl context api --flavor', every file replaces the rule groups of
+a namespace of the ruler API instead of all rules of the tenant, groups no longer in the file being
+deleted. The namespace is the name of the file without extension, unless set with --namespace.
+Multiple files are then uploaded concurrently, each to its namespace, and the result of every
+upload is reported.`,
+		Example: `obsctl metrics set --rule.file=rules.yaml
+obsctl metrics set --rule.file=rules/ --workers=8
+obsctl metrics set --rule.file=rules.yaml --verify.key=cosign.pub
+obsctl metrics set --rule.file=rules/ --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, err := expandRuleFiles(ruleFiles)
+			if err != nil {
+				return err
+			}
+
+			if workers < 1 {
+				return fmt.Errorf("--workers must be at least 1, got %d", workers)
+			}
+			if namespace != "" && len(files) > 1 {
+				return errors.New("--namespace can only be used with a single rule file")
+			}
+
+			if err := checkRuleFiles(files); err != nil {
+				return err
+			}
+
+			verifier, err := newRulesVerifier(verifyKey)
+			if err != nil {
+				return err
+			}
+			if err := verifier.verifyFiles(files); err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Fprintln(cmd.OutOrStdout(), "All rule files are valid, nothing was uploaded.")
+				return nil
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			if f.Flavor() != config.FlavorCortex {
+				rules, err := mergeRuleFiles(files, verifier)
+				if err != nil {
+					return err
+				}
+				return setRules(ctx, cmd, f, rules, "")
+			}
+
+			if len(files) == 1 {
+				rules, err := readRuleFile(files[0], verifier)
+				if err != nil {
+					return err
+				}
+				if namespace == "" {
+					namespace = ruleNamespace(files[0])
+				}
+				return setRules(ctx, cmd, f, rules, namespace)
+			}
+
+			if err := confirm(cmd, fmt.Sprintf("Rules of tenant %s in the namespaces of %d files will be replaced:\n  %s", f.Tenant(), len(files), strings.Join(files, "\n  "))); err != nil {
+				return err
+			}
+
+			return uploadRuleFiles(ctx, cmd.OutOrStdout(), f, files, workers, verifier)
 		},
 	}
 
-	cmd.Flags().String("rule.file", "", "Path to Rules configuration file, which will be set for a tenant.")
+	cmd.Flags().StringArrayVar(&ruleFiles, "rule.file", nil, "Path to Rules configuration file or directory of files, which will be set for a tenant. Can be repeated.")
+	cmd.Flags().IntVar(&workers, "workers", 4, "Number of rule files uploaded concurrently to Cortex APIs.")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Namespace of the rules of Cortex APIs. Defaults to the name of the rule file without extension.")
+	cmd.Flags().StringVar(&verifyKey, "verify.key", "", "Path of a public key every rule file has to be signed with, PEM-encoded for cosign signatures or a minisign public key.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only validate the rule files, without uploading them.")
+	_ = cmd.MarkFlagRequired("rule.file")
 
 	return cmd
 }
 
+// expandRuleFiles returns the given paths with directories replaced by the YAML files they contain.
+func expandRuleFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading rule file: %w", err)
+		}
+
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading rule directory: %w", err)
+		}
+
+		var n int
+		for _, e := range entries {
+			if ext := filepath.Ext(e.Name()); !e.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				files = append(files, filepath.Join(p, e.Name()))
+				n++
+			}
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("rule directory %s contains no *.yaml or *.yml files", p)
+		}
+	}
+	return files, nil
+}
+
+// ruleNamespace returns the namespace of the rules of a file for Cortex APIs: its name without extension.
+func ruleNamespace(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// checkRuleFiles returns an error listing all problems of the files that are not valid Prometheus
+// rule groups, located by file and line.
+func checkRuleFiles(files []string) error {
+	var problems []string
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("reading rule file: %w", err)
+		}
+		for _, err := range promql.CheckRules(b) {
+			var rerr *promql.RuleError
+			if errors.As(err, &rerr) {
+				problems = append(problems, fmt.Sprintf("%s:%d: %s", file, rerr.Line, rerr.Err))
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("%s: %s", file, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid rule files:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// readRuleFile reads a rule file and verifies its signature, as the file could have changed since
+// it was verified.
+func readRuleFile(file string, verifier rulesVerifier) ([]byte, error) {
+	rules, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading rule file: %w", err)
+	}
+	if err := verifier.verify(file, rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// mergeRuleFiles reads the rule files and merges them into a single rule file, see
+// fetcher.MergeRules. A single file is kept as it is.
+func mergeRuleFiles(files []string, verifier rulesVerifier) ([]byte, error) {
+	contents := make([][]byte, 0, len(files))
+	for _, file := range files {
+		rules, err := readRuleFile(file, verifier)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, rules)
+	}
+	if len(contents) == 1 {
+		return contents[0], nil
+	}
+	return fetcher.MergeRules(files, contents)
+}
+
+// setRules replaces the rules of the tenant, or of the namespace for Cortex APIs, with the given
+// rules, after confirming the changes.
+func setRules(ctx context.Context, cmd *cobra.Command, f *fetcher.Fetcher, rules []byte, namespace string) error {
+	current, err := f.CurrentRules(ctx, namespace)
+	if err != nil {
+		return fmt.Errorf("getting current rules: %w", err)
+	}
+
+	changes := diff.Lines(string(current), string(rules))
+	if changes == "" {
+		level.Info(logger).Log("msg", "rules are unchanged", "tenant", f.Tenant())
+		return nil
+	}
+
+	if err := confirm(cmd, fmt.Sprintf("Rules of tenant %s will be replaced:\n%s", f.Tenant(), strings.TrimSuffix(changes, "\n"))); err != nil {
+		return err
+	}
+
+	resp, err := f.SetRules(ctx, namespace, rules)
+	if err != nil {
+		return fmt.Errorf("setting rules: %w", err)
+	}
+
+	level.Info(logger).Log("msg", "set rules", "tenant", f.Tenant(), "response", strings.TrimSpace(string(resp)))
+	return nil
+}
+
+// uploadRuleFiles uploads the rule files to their namespaces of a Cortex API with the given number
+// of concurrent workers and prints the result of each upload, in the order of files.
+func uploadRuleFiles(ctx context.Context, w io.Writer, f *fetcher.Fetcher, files []string, workers int, verifier rulesVerifier) error {
+	tasks := make([]fanout.Task, 0, len(files))
+	for _, file := range files {
+		file := file
+		tasks = append(tasks, fanout.Task{
+			Name:  file,
+			Group: f.Context().API,
+			Run:   func(ctx context.Context) error { return uploadRuleFile(ctx, f, file, verifier) },
+		})
+	}
+
+	indicator.Start("Uploading rule files", len(tasks))
+	results := newPool(workers, 0).Run(ctx, tasks)
+	indicator.Stop()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tSTATUS\tDETAIL")
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(tw, "%s\tfailed\t%s\n", r.Name, r.Err)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\tok\t\n", r.Name)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if err := fanout.Err(results); err != nil {
+		return fmt.Errorf("uploading rule files: %w", err)
+	}
+	return nil
+}
+
+func uploadRuleFile(ctx context.Context, f *fetcher.Fetcher, file string, verifier rulesVerifier) error {
+	rules, err := readRuleFile(file, verifier)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.SetRules(ctx, ruleNamespace(file), rules); err != nil {
+		return fmt.Errorf("setting rules: %w", err)
+	}
+	return nil
+}
+
+const (
+	outputJSON       = "json"
+	outputJSONL      = "jsonl"
+	outputLink       = "link"
+	outputName       = "name"
+	outputTable      = "table"
+	outputTree       = "tree"
+	outputYAML       = "yaml"
+	outputHeatmap    = "heatmap"
+	outputHeatmapCSV = "heatmap.csv"
+)
+
+// queryOutput configures how query results are printed.
+type queryOutput struct {
+	format string
+	// unit is the unit values are formatted in with the table format, see units.Format.
+	unit string
+	// dedupBy are the replica labels by which series are deduplicated, see fetcher.Dedup.
+	dedupBy []string
+	// at is the evaluation time of the query, now if empty, see parseTime.
+	at string
+	// rng makes the query a range query from start to end with resolution step, see rangeQueryParams.
+	rng        bool
+	start, end string
+	step       time.Duration
+}
+
+// params returns the endpoint and parameters of the query.
+func (o queryOutput) params(query string) (string, url.Values, error) {
+	if o.rng {
+		params, err := rangeQueryParams(query, o.start, o.end, o.step)
+		return "/api/v1/query_range", params, err
+	}
+	params, err := instantQueryParams(query, o.at)
+	return "/api/v1/query", params, err
+}
+
 func NewMetricsQueryCmd(ctx context.Context) *cobra.Command {
+	var grafanaDatasource string
+	var allTenants, interactive, explain, analyze bool
+	var out queryOutput
+	// prompted is the query entered with --interactive.
+	var prompted string
+
 	cmd := &cobra.Command{
-		Use:     "query",
-		Short:   "Query metrics for a tenant.",
-		Long:    "Query metrics for a tenant. Pass a single valid PromQL query to fetch results for.",
-		Example: `obsctl query "prometheus_http_request_total"`,
-		Args:    cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "query called")
+		Use:   "query",
+		Short: "Query metrics for a tenant.",
+		Long: `Query metrics for a tenant. Pass a single valid PromQL query to fetch results for.
+
+With --all-tenants, the query is run against every configured context, see --concurrency and
+--tenant.timeout. The json format then prints one object per context and line.
+
+With --interactive, the query is edited in a prompt completing metric names, label names and
+label values of the current context. A query passed as argument is the prompt's initial text.
+
+The heatmap format runs the query as range query over the default range of the current context
+(see 'obsctl context defaults') up to --time, or between --start and --end at the resolution of
+--step if given, and renders the distribution of classic histogram buckets over time, one row per
+le bucket. Pass a query over _bucket series like
+'sum by (le) (rate(http_request_duration_seconds_bucket[5m]))'. The heatmap.csv format exports
+the same matrix of per-bucket values as CSV.
+
+With --range, the query is run as range query between --start and --end, returning the samples of
+every series at the resolution of --step. The table format then prints a row per sample.
+
+With --explain, the query is not run but the plan of operators it would be executed with is
+printed as tree. --analyze runs the query and prints its plan with the execution time and the
+peak and total number of samples of every operator, instead of the result, which helps finding
+the expensive parts of slow queries. With -o json, the plan is printed as returned by the API.
+Both need Thanos with the Thanos PromQL engine.`,
+		Example: `obsctl metrics query "prometheus_http_request_total"
+obsctl metrics query --all-tenants -o table "sum(up)"
+obsctl metrics query --range --start=-1h --step=5m -o table 'sum by (job) (up)'
+obsctl metrics query -i -o table
+obsctl metrics query -o heatmap 'sum by (le) (rate(http_request_duration_seconds_bucket[5m]))'
+obsctl metrics query --analyze 'sum by (job) (rate(http_requests_total[5m]))'
+obsctl metrics query -o go-template='{{range .data.result}}{{.metric.instance}}{{"\n"}}{{end}}' up`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if interactive {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
 		},
+		// The prompt is shown once, before the query is possibly re-executed with --watch.
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if !interactive {
+				return nil
+			}
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+			var initial string
+			if len(args) > 0 {
+				initial = args[0]
+			}
+			prompted, err = tui.Prompt(ctx, f, initial)
+			return err
+		},
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			if prompted != "" {
+				args = []string{prompted}
+			}
+
+			rangeFlags := cmd.Flags().Changed("start") || cmd.Flags().Changed("end") || cmd.Flags().Changed("step")
+			heatmap := out.format == outputHeatmap || out.format == outputHeatmapCSV
+			if heatmap && rangeFlags {
+				// Heatmaps are range queries anyway.
+				out.rng = true
+			}
+
+			if out.rng {
+				if cmd.Flags().Changed("time") {
+					return fmt.Errorf("--time is not supported with --range or --start, --end and --step, use --start and --end")
+				}
+				if out.format != outputJSON && out.format != outputTable && out.format != outputLink && !heatmap && !printer.IsGoTemplate(out.format) {
+					return fmt.Errorf("output format %q is not supported with --range", out.format)
+				}
+				if explain || analyze {
+					return fmt.Errorf("--explain and --analyze are not supported with --range")
+				}
+			} else if rangeFlags {
+				return fmt.Errorf("--start, --end and --step require --range")
+			}
+
+			if explain || analyze {
+				if explain && analyze {
+					return fmt.Errorf("--explain and --analyze are mutually exclusive")
+				}
+				if allTenants {
+					return fmt.Errorf("--explain and --analyze are not supported with --all-tenants")
+				}
+				asJSON := cmd.Flags().Changed("output") && out.format == outputJSON
+				if !asJSON && cmd.Flags().Changed("output") && out.format != outputTable {
+					return fmt.Errorf("output format %q is not supported with --explain and --analyze", out.format)
+				}
+				return runMetricsQueryPlan(ctx, cmd.OutOrStdout(), args[0], out.at, analyze, asJSON)
+			}
+
+			switch out.format {
+			case outputJSON, outputTable:
+			case outputHeatmap, outputHeatmapCSV:
+				if allTenants {
+					return fmt.Errorf("output format %q is not supported with --all-tenants", out.format)
+				}
+				return runMetricsHeatmap(ctx, cmd.OutOrStdout(), args[0], out)
+			case outputLink:
+				if allTenants {
+					return fmt.Errorf("output format %q is not supported with --all-tenants", out.format)
+				}
+				from, to, err := linkRange(out)
+				if err != nil {
+					return err
+				}
+				link, err := exploreLink(grafanaDatasource, args[0], from, to)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), link)
+				return nil
+			default:
+				if !printer.IsGoTemplate(out.format) {
+					return fmt.Errorf("unsupported output format %q", out.format)
+				}
+				if allTenants {
+					return fmt.Errorf("output format %s is not supported with --all-tenants", printer.GoTemplate)
+				}
+				if _, err := printer.New(out.format); err != nil {
+					return err
+				}
+			}
+
+			if allTenants {
+				return runMetricsQueryAllTenants(ctx, cmd.OutOrStdout(), args[0], out)
+			}
+			return runMetricsQuery(ctx, cmd.OutOrStdout(), args[0], out)
+		}),
+		ValidArgsFunction: completeQueryFromHistory(fetcher.Metrics),
 	}
 
+	cmd.Flags().StringVarP(&out.format, "output", "o", outputJSON, "Output format. One of: json|table|link|heatmap|heatmap.csv|go-template=<template>. Go templates get the response as data. The link format prints a Grafana Explore URL for the query over the range of --range, or the default range of the current context up to --time, see 'obsctl context api --grafana-url'. The heatmap formats run a range query over classic histogram buckets, see above.")
+	cmd.Flags().StringVar(&out.unit, "unit", units.Auto, "Unit of the values in table output. One of: "+strings.Join(units.Valid, "|")+". With auto, the unit is guessed from metric name suffixes like _bytes or _seconds.")
+	cmd.Flags().StringSliceVar(&out.dedupBy, "dedup-by", nil, "Replica labels by which to deduplicate series client-side, e.g. replica,prometheus_replica. Series only differing in these labels are collapsed and the labels are removed. Useful when the backend does not deduplicate.")
+	cmd.Flags().StringVar(&out.at, "time", "", "Evaluation time of the query, as RFC3339 or Unix timestamp, or relative to now like -1h. Defaults to now.")
+	cmd.Flags().BoolVar(&out.rng, "range", false, "Run a range query between --start and --end instead of an instant query.")
+	cmd.Flags().StringVar(&out.start, "start", "", "Start of the range of --range, as RFC3339 or Unix timestamp, or relative to now like -1h. Defaults to the default range of the current context before --end, see 'obsctl context defaults'.")
+	cmd.Flags().StringVar(&out.end, "end", "", "End of the range of --range, in the same formats as --start. Defaults to now.")
+	cmd.Flags().Var(duration.NewValue(&out.step, 0), "step", "Resolution of --range queries. Defaults to a step resulting in about 250 samples per series.")
+	cmd.Flags().BoolVar(&allTenants, "all-tenants", false, "Run the query against all configured contexts.")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Edit the query in a prompt with completion of metric names, label names and label values of the current context.")
+	cmd.Flags().StringVar(&grafanaDatasource, "grafana-datasource", "", "Name of the Grafana datasource used in Explore links. Defaults to the default datasource of Grafana.")
+	cmd.Flags().BoolVar(&explain, "explain", false, "Print the plan of the query instead of running it. Needs the Thanos PromQL engine.")
+	cmd.Flags().BoolVar(&analyze, "analyze", false, "Run the query and print its plan with the timing of every operator instead of the result. Needs the Thanos PromQL engine.")
+
 	return cmd
 }
 
+// runMetricsQueryPlan explains or analyzes an instant query against the current context and prints
+// its plan as tree, or as JSON if asJSON.
+func runMetricsQueryPlan(ctx context.Context, w io.Writer, query, at string, analyze, asJSON bool) error {
+	if err := validateQuery(query); err != nil {
+		return err
+	}
+
+	f, err := newFetcher(ctx)
+	if err != nil {
+		return err
+	}
+
+	params, err := instantQueryParams(query, at)
+	if err != nil {
+		return err
+	}
+
+	var plan *fetcher.PlanNode
+	if analyze {
+		recordHistory(ctx, f, fetcher.Metrics, query)
+		indicator.Start("Analyzing query", 0)
+		_, plan, err = f.AnalyzeQuery(ctx, params)
+	} else {
+		indicator.Start("Explaining query", 0)
+		plan, err = f.ExplainQuery(ctx, params)
+	}
+	indicator.Stop()
+	if err != nil {
+		return fmt.Errorf("getting query plan: %w", err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return enc.Encode(plan)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if analyze {
+		fmt.Fprintln(tw, "OPERATOR\tTIME\tPEAK SAMPLES\tTOTAL SAMPLES")
+	}
+	writePlan(tw, *plan, "", "", analyze)
+	return tw.Flush()
+}
+
+// writePlan writes a line per operator of the plan, with its children indented below it.
+func writePlan(w io.Writer, node fetcher.PlanNode, prefix, childPrefix string, analyzed bool) {
+	if analyzed {
+		fmt.Fprintf(w, "%s%s\t%s\t%d\t%d\n", prefix, node.Name, node.ExecutionTime, node.PeakSamples, node.TotalSamples)
+	} else {
+		fmt.Fprintf(w, "%s%s\n", prefix, node.Name)
+	}
+	for i, c := range node.Children {
+		if i == len(node.Children)-1 {
+			writePlan(w, c, childPrefix+"└─ ", childPrefix+"   ", analyzed)
+		} else {
+			writePlan(w, c, childPrefix+"├─ ", childPrefix+"│  ", analyzed)
+		}
+	}
+}
+
+// runMetricsQuery runs an instant query against the current context, records it in the history and prints the response.
+func runMetricsQuery(ctx context.Context, w io.Writer, query string, out queryOutput) error {
+	if err := validateQuery(query); err != nil {
+		return err
+	}
+
+	f, err := newFetcher(ctx)
+	if err != nil {
+		return err
+	}
+
+	recordHistory(ctx, f, fetcher.Metrics, query)
+
+	endpoint, params, err := out.params(query)
+	if err != nil {
+		return err
+	}
+
+	indicator.Start("Running query", 0)
+	b, err := cachedQuery(ctx, f, fetcher.Metrics, endpoint, params)
+	indicator.Stop()
+	if err != nil {
+		return fmt.Errorf("querying metrics: %w", err)
+	}
+
+	if b, err = dedupResponse(b, out.dedupBy); err != nil {
+		return err
+	}
+
+	if out.format == outputTable {
+		return printQueryTable(w, b, query, out.unit)
+	}
+	if printer.IsGoTemplate(out.format) {
+		p, err := printer.New(out.format)
+		if err != nil {
+			return err
+		}
+		return p.Print(w, json.RawMessage(b), nil)
+	}
+
+	fmt.Fprintln(w, string(b))
+	return nil
+}
+
+// dedupResponse deduplicates the series of a successful query response by the given replica labels.
+// All other parts of the response are kept as they are.
+func dedupResponse(b []byte, replicaLabels []string) ([]byte, error) {
+	if len(replicaLabels) == 0 {
+		return b, nil
+	}
+
+	var data fetcher.QueryData
+	if err := fetcher.DecodeData(b, &data); err != nil {
+		return nil, err
+	}
+	if err := data.Dedup(replicaLabels); err != nil {
+		return nil, err
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	var err error
+	if envelope["data"], err = json.Marshal(data); err != nil {
+		return nil, fmt.Errorf("encoding response data: %w", err)
+	}
+	return json.Marshal(envelope)
+}
+
+// streamList prints the elements of a list response of the signal's query API as they are decoded,
+// in the format of the -o flag of cmd. format returns the element to print as JSON or YAML and
+// its line in tables, or false to skip it.
+func streamList(ctx context.Context, cmd *cobra.Command, signal fetcher.Signal, endpoint string, params url.Values, format func(json.RawMessage) (interface{}, string, bool, error)) error {
+	p, err := newPrinter(cmd)
+	if err != nil {
+		return err
+	}
+
+	f, err := newFetcher(ctx)
+	if err != nil {
+		return err
+	}
+
+	return withOutput(ctx, cmd, func(w io.Writer) error {
+		list := p.List(w)
+		indicator.Start("Fetching", 0)
+		defer indicator.Stop()
+
+		err := f.Stream(ctx, signal, endpoint, params, func(raw json.RawMessage) error {
+			v, line, ok, err := format(raw)
+			if err != nil || !ok {
+				return err
+			}
+			return list.Add(v, line)
+		})
+		level.Debug(logger).Log("msg", "fetched list", "endpoint", endpoint, "items", list.Len())
+		if err != nil {
+			return err
+		}
+		return list.Close()
+	})
+}
+
+func decodeString(raw json.RawMessage) (interface{}, string, bool, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, "", false, fmt.Errorf("decoding response data: %w", err)
+	}
+	return s, s, true, nil
+}
+
+// decodeSeries decodes a label set of a series response.
+func decodeSeries(raw json.RawMessage) (map[string]string, error) {
+	var lset map[string]string
+	if err := json.Unmarshal(raw, &lset); err != nil {
+		return nil, fmt.Errorf("decoding series: %w", err)
+	}
+	return lset, nil
+}
+
+// runMetricsQueryAllTenants runs an instant query against all contexts and prints the responses in the order of contexts.
+func runMetricsQueryAllTenants(ctx context.Context, w io.Writer, query string, out queryOutput) error {
+	if err := validateQuery(query); err != nil {
+		return err
+	}
+
+	endpoint, params, err := out.params(query)
+	if err != nil {
+		return err
+	}
+
+	var mtx sync.Mutex
+	responses := map[string][]byte{}
+
+	results, err := forEachContext(ctx, "Running query", func(ctx context.Context, f *fetcher.Fetcher) error {
+		b, err := f.Do(ctx, http.MethodGet, fetcher.Metrics, endpoint, params, nil, "")
+		if err != nil {
+			return err
+		}
+		if err := f.CheckWarnings(endpoint, b); err != nil {
+			return err
+		}
+		if b, err = dedupResponse(b, out.dedupBy); err != nil {
+			return err
+		}
+
+		mtx.Lock()
+		responses[f.Context().String()] = b
+		mtx.Unlock()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, r := range results {
+		if out.format == outputJSON {
+			e := struct {
+				Context  string          `json:"context"`
+				Response json.RawMessage `json:"response,omitempty"`
+				Error    string          `json:"error,omitempty"`
+			}{Context: r.Name, Response: responses[r.Name]}
+			if r.Err != nil {
+				e.Error = r.Err.Error()
+			}
+			if err := json.NewEncoder(w).Encode(e); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "# %s\n", r.Name)
+		if r.Err != nil {
+			fmt.Fprintf(w, "error: %s\n", r.Err)
+			continue
+		}
+		if err := printQueryTable(w, responses[r.Name], query, out.unit); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		if out.format == outputJSON {
+			fmt.Fprintln(w, `{"truncated":true}`)
+		} else {
+			fmt.Fprintln(w, truncatedMarker)
+		}
+	}
+
+	if err := fanout.Err(results); err != nil {
+		return fmt.Errorf("querying metrics: %w", err)
+	}
+	return nil
+}
+
+// printQueryTable prints a query response as table with humanized values.
+func printQueryTable(w io.Writer, resp []byte, query, unit string) error {
+	if !units.IsValid(unit) {
+		return fmt.Errorf("unsupported unit %q, expected one of %s", unit, strings.Join(units.Valid, ", "))
+	}
+
+	var data fetcher.QueryData
+	if err := fetcher.DecodeData(resp, &data); err != nil {
+		return err
+	}
+	return printQueryDataTable(w, &data, query, unit)
+}
+
+// printQueryDataTable prints the data of a query response as table with values humanized in unit.
+func printQueryDataTable(w io.Writer, data *fetcher.QueryData, query, unit string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERIES\tVALUE\tTIME")
+
+	row := func(name string, s fetcher.SamplePair, u string) {
+		if u == units.Auto {
+			if u = units.Guess(name); u == units.None {
+				u = units.Guess(query)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, units.Format(s.Float(), u), formatTime(s.Time()))
+	}
+	// Native histograms are summarized, the json format has all of their buckets.
+	histogramRow := func(name string, h fetcher.HistogramPair, u string) {
+		if u == units.Auto {
+			if u = units.Guess(name); u == units.None {
+				u = units.Guess(query)
+			}
+		}
+		summary := h.Histogram.Summary(func(f float64) string { return units.Format(f, u) })
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, summary, formatTime(h.Time()))
+	}
+
+	switch data.ResultType {
+	case "scalar", "string":
+		var s fetcher.SamplePair
+		if err := json.Unmarshal(data.Result, &s); err != nil {
+			return fmt.Errorf("decoding %s result: %w", data.ResultType, err)
+		}
+		row(data.ResultType, s, unit)
+	default:
+		series, err := data.Series()
+		if err != nil {
+			return err
+		}
+		for _, s := range series {
+			if s.Value != nil {
+				row(fetcher.FormatMetric(s.Metric), *s.Value, unit)
+			}
+			if s.Histogram != nil {
+				histogramRow(fetcher.FormatMetric(s.Metric), *s.Histogram, unit)
+			}
+			// Range vectors have a row per sample.
+			for _, v := range s.Values {
+				row(fetcher.FormatMetric(s.Metric), v, unit)
+			}
+			for _, h := range s.Histograms {
+				histogramRow(fetcher.FormatMetric(s.Metric), h, unit)
+			}
+		}
+	}
+
+	return tw.Flush()
+}
+
+// linkRange returns the time range of Explore links for the query options, as Unix milliseconds. Without
+// --range or --time, the range is relative to now, so that the link stays current.
+func linkRange(out queryOutput) (string, string, error) {
+	var start, end time.Time
+	switch {
+	case out.rng:
+		var err error
+		if start, end, err = parseTimeRange(out.start, out.end); err != nil {
+			return "", "", err
+		}
+	case out.at != "":
+		var err error
+		if end, err = parseTime(out.at, time.Now()); err != nil {
+			return "", "", fmt.Errorf("parsing --time: %w", err)
+		}
+		start = end.Add(-defaultRange)
+	case defaultRange%time.Hour == 0:
+		return fmt.Sprintf("now-%dh", defaultRange/time.Hour), "now", nil
+	default:
+		return fmt.Sprintf("now-%ds", defaultRange/time.Second), "now", nil
+	}
+	return strconv.FormatInt(start.UnixMilli(), 10), strconv.FormatInt(end.UnixMilli(), 10), nil
+}
+
+// exploreLink returns a Grafana Explore URL for the query, using the Grafana URL configured for the current API.
+func exploreLink(datasource, query, from, to string) (string, error) {
+	cfg, err := config.Read(logger)
+	if err != nil {
+		return "", fmt.Errorf("reading config: %w", err)
+	}
+
+	api, _, err := cfg.GetCurrent()
+	if err != nil {
+		return "", fmt.Errorf("getting current context: %w", err)
+	}
+
+	if api.GrafanaURL == "" {
+		return "", fmt.Errorf("no Grafana URL configured for api %s, set one with 'obsctl context api --name %s --grafana-url <url>'", cfg.Current.API, cfg.Current.API)
+	}
+
+	return grafana.ExploreURL(api.GrafanaURL, datasource, query, from, to)
+}
+
 func NewMetricsCmd(ctx context.Context) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "metrics",
 		Short: "Metrics based operations for Observatorium.",
 		Long:  "Metrics based operations for Observatorium.",
-		Run: func(cmd *cobra.Command, args []string) {
-			level.Info(logger).Log("msg", "metrics called")
-		},
 	}
 
 	cmd.AddCommand(NewMetricsGetCmd(ctx))
 	cmd.AddCommand(NewMetricsSetCmd(ctx))
 	cmd.AddCommand(NewMetricsQueryCmd(ctx))
+	cmd.AddCommand(NewMetricsAssertCmd(ctx))
+	cmd.AddCommand(NewMetricsExportCmd(ctx))
+	cmd.AddCommand(NewMetricsPushCmd(ctx))
+	cmd.AddCommand(NewMetricsRulesCmd(ctx))
+	cmd.AddCommand(NewMetricsDeleteCmd(ctx))
 
 	return cmd
 }
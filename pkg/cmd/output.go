@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/spf13/cobra"
+)
+
+// ExitCodeCancelled is the exit code of obsctl when interrupted with SIGINT or SIGTERM, like shells use for SIGINT.
+const ExitCodeCancelled = 130
+
+// truncatedMarker is printed after partial output of interrupted commands, so that it can't be mistaken for complete output.
+const truncatedMarker = "# truncated: interrupted before all results were received"
+
+// withOutput calls fn with a buffered writer to the output of cmd. The writer is flushed as it
+// fills up, so output is streamed rather than accumulated in memory. If fn fails because ctx was
+// cancelled, the partial output is followed by truncatedMarker.
+func withOutput(ctx context.Context, cmd *cobra.Command, fn func(w io.Writer) error) error {
+	w := bufio.NewWriter(cmd.OutOrStdout())
+	if err := fn(w); err != nil {
+		// Keep what was written so far, it is likely useful for debugging partial exports.
+		if ctx.Err() != nil {
+			fmt.Fprintln(w, truncatedMarker)
+		}
+		_ = w.Flush()
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+var (
+	// outFile is the path of a file the primary output of commands is written to instead of stdout.
+	outFile string
+	// outGzip compresses outFile with gzip.
+	outGzip bool
+)
+
+// output is the output file of the running command if --out is set, see setupOutput.
+var output *fileOutput
+
+// setupOutput redirects the output of cmd to --out.
+func setupOutput(cmd *cobra.Command, _ []string) error {
+	if outFile == "" {
+		return nil
+	}
+	if watch {
+		return errors.New("--out can't be combined with --watch")
+	}
+
+	output = &fileOutput{path: outFile, gzip: outGzip || strings.HasSuffix(outFile, ".gz")}
+	cmd.SetOut(output)
+	return nil
+}
+
+// finishOutput replaces the output file with the output of the command if it succeeded.
+func finishOutput(cmdErr error) error {
+	if output == nil {
+		return nil
+	}
+	if cmdErr != nil {
+		output.abort()
+		return nil
+	}
+	return output.commit()
+}
+
+// fileOutput writes to a temporary file next to its path, which is renamed to the path once the
+// command succeeded. Readers of the file never see partial output, and a failed run doesn't
+// destroy the output of a previous one. The temporary file is created on the first write.
+type fileOutput struct {
+	path string
+	gzip bool
+
+	file *os.File
+	gz   *gzip.Writer
+	w    io.Writer
+
+	// claimed is set by commands writing the file themselves, see claim.
+	claimed bool
+}
+
+func (o *fileOutput) Write(p []byte) (int, error) {
+	if o.w == nil {
+		if err := o.open(); err != nil {
+			return 0, err
+		}
+	}
+	return o.w.Write(p)
+}
+
+func (o *fileOutput) open() error {
+	f, err := os.CreateTemp(filepath.Dir(o.path), "."+filepath.Base(o.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	// Like files created by shell redirection, instead of the private mode of temporary files.
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("creating output file: %w", err)
+	}
+
+	o.file, o.w = f, f
+	if o.gzip {
+		o.gz = gzip.NewWriter(f)
+		o.w = o.gz
+	}
+	return nil
+}
+
+// claim hands the output file over to the command, for writing it in place, and returns its path.
+func (o *fileOutput) claim() string {
+	o.claimed = true
+	return o.path
+}
+
+// close flushes and closes the temporary file.
+func (o *fileOutput) close() error {
+	if o.gz != nil {
+		if err := o.gz.Close(); err != nil {
+			o.file.Close()
+			return err
+		}
+	}
+	if err := o.file.Sync(); err != nil {
+		o.file.Close()
+		return err
+	}
+	return o.file.Close()
+}
+
+// commit replaces the file at the path with the temporary file, creating an empty file if the
+// command had no output.
+func (o *fileOutput) commit() error {
+	if o.claimed {
+		return nil
+	}
+	if o.w == nil {
+		if err := o.open(); err != nil {
+			return err
+		}
+	}
+
+	if err := o.close(); err != nil {
+		os.Remove(o.file.Name())
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	if err := os.Rename(o.file.Name(), o.path); err != nil {
+		os.Remove(o.file.Name())
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	return nil
+}
+
+// abort keeps the output of a failed command in <path>.partial, leaving the file at the path untouched.
+func (o *fileOutput) abort() {
+	if o.claimed || o.w == nil {
+		return
+	}
+
+	partial := o.path + ".partial"
+	if o.gzip {
+		partial = strings.TrimSuffix(o.path, ".gz") + ".partial.gz"
+	}
+	if err := o.close(); err == nil {
+		if err = os.Rename(o.file.Name(), partial); err == nil {
+			level.Info(logger).Log("msg", "kept partial output", "file", partial)
+			return
+		}
+	}
+	os.Remove(o.file.Name())
+}
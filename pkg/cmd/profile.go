@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/go-kit/log/level"
+	"github.com/spf13/cobra"
+)
+
+// cpuProfile and memProfile are the paths pprof profiles of the run are written to, if set.
+var cpuProfile, memProfile string
+
+// cpuProfileFile is the file the running CPU profile is written to.
+var cpuProfileFile *os.File
+
+func startProfiling(*cobra.Command, []string) error {
+	if cpuProfile == "" {
+		return nil
+	}
+
+	f, err := os.Create(cpuProfile)
+	if err != nil {
+		return fmt.Errorf("creating CPU profile: %w", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("starting CPU profile: %w", err)
+	}
+	cpuProfileFile = f
+	return nil
+}
+
+// stopProfiling writes the profiles of the run. It is called after the command finished, whether it failed or not.
+func stopProfiling() {
+	if cpuProfileFile != nil {
+		pprof.StopCPUProfile()
+		if err := cpuProfileFile.Close(); err != nil {
+			level.Warn(logger).Log("msg", "failed to write CPU profile", "file", cpuProfile, "err", err)
+		}
+	}
+
+	if memProfile == "" {
+		return
+	}
+
+	f, err := os.Create(memProfile)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to create memory profile", "file", memProfile, "err", err)
+		return
+	}
+	defer f.Close()
+
+	// Get up-to-date statistics of all allocations up to now.
+	runtime.GC()
+	if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+		level.Warn(logger).Log("msg", "failed to write memory profile", "file", memProfile, "err", err)
+	}
+}
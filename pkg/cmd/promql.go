@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/observatorium/obsctl/pkg/promql"
+	"github.com/spf13/cobra"
+)
+
+// validateQueries makes query commands check the syntax of PromQL expressions before sending them.
+var validateQueries bool
+
+// promqlError adds the erroneous part of the expression and hints for fixing it to syntax errors.
+func promqlError(err error) error {
+	var perr *promql.Error
+	if !errors.As(err, &perr) {
+		return err
+	}
+
+	msg := perr.Pointed()
+	for _, h := range perr.Hints {
+		msg += "\nhint: " + h
+	}
+	return fmt.Errorf("%w\n%s", err, msg)
+}
+
+// validateQuery checks the syntax of a PromQL expression client-side, unless disabled with --promql.validate=false.
+func validateQuery(query string) error {
+	if !validateQueries {
+		return nil
+	}
+	if _, err := promql.Parse(query); err != nil {
+		return promqlError(err)
+	}
+	return nil
+}
+
+func NewPromQLCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "promql",
+		Short: "Format, check and explain PromQL expressions offline.",
+		Long:  "Format, check and explain PromQL expressions offline, using the upstream PromQL parser. No context is needed.",
+	}
+
+	fmtCmd := &cobra.Command{
+		Use:     "fmt <expr>",
+		Short:   "Pretty-print a PromQL expression.",
+		Long:    "Pretty-print a PromQL expression, splitting long expressions over multiple lines.",
+		Example: `obsctl promql fmt 'sum by(job)(rate(http_requests_total{code=~"5.."}[5m]))'`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := promql.Format(args[0])
+			if err != nil {
+				return promqlError(err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), s)
+			return nil
+		},
+	}
+
+	checkCmd := &cobra.Command{
+		Use:     "check <expr>",
+		Short:   "Check the syntax of a PromQL expression.",
+		Long:    "Check the syntax of a PromQL expression, reporting errors with their position.",
+		Example: `obsctl promql check 'sum(rate(http_requests_total[5m])'`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := promql.Parse(args[0]); err != nil {
+				return promqlError(err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "ok")
+			return nil
+		},
+	}
+
+	explainCmd := &cobra.Command{
+		Use:     "explain <expr>",
+		Short:   "Explain the structure of a PromQL expression.",
+		Long:    "Explain the structure of a PromQL expression: its result type, syntax tree and the selectors it queries.",
+		Example: `obsctl promql explain 'sum by(job)(rate(http_requests_total[5m] offset 1h))'`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return promqlError(promql.Explain(cmd.OutOrStdout(), args[0]))
+		},
+	}
+
+	cmd.AddCommand(fmtCmd)
+	cmd.AddCommand(checkCmd)
+	cmd.AddCommand(explainCmd)
+
+	return cmd
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/spf13/cobra"
+)
+
+func NewProxyCmd(ctx context.Context) *cobra.Command {
+	var listen string
+	var allowWrites bool
+
+	cmd := &cobra.Command{
+		Use:   "proxy",
+		Short: "Serve the API of the current context locally, without authentication.",
+		Long: `Serve the API of the current context locally, forwarding requests with a fresh token of the current
+context, so that tools like Grafana, promtool or curl can query the tenant without knowing about OIDC.
+
+Requests are forwarded to the API of a signal of the tenant, by the path of the request:
+
+  /loki/...                   logs, e.g. for a Loki datasource
+  /api/traces, /api/services  traces, e.g. for a Jaeger datasource
+  everything else             metrics, e.g. for a Prometheus datasource
+
+Only requests reading data are forwarded: GET and HEAD requests, and POST requests to the query,
+series and label endpoints of the metrics and logs APIs, which clients like Grafana use for long
+queries. Pass --allow-writes to forward everything else as well, e.g. to set rules.
+
+Anyone able to connect to --listen gets the access of the current context. It listens on localhost
+by default, only listen on other interfaces on trusted networks. Requests of web pages are rejected:
+requests for host names other than localhost or the one of --listen, e.g. of DNS rebinding, and
+requests with the Origin of another site.`,
+		Example: `obsctl proxy --listen=localhost:8080
+curl 'http://localhost:8080/api/v1/query?query=up'`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			return serve(ctx, listen, newProxy(f, proxySignal, allowWrites), "proxying the current context", "context", f.Context(), "tenant", f.Tenant(), "writes", allowWrites)
+		},
+	}
+
+	cmd.Flags().StringVar(&listen, "listen", "localhost:8080", "Address to listen on.")
+	cmd.Flags().BoolVar(&allowWrites, "allow-writes", false, "Forward requests changing data as well, e.g. of rules or deletions, rather than only requests reading data.")
+
+	return cmd
+}
+
+// proxySignal returns the signal whose API serves the path of a proxied request.
+func proxySignal(path string) fetcher.Signal {
+	switch {
+	case strings.HasPrefix(path, "/loki/"):
+		return fetcher.Logs
+	case strings.HasPrefix(path, "/api/traces"), strings.HasPrefix(path, "/api/services"):
+		return fetcher.Traces
+	default:
+		return fetcher.Metrics
+	}
+}
+
+// lokiEndpoints are the read endpoints of the Loki HTTP API, relative to /loki/api/v1. Endpoints
+// ending in / are prefixes.
+var lokiEndpoints = []string{
+	"/query",
+	"/query_range",
+	"/series",
+	"/labels",
+	"/label/",
+	"/index/stats",
+	"/index/volume",
+	"/index/volume_range",
+	"/patterns",
+	"/detected_fields",
+}
+
+// readRequest reports whether req only reads data. Besides GET and HEAD requests, the query, series
+// and label endpoints of Prometheus and Loki accept POST requests with the parameters in the body.
+func readRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		return prometheusEndpoint(req.URL.Path) || apiEndpoint(req.URL.Path, "/loki/api/v1", lokiEndpoints)
+	}
+	return false
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// newProxy returns a handler forwarding requests to the API of the tenant of f, of the signal
+// returned by route for the path of the request. Unless allowWrites, only requests reading data are
+// forwarded, see readRequest.
+func newProxy(f *fetcher.Fetcher, route func(path string) fetcher.Signal, allowWrites bool) http.Handler {
+	proxy := &httputil.ReverseProxy{
+		// The target is chosen by Forward.
+		Director: func(*http.Request) {},
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			signal := route(req.URL.Path)
+			resp, err := f.Forward(req, signal)
+			if err != nil {
+				return nil, err
+			}
+			level.Debug(logger).Log("msg", "forwarded request", "method", req.Method, "path", req.URL.Path, "signal", signal, "status", resp.StatusCode)
+			return resp, nil
+		}),
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			level.Warn(logger).Log("msg", "forwarding request failed", "method", req.Method, "path", req.URL.Path, "err", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+		// Stream responses like log tails as they arrive.
+		FlushInterval: -1,
+	}
+	if allowWrites {
+		return proxy
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !readRequest(req) {
+			level.Warn(logger).Log("msg", "rejected request changing data, see --allow-writes", "method", req.Method, "path", req.URL.Path)
+			http.Error(w, "only requests reading data are forwarded, see --allow-writes", http.StatusForbidden)
+			return
+		}
+		proxy.ServeHTTP(w, req)
+	})
+}
+
+// serve serves handler on addr until ctx is cancelled, logging msg and keyvals once it listens.
+// Requests of web pages are rejected, see localOnly.
+func serve(ctx context.Context, addr string, handler http.Handler, msg string, keyvals ...interface{}) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+
+	srv := &http.Server{Handler: localOnly(addr, l.Addr(), handler), ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(l) }()
+
+	level.Info(logger).Log(append([]interface{}{"msg", msg, "address", "http://" + l.Addr().String()}, keyvals...)...)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		return nil
+	}
+}
+
+// localOnly rejects requests web pages may make the browser send, as the served APIs give the
+// access of the current context without authentication: requests for host names other than the
+// ones of the listener, as made after DNS rebinding, and cross-origin requests.
+func localOnly(addr string, listenAddr net.Addr, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !allowedHost(req.Host, addr, listenAddr) {
+			level.Warn(logger).Log("msg", "rejected request for unknown host", "host", req.Host, "path", req.URL.Path)
+			http.Error(w, fmt.Sprintf("host %q is not allowed", req.Host), http.StatusForbidden)
+			return
+		}
+		if origin := req.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || !strings.EqualFold(u.Host, req.Host) {
+				level.Warn(logger).Log("msg", "rejected cross-origin request", "origin", origin, "path", req.URL.Path)
+				http.Error(w, fmt.Sprintf("origin %q is not allowed", origin), http.StatusForbidden)
+				return
+			}
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// allowedHost reports whether hostport, the Host of a request, addresses the listener, listening on
+// addr as given and resolved to listenAddr: localhost, loopback addresses and the host of addr. If
+// it listens on all interfaces, any IP address and the hostname of the machine are allowed too.
+func allowedHost(hostport, addr string, listenAddr net.Addr) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+
+	ip := net.ParseIP(host)
+	if strings.EqualFold(host, "localhost") || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(addr); err == nil && h != "" && strings.EqualFold(host, h) {
+		return true
+	}
+
+	listenHost, _, _ := net.SplitHostPort(listenAddr.String())
+	listenIP := net.ParseIP(listenHost)
+	if listenIP != nil && listenIP.IsUnspecified() {
+		// DNS rebinding needs host names, so IP addresses are safe.
+		if ip != nil {
+			return true
+		}
+		name, err := os.Hostname()
+		return err == nil && strings.EqualFold(host, name)
+	}
+	return ip != nil && ip.Equal(listenIP)
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/otlp"
+	"github.com/spf13/cobra"
+)
+
+func NewMetricsPushCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "push",
+		Short: "Write metrics for a tenant, to test the write path.",
+		Long:  "Write metrics for a tenant, to test the write path.",
+	}
+
+	cmd.AddCommand(NewMetricsPushOTLPCmd(ctx))
+
+	return cmd
+}
+
+func NewMetricsPushOTLPCmd(ctx context.Context) *cobra.Command {
+	var file string
+	var synthetic, dryRun bool
+	var series int
+
+	cmd := &cobra.Command{
+		Use:   "otlp",
+		Short: "Push OTLP metrics for a tenant.",
+		Long: `Push OTLP metrics for a tenant to the OTLP receiver of the metrics API, with the credentials of
+the current context, to validate ingestion through an OpenTelemetry pipeline.
+
+The metrics are read from a file in the JSON encoding of OTLP/HTTP, as written by the file exporter
+of the OpenTelemetry Collector, or generated with --synthetic: a gauge ` + otlp.SyntheticGauge + ` and a counter
+` + otlp.SyntheticCounter + ` of --synthetic.series series, labelled with a new ` + otlp.RunAttribute + ` per invocation, which is
+printed to query them back.`,
+		Example: `obsctl metrics push otlp -f metrics.json
+obsctl metrics push otlp --synthetic --synthetic.series=100`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (file == "") == !synthetic {
+				return errors.New("exactly one of --file and --synthetic is required")
+			}
+			if series < 1 {
+				return fmt.Errorf("--synthetic.series must be at least 1, got %d", series)
+			}
+
+			var (
+				body []byte
+				run  string
+				err  error
+			)
+			if synthetic {
+				if run, err = newRunID(); err != nil {
+					return err
+				}
+				if body, err = otlp.Synthetic(run, series, time.Now()); err != nil {
+					return fmt.Errorf("generating metrics: %w", err)
+				}
+			} else if body, err = readFileOrStdin(file); err != nil {
+				return err
+			}
+
+			summary, err := otlp.Summarize(body)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Fprintf(cmd.OutOrStdout(), "Would push %s.\n", summary)
+				return nil
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			indicator.Start("Pushing metrics", 0)
+			resp, err := f.PushOTLPMetrics(ctx, body)
+			indicator.Stop()
+			if err != nil {
+				return fmt.Errorf("pushing metrics: %w", err)
+			}
+
+			if ps := otlp.ParseResponse(resp); ps != nil {
+				return fmt.Errorf("%d of %d data points were rejected: %s", ps.RejectedDataPoints, summary.DataPoints, ps.ErrorMessage)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Pushed %s for tenant %s.\n", summary, f.Tenant())
+			if synthetic {
+				fmt.Fprintf(cmd.OutOrStdout(), "Query them with: obsctl metrics query '{%s=%q}'\n", otlp.RunAttribute, run)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Path of a file with OTLP metrics in the JSON encoding. - reads from stdin.")
+	cmd.Flags().BoolVar(&synthetic, "synthetic", false, "Push generated metrics instead of a file.")
+	cmd.Flags().IntVar(&series, "synthetic.series", 10, "Number of series of each generated metric.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only validate the metrics and print what would be pushed.")
+
+	return cmd
+}
+
+// readFileOrStdin reads the file at path, or stdin if path is -.
+func readFileOrStdin(path string) ([]byte, error) {
+	if path == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("reading stdin: %w", err)
+		}
+		return b, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// newRunID returns a random ID identifying the metrics of one invocation.
+func newRunID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating run ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/units"
+	"github.com/spf13/cobra"
+)
+
+// parseParams parses key=value pairs as given to repeated flags.
+func parseParams(kvs []string) (map[string]string, error) {
+	res := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid parameter %q, expected key=value", kv)
+		}
+		res[parts[0]] = parts[1]
+	}
+	return res, nil
+}
+
+// completeSavedQueries completes the names of saved queries for the first argument.
+func completeSavedQueries(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	cfg, err := config.Read(logger)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var names []string
+	for name, q := range cfg.Queries {
+		if strings.HasPrefix(name, toComplete) {
+			names = append(names, name+"\t"+q.Description)
+		}
+	}
+	sort.Strings(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func NewQueryCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Manage and run named queries saved in the configuration.",
+		Long: `Manage and run named queries saved in the configuration.
+
+Saved queries can be parameterized using Go templates, e.g. {{ .namespace }}, with values
+given at run time via --param.`,
+	}
+
+	var description string
+	saveCmd := &cobra.Command{
+		Use:     "save <name> <query>",
+		Short:   "Save a named PromQL query.",
+		Long:    "Save a named PromQL query, replacing any existing query with the same name.",
+		Example: `obsctl query save error-rate 'sum(rate(http_requests_total{namespace="{{ .ns }}", code=~"5.."}[5m]))'`,
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.Update(ctx, logger, func(cfg *config.Config) error {
+				return cfg.SaveQuery(logger, args[0], config.SavedQuery{Query: args[1], Description: description})
+			})
+			if err != nil {
+				return err
+			}
+
+			level.Info(logger).Log("msg", "saved query", "name", args[0])
+			return nil
+		},
+	}
+	saveCmd.Flags().StringVar(&description, "description", "", "Description of the query.")
+
+	var params []string
+	var out queryOutput
+	runCmd := &cobra.Command{
+		Use:               "run <name>",
+		Short:             "Run a saved query against the current context.",
+		Long:              "Run a saved query against the current context.",
+		Example:           `obsctl query run error-rate --param ns=foo`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSavedQueries,
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			p, err := parseParams(params)
+			if err != nil {
+				return err
+			}
+
+			query, err := cfg.RenderQuery(args[0], p)
+			if err != nil {
+				return err
+			}
+
+			return runMetricsQuery(ctx, cmd.OutOrStdout(), query, out)
+		}),
+	}
+	runCmd.Flags().StringArrayVar(&params, "param", nil, "Value of a query parameter as key=value. Can be repeated.")
+	runCmd.Flags().StringVarP(&out.format, "output", "o", outputJSON, "Output format. One of: json|table.")
+	runCmd.Flags().StringVar(&out.unit, "unit", units.Auto, "Unit of the values in table output. One of: "+strings.Join(units.Valid, "|")+".")
+	runCmd.Flags().StringSliceVar(&out.dedupBy, "dedup-by", nil, "Replica labels by which to deduplicate series client-side, e.g. replica,prometheus_replica.")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List saved queries.",
+		Long:  "List saved queries.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			names := make([]string, 0, len(cfg.Queries))
+			for name := range cfg.Queries {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tDESCRIPTION\tQUERY")
+			for _, name := range names {
+				q := cfg.Queries[name]
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", name, q.Description, q.Query)
+			}
+			return tw.Flush()
+		},
+	}
+
+	deleteCmd := &cobra.Command{
+		Use:               "delete <name>",
+		Short:             "Delete a saved query.",
+		Long:              "Delete a saved query.",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSavedQueries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.Update(ctx, logger, func(cfg *config.Config) error {
+				return cfg.RemoveQuery(logger, args[0])
+			})
+			if err != nil {
+				return err
+			}
+
+			level.Info(logger).Log("msg", "deleted query", "name", args[0])
+			return nil
+		},
+	}
+
+	cmd.AddCommand(saveCmd)
+	cmd.AddCommand(runCmd)
+	cmd.AddCommand(listCmd)
+	cmd.AddCommand(deleteCmd)
+
+	return cmd
+}
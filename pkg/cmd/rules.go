@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/grafana"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var rulesDocsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"cell":    markdownCell,
+	"runbook": ruleRunbook,
+}).Parse(`# Alerts of tenant {{ .Tenant }}
+{{ range .Groups }}{{ if .Alerts }}
+## {{ .Name }}
+
+| Alert | Severity | Expression | Runbook |
+|-------|----------|------------|---------|
+{{ range .Alerts }}| {{ cell .Name }} | {{ cell (index .Labels "severity") }} | {{ if .Query }}` + "`{{ cell .Query }}`" + `{{ end }} | {{ with runbook . }}[{{ cell . }}]({{ . }}){{ end }} |
+{{ end }}{{ end }}{{ end }}`))
+
+// markdownCell makes s safe to use inside of a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// ruleRunbook returns the runbook link of a rule, from the conventional runbook_url annotation or, failing that, runbook.
+func ruleRunbook(r fetcher.Rule) string {
+	if u := r.Annotations["runbook_url"]; u != "" {
+		return u
+	}
+	return r.Annotations["runbook"]
+}
+
+type rulesDocsGroup struct {
+	Name   string
+	Alerts []fetcher.Rule
+}
+
+func NewMetricsRulesDocsCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docs",
+		Short: "Generate Markdown documentation of the alerting rules of a tenant.",
+		Long: `Generate Markdown documentation of the alerting rules of a tenant.
+
+Fetches the rules of the tenant and renders an inventory of all alerts with their severity,
+expression and runbook, grouped by rule group. Redirect the output to a file to keep an
+alert catalog generated from the rules actually configured for the tenant.`,
+		Example: `obsctl metrics rules docs > ALERTS.md`,
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			indicator.Start("Fetching rules", 0)
+			groups, err := f.Rules(ctx, fetcher.Metrics)
+			indicator.Stop()
+			if err != nil {
+				return err
+			}
+
+			data := struct {
+				Tenant string
+				Groups []rulesDocsGroup
+			}{Tenant: f.Tenant()}
+
+			for _, g := range groups {
+				dg := rulesDocsGroup{Name: g.Name}
+				for _, r := range g.Rules {
+					if r.Type == "alerting" {
+						dg.Alerts = append(dg.Alerts, r)
+					}
+				}
+				data.Groups = append(data.Groups, dg)
+			}
+
+			return rulesDocsTemplate.Execute(cmd.OutOrStdout(), data)
+		}),
+	}
+
+	return cmd
+}
+
+func NewMetricsRulesExportGrafanaCmd(ctx context.Context) *cobra.Command {
+	opts := grafana.AlertingOptions{DefaultInterval: time.Minute}
+
+	cmd := &cobra.Command{
+		Use:   "export-grafana",
+		Short: "Convert the alerting rules of a tenant into Grafana alerting provisioning YAML.",
+		Long: `Convert the alerting rules of a tenant into Grafana alerting provisioning YAML, e.g. to consolidate
+alert definitions in Grafana while keeping Observatorium as the data source.
+
+Every alerting rule becomes a Grafana-managed alert rule querying the datasource given by
+--datasource-uid, which has to query the tenant, e.g. through the Observatorium API. Like in
+Prometheus, every series returned by the expression is an alert, whatever its value, and the rule
+groups keep their names, evaluation intervals, for durations, labels and annotations. Recording
+rules are skipped.
+
+The rule UIDs are derived from group and rule names, so that provisioning a newer export updates
+the rules instead of duplicating them.`,
+		Example: `obsctl metrics rules export-grafana --datasource-uid=observatorium --folder=Platform --out=alerting/rules.yaml`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			indicator.Start("Fetching rules", 0)
+			groups, err := f.Rules(ctx, fetcher.Metrics)
+			indicator.Stop()
+			if err != nil {
+				return err
+			}
+
+			if opts.Folder == "" {
+				opts.Folder = f.Tenant()
+			}
+			p := grafana.AlertingFromPrometheus(groups, opts)
+
+			return withOutput(ctx, cmd, func(w io.Writer) error {
+				enc := yaml.NewEncoder(w)
+				enc.SetIndent(2)
+				if err := enc.Encode(p); err != nil {
+					return fmt.Errorf("encoding alert rules: %w", err)
+				}
+				return enc.Close()
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.DatasourceUID, "datasource-uid", "", "UID of the Grafana datasource the alert rules query.")
+	cmd.Flags().StringVar(&opts.Folder, "folder", "", "Grafana folder the alert rules are provisioned in. Defaults to the name of the tenant.")
+	cmd.Flags().IntVar(&opts.OrgID, "org-id", 1, "ID of the Grafana organization the alert rules are provisioned in.")
+	_ = cmd.MarkFlagRequired("datasource-uid")
+
+	return cmd
+}
+
+func NewMetricsRulesCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rules",
+		Short: "Rules based operations for a tenant.",
+		Long:  "Rules based operations for a tenant.",
+	}
+
+	cmd.AddCommand(NewMetricsRulesDocsCmd(ctx))
+	cmd.AddCommand(NewMetricsRulesExportGrafanaCmd(ctx))
+
+	return cmd
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/selfupdate"
+	"github.com/observatorium/obsctl/pkg/signature"
+	"github.com/observatorium/obsctl/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+func NewSelfUpdateCmd(ctx context.Context) *cobra.Command {
+	var (
+		tag, publicKey string
+		check, force   bool
+		client         = selfupdate.Client{HTTP: http.DefaultClient, Token: os.Getenv("GITHUB_TOKEN")}
+	)
+
+	cmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "Update obsctl to the latest release.",
+		Long: `Update obsctl to the latest release, or the release given with --version, by replacing the running
+binary with the binary of the release for this OS and architecture.
+
+The SHA-256 checksum of the downloaded binary is verified against the ` + selfupdate.ChecksumsAsset + ` asset of
+the release. The signature of the checksums in the ` + selfupdate.SignatureAsset + ` asset is verified as well,
+with the release public key built into obsctl or the one given with --public-key, e.g. the public key
+of a cosign key pair, and releases without signature are rejected. Builds without release public key
+warn before installing a release whose signature is not verified. The binary is only replaced if all
+checks pass.
+
+Set $GITHUB_TOKEN to avoid the rate limits of anonymous requests to the GitHub API.`,
+		Example: `obsctl self-update --check
+obsctl self-update --public-key=/etc/obsctl/cosign.pub
+obsctl self-update --version=v0.2.0 --yes`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := selfupdate.DefaultPublicKey()
+			if err != nil {
+				return err
+			}
+			if publicKey != "" {
+				if key, err = os.ReadFile(publicKey); err != nil {
+					return fmt.Errorf("reading public key: %w", err)
+				}
+			}
+
+			indicator.Start("Looking up release", 0)
+			release, err := client.Release(ctx, tag)
+			indicator.Stop()
+			if err != nil {
+				return fmt.Errorf("looking up release: %w", err)
+			}
+
+			if check {
+				fmt.Fprintf(cmd.OutOrStdout(), "current: %s\nrelease: %s\n", version.Version, release.TagName)
+				return nil
+			}
+			if release.TagName == version.Version && !force {
+				level.Info(logger).Log("msg", "obsctl is up to date", "version", version.Version)
+				return nil
+			}
+
+			name := selfupdate.BinaryAsset(runtime.GOOS, runtime.GOARCH)
+			binary, ok := release.Asset(name)
+			if !ok {
+				return fmt.Errorf("release %s has no binary for %s/%s, expected asset %s", release.TagName, runtime.GOOS, runtime.GOARCH, name)
+			}
+			checksumsAsset, ok := release.Asset(selfupdate.ChecksumsAsset)
+			if !ok {
+				return fmt.Errorf("release %s has no %s, refusing to install an unverified binary", release.TagName, selfupdate.ChecksumsAsset)
+			}
+
+			exe, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("finding the running binary: %w", err)
+			}
+			if exe, err = filepath.EvalSymlinks(exe); err != nil {
+				return fmt.Errorf("finding the running binary: %w", err)
+			}
+
+			summary := fmt.Sprintf("%s (%s) will be replaced with %s of release %s.", exe, version.Version, name, release.TagName)
+			if key == nil {
+				// The checksums come from the same release, so they don't protect against tampered releases.
+				level.Warn(logger).Log("msg", "this build has no release public key, the signature of the release will NOT be verified, pass --public-key to verify it")
+				summary += " WARNING: its signature is not verified, only its checksum."
+			}
+			if err := confirm(cmd, summary); err != nil {
+				return err
+			}
+
+			indicator.Start("Downloading release", 0)
+			checksums, err := client.Download(ctx, checksumsAsset)
+			if err != nil {
+				indicator.Stop()
+				return fmt.Errorf("downloading %s: %w", selfupdate.ChecksumsAsset, err)
+			}
+			if key != nil {
+				sigAsset, ok := release.Asset(selfupdate.SignatureAsset)
+				if !ok {
+					indicator.Stop()
+					return fmt.Errorf("release %s has no %s to verify its signature with", release.TagName, selfupdate.SignatureAsset)
+				}
+				sig, err := client.Download(ctx, sigAsset)
+				if err != nil {
+					indicator.Stop()
+					return fmt.Errorf("downloading %s: %w", selfupdate.SignatureAsset, err)
+				}
+				if err := signature.Verify(key, checksums, sig); err != nil {
+					indicator.Stop()
+					return fmt.Errorf("verifying %s: %w", selfupdate.ChecksumsAsset, err)
+				}
+			}
+			data, err := client.Download(ctx, binary)
+			indicator.Stop()
+			if err != nil {
+				return fmt.Errorf("downloading %s: %w", name, err)
+			}
+			if err := selfupdate.VerifyChecksum(checksums, name, data); err != nil {
+				return err
+			}
+
+			if err := selfupdate.Replace(exe, data); err != nil {
+				return fmt.Errorf("updating %s: %w", exe, err)
+			}
+			level.Info(logger).Log("msg", "updated obsctl", "from", version.Version, "to", release.TagName, "signed", key != nil)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&tag, "version", "", "Release to install, e.g. v0.2.0. Defaults to the latest release.")
+	cmd.Flags().BoolVar(&check, "check", false, "Only print the current version and the version of the release, without updating.")
+	cmd.Flags().BoolVar(&force, "force", false, "Install the release even if it is the version already running.")
+	cmd.Flags().StringVar(&publicKey, "public-key", os.Getenv("OBSCTL_RELEASE_PUBLIC_KEY"), "Path of the PEM-encoded ECDSA or Ed25519 public key to verify the signature of the release checksums with. Defaults to $OBSCTL_RELEASE_PUBLIC_KEY, or the release public key built into obsctl.")
+	cmd.Flags().StringVar(&client.Repo, "repo", selfupdate.DefaultRepo, "GitHub repository obsctl is released from.")
+	cmd.Flags().StringVar(&client.APIURL, "github.url", selfupdate.DefaultAPIURL, "URL of the GitHub API, e.g. of a GitHub Enterprise instance mirroring the releases.")
+
+	return cmd
+}
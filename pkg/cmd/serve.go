@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/remoteread"
+	"github.com/spf13/cobra"
+)
+
+func NewServeCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve data of the current context locally with other protocols.",
+		Long:  "Serve data of the current context locally with other protocols.",
+	}
+
+	cmd.AddCommand(NewServeRemoteReadCmd(ctx))
+	cmd.AddCommand(NewServePrometheusCmd(ctx))
+
+	return cmd
+}
+
+func NewServeRemoteReadCmd(ctx context.Context) *cobra.Command {
+	var listen string
+
+	cmd := &cobra.Command{
+		Use:   "remote-read",
+		Short: "Serve the metrics of the current context as Prometheus remote read endpoint.",
+		Long: `Serve the metrics of the current context as Prometheus remote read endpoint at ` + remoteread.Path + `, so that
+a scratch Prometheus or other remote read clients can read the data of the tenant through the
+authentication of obsctl.
+
+Every remote read query is answered with the raw samples of a range vector selector, queried from
+the query API of the tenant. Large time ranges are limited by --memory.budget.
+
+Anyone able to connect to --listen gets read access to the metrics of the current context. It
+listens on localhost by default, only listen on other interfaces on trusted networks. Requests of
+web pages are rejected, like by 'obsctl proxy': requests for host names other than localhost or the
+one of --listen, e.g. of DNS rebinding, and requests with the Origin of another site.`,
+		Example: `obsctl serve remote-read --listen=localhost:9201
+
+# prometheus.yml
+remote_read:
+  - url: http://localhost:9201` + remoteread.Path + `
+    read_recent: true`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle(remoteread.Path, remoteread.Handler(func(ctx context.Context, expr string, t time.Time) ([]fetcher.Series, error) {
+				return remoteReadQuery(ctx, f, expr, t)
+			}))
+
+			return serve(ctx, listen, mux, "serving remote read", "path", remoteread.Path, "context", f.Context(), "tenant", f.Tenant())
+		},
+	}
+
+	cmd.Flags().StringVar(&listen, "listen", "localhost:9201", "Address to listen on.")
+
+	return cmd
+}
+
+// remoteReadQuery evaluates the range vector selector of a remote read query as instant query at t.
+func remoteReadQuery(ctx context.Context, f *fetcher.Fetcher, expr string, t time.Time) ([]fetcher.Series, error) {
+	data, err := f.Query(ctx, fetcher.Metrics, "/query", map[string][]string{
+		"query": {expr},
+		"time":  {formatUnix(t)},
+	})
+	var serr *fetcher.StatusError
+	if errors.As(err, &serr) && serr.StatusCode == http.StatusBadRequest {
+		return nil, fmt.Errorf("%w: %s", remoteread.ErrBadRequest, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data.Series()
+}
+
+// prometheusEndpoints are the read endpoints of the Prometheus HTTP API served by 'serve prometheus',
+// relative to /api/v1. Endpoints ending in / are prefixes.
+var prometheusEndpoints = []string{
+	"/query",
+	"/query_range",
+	"/query_exemplars",
+	"/format_query",
+	"/labels",
+	"/label/",
+	"/series",
+	"/metadata",
+	"/rules",
+	"/alerts",
+	"/status/buildinfo",
+}
+
+func NewServePrometheusCmd(ctx context.Context) *cobra.Command {
+	var listen string
+
+	cmd := &cobra.Command{
+		Use:   "prometheus",
+		Short: "Serve the metrics of the current context as Prometheus HTTP API, e.g. as Grafana datasource.",
+		Long: `Serve the metrics of the current context as Prometheus HTTP API without authentication, forwarding
+requests with a fresh token of the current context. Adding the served URL as Prometheus datasource
+is all Grafana needs for local dashboards.
+
+Only the read endpoints of the API are served: queries, labels, series, metadata, exemplars, rules,
+alerts and build information. Unlike 'obsctl proxy', nothing else of the API is reachable.
+
+Anyone able to connect to --listen gets read access to the metrics of the current context. It
+listens on localhost by default, only listen on other interfaces on trusted networks. Requests of
+web pages are rejected, like by 'obsctl proxy': requests for host names other than localhost or the
+one of --listen, e.g. of DNS rebinding, and requests with the Origin of another site.`,
+		Example: `obsctl serve prometheus --listen=localhost:9091`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			proxy := newProxy(f, func(string) fetcher.Signal { return fetcher.Metrics }, false)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !prometheusEndpoint(r.URL.Path) {
+					http.NotFound(w, r)
+					return
+				}
+				if r.Method != http.MethodGet && r.Method != http.MethodPost {
+					w.Header().Set("Allow", "GET, POST")
+					http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+					return
+				}
+				proxy.ServeHTTP(w, r)
+			})
+
+			return serve(ctx, listen, handler, "serving Prometheus API", "context", f.Context(), "tenant", f.Tenant())
+		},
+	}
+
+	cmd.Flags().StringVar(&listen, "listen", "localhost:9091", "Address to listen on.")
+
+	return cmd
+}
+
+// prometheusEndpoint reports whether path is one of prometheusEndpoints.
+func prometheusEndpoint(path string) bool {
+	return apiEndpoint(path, "/api/v1", prometheusEndpoints)
+}
+
+// apiEndpoint reports whether path is one of endpoints of the API at prefix.
+func apiEndpoint(path, prefix string, endpoints []string) bool {
+	if !strings.HasPrefix(path, prefix+"/") {
+		return false
+	}
+	path = strings.TrimPrefix(path, prefix)
+	for _, e := range endpoints {
+		if path == e || (strings.HasSuffix(e, "/") && strings.HasPrefix(path, e)) {
+			return true
+		}
+	}
+	return false
+}
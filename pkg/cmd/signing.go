@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/signature"
+	"github.com/spf13/cobra"
+)
+
+func newContextRulesPolicyCmd(ctx context.Context) *cobra.Command {
+	var publicKey string
+
+	cmd := &cobra.Command{
+		Use:   "rules-policy",
+		Short: "View or set the signature policy for rules of the current context.",
+		Long: `View or set the signature policy for rules of the current context.
+
+With --public-key, rule files have to be signed with the key before 'obsctl metrics set' uploads them
+for the tenant of the current context, and unsigned or wrongly signed files are refused. The key is
+stored in the config. Pass an empty value to accept unsigned rule files again.
+
+Signatures are detached files next to the rule files, <file>.sig as made by 'cosign sign-blob' for
+PEM-encoded keys, or <file>.minisig as made by minisign for minisign keys.`,
+		Example: `obsctl context rules-policy --public-key=cosign.pub
+cosign sign-blob --key=cosign.key --output-signature=rules.yaml.sig rules.yaml`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			_, t, err := cfg.GetCurrent()
+			if err != nil {
+				return fmt.Errorf("getting current context: %w", err)
+			}
+
+			if !cmd.Flags().Changed("public-key") {
+				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				if t.RulesPublicKey == "" {
+					fmt.Fprintln(tw, "signatures:\tnot required")
+				} else {
+					fmt.Fprintln(tw, "signatures:\trequired")
+					fmt.Fprintf(tw, "public key:\n%s\n", strings.TrimSpace(t.RulesPublicKey))
+				}
+				return tw.Flush()
+			}
+
+			var key string
+			if publicKey != "" {
+				b, err := os.ReadFile(publicKey)
+				if err != nil {
+					return fmt.Errorf("reading public key: %w", err)
+				}
+				if err := signature.CheckPublicKey(b); err != nil {
+					return fmt.Errorf("invalid --public-key: %w", err)
+				}
+				key = string(b)
+			}
+
+			return updateCurrentTenant(ctx, func(t *config.TenantConfig) {
+				t.RulesPublicKey = key
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&publicKey, "public-key", "", "Path of the public key rule files have to be signed with.")
+
+	return cmd
+}
+
+// rulesVerifier holds the public keys rule files have to be signed with.
+type rulesVerifier [][]byte
+
+// newRulesVerifier returns a verifier for the public key at keyFile, if given, and the key required
+// by the rules policy of the current context, if any.
+func newRulesVerifier(keyFile string) (rulesVerifier, error) {
+	var v rulesVerifier
+	if keyFile != "" {
+		b, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading --verify.key: %w", err)
+		}
+		if err := signature.CheckPublicKey(b); err != nil {
+			return nil, fmt.Errorf("invalid --verify.key: %w", err)
+		}
+		v = append(v, b)
+	}
+
+	cfg, err := config.Read(logger)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	if _, t, err := cfg.GetCurrent(); err == nil && t.RulesPublicKey != "" {
+		v = append(v, []byte(t.RulesPublicKey))
+	}
+	return v, nil
+}
+
+// verify checks that the contents of a rule file are signed with all keys of v.
+func (v rulesVerifier) verify(file string, data []byte) error {
+	for _, key := range v {
+		if err := signature.VerifyFile(key, file, data); err != nil {
+			return fmt.Errorf("refusing rule file: %w", err)
+		}
+	}
+	return nil
+}
+
+// verifyFiles checks the signatures of all files, so that none is uploaded if any is refused.
+func (v rulesVerifier) verifyFiles(files []string) error {
+	if len(v) == 0 {
+		return nil
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("reading rule file: %w", err)
+		}
+		if err := v.verify(file, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
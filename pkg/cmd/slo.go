@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/slo"
+	"github.com/spf13/cobra"
+)
+
+func NewSLOCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "slo",
+		Short: "Report on service level objectives of a tenant.",
+		Long:  "Report on service level objectives of a tenant.",
+	}
+
+	cmd.AddCommand(NewSLOStatusCmd(ctx))
+
+	return cmd
+}
+
+func NewSLOStatusCmd(ctx context.Context) *cobra.Command {
+	var file, at, output string
+	var step, burnWindow time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Report compliance, error budget and burn rate of SLOs.",
+		Long: `Report the compliance, remaining error budget and burn rate of the SLOs defined in a file, by
+evaluating their SLIs over the SLO window with range queries against the current context.
+
+An SLO file lists SLOs with a name, an objective as percentage of good events, a window and an SLI of
+two queries returning the per-second rates of bad and of all events. The rates are sampled every
+--step across the window, so range vectors should use ` + slo.StepPlaceholder + `, which is replaced by the step:
+
+  slos:
+    - name: api-availability
+      objective: 99.9
+      window: 30d
+      sli:
+        errorQuery: sum(rate(http_requests_total{job="api",code=~"5.."}[` + slo.StepPlaceholder + `]))
+        totalQuery: sum(rate(http_requests_total{job="api"}[` + slo.StepPlaceholder + `]))
+
+The burn rate is the rate at which the error budget was spent over --burn-window, relative to the
+rate that spends it exactly over the SLO window: above 1, the budget runs out before the window ends.`,
+		Example: `obsctl slo status -f slo.yaml
+obsctl slo status -f slo.yaml --burn-window=6h -o json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("unsupported output format %q", output)
+			}
+
+			slos, err := slo.Load(file)
+			if err != nil {
+				return err
+			}
+
+			end, err := parseTime(at, time.Now())
+			if err != nil {
+				return fmt.Errorf("parsing --time: %w", err)
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			reports := make([]slo.Report, 0, len(slos.SLOs))
+			for _, s := range slos.SLOs {
+				r, err := evaluateSLO(ctx, f, s, end, step, burnWindow)
+				if err != nil {
+					return fmt.Errorf("evaluating SLO %s: %w", s.Name, err)
+				}
+				reports = append(reports, r)
+			}
+
+			if output == outputJSON {
+				return json.NewEncoder(cmd.OutOrStdout()).Encode(reports)
+			}
+			return printSLOReports(cmd.OutOrStdout(), reports, burnWindow)
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Path of the SLO definitions file.")
+	cmd.Flags().StringVar(&at, "time", "", "End of the SLO windows, as RFC3339 or Unix timestamp, or relative to now like -1d. Defaults to now.")
+	cmd.Flags().Var(duration.NewValue(&step, 0), "step", "Interval at which the SLIs are sampled. Defaults to a step resulting in about 250 samples per window.")
+	cmd.Flags().Var(duration.NewValue(&burnWindow, time.Hour), "burn-window", "Time before the end of the SLO windows over which the burn rate is computed.")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format. One of: table|json.")
+	_ = cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+// evaluateSLO samples the SLI of an SLO over its window before end and reports on it.
+func evaluateSLO(ctx context.Context, f *fetcher.Fetcher, s slo.SLO, end time.Time, step, burnWindow time.Duration) (slo.Report, error) {
+	window, err := s.WindowDuration()
+	if err != nil {
+		return slo.Report{}, err
+	}
+
+	start := end.Add(-window)
+	if step <= 0 {
+		step = autoStep(start, end)
+	}
+	// The first sample covers the step before it, which has to be within the window.
+	start = start.Add(step)
+
+	errorQuery, totalQuery := s.Queries(step)
+	for _, q := range []string{errorQuery, totalQuery} {
+		if err := validateQuery(q); err != nil {
+			return slo.Report{}, err
+		}
+	}
+
+	errorRates, err := sliRates(ctx, f, errorQuery, start, end, step)
+	if err != nil {
+		return slo.Report{}, err
+	}
+	totalRates, err := sliRates(ctx, f, totalQuery, start, end, step)
+	if err != nil {
+		return slo.Report{}, err
+	}
+	return slo.Evaluate(s, errorRates, totalRates, end, burnWindow), nil
+}
+
+// sliRates evaluates a query as range query, summing up the samples of all its series per timestamp.
+func sliRates(ctx context.Context, f *fetcher.Fetcher, query string, start, end time.Time, step time.Duration) ([]slo.Sample, error) {
+	indicator.Start("Running query", 0)
+	data, err := f.Query(ctx, fetcher.Metrics, "/query_range", url.Values{
+		"query": []string{query},
+		"start": []string{formatUnix(start)},
+		"end":   []string{formatUnix(end)},
+		"step":  []string{strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	})
+	indicator.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("querying metrics: %w", err)
+	}
+
+	series, err := data.Series()
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []slo.Sample
+	index := map[float64]int{}
+	for _, s := range series {
+		for _, v := range s.Values {
+			i, ok := index[v.Timestamp]
+			if !ok {
+				i = len(samples)
+				index[v.Timestamp] = i
+				samples = append(samples, slo.Sample{Time: v.Time()})
+			}
+			samples[i].Value += v.Float()
+		}
+	}
+	return samples, nil
+}
+
+func printSLOReports(w io.Writer, reports []slo.Report, burnWindow time.Duration) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "SLO\tOBJECTIVE\tWINDOW\tCOMPLIANCE\tBUDGET REMAINING\tBURN RATE (%s)\n", duration.Format(burnWindow))
+	for _, r := range reports {
+		if r.NoData {
+			fmt.Fprintf(tw, "%s\t%g%%\t%s\tno data\t-\t-\n", r.Name, r.Objective, r.Window)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%g%%\t%s\t%.3f%%\t%.1f%%\t%.2f\n", r.Name, r.Objective, r.Window, r.Compliance, r.BudgetRemaining, r.BurnRate)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/spf13/cobra"
+)
+
+// healthCheck is a single check of the health of the API.
+type healthCheck struct {
+	Name string `json:"name"`
+	// Status is ok, failed, or unavailable if the API does not expose the checked endpoint.
+	Status  string        `json:"status"`
+	Latency time.Duration `json:"latencyNanoseconds"`
+	Error   string        `json:"error,omitempty"`
+	check   func(context.Context) error
+}
+
+func NewStatusCmd(ctx context.Context) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Check the health of the API of the current context.",
+		Long: `Check the health of the API of the current context.
+
+Checks the readiness and liveness endpoints of the gateway, as well as whether the backend of every
+signal responds for the tenant. A first-line check before debugging queries. Exits non-zero if any
+check fails. Checks of endpoints the API does not expose are reported as unavailable.`,
+		Args: cobra.NoArgs,
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			if output != outputJSON && output != outputTable {
+				return fmt.Errorf("unsupported output format %q", output)
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			checks := []*healthCheck{
+				{Name: "gateway ready", check: func(ctx context.Context) error { return f.Probe(ctx, "/-/ready") }},
+				{Name: "gateway healthy", check: func(ctx context.Context) error { return f.Probe(ctx, "/-/healthy") }},
+			}
+			for _, s := range fetcher.Signals {
+				s := s
+				checks = append(checks, &healthCheck{Name: string(s), check: func(ctx context.Context) error {
+					_, err := f.BuildInfo(ctx, s)
+					return err
+				}})
+			}
+
+			failed := runHealthChecks(ctx, checks)
+
+			if output == outputJSON {
+				if err := json.NewEncoder(cmd.OutOrStdout()).Encode(checks); err != nil {
+					return err
+				}
+			} else if err := printHealthChecks(cmd.OutOrStdout(), checks); err != nil {
+				return err
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+			}
+			return nil
+		}),
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format. One of: table|json.")
+
+	return cmd
+}
+
+// runHealthChecks runs the checks one after another and returns the number of failed ones.
+func runHealthChecks(ctx context.Context, checks []*healthCheck) int {
+	indicator.Start("Checking health", len(checks))
+	defer indicator.Stop()
+
+	var failed int
+	for _, c := range checks {
+		start := time.Now()
+		err := c.check(ctx)
+		c.Latency = time.Since(start)
+
+		var serr *fetcher.StatusError
+		switch {
+		case err == nil:
+			c.Status = "ok"
+		case errors.As(err, &serr) && serr.StatusCode == http.StatusNotFound:
+			c.Status = "unavailable"
+		default:
+			c.Status, c.Error = "failed", err.Error()
+			failed++
+		}
+		indicator.Increment(c.Name, c.Status)
+	}
+	return failed
+}
+
+func printHealthChecks(w io.Writer, checks []*healthCheck) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tLATENCY\tDETAIL")
+	for _, c := range checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Name, c.Status, c.Latency.Round(time.Millisecond), c.Error)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// scaffoldTenant is a tenant in the tenants.yaml of the Observatorium API.
+type scaffoldTenant struct {
+	Name string             `yaml:"name"`
+	ID   string             `yaml:"id"`
+	OIDC scaffoldTenantOIDC `yaml:"oidc"`
+}
+
+type scaffoldTenantOIDC struct {
+	ClientID      string `yaml:"clientID"`
+	ClientSecret  string `yaml:"clientSecret,omitempty"`
+	IssuerURL     string `yaml:"issuerURL"`
+	RedirectURL   string `yaml:"redirectURL"`
+	UsernameClaim string `yaml:"usernameClaim,omitempty"`
+	GroupClaim    string `yaml:"groupClaim,omitempty"`
+}
+
+func NewTenantCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tenant",
+		Short: "Help with the administration of tenants.",
+		Long:  "Help with the administration of tenants.",
+	}
+
+	cmd.AddCommand(NewTenantScaffoldCmd(ctx))
+
+	return cmd
+}
+
+func NewTenantScaffoldCmd(ctx context.Context) *cobra.Command {
+	var api string
+	var t scaffoldTenant
+
+	cmd := &cobra.Command{
+		Use:   "scaffold",
+		Short: "Generate the configuration of a new tenant.",
+		Long: `Generate the configuration of a new tenant: the snippet for the tenants.yaml of the Observatorium
+API and the matching 'obsctl login' command, so that both use the same OIDC client settings.
+
+Values missing from the flags are prompted for if stdin is a terminal. The tenant ID defaults to a
+new random UUID, the redirect URL to the OIDC callback of the tenant on the API. Nothing is applied,
+the output is meant to be reviewed and added to the configuration of the API.`,
+		Example: `obsctl tenant scaffold
+obsctl tenant scaffold --name=team-a --api=https://observatorium.example.com --oidc.issuer-url=https://sso.example.com --oidc.client-id=observatorium --oidc.client-secret=...`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fields := []struct {
+				flag, label string
+				value       *string
+			}{
+				{"name", "Tenant name", &t.Name},
+				{"api", "Observatorium API URL", &api},
+				{"oidc.issuer-url", "OIDC issuer URL", &t.OIDC.IssuerURL},
+				{"oidc.client-id", "OIDC client ID", &t.OIDC.ClientID},
+			}
+
+			var missing []string
+			for _, f := range fields {
+				if *f.value == "" {
+					missing = append(missing, "--"+f.flag)
+				}
+			}
+			if len(missing) > 0 {
+				if !term.IsTerminal(int(os.Stdin.Fd())) {
+					return fmt.Errorf("missing %s, pass them as flags or run interactively", strings.Join(missing, ", "))
+				}
+
+				in := bufio.NewReader(os.Stdin)
+				for _, f := range fields {
+					var err error
+					if *f.value, err = prompt(cmd.ErrOrStderr(), in, f.label, *f.value); err != nil {
+						return err
+					}
+				}
+				if t.OIDC.ClientSecret == "" {
+					var err error
+					if t.OIDC.ClientSecret, err = prompt(cmd.ErrOrStderr(), in, "OIDC client secret (optional)", ""); err != nil {
+						return err
+					}
+				}
+			}
+
+			for _, f := range fields {
+				if *f.value == "" {
+					return fmt.Errorf("--%s is required", f.flag)
+				}
+			}
+			for _, u := range []string{api, t.OIDC.IssuerURL} {
+				if parsed, err := url.Parse(u); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+					return fmt.Errorf("invalid URL %q, expected e.g. https://observatorium.example.com", u)
+				}
+			}
+
+			api = strings.TrimSuffix(api, "/")
+			if t.ID == "" {
+				var err error
+				if t.ID, err = newUUID(); err != nil {
+					return err
+				}
+			}
+			if t.OIDC.RedirectURL == "" {
+				t.OIDC.RedirectURL = api + "/oidc/" + t.Name + "/callback"
+			}
+
+			return printTenantScaffold(cmd.OutOrStdout(), api, t)
+		},
+	}
+
+	cmd.Flags().StringVar(&t.Name, "name", "", "The name of the tenant.")
+	cmd.Flags().StringVar(&t.ID, "id", "", "The ID of the tenant. Defaults to a new random UUID.")
+	cmd.Flags().StringVar(&api, "api", "", "The URL of the Observatorium API.")
+	cmd.Flags().StringVar(&t.OIDC.IssuerURL, "oidc.issuer-url", "", "The OIDC issuer URL.")
+	cmd.Flags().StringVar(&t.OIDC.ClientID, "oidc.client-id", "", "The OIDC client ID.")
+	cmd.Flags().StringVar(&t.OIDC.ClientSecret, "oidc.client-secret", "", "The OIDC client secret.")
+	cmd.Flags().StringVar(&t.OIDC.RedirectURL, "oidc.redirect-url", "", "The OIDC redirect URL of the tenant. Defaults to <api>/oidc/<name>/callback.")
+	cmd.Flags().StringVar(&t.OIDC.UsernameClaim, "oidc.username-claim", "email", "The claim of the ID token holding the name of the user.")
+	cmd.Flags().StringVar(&t.OIDC.GroupClaim, "oidc.group-claim", "", "The claim of the ID token holding the groups of the user, if any.")
+
+	return cmd
+}
+
+// prompt asks for a value on w, returning def if the answer is empty.
+func prompt(w io.Writer, in *bufio.Reader, label, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w, "%s [%s]: ", label, def)
+	} else {
+		fmt.Fprintf(w, "%s: ", label)
+	}
+
+	answer, err := in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("reading answer: %w", err)
+	}
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating tenant ID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func printTenantScaffold(w io.Writer, api string, t scaffoldTenant) error {
+	fmt.Fprintln(w, "# Add to the tenants of the tenants.yaml of the Observatorium API:")
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string][]scaffoldTenant{"tenants": {t}}); err != nil {
+		return fmt.Errorf("encoding tenant: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	secret := t.OIDC.ClientSecret
+	if secret == "" {
+		secret = "<client-secret>"
+	}
+	fmt.Fprintln(w, "\n# Log in to the tenant with:")
+	_, err := fmt.Fprintf(w, "obsctl login --api=%s --tenant=%s --oidc.issuer-url=%s --oidc.client-id=%s --oidc.client-secret=%s\n",
+		shellQuote(api), shellQuote(t.Name), shellQuote(t.OIDC.IssuerURL), shellQuote(t.OIDC.ClientID), shellQuote(secret))
+	return err
+}
+
+// shellQuote quotes s for POSIX shells if it contains characters other than those common in URLs and names.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.:/@%+=,") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/duration"
+)
+
+// localLayouts are the layouts of timestamps without a zone accepted by parseTime.
+var localLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// unixMillisThreshold is the smallest number parseTime treats as Unix milliseconds rather than seconds,
+// i.e. timestamps in seconds after the year 33658 or in milliseconds after March 1973.
+const unixMillisThreshold = 1e11
+
+// parseTime parses a point in time given as RFC3339 timestamp, date with optional time, Unix timestamp
+// in seconds or milliseconds, "now", or as duration relative to now, e.g. -1h. Bare numbers, like 0, are
+// always Unix timestamps. Timestamps without a zone are interpreted in the configured time zone.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "now" {
+		return now, nil
+	}
+
+	// Bare numbers, including 0, are Unix timestamps. Only signed numbers or numbers with a unit are
+	// durations relative to now, e.g. -1h or +30m.
+	if s[0] >= '0' && s[0] <= '9' {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			if f >= unixMillisThreshold {
+				f /= 1000
+			}
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(frac*1e9)), nil
+		}
+	}
+
+	if d, err := duration.Parse(s); err == nil {
+		return now.Add(d), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, s, location); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, expected one of: RFC3339 like 2006-01-02T15:04:05Z, a date like 2006-01-02 "+
+		"with optional time 15:04[:05] in the configured time zone, Unix seconds or milliseconds, now, or a duration relative to now like -1h", s)
+}
+
+// parseTimeRange parses the start and end of a time range, see parseTime. An empty start is the
+// default range of the current context before the end.
+func parseTimeRange(start, end string) (time.Time, time.Time, error) {
+	now := time.Now()
+
+	e, err := parseTime(end, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("parsing end: %w", err)
+	}
+
+	if strings.TrimSpace(start) == "" {
+		return e.Add(-defaultRange), e, nil
+	}
+
+	s, err := parseTime(start, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("parsing start: %w", err)
+	}
+
+	if e.Before(s) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end %s is before start %s", formatTime(e), formatTime(s))
+	}
+	return s, e, nil
+}
+
+// timeBoundParams sets the start and end parameters of list endpoints like /series to the given
+// bounds, see parseTime. Empty bounds are not set, leaving the API's default.
+func timeBoundParams(params url.Values, start, end string) error {
+	now := time.Now()
+	for _, b := range []struct{ name, value string }{{"start", start}, {"end", end}} {
+		if strings.TrimSpace(b.value) == "" {
+			continue
+		}
+		t, err := parseTime(b.value, now)
+		if err != nil {
+			return fmt.Errorf("parsing --%s: %w", b.name, err)
+		}
+		params.Set(b.name, formatUnix(t))
+	}
+	return nil
+}
+
+// formatUnix formats a time as Unix timestamp with sub-second precision, as accepted by the query APIs.
+func formatUnix(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64)
+}
+
+// targetPoints is the number of samples per series aimed for by autoStep.
+const targetPoints = 250
+
+// steps are the steps autoStep chooses from, so that samples are aligned to round times.
+var steps = []time.Duration{
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// autoStep returns the smallest round step resulting in at most about targetPoints samples
+// per series between start and end, like Grafana does for graphs.
+func autoStep(start, end time.Time) time.Duration {
+	return stepFor(start, end, targetPoints)
+}
+
+// stepFor returns the smallest round step resulting in at most about points samples per series between start and end.
+func stepFor(start, end time.Time, points int) time.Duration {
+	raw := end.Sub(start) / time.Duration(points)
+	for _, s := range steps {
+		if s >= raw {
+			return s
+		}
+	}
+	// Beyond a day, whole days are round enough.
+	return (raw + 24*time.Hour - 1) / (24 * time.Hour) * (24 * time.Hour)
+}
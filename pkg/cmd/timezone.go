@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// timezone is the name of the time zone timestamps are displayed in, see setupTimezone.
+var timezone string
+
+// location is the time zone timestamps are displayed in.
+var location = time.Local
+
+// loadLocation loads a time zone by IANA name, also accepting "local" and "utc" in any case.
+func loadLocation(name string) (*time.Location, error) {
+	switch strings.ToLower(name) {
+	case "local":
+		return time.Local, nil
+	case "utc":
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("loading time zone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// setupTimezone sets the time zone timestamps are displayed in from --timezone or, if not given,
+// from the default time zone of the current context. Otherwise, the local time zone is used.
+func setupTimezone(*cobra.Command, []string) error {
+	tz := timezone
+	if tz == "" {
+		if cfg, err := config.Read(logger); err == nil {
+			if _, t, err := cfg.GetCurrent(); err == nil {
+				tz = t.Timezone
+			}
+		}
+	}
+
+	if tz == "" {
+		return nil
+	}
+
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return err
+	}
+	location = loc
+	return nil
+}
+
+// formatTime formats a timestamp for display, in the configured time zone.
+func formatTime(t time.Time) string {
+	return t.In(location).Format(time.RFC3339)
+}
+
+func newContextTimezoneCmd(ctx context.Context) *cobra.Command {
+	return &cobra.Command{
+		Use:   "timezone [<zone>]",
+		Short: "View or set the default time zone of the current context.",
+		Long: `View or set the default time zone of the current context.
+
+Timestamps are displayed in the default time zone of the current context, unless overridden
+with --timezone. Accepts IANA time zone names like Europe/Berlin, as well as local and UTC.`,
+		Example: `obsctl context timezone America/New_York`,
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			_, t, err := cfg.GetCurrent()
+			if err != nil {
+				return fmt.Errorf("getting current context: %w", err)
+			}
+
+			if len(args) == 0 {
+				tz := t.Timezone
+				if tz == "" {
+					tz = "local"
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), tz)
+				return nil
+			}
+
+			if _, err := loadLocation(args[0]); err != nil {
+				return err
+			}
+
+			return updateCurrentTenant(ctx, func(t *config.TenantConfig) {
+				t.Timezone = args[0]
+			})
+		},
+	}
+}
@@ -0,0 +1,408 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/spf13/cobra"
+)
+
+func NewTracesCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "traces",
+		Short: "Traces based operations for Observatorium.",
+		Long:  "Traces based operations for Observatorium.",
+	}
+
+	cmd.AddCommand(NewTracesSearchCmd(ctx))
+	cmd.AddCommand(NewTracesGetCmd(ctx))
+	cmd.AddCommand(NewTracesLogsCmd(ctx))
+
+	return cmd
+}
+
+func NewTracesSearchCmd(ctx context.Context) *cobra.Command {
+	var (
+		service, operation, start, end, output string
+		tags                                   []string
+		minDuration, maxDuration               time.Duration
+		limit                                  int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "search",
+		Short: "Search the traces of a tenant.",
+		Long: `Search the traces of a tenant with spans of a service between --start and --end, optionally
+only those with spans of an operation, with the given tags and within the given durations. Each
+trace is printed with its root span, the number of its spans and how many of them failed.
+
+Get all spans of a trace with 'obsctl traces get <trace-id>'.`,
+		Example: `obsctl traces search --service=frontend --start=-1h
+obsctl traces search --service=frontend --operation='GET /cart' --tag=http.status_code=500 --min-duration=1s`,
+		Args: cobra.NoArgs,
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("unsupported output format %q", output)
+			}
+			if maxDuration > 0 && maxDuration < minDuration {
+				return fmt.Errorf("--max-duration %s is less than --min-duration %s", maxDuration, minDuration)
+			}
+
+			s, e, err := parseTimeRange(start, end)
+			if err != nil {
+				return err
+			}
+			params := url.Values{
+				"service": {service},
+				"start":   {strconv.FormatInt(s.UnixMicro(), 10)},
+				"end":     {strconv.FormatInt(e.UnixMicro(), 10)},
+				"limit":   {strconv.Itoa(limit)},
+			}
+			if operation != "" {
+				params.Set("operation", operation)
+			}
+			if len(tags) > 0 {
+				kvs := map[string]string{}
+				for _, t := range tags {
+					kv := strings.SplitN(t, "=", 2)
+					if len(kv) != 2 || kv[0] == "" {
+						return fmt.Errorf("invalid --tag %q, expected key=value", t)
+					}
+					kvs[kv[0]] = kv[1]
+				}
+				b, err := json.Marshal(kvs)
+				if err != nil {
+					return err
+				}
+				params.Set("tags", string(b))
+			}
+			if minDuration > 0 {
+				params.Set("minDuration", minDuration.String())
+			}
+			if maxDuration > 0 {
+				params.Set("maxDuration", maxDuration.String())
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			indicator.Start("Searching traces", 0)
+			traces, err := f.SearchTraces(ctx, params)
+			indicator.Stop()
+			if err != nil {
+				return fmt.Errorf("searching traces: %w", err)
+			}
+
+			// Most recent first, like the Jaeger UI.
+			sort.SliceStable(traces, func(i, j int) bool {
+				si, _ := traces[i].Window()
+				sj, _ := traces[j].Window()
+				return si.After(sj)
+			})
+
+			if output == outputJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetEscapeHTML(false)
+				return enc.Encode(traces)
+			}
+			return printTraces(cmd.OutOrStdout(), traces)
+		}),
+	}
+
+	cmd.Flags().StringVar(&service, "service", "", "Service with spans in the traces.")
+	cmd.Flags().StringVar(&operation, "operation", "", "Operation of the service with spans in the traces.")
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "Tag of spans in the traces as key=value. Can be repeated.")
+	cmd.Flags().Var(duration.NewValue(&minDuration, 0), "min-duration", "Minimum duration of a span of the traces, e.g. 500ms.")
+	cmd.Flags().Var(duration.NewValue(&maxDuration, 0), "max-duration", "Maximum duration of a span of the traces, e.g. 2s.")
+	cmd.Flags().StringVar(&start, "start", "", "Start of the time range, as RFC3339 or Unix timestamp, or relative to now like -1h. Defaults to the default range of the current context before --end.")
+	cmd.Flags().StringVar(&end, "end", "now", "End of the time range, as RFC3339 or Unix timestamp, or relative to now.")
+	cmd.Flags().IntVar(&limit, "limit", 20, "Maximum number of traces to return.")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format. One of: table|json.")
+	_ = cmd.MarkFlagRequired("service")
+
+	return cmd
+}
+
+// printTraces prints a line per trace with its root span.
+func printTraces(w io.Writer, traces []fetcher.Trace) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TRACE ID\tSTART\tDURATION\tSPANS\tERRORS\tROOT")
+	for _, t := range traces {
+		start, end := t.Window()
+		var failed int
+		for _, s := range t.Spans {
+			if s.Failed() {
+				failed++
+			}
+		}
+		var root string
+		if r := t.Root(); r != nil {
+			root = spanName(&t, *r)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", t.TraceID, formatTime(start), end.Sub(start), len(t.Spans), failed, root)
+	}
+	return tw.Flush()
+}
+
+func NewTracesGetCmd(ctx context.Context) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "get <trace-id>",
+		Short: "Get a trace of a tenant.",
+		Long: `Get a trace of a tenant by its ID, printed as tree of its spans with the start of every span
+relative to the start of the trace and its duration, or as JSON in the model of the Jaeger query API.`,
+		Example: `obsctl traces get 4bf92f3577b34da6a3ce929d0e0e4736
+obsctl traces get 4bf92f3577b34da6a3ce929d0e0e4736 -o json`,
+		Args: cobra.ExactArgs(1),
+		RunE: watchable(ctx, func(cmd *cobra.Command, args []string) error {
+			if output != outputTree && output != outputJSON {
+				return fmt.Errorf("unsupported output format %q", output)
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			indicator.Start("Fetching trace", 0)
+			trace, err := f.Trace(ctx, args[0])
+			indicator.Stop()
+			if err != nil {
+				if errors.Is(err, fetcher.ErrTraceNotFound) {
+					return err
+				}
+				return fmt.Errorf("getting trace: %w", err)
+			}
+
+			if output == outputJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetEscapeHTML(false)
+				return enc.Encode(trace)
+			}
+			return printSpanTree(cmd.OutOrStdout(), trace)
+		}),
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", outputTree, "Output format. One of: tree|json.")
+
+	return cmd
+}
+
+// printSpanTree prints a line per span of the trace, with the children of spans indented below them.
+// Spans whose parent is not part of the trace are printed as roots.
+func printSpanTree(w io.Writer, trace *fetcher.Trace) error {
+	ids := make(map[string]bool, len(trace.Spans))
+	for _, s := range trace.Spans {
+		ids[s.SpanID] = true
+	}
+	children := map[string][]fetcher.Span{}
+	var roots []fetcher.Span
+	for _, s := range trace.Spans {
+		if p := s.ParentID(); ids[p] {
+			children[p] = append(children[p], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+	byStart := func(spans []fetcher.Span) {
+		sort.SliceStable(spans, func(i, j int) bool { return spans[i].StartTime < spans[j].StartTime })
+	}
+	byStart(roots)
+	for _, c := range children {
+		byStart(c)
+	}
+
+	start, _ := trace.Window()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SPAN\tSTART\tDURATION")
+
+	var write func(s fetcher.Span, prefix, childPrefix string)
+	write = func(s fetcher.Span, prefix, childPrefix string) {
+		fmt.Fprintf(tw, "%s%s\t+%s\t%s\n", prefix, spanName(trace, s), time.UnixMicro(s.StartTime).Sub(start), time.Duration(s.Duration)*time.Microsecond)
+		cs := children[s.SpanID]
+		for i, c := range cs {
+			if i == len(cs)-1 {
+				write(c, childPrefix+"└─ ", childPrefix+"   ")
+			} else {
+				write(c, childPrefix+"├─ ", childPrefix+"│  ")
+			}
+		}
+	}
+	for _, r := range roots {
+		write(r, "", "")
+	}
+	return tw.Flush()
+}
+
+// spanName returns the service and operation of a span, marked if it failed.
+func spanName(trace *fetcher.Trace, s fetcher.Span) string {
+	name := trace.Processes[s.ProcessID].ServiceName + ": " + s.OperationName
+	if s.Failed() {
+		name += " (error)"
+	}
+	return name
+}
+
+// traceLogsSelector configures which log streams belong to the processes of a trace.
+type traceLogsSelector struct {
+	// serviceLabel is the stream label holding the service name of processes.
+	serviceLabel string
+	// podLabel is the stream label holding the k8s.pod.name attribute of processes.
+	podLabel string
+	// namespaceLabel is the stream label holding the k8s.namespace.name attribute of processes.
+	namespaceLabel string
+}
+
+func NewTracesLogsCmd(ctx context.Context) *cobra.Command {
+	var (
+		sel         traceLogsSelector
+		padding     time.Duration
+		limit       int
+		filterTrace bool
+		out         logsQueryOutput
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs <trace-id>",
+		Short: "Query the logs of the services involved in a trace.",
+		Long: `Query the logs of the services involved in a trace. The trace is fetched from the traces API of
+the tenant, and the logs of its services are queried over the time window of its spans, widened
+by --padding on both sides.
+
+The stream selector matches the service names of the processes of the trace with --service.label.
+If all processes have the k8s.pod.name or k8s.namespace.name resource attributes, the pods and
+namespaces are matched with --pod.label and --namespace.label as well. Set a label to an empty
+string to not match on it. With --filter-trace-id, only lines containing the trace ID are printed,
+for services logging it.`,
+		Example: `obsctl traces logs 4bf92f3577b34da6a3ce929d0e0e4736
+obsctl traces logs 4bf92f3577b34da6a3ce929d0e0e4736 --filter-trace-id --padding=5m -o jsonl`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch out.format {
+			case outputJSON, outputJSONL, outputTable:
+			default:
+				return fmt.Errorf("unsupported output format %q", out.format)
+			}
+			if sel.serviceLabel == "" && sel.podLabel == "" && sel.namespaceLabel == "" {
+				return fmt.Errorf("at least one of --service.label, --pod.label and --namespace.label is required")
+			}
+
+			f, err := newFetcher(ctx)
+			if err != nil {
+				return err
+			}
+
+			indicator.Start("Fetching trace", 0)
+			trace, err := f.Trace(ctx, args[0])
+			indicator.Stop()
+			if err != nil {
+				if errors.Is(err, fetcher.ErrTraceNotFound) {
+					return err
+				}
+				return fmt.Errorf("getting trace: %w", err)
+			}
+
+			query, err := traceLogsQuery(trace, sel, filterTrace)
+			if err != nil {
+				return err
+			}
+			start, end := trace.Window()
+			start, end = start.Add(-padding), end.Add(padding)
+			level.Info(logger).Log("msg", "querying logs of trace", "trace", trace.TraceID, "spans", len(trace.Spans), "query", query, "start", formatTime(start), "end", formatTime(end))
+
+			params := url.Values{
+				"query":     {query},
+				"start":     {strconv.FormatInt(start.UnixNano(), 10)},
+				"end":       {strconv.FormatInt(end.UnixNano(), 10)},
+				"limit":     {strconv.Itoa(limit)},
+				"direction": {"forward"},
+			}
+
+			recordHistory(ctx, f, fetcher.Logs, query)
+
+			indicator.Start("Running query", 0)
+			data, err := f.Query(ctx, fetcher.Logs, "/query_range", params)
+			indicator.Stop()
+			if err != nil {
+				return fmt.Errorf("querying logs: %w", err)
+			}
+
+			return printLogs(cmd.OutOrStdout(), data, out)
+		},
+	}
+
+	cmd.Flags().StringVar(&sel.serviceLabel, "service.label", "service_name", "Stream label holding the service name of the processes of the trace.")
+	cmd.Flags().StringVar(&sel.podLabel, "pod.label", "pod", "Stream label holding the k8s.pod.name resource attribute of the processes of the trace.")
+	cmd.Flags().StringVar(&sel.namespaceLabel, "namespace.label", "namespace", "Stream label holding the k8s.namespace.name resource attribute of the processes of the trace.")
+	cmd.Flags().Var(duration.NewValue(&padding, 30*time.Second), "padding", "Time added before the first and after the last span of the trace to the time range of the logs query.")
+	cmd.Flags().IntVar(&limit, "limit", 1000, "Maximum number of lines to fetch. The earliest lines are fetched.")
+	cmd.Flags().BoolVar(&filterTrace, "filter-trace-id", false, "Only fetch lines containing the trace ID.")
+	cmd.Flags().StringVarP(&out.format, "output", "o", outputTable, "Output format. One of: table|json|jsonl.")
+	cmd.Flags().BoolVar(&out.dedup, "dedup", false, "Collapse runs of consecutive near-identical lines into their first line and a count.")
+
+	return cmd
+}
+
+// traceLogsQuery returns the LogQL query of the logs of the processes of a trace.
+func traceLogsQuery(trace *fetcher.Trace, sel traceLogsSelector, filterTrace bool) (string, error) {
+	processes := trace.SpanProcesses()
+
+	var matchers []string
+	add := func(label string, value func(fetcher.Process) string) {
+		if label == "" {
+			return
+		}
+		values := map[string]bool{}
+		for _, p := range processes {
+			v := value(p)
+			if v == "" {
+				// Matching on the label would drop the logs of this process.
+				return
+			}
+			values[v] = true
+		}
+		if len(values) == 0 {
+			return
+		}
+		matchers = append(matchers, label+"=~"+strconv.Quote(alternation(values)))
+	}
+	add(sel.serviceLabel, func(p fetcher.Process) string { return p.ServiceName })
+	add(sel.namespaceLabel, func(p fetcher.Process) string { return p.Tag("k8s.namespace.name") })
+	add(sel.podLabel, func(p fetcher.Process) string { return p.Tag("k8s.pod.name") })
+
+	if len(matchers) == 0 {
+		return "", fmt.Errorf("the processes of trace %s have none of the attributes to select their logs by", trace.TraceID)
+	}
+
+	query := "{" + strings.Join(matchers, ", ") + "}"
+	if filterTrace {
+		query += " |= " + strconv.Quote(trace.TraceID)
+	}
+	return query, nil
+}
+
+// alternation returns a regular expression matching exactly the given values.
+func alternation(values map[string]bool) string {
+	quoted := make([]string, 0, len(values))
+	for v := range values {
+		quoted = append(quoted, regexp.QuoteMeta(v))
+	}
+	sort.Strings(quoted)
+	return strings.Join(quoted, "|")
+}
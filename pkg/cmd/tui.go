@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/tui"
+	"github.com/spf13/cobra"
+)
+
+func NewTUICmd(ctx context.Context) *cobra.Command {
+	var graphRange time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "tui",
+		Short: "Interactive terminal UI to browse the metrics of a tenant.",
+		Long: `Interactive terminal UI to browse the metrics of a tenant.
+
+Type a PromQL query to get metric, label name and label value completions fetched from
+the API. Running a query shows its current result in a table and its recent history as
+sparklines. All configured contexts can be switched to without leaving the UI.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Read(logger)
+			if err != nil {
+				return fmt.Errorf("reading config: %w", err)
+			}
+
+			// Anything logged would garble the UI, errors are shown in its status bar instead.
+			b := tui.New(ctx, log.NewNopLogger(), cfg)
+			b.Range = defaultRange
+			if cmd.Flags().Changed("graph.range") {
+				b.Range = graphRange
+			}
+
+			return b.Run()
+		},
+	}
+
+	cmd.Flags().Var(duration.NewValue(&graphRange, time.Hour), "graph.range", "Time range shown in the graph pane. Defaults to the default range of the current context, see 'obsctl context defaults'.")
+
+	return cmd
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/observatorium/obsctl/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+// remoteVersion is the version of the backend serving a signal, or the error getting it.
+type remoteVersion struct {
+	Signal    fetcher.Signal     `json:"signal"`
+	BuildInfo *fetcher.BuildInfo `json:"buildInfo,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+func NewVersionCmd(ctx context.Context) *cobra.Command {
+	var remote bool
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the version of obsctl and, with --remote, of the backends.",
+		Long: `Print the version of obsctl and, with --remote, of the backends.
+
+With --remote, the build information of the backend serving every signal is fetched from its
+buildinfo API through the current context. Include the output when filing compatibility bugs.`,
+		Example: `obsctl version --remote`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != outputJSON && output != outputTable {
+				return fmt.Errorf("unsupported output format %q", output)
+			}
+
+			var remotes []remoteVersion
+			if remote {
+				f, err := newFetcher(ctx)
+				if err != nil {
+					return err
+				}
+
+				indicator.Start("Fetching build information", len(fetcher.Signals))
+				for _, s := range fetcher.Signals {
+					rv := remoteVersion{Signal: s}
+					status := "ok"
+					if rv.BuildInfo, err = f.BuildInfo(ctx, s); err != nil {
+						rv.Error, status = err.Error(), "failed"
+					}
+					remotes = append(remotes, rv)
+					indicator.Increment(string(s), status)
+				}
+				indicator.Stop()
+			}
+
+			if output == outputJSON {
+				return json.NewEncoder(cmd.OutOrStdout()).Encode(struct {
+					Version   string          `json:"version"`
+					Revision  string          `json:"revision"`
+					GoVersion string          `json:"goVersion"`
+					Remote    []remoteVersion `json:"remote,omitempty"`
+				}{version.Version, version.Revision, version.GoVersion, remotes})
+			}
+			return printVersions(cmd.OutOrStdout(), remotes)
+		},
+	}
+
+	cmd.Flags().BoolVar(&remote, "remote", false, "Also print the versions of the backends of the current context.")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format. One of: table|json.")
+
+	return cmd
+}
+
+func printVersions(w io.Writer, remotes []remoteVersion) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tVERSION\tREVISION\tGO VERSION")
+	fmt.Fprintf(tw, "obsctl\t%s\t%s\t%s\n", version.Version, version.Revision, version.GoVersion)
+	for _, r := range remotes {
+		if r.BuildInfo == nil {
+			fmt.Fprintf(tw, "%s\terror: %s\n", r.Signal, r.Error)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Signal, r.BuildInfo.Version, r.BuildInfo.Revision, r.BuildInfo.GoVersion)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+)
+
+// failOnPartial fails commands on partial responses, instead of only warning about them.
+var failOnPartial bool
+
+// failOnWarnings fails commands on responses with any warnings, instead of only printing them.
+var failOnWarnings bool
+
+// partialRe matches warnings of Thanos about stores that could not be queried, e.g.
+// "receive series from Addr: thanos-store:10901: rpc error: code = Unavailable".
+var partialRe = regexp.MustCompile(`(?i)partial|receive series from|rpc error|unavailable|no store`)
+
+// handleWarnings makes f print, or with --fail-on-warnings and --fail-on-partial fail on, the
+// warnings of query responses. Warnings about stores that could not be queried are highlighted,
+// as the response lacks their data.
+func handleWarnings(f *fetcher.Fetcher) *fetcher.Fetcher {
+	f.OnWarnings = func(endpoint string, warnings []string) error {
+		partial := false
+		for _, w := range warnings {
+			if partialRe.MatchString(w) {
+				partial = true
+			}
+		}
+
+		switch {
+		case failOnWarnings:
+			return fmt.Errorf("response from context %s for %s has warnings: %s", f.Context(), endpoint, strings.Join(warnings, "; "))
+		case failOnPartial && partial:
+			return fmt.Errorf("partial response from context %s for %s: %s", f.Context(), endpoint, strings.Join(warnings, "; "))
+		case partial:
+			level.Warn(logger).Log("msg", "PARTIAL RESPONSE, results may be incomplete", "context", f.Context(), "endpoint", endpoint, "warnings", strings.Join(warnings, "; "))
+		default:
+			for _, w := range warnings {
+				level.Warn(logger).Log("msg", "query returned warning", "context", f.Context(), "endpoint", endpoint, "warning", w)
+			}
+		}
+		return nil
+	}
+	return f
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	clearScreen    = "\033[H\033[2J"
+	highlightStart = "\033[7m"
+	highlightEnd   = "\033[0m"
+)
+
+var watch bool
+var watchInterval time.Duration
+
+// watchable wraps the run function of a read command, so that with --watch it is re-executed
+// every --interval until ctx is cancelled. Like watch(1), the screen is cleared before each
+// execution and characters that changed since the previous one are highlighted.
+func watchable(ctx context.Context, run func(*cobra.Command, []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if !watch {
+			return run(cmd, args)
+		}
+
+		out := cmd.OutOrStdout()
+		defer cmd.SetOut(out)
+
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		var prev []string
+		for {
+			var buf bytes.Buffer
+			cmd.SetOut(&buf)
+			if err := run(cmd, args); err != nil {
+				fmt.Fprintf(&buf, "Error: %v\n", err)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+			fmt.Fprint(out, clearScreen)
+			fmt.Fprintf(out, "Every %s: %s %s    %s\n\n", watchInterval, cmd.CommandPath(), strings.Join(args, " "), time.Now().Format(time.RFC1123))
+			for i, l := range lines {
+				var old string
+				if i < len(prev) {
+					old = prev[i]
+				}
+				if prev == nil {
+					fmt.Fprintln(out, l)
+					continue
+				}
+				fmt.Fprintln(out, highlightChanges(old, l))
+			}
+			prev = lines
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// highlightChanges returns line with all runes that differ from old at the same position highlighted.
+func highlightChanges(old, line string) string {
+	o, n := []rune(old), []rune(line)
+
+	var sb strings.Builder
+	highlighted := false
+	for i, r := range n {
+		changed := i >= len(o) || o[i] != r
+		if changed != highlighted {
+			if changed {
+				sb.WriteString(highlightStart)
+			} else {
+				sb.WriteString(highlightEnd)
+			}
+			highlighted = changed
+		}
+		sb.WriteRune(r)
+	}
+	if highlighted {
+		sb.WriteString(highlightEnd)
+	}
+	return sb.String()
+}
@@ -0,0 +1,914 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	configDirName  = "obsctl"
+	configFileName = "config.json"
+)
+
+// defaultConfigPath returns the path of the obsctl config file inside the user config directory.
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("getting user config dir: %w", err)
+	}
+
+	return filepath.Join(dir, configDirName, configFileName), nil
+}
+
+// getConfigPath returns the path of the config file changes are written to, the first of Files.
+func getConfigPath() (string, error) {
+	paths, err := files()
+	if err != nil {
+		return "", err
+	}
+	return paths[0], nil
+}
+
+// Dir returns the directory of the config file, in which other local state of obsctl is kept as well.
+func Dir() (string, error) {
+	file, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(file), nil
+}
+
+// Config represents the structure of the configuration file.
+type Config struct {
+	APIs    map[string]APIConfig `json:"apis"`
+	Current Context              `json:"current"`
+
+	// Queries are named PromQL queries, which can be parameterized with Go templates, e.g. {{ .namespace }}.
+	Queries map[string]SavedQuery `json:"queries,omitempty"`
+
+	// CredentialStore is where client secrets and tokens are saved, one of CredentialStores.
+	// CredentialStoreFile if empty.
+	CredentialStore string `json:"credentialStore,omitempty"`
+
+	// base is the merged config of all config files but the first, if there are several, see Files.
+	base *Config
+	// raw is the first config file as read, before expanding environment variables, see Read.
+	raw *Config
+	// fileCurrent is the current context of the config files while CurrentOverride applies.
+	fileCurrent *Context
+	// stored are the credentials in the keyring referenced by the first config file by key, as
+	// they were read or last saved, see storeCredentials.
+	stored map[string]string
+}
+
+// CurrentOverride, if set, is used as current context instead of the one of the config files,
+// without ever being saved, so that e.g. scripts can run commands against several contexts at once.
+var CurrentOverride Context
+
+// SavedQuery is a named query saved in the configuration.
+type SavedQuery struct {
+	Query       string `json:"query"`
+	Description string `json:"description,omitempty"`
+}
+
+// Context identifies a tenant of a particular API.
+type Context struct {
+	API    string `json:"api"`
+	Tenant string `json:"tenant"`
+}
+
+// APIConfig represents configuration for an instance of Observatorium.
+type APIConfig struct {
+	URL      string                  `json:"url"`
+	Contexts map[string]TenantConfig `json:"contexts"`
+
+	// GrafanaURL is the URL of a Grafana instance with the API as datasource, used to generate Explore links.
+	GrafanaURL string `json:"grafanaURL,omitempty"`
+
+	// Paths are the path templates of the APIs of signals by signal name, for gateways mounted under
+	// other prefixes, e.g. {"metrics": "/observatorium/api/metrics/v1/{tenant}"}. Signals without a
+	// path use DefaultPath.
+	Paths map[string]string `json:"paths,omitempty"`
+
+	// Flavor is the kind of backend serving the API, FlavorObservatorium if empty.
+	Flavor string `json:"flavor,omitempty"`
+
+	// CAFile is the path of a PEM bundle of CAs the certificate of the API is verified against,
+	// instead of the system certificates, e.g. for APIs behind an internal CA.
+	CAFile string `json:"caFile,omitempty"`
+}
+
+// Flavors of APIs.
+const (
+	// FlavorObservatorium APIs have the tenant in their paths and replace all rules of a tenant at once.
+	FlavorObservatorium = "observatorium"
+	// FlavorCortex APIs, like Cortex and Mimir, identify the tenant with the X-Scope-OrgID header
+	// and manage rules in namespaces of rule groups with the ruler configuration API.
+	FlavorCortex = "cortex"
+)
+
+// Flavors are all flavors of APIs.
+var Flavors = []string{FlavorObservatorium, FlavorCortex}
+
+// DefaultPath is the path template of the API of a signal, with {signal} and {tenant} being replaced
+// by the names of the signal and tenant.
+const DefaultPath = "/api/{signal}/v1/{tenant}"
+
+// Path returns the path of the API of the signal for the tenant, see Paths.
+func (a APIConfig) Path(signal, tenant string) string {
+	tmpl, ok := a.Paths[signal]
+	if !ok {
+		tmpl = DefaultPath
+	}
+	return strings.NewReplacer("{signal}", signal, "{tenant}", tenant).Replace(tmpl)
+}
+
+// TenantConfig represents configuration for a tenant.
+type TenantConfig struct {
+	OIDC   *OIDCConfig `json:"oidc"`
+	Tenant string      `json:"tenant"`
+	// TokenFile is the path of a file the bearer token is read from, as alternative to OIDC.
+	// The file is read again when it changes, see fileTokenSource.
+	TokenFile string `json:"tokenFile,omitempty"`
+
+	// Timezone is the name of the time zone timestamps are displayed in by default.
+	Timezone string `json:"timezone,omitempty"`
+	// DefaultRange is the time range queried when commands are not given a start, e.g. 1h.
+	DefaultRange string `json:"defaultRange,omitempty"`
+	// LookbackDelta is the lookback delta of instant queries, e.g. 5m. The API's default is used if empty.
+	LookbackDelta string `json:"lookbackDelta,omitempty"`
+	// TLSCert and TLSKey are the paths of the PEM-encoded client certificate and key presented to
+	// the API, for gateways authenticating tenants with mTLS. Both or none are set.
+	TLSCert string `json:"tlsCert,omitempty"`
+	TLSKey  string `json:"tlsKey,omitempty"`
+	// RulesPublicKey is the public key rule files have to be signed with before they are set for the
+	// tenant. Unsigned rule files are accepted if empty.
+	RulesPublicKey string `json:"rulesPublicKey,omitempty"`
+}
+
+// OIDCConfig represents OIDC auth config for a tenant.
+type OIDCConfig struct {
+	Token *oauth2.Token `json:"token"`
+
+	Audience     Audiences `json:"audience"`
+	ClientID     string    `json:"clientID"`
+	ClientSecret string    `json:"clientSecret"`
+	IssuerURL    string    `json:"issuerURL"`
+	// EndpointParams are additional parameters of token requests, e.g. resource.
+	EndpointParams url.Values `json:"endpointParams,omitempty"`
+
+	// IssuerCAFile is the path of a PEM bundle of CAs the issuer's certificate is verified against,
+	// instead of the system certificates. It is only used for discovery and token requests.
+	IssuerCAFile string `json:"issuerCAFile,omitempty"`
+	// IssuerInsecureSkipVerify disables the verification of the issuer's certificate.
+	IssuerInsecureSkipVerify bool `json:"issuerInsecureSkipVerify,omitempty"`
+	// GrantType is the grant type tokens are obtained with, one of GrantTypes. GrantClientCredentials if empty.
+	GrantType string `json:"grantType,omitempty"`
+	// WebListen is the address of the local listener receiving the redirect of logins with
+	// GrantAuthorizationCode, DefaultWebListen if empty. It is kept so that logging in again, e.g. when
+	// the refresh token expired, uses the redirect URL registered for the client.
+	WebListen string `json:"webListen,omitempty"`
+	// Credentials references the client secret and token in the keyring, e.g. keyring:prod/team-a,
+	// with CredentialStoreKeyring. Both are read from it when the config is read, see Read.
+	Credentials string `json:"credentials,omitempty"`
+}
+
+// Audiences are the audiences tokens are requested for. A single audience is stored as plain
+// string, as it was before multiple audiences were supported.
+type Audiences []string
+
+// MarshalJSON implements json.Marshaler.
+func (a Audiences) MarshalJSON() ([]byte, error) {
+	switch len(a) {
+	case 0:
+		return json.Marshal("")
+	case 1:
+		return json.Marshal(a[0])
+	default:
+		return json.Marshal([]string(a))
+	}
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *Audiences) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = nil
+		if s != "" {
+			*a = Audiences{s}
+		}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// issuerClient returns the HTTP client used for requests to the issuer, or nil if the default
+// client is used.
+func (c *OIDCConfig) issuerClient() (*http.Client, error) {
+	if c.IssuerCAFile == "" && !c.IssuerInsecureSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.IssuerInsecureSkipVerify}
+	if c.IssuerCAFile != "" {
+		pool, err := loadCAs(c.IssuerCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading issuer CA: %w", err)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// Transport returns the transport of requests of the tenant to the API, which verifies the
+// certificate of the API against CAFile and presents the client certificate of the tenant, if set.
+func (a APIConfig) Transport(t TenantConfig) (http.RoundTripper, error) {
+	tlsConfig, err := a.TLSConfig(t)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		return http.DefaultTransport, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// TLSConfig returns the TLS config of connections of the tenant to the API, see Transport, or nil
+// if the defaults are used.
+func (a APIConfig) TLSConfig(t TenantConfig) (*tls.Config, error) {
+	if a.CAFile == "" && t.TLSCert == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if a.CAFile != "" {
+		pool, err := loadCAs(a.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading API CA: %w", err)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(t.TLSCert, t.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("reading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// loadCAs returns a pool of the certificates in the PEM bundle file.
+func loadCAs(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", file)
+	}
+	return pool, nil
+}
+
+// Client returns an HTTP client authenticated for the tenant. If OIDC is configured,
+// a token is fetched (or the stored one reused while valid) and kept in t.OIDC.Token,
+// so that callers can persist it with Save. If a token file is configured, the token is
+// read from it on every request instead. Requests to the API are made with the client of ctx, see
+// oauth2.HTTPClient, or http.DefaultClient if there is none.
+func (t *TenantConfig) Client(ctx context.Context, logger log.Logger) (*http.Client, error) {
+	if t.TokenFile != "" {
+		ts := &fileTokenSource{path: t.TokenFile}
+		// Fail early if the file can't be read, rather than on the first request.
+		if _, err := ts.Token(); err != nil {
+			return nil, err
+		}
+		return oauth2.NewClient(ctx, ts), nil
+	}
+	if t.OIDC == nil {
+		return oauth2.NewClient(ctx, nil), nil
+	}
+
+	// Requests to the issuer may need other TLS settings than those to the API.
+	issuerCtx, _, provider, err := t.OIDC.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &earlyReuseTokenSource{
+		t:      t.OIDC.Token,
+		window: TokenRefreshWindow,
+	}
+
+	if t.OIDC.Interactive() {
+		// Only the user can log in again, tokens are renewed with the refresh token meanwhile.
+		ts.src = func() (*oauth2.Token, error) { return t.OIDC.refresh(issuerCtx, provider.Endpoint(), ts.t) }
+	} else {
+		ccc := clientcredentials.Config{
+			ClientID:     t.OIDC.ClientID,
+			ClientSecret: t.OIDC.ClientSecret,
+			TokenURL:     provider.Endpoint().TokenURL,
+			Scopes:       []string{"openid", "offline_access"},
+		}
+
+		if len(t.OIDC.Audience) > 0 || len(t.OIDC.EndpointParams) > 0 {
+			ccc.EndpointParams = url.Values{}
+			for k, vs := range t.OIDC.EndpointParams {
+				ccc.EndpointParams[k] = append([]string(nil), vs...)
+			}
+			for _, a := range t.OIDC.Audience {
+				ccc.EndpointParams.Add("audience", a)
+			}
+		}
+		ts.src = func() (*oauth2.Token, error) { return ccc.Token(issuerCtx) }
+	}
+
+	tkn, err := ts.Token()
+	if err != nil {
+		return nil, fmt.Errorf("fetching token: %w", err)
+	}
+
+	if t.OIDC.Token == nil || tkn.AccessToken != t.OIDC.Token.AccessToken {
+		level.Debug(logger).Log("msg", "fetched new token", "tenant", t.Tenant)
+		t.OIDC.Token = tkn
+	}
+
+	return oauth2.NewClient(ctx, ts), nil
+}
+
+// TokenRefreshWindow is the time before their expiry at which tokens are refreshed, so that they
+// don't expire between obtaining them and a request reaching the API.
+var TokenRefreshWindow = 2 * time.Minute
+
+// earlyReuseTokenSource is like oauth2.ReuseTokenSource, but fetches a new token as soon as the
+// current one expires within window instead of at expiry.
+type earlyReuseTokenSource struct {
+	mtx    sync.Mutex
+	t      *oauth2.Token
+	src    func() (*oauth2.Token, error)
+	window time.Duration
+}
+
+// Token implements oauth2.TokenSource.
+func (s *earlyReuseTokenSource) Token() (*oauth2.Token, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if fresh(s.t, s.window) {
+		return s.t, nil
+	}
+
+	t, err := s.src()
+	if err != nil {
+		return nil, err
+	}
+	s.t = t
+	return t, nil
+}
+
+// fresh reports whether the token is set and does not expire within window.
+func fresh(t *oauth2.Token, window time.Duration) bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || time.Until(t.Expiry) > window)
+}
+
+// TokenFresh reports whether the stored token can be used without refreshing it, see TokenRefreshWindow.
+func (c *OIDCConfig) TokenFresh() bool {
+	return fresh(c.Token, TokenRefreshWindow)
+}
+
+// SameCredentials reports whether tokens obtained with the credentials of o can be used in place of
+// tokens obtained with those of c, i.e. both use the same client of the same issuer for the same audience.
+func (c *OIDCConfig) SameCredentials(o *OIDCConfig) bool {
+	return c != nil && o != nil &&
+		c.IssuerURL == o.IssuerURL &&
+		c.ClientID == o.ClientID &&
+		c.ClientSecret == o.ClientSecret &&
+		c.GrantType == o.GrantType &&
+		strings.Join(c.Audience, "\x00") == strings.Join(o.Audience, "\x00") &&
+		c.EndpointParams.Encode() == o.EndpointParams.Encode()
+}
+
+// CredentialsKey returns a key that is equal for configs with the same credentials, see SameCredentials.
+// It doesn't reveal the credentials, so that it can be used e.g. in file names.
+func (c *OIDCConfig) CredentialsKey() string {
+	h := sha256.New()
+	for _, s := range []string{c.IssuerURL, c.ClientID, c.ClientSecret, c.GrantType, strings.Join(c.Audience, "\x00"), c.EndpointParams.Encode()} {
+		fmt.Fprintf(h, "%q\n", s)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// SharedToken returns a fresh token of any context with the same credentials as oidc, see
+// SameCredentials, other than the token except. It returns nil if there is none.
+func (c *Config) SharedToken(oidc *OIDCConfig, except string) *oauth2.Token {
+	for _, ctx := range c.Contexts() {
+		t := c.APIs[ctx.API].Contexts[ctx.Tenant]
+		if t.OIDC.SameCredentials(oidc) && t.OIDC.TokenFresh() && t.OIDC.Token.AccessToken != except {
+			return t.OIDC.Token
+		}
+	}
+	return nil
+}
+
+// ShareToken sets the token of all contexts with the same credentials as oidc, see SameCredentials,
+// so that they don't each fetch a token of their own.
+func (c *Config) ShareToken(oidc *OIDCConfig, token *oauth2.Token) {
+	for _, ctx := range c.Contexts() {
+		t := c.APIs[ctx.API].Contexts[ctx.Tenant]
+		if !t.OIDC.SameCredentials(oidc) {
+			continue
+		}
+		shared := *t.OIDC
+		shared.Token = token
+		t.OIDC = &shared
+		c.APIs[ctx.API].Contexts[ctx.Tenant] = t
+	}
+}
+
+// Read loads the configuration from the config files, merged as described for Files. An empty
+// configuration is returned if no file exists yet. The current context is CurrentOverride if set.
+//
+// All string values and keys of the files may contain ${VAR} placeholders, which are replaced by
+// the value of the environment variable VAR, or ${VAR:-default} to use default if VAR is unset or
+// empty, so that one config file can serve several environments. $${ stands for a literal ${.
+// Placeholders of unset variables without default are an error. Save keeps the placeholders of
+// values that were not changed.
+func Read(logger log.Logger) (*Config, error) {
+	paths, err := files()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		fcs    []*Config
+		raw    *Config
+		stored = map[string]string{}
+	)
+	for i, file := range paths {
+		fc, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if fc == nil {
+			level.Debug(logger).Log("msg", "config file does not exist, skipping it", "path", file)
+			fc = &Config{APIs: map[string]APIConfig{}}
+		}
+		if i == 0 {
+			if raw, err = fc.clone(); err != nil {
+				return nil, fmt.Errorf("reading config file %s: %w", file, err)
+			}
+		}
+		if err := expandEnv(reflect.ValueOf(fc).Elem(), ""); err != nil {
+			return nil, fmt.Errorf("expanding environment variables in config file %s: %w", file, err)
+		}
+		// Only the credentials of the first file are saved again, see Save.
+		loaded := stored
+		if i > 0 {
+			loaded = map[string]string{}
+		}
+		if err := fc.loadCredentials(logger, loaded); err != nil {
+			return nil, fmt.Errorf("reading config file %s: %w", file, err)
+		}
+		fcs = append(fcs, fc)
+	}
+
+	cfg := &Config{APIs: map[string]APIConfig{}, raw: raw, stored: stored}
+	if len(fcs) > 1 {
+		// Keep the config of the other files to only write differences from it to the first file.
+		base := &Config{APIs: map[string]APIConfig{}}
+		for _, fc := range fcs[1:] {
+			base.merge(fc)
+		}
+		if cfg.base, err = base.clone(); err != nil {
+			return nil, fmt.Errorf("merging config files: %w", err)
+		}
+	}
+	for _, fc := range fcs {
+		cfg.merge(fc)
+	}
+
+	if CurrentOverride != (Context{}) {
+		fileCurrent := cfg.Current
+		cfg.fileCurrent = &fileCurrent
+		cfg.Current = CurrentOverride
+	}
+
+	return cfg, nil
+}
+
+// Save writes the configuration to the first config file, creating its directory if needed. Changes
+// of other processes since the config was read are overwritten, see Update to keep them.
+func (c *Config) Save(logger log.Logger) error {
+	file, err := getConfigPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("creating config dir: %w", err)
+	}
+
+	toSave := c
+	if c.fileCurrent != nil {
+		// The overridden current context is not saved.
+		cfg := *c
+		cfg.Current = *c.fileCurrent
+		toSave = &cfg
+	}
+	if c.base != nil {
+		toSave = toSave.without(c.base)
+	}
+	// Work on a copy, moving credentials and restoring placeholders must not change the config in use.
+	if toSave, err = toSave.clone(); err != nil {
+		return fmt.Errorf("marshaling config: %w", err)
+	}
+	if err := c.storeCredentials(toSave); err != nil {
+		return err
+	}
+	if c.raw != nil {
+		restoreEnv(reflect.ValueOf(toSave).Elem(), reflect.ValueOf(c.raw).Elem())
+	}
+
+	b, err := json.MarshalIndent(toSave, "", "\t")
+	if err != nil {
+		return fmt.Errorf("marshaling config: %w", err)
+	}
+
+	// Replace the file atomically, so that concurrently running processes never read a partial config.
+	tmp, err := os.CreateTemp(filepath.Dir(file), configFileName+".tmp")
+	if err != nil {
+		return fmt.Errorf("creating config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing config file %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing config file %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("writing config file %s: %w", file, err)
+	}
+
+	c.removeCredentials(logger, toSave)
+
+	level.Debug(logger).Log("msg", "saved config", "path", file)
+	return nil
+}
+
+// AddAPI adds a new Observatorium API to the configuration.
+func (c *Config) AddAPI(logger log.Logger, name, apiURL string) error {
+	if _, ok := c.APIs[name]; ok {
+		return fmt.Errorf("api with name %s already exists", name)
+	}
+
+	if _, err := url.Parse(apiURL); err != nil {
+		return fmt.Errorf("parsing api url %s: %w", apiURL, err)
+	}
+
+	c.APIs[name] = APIConfig{URL: apiURL, Contexts: map[string]TenantConfig{}}
+
+	level.Debug(logger).Log("msg", "added api", "name", name, "url", apiURL)
+	return nil
+}
+
+// UpdateAPI updates the URL, Grafana URL and flavor of an existing API. Empty values are left unchanged.
+func (c *Config) UpdateAPI(logger log.Logger, name, apiURL, grafanaURL, flavor string, paths map[string]string) error {
+	a, ok := c.APIs[name]
+	if !ok {
+		return fmt.Errorf("api with name %s doesn't exist", name)
+	}
+
+	if apiURL != "" {
+		if _, err := url.Parse(apiURL); err != nil {
+			return fmt.Errorf("parsing api url %s: %w", apiURL, err)
+		}
+		a.URL = apiURL
+	}
+
+	if grafanaURL != "" {
+		if _, err := url.Parse(grafanaURL); err != nil {
+			return fmt.Errorf("parsing grafana url %s: %w", grafanaURL, err)
+		}
+		a.GrafanaURL = grafanaURL
+	}
+
+	switch flavor {
+	case "":
+	case FlavorObservatorium:
+		// The default is not stored, so that configs stay as they were.
+		a.Flavor = ""
+	case FlavorCortex:
+		a.Flavor = flavor
+	default:
+		return fmt.Errorf("unknown flavor %s, expected one of: %s", flavor, strings.Join(Flavors, "|"))
+	}
+
+	// Empty paths reset the signal to DefaultPath.
+	for signal, p := range paths {
+		if p == "" {
+			delete(a.Paths, signal)
+			continue
+		}
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("path %s of signal %s must start with /", p, signal)
+		}
+		if a.Paths == nil {
+			a.Paths = map[string]string{}
+		}
+		a.Paths[signal] = p
+	}
+
+	c.APIs[name] = a
+
+	level.Debug(logger).Log("msg", "updated api", "name", name)
+	return nil
+}
+
+// AddTenant adds a tenant to an existing API in the configuration.
+func (c *Config) AddTenant(logger log.Logger, api, tenant string, oidcCfg *OIDCConfig) error {
+	a, ok := c.APIs[api]
+	if !ok {
+		return fmt.Errorf("api with name %s doesn't exist", api)
+	}
+
+	if a.Contexts == nil {
+		a.Contexts = map[string]TenantConfig{}
+	}
+
+	if _, ok := a.Contexts[tenant]; ok {
+		return fmt.Errorf("tenant %s already exists for api %s", tenant, api)
+	}
+
+	a.Contexts[tenant] = TenantConfig{OIDC: oidcCfg, Tenant: tenant}
+	c.APIs[api] = a
+
+	level.Debug(logger).Log("msg", "added tenant", "api", api, "tenant", tenant)
+	return nil
+}
+
+// RemoveTenant removes the context of a tenant. If it is the current context, no context is
+// current anymore. Contexts of config files other than the first can't be removed, see Files.
+func (c *Config) RemoveTenant(logger log.Logger, api, tenant string) error {
+	a, ok := c.APIs[api]
+	if !ok {
+		return fmt.Errorf("api with name %s doesn't exist", api)
+	}
+	if _, ok := a.Contexts[tenant]; !ok {
+		return fmt.Errorf("tenant %s doesn't exist for api %s", tenant, api)
+	}
+	if c.base != nil {
+		if _, ok := c.base.APIs[api].Contexts[tenant]; ok {
+			return fmt.Errorf("tenant %s of api %s is defined in another config file than the first and can't be removed", tenant, api)
+		}
+	}
+
+	delete(a.Contexts, tenant)
+	c.APIs[api] = a
+
+	removed := Context{API: api, Tenant: tenant}
+	if c.Current == removed {
+		c.Current = Context{}
+	}
+	if c.fileCurrent != nil && *c.fileCurrent == removed {
+		c.fileCurrent = &Context{}
+	}
+
+	level.Debug(logger).Log("msg", "removed tenant", "api", api, "tenant", tenant)
+	return nil
+}
+
+// UpdateTenant replaces the stored configuration of an existing tenant, e.g. after its token was refreshed.
+func (c *Config) UpdateTenant(api string, tc TenantConfig) error {
+	a, ok := c.APIs[api]
+	if !ok {
+		return fmt.Errorf("api with name %s doesn't exist", api)
+	}
+
+	if _, ok := a.Contexts[tc.Tenant]; !ok {
+		return fmt.Errorf("tenant %s doesn't exist for api %s", tc.Tenant, api)
+	}
+
+	a.Contexts[tc.Tenant] = tc
+	return nil
+}
+
+// RotateClientSecret sets the client secret of all contexts authenticating with the OIDC client
+// clientID of issuerURL and discards their stored tokens, so that new ones are fetched with the
+// new secret. It returns the contexts whose secret changed.
+func (c *Config) RotateClientSecret(issuerURL, clientID, secret string) []Context {
+	var rotated []Context
+	for _, ctx := range c.Contexts() {
+		t := c.APIs[ctx.API].Contexts[ctx.Tenant]
+		if t.OIDC == nil || t.OIDC.IssuerURL != issuerURL || t.OIDC.ClientID != clientID || t.OIDC.ClientSecret == secret {
+			continue
+		}
+
+		oidc := *t.OIDC
+		oidc.ClientSecret, oidc.Token = secret, nil
+		t.OIDC = &oidc
+		c.APIs[ctx.API].Contexts[ctx.Tenant] = t
+		rotated = append(rotated, ctx)
+	}
+	return rotated
+}
+
+// SaveQuery saves a named query, replacing any existing query with the same name.
+func (c *Config) SaveQuery(logger log.Logger, name string, q SavedQuery) error {
+	if _, err := template.New(name).Parse(q.Query); err != nil {
+		return fmt.Errorf("parsing query template: %w", err)
+	}
+
+	if c.Queries == nil {
+		c.Queries = map[string]SavedQuery{}
+	}
+	c.Queries[name] = q
+
+	level.Debug(logger).Log("msg", "saved query", "name", name)
+	return nil
+}
+
+// RemoveQuery removes a named query.
+func (c *Config) RemoveQuery(logger log.Logger, name string) error {
+	if _, ok := c.Queries[name]; !ok {
+		return fmt.Errorf("query with name %s doesn't exist", name)
+	}
+	delete(c.Queries, name)
+
+	level.Debug(logger).Log("msg", "removed query", "name", name)
+	return nil
+}
+
+// RenderQuery returns the named query with its template parameters replaced by params.
+// All parameters used by the query must be given.
+func (c *Config) RenderQuery(name string, params map[string]string) (string, error) {
+	q, ok := c.Queries[name]
+	if !ok {
+		return "", fmt.Errorf("query with name %s doesn't exist", name)
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Parse(q.Query)
+	if err != nil {
+		return "", fmt.Errorf("parsing query template: %w", err)
+	}
+
+	var sb strings.Builder
+	if err := t.Execute(&sb, params); err != nil {
+		return "", fmt.Errorf("rendering query %s: %w", name, err)
+	}
+	return sb.String(), nil
+}
+
+// GetCurrent returns the API and tenant configuration of the current context. If the current context
+// is not set or does not exist, a *CurrentContextError is returned.
+func (c *Config) GetCurrent() (APIConfig, TenantConfig, error) {
+	if c.Current.API == "" || c.Current.Tenant == "" {
+		return APIConfig{}, TenantConfig{}, &CurrentContextError{Err: errors.New("current context is empty"), Contexts: c.Contexts()}
+	}
+
+	a, t, err := c.GetContext(c.Current)
+	if err != nil {
+		return APIConfig{}, TenantConfig{}, &CurrentContextError{Err: err, Contexts: c.Contexts(), Overridden: c.fileCurrent != nil}
+	}
+	return a, t, nil
+}
+
+// CurrentContextError is returned if the current context is not set or does not exist. Its message
+// lists the configured contexts and how to switch to one of them or log in.
+type CurrentContextError struct {
+	Err      error
+	Contexts []Context
+	// Overridden is set if the current context is CurrentOverride.
+	Overridden bool
+}
+
+func (e *CurrentContextError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Err.Error())
+
+	if len(e.Contexts) == 0 {
+		sb.WriteString(", no contexts are configured. Log in to one with:\n")
+		sb.WriteString("  obsctl login --api <url> --tenant <tenant> --oidc.issuer-url=... --oidc.client-id=... --oidc.client-secret=...")
+		return sb.String()
+	}
+
+	sb.WriteString(", available contexts are:\n")
+	for _, c := range e.Contexts {
+		sb.WriteString("  " + c.String() + "\n")
+	}
+	if e.Overridden {
+		fmt.Fprintf(&sb, "Use one with --context %s, or log in to another with 'obsctl login'.", e.Contexts[0])
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "Switch to one with 'obsctl context switch %s', or log in to another with 'obsctl login'.", e.Contexts[0])
+	return sb.String()
+}
+
+func (e *CurrentContextError) Unwrap() error {
+	return e.Err
+}
+
+// GetContext returns the API and tenant configuration of the given context.
+func (c *Config) GetContext(ctx Context) (APIConfig, TenantConfig, error) {
+	a, ok := c.APIs[ctx.API]
+	if !ok {
+		return APIConfig{}, TenantConfig{}, fmt.Errorf("api with name %s doesn't exist", ctx.API)
+	}
+
+	t, ok := a.Contexts[ctx.Tenant]
+	if !ok {
+		return APIConfig{}, TenantConfig{}, fmt.Errorf("tenant %s doesn't exist for api %s", ctx.Tenant, ctx.API)
+	}
+
+	return a, t, nil
+}
+
+// Contexts returns all configured contexts, sorted by API and tenant name.
+func (c *Config) Contexts() []Context {
+	var res []Context
+	for name, a := range c.APIs {
+		for tenant := range a.Contexts {
+			res = append(res, Context{API: name, Tenant: tenant})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].API != res[j].API {
+			return res[i].API < res[j].API
+		}
+		return res[i].Tenant < res[j].Tenant
+	})
+	return res
+}
+
+// String returns the context in the api/tenant notation.
+func (c Context) String() string {
+	return c.API + "/" + c.Tenant
+}
+
+// SetAPICA sets the CA file the certificate of the API is verified against, see APIConfig.CAFile.
+// An empty file resets it to the system certificates.
+func (c *Config) SetAPICA(logger log.Logger, name, caFile string) error {
+	a, ok := c.APIs[name]
+	if !ok {
+		return fmt.Errorf("api with name %s doesn't exist", name)
+	}
+
+	a.CAFile = caFile
+	// Fail before the config is saved rather than on the next request.
+	if _, err := a.Transport(TenantConfig{}); err != nil {
+		return err
+	}
+	c.APIs[name] = a
+
+	level.Debug(logger).Log("msg", "set api CA", "name", name, "file", caFile)
+	return nil
+}
+
+// SetCurrent switches the current context to the given API and tenant.
+func (c *Config) SetCurrent(logger log.Logger, api, tenant string) error {
+	a, ok := c.APIs[api]
+	if !ok {
+		return fmt.Errorf("api with name %s doesn't exist", api)
+	}
+
+	if _, ok := a.Contexts[tenant]; !ok {
+		return fmt.Errorf("tenant %s doesn't exist for api %s", tenant, api)
+	}
+
+	c.Current = Context{API: api, Tenant: tenant}
+	// Switching contexts is saved even while CurrentOverride applies.
+	c.fileCurrent = nil
+
+	level.Debug(logger).Log("msg", "switched current context", "api", api, "tenant", tenant)
+	return nil
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// placeholder matches the placeholders expanded in config values: ${VAR} is replaced by the value
+// of the environment variable VAR and ${VAR:-default} by default if VAR is unset or empty. $${
+// stands for a literal ${.
+var placeholder = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// EnvError is returned for placeholders of unset environment variables without default.
+type EnvError struct {
+	// Path locates the value in the config file, e.g. apis.prod.url.
+	Path string
+	Name string
+}
+
+func (e *EnvError) Error() string {
+	return fmt.Sprintf("%s: environment variable %s is not set", e.Path, e.Name)
+}
+
+// expandString returns s with its placeholders replaced, see placeholder. The name of the first
+// unset variable without default is returned if there is one.
+func expandString(s string) (string, string) {
+	if !strings.Contains(s, "${") {
+		return s, ""
+	}
+
+	var unset string
+	res := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$${" {
+			return "${"
+		}
+		sub := placeholder.FindStringSubmatch(m)
+		v, ok := os.LookupEnv(sub[1])
+		switch {
+		case strings.Contains(m, ":-") && v == "":
+			return sub[2]
+		case !ok && unset == "":
+			unset = sub[1]
+		}
+		return v
+	})
+	return res, unset
+}
+
+// expandEnv replaces the placeholders in all strings of v, including map keys, see placeholder.
+// v must be settable. Values behind pointers are changed in place. path locates v in errors.
+func expandEnv(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return expandEnv(v.Elem(), path)
+	case reflect.String:
+		s, unset := expandString(v.String())
+		if unset != "" {
+			return &EnvError{Path: path, Name: unset}
+		}
+		v.SetString(s)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				// Unexported.
+				continue
+			}
+			if err := expandEnv(v.Field(i), join(path, fieldName(t.Field(i)))); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := expandEnv(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		res := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k := iter.Key()
+			if k.Kind() == reflect.String {
+				s, unset := expandString(k.String())
+				if unset != "" {
+					return &EnvError{Path: join(path, k.String()), Name: unset}
+				}
+				k = reflect.ValueOf(s).Convert(v.Type().Key())
+				if res.MapIndex(k).IsValid() {
+					return fmt.Errorf("%s: duplicate key %s after expanding environment variables", path, s)
+				}
+			}
+
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(iter.Value())
+			if err := expandEnv(e, join(path, fmt.Sprint(k.Interface()))); err != nil {
+				return err
+			}
+			res.SetMapIndex(k, e)
+		}
+		v.Set(res)
+	}
+	return nil
+}
+
+// restoreEnv puts the placeholders of raw, the unexpanded counterpart of v, back into v wherever v
+// still has the value they expand to, so that saving a config does not replace placeholders by
+// their values. v must be settable and not share pointers with a config in use.
+func restoreEnv(v, raw reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || raw.IsNil() {
+			return
+		}
+		restoreEnv(v.Elem(), raw.Elem())
+	case reflect.String:
+		if r := raw.String(); strings.Contains(r, "${") {
+			if s, unset := expandString(r); unset == "" && s == v.String() {
+				v.SetString(r)
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath == "" {
+				restoreEnv(v.Field(i), raw.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if v.Len() != raw.Len() {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			restoreEnv(v.Index(i), raw.Index(i))
+		}
+	case reflect.Map:
+		if v.IsNil() || raw.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		// The raw keys by the keys they expand to.
+		rawKeys := map[string]reflect.Value{}
+		iter := raw.MapRange()
+		for iter.Next() {
+			if s, unset := expandString(iter.Key().String()); unset == "" {
+				rawKeys[s] = iter.Key()
+			}
+		}
+
+		res := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter = v.MapRange()
+		for iter.Next() {
+			k := iter.Key()
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(iter.Value())
+			if rk, ok := rawKeys[k.String()]; ok {
+				restoreEnv(e, raw.MapIndex(rk))
+				k = rk
+			}
+			res.SetMapIndex(k, e)
+		}
+		v.Set(res)
+	}
+}
+
+// fieldName returns the name of the field in config files.
+func fieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
@@ -0,0 +1,457 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Grant types tokens are obtained from the OIDC issuer with.
+const (
+	// GrantClientCredentials authenticates obsctl itself with the client secret, without user interaction.
+	GrantClientCredentials = "client-credentials"
+	// GrantDeviceCode authenticates a user, who confirms the login in a browser on any device, see
+	// https://tools.ietf.org/html/rfc8628. Tokens are renewed with the refresh token afterwards.
+	GrantDeviceCode = "device-code"
+	// GrantAuthorizationCode authenticates a user, who logs in with the browser of this machine, see
+	// https://tools.ietf.org/html/rfc8252. The authorization code is protected with PKCE, see
+	// https://tools.ietf.org/html/rfc7636. Tokens are renewed with the refresh token afterwards.
+	GrantAuthorizationCode = "authorization-code"
+)
+
+// GrantTypes are all grant types.
+var GrantTypes = []string{GrantClientCredentials, GrantDeviceCode, GrantAuthorizationCode}
+
+// ErrLoginRequired is returned if a token can only be obtained by logging in interactively again,
+// e.g. because the refresh token expired or was revoked.
+var ErrLoginRequired = errors.New("login expired, log in again with 'obsctl login --force'")
+
+// deviceCodeGrantType is the grant_type of token requests of the device authorization grant.
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Interactive reports whether tokens are obtained with the interaction of a user, and renewed
+// with refresh tokens.
+func (c *OIDCConfig) Interactive() bool {
+	return c.GrantType == GrantDeviceCode || c.GrantType == GrantAuthorizationCode
+}
+
+// DiscardToken discards the stored token, so that a new one is fetched. The refresh token of
+// interactive grants is kept, as it is the only way to get a new token without the user.
+func (c *OIDCConfig) DiscardToken() {
+	if c.Interactive() && c.Token != nil && c.Token.RefreshToken != "" {
+		c.Token = &oauth2.Token{RefreshToken: c.Token.RefreshToken}
+		return
+	}
+	c.Token = nil
+}
+
+// provider discovers the issuer. The returned context and client are those to use for requests to
+// the issuer, see issuerClient.
+func (c *OIDCConfig) provider(ctx context.Context) (context.Context, *http.Client, *oidc.Provider, error) {
+	ic, err := c.issuerClient()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ic == nil {
+		ic = http.DefaultClient
+	}
+	// Set the client even if it's the default one, so that the client for the API in ctx, if any, is
+	// not used for the issuer.
+	ctx = oidc.ClientContext(ctx, ic)
+
+	provider, err := oidc.NewProvider(ctx, c.IssuerURL)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("constructing oidc provider: %w", err)
+	}
+	return ctx, ic, provider, nil
+}
+
+// refresh returns a new token for the refresh token of t.
+func (c *OIDCConfig) refresh(ctx context.Context, endpoint oauth2.Endpoint, t *oauth2.Token) (*oauth2.Token, error) {
+	if t == nil || t.RefreshToken == "" {
+		return nil, ErrLoginRequired
+	}
+
+	oc := oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Endpoint:     endpoint,
+		Scopes:       []string{"openid", "offline_access"},
+	}
+	tkn, err := oc.TokenSource(ctx, &oauth2.Token{RefreshToken: t.RefreshToken}).Token()
+	if err != nil {
+		var rerr *oauth2.RetrieveError
+		if errors.As(err, &rerr) {
+			// The refresh token expired or was revoked.
+			return nil, fmt.Errorf("%w: %s", ErrLoginRequired, err)
+		}
+		return nil, err
+	}
+	return tkn, nil
+}
+
+// DeviceLogin logs in with the device authorization grant: it prints the URL and code the user
+// confirms the login with to w, and polls the issuer until the user did so, the code expired or
+// ctx is done. The token is kept in c.Token.
+func (c *OIDCConfig) DeviceLogin(ctx context.Context, w io.Writer) error {
+	issuerCtx, client, provider, err := c.provider(ctx)
+	if err != nil {
+		return err
+	}
+
+	var claims struct {
+		DeviceAuthURL string `json:"device_authorization_endpoint"`
+	}
+	if err := provider.Claims(&claims); err != nil {
+		return fmt.Errorf("decoding provider metadata: %w", err)
+	}
+	if claims.DeviceAuthURL == "" {
+		return fmt.Errorf("issuer %s does not support the device authorization grant", c.IssuerURL)
+	}
+
+	var auth struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		// VerificationURL is the non-standard name of VerificationURI used by some providers.
+		VerificationURL string `json:"verification_url"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+	}
+	if err := c.postForm(issuerCtx, client, claims.DeviceAuthURL, c.authParams(), &auth); err != nil {
+		return fmt.Errorf("requesting device code: %w", err)
+	}
+	if auth.VerificationURI == "" {
+		auth.VerificationURI = auth.VerificationURL
+	}
+
+	if auth.VerificationURIComplete != "" {
+		fmt.Fprintf(w, "To log in, open %s and confirm the code %s.\n", auth.VerificationURIComplete, auth.UserCode)
+	} else {
+		fmt.Fprintf(w, "To log in, open %s and enter the code %s.\n", auth.VerificationURI, auth.UserCode)
+	}
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	var deadline <-chan time.Time
+	if auth.ExpiresIn > 0 {
+		deadline = time.After(time.Duration(auth.ExpiresIn) * time.Second)
+	}
+
+	tokenParams := url.Values{"grant_type": []string{deviceCodeGrantType}, "device_code": []string{auth.DeviceCode}}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("the code expired before the login was confirmed")
+		case <-time.After(interval):
+		}
+
+		tkn, err := c.exchange(issuerCtx, client, provider.Endpoint().TokenURL, tokenParams)
+		var terr *tokenError
+		switch {
+		case err == nil:
+			c.Token = tkn
+			return nil
+		case errors.As(err, &terr) && terr.Code == "authorization_pending":
+		case errors.As(err, &terr) && terr.Code == "slow_down":
+			interval += 5 * time.Second
+		case errors.As(err, &terr) && terr.Code == "access_denied":
+			return fmt.Errorf("the login was denied")
+		case errors.As(err, &terr) && terr.Code == "expired_token":
+			return fmt.Errorf("the code expired before the login was confirmed")
+		default:
+			return fmt.Errorf("fetching token: %w", err)
+		}
+	}
+}
+
+// DefaultWebListen is the address of the listener of web logins, unless another one is configured,
+// see OIDCConfig.WebListen. Issuers usually allow redirects to any port of loopback addresses.
+const DefaultWebListen = "127.0.0.1:0"
+
+// CheckWebListen returns an error if listen is not an address of the loopback interface. The
+// listener of web logins receives authorization codes, so it must not be reachable from other machines.
+func CheckWebListen(listen string) error {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", listen, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("%s is not a loopback address, e.g. %s", listen, DefaultWebListen)
+}
+
+// WebLogin logs in with the authorization code grant: it listens on c.WebListen, an address of the
+// loopback interface, for the redirect of the issuer, calls open with the URL to log in at, usually
+// opening it in the browser, and waits until the user logged in or ctx is done. The URL is also
+// printed to w, in case it can't be opened. The token is kept in c.Token.
+func (c *OIDCConfig) WebLogin(ctx context.Context, w io.Writer, open func(url string) error) error {
+	listen := c.WebListen
+	if listen == "" {
+		listen = DefaultWebListen
+	}
+	if err := CheckWebListen(listen); err != nil {
+		return fmt.Errorf("listening for the login callback: %w", err)
+	}
+
+	issuerCtx, client, provider, err := c.provider(ctx)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("listening for the login callback: %w", err)
+	}
+	defer l.Close()
+	redirectURL := "http://" + l.Addr().String() + "/callback"
+
+	state, err := randomString()
+	if err != nil {
+		return err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	params := c.authParams()
+	params.Set("client_id", c.ClientID)
+	params.Set("response_type", "code")
+	params.Set("redirect_uri", redirectURL)
+	params.Set("state", state)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+	authURL := provider.Endpoint().AuthURL
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + params.Encode()
+	} else {
+		authURL += "?" + params.Encode()
+	}
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(rw, r)
+			return
+		}
+
+		q := r.URL.Query()
+		var res result
+		switch {
+		case q.Get("state") != state:
+			// Not the redirect of this login, e.g. a stale browser tab.
+			http.Error(rw, "Unexpected state, start the login again.", http.StatusBadRequest)
+			return
+		case q.Get("error") != "":
+			res.err = &tokenError{Code: q.Get("error"), Description: q.Get("error_description")}
+			http.Error(rw, "Login failed: "+res.err.Error(), http.StatusUnauthorized)
+		case q.Get("code") == "":
+			res.err = fmt.Errorf("redirect without authorization code")
+			http.Error(rw, "Login failed: no authorization code received.", http.StatusBadRequest)
+		default:
+			res.code = q.Get("code")
+			fmt.Fprintln(rw, "Logged in to obsctl. You can close this window.")
+		}
+
+		select {
+		case results <- res:
+		default:
+		}
+	})}
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Close()
+
+	fmt.Fprintf(w, "To log in, open %s\n", authURL)
+	if err := open(authURL); err != nil {
+		fmt.Fprintf(w, "Opening the browser failed, open the URL above manually: %s\n", err)
+	}
+
+	var res result
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res = <-results:
+	}
+	if res.err != nil {
+		return fmt.Errorf("logging in: %w", res.err)
+	}
+
+	tkn, err := c.exchange(issuerCtx, client, provider.Endpoint().TokenURL, url.Values{
+		"grant_type":    []string{"authorization_code"},
+		"code":          []string{res.code},
+		"redirect_uri":  []string{redirectURL},
+		"code_verifier": []string{verifier},
+	})
+	if err != nil {
+		return fmt.Errorf("fetching token: %w", err)
+	}
+	c.Token = tkn
+	return nil
+}
+
+// authParams returns the parameters of authorization requests of interactive grants.
+func (c *OIDCConfig) authParams() url.Values {
+	params := url.Values{"scope": []string{"openid offline_access"}}
+	for k, vs := range c.EndpointParams {
+		params[k] = append([]string(nil), vs...)
+	}
+	for _, a := range c.Audience {
+		params.Add("audience", a)
+	}
+	return params
+}
+
+// randomString returns a random URL-safe string, as used for PKCE code verifiers and states.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// exchange requests a token from the token endpoint with the given parameters, authenticating
+// with the client ID and, if set, the client secret.
+func (c *OIDCConfig) exchange(ctx context.Context, client *http.Client, tokenURL string, params url.Values) (*oauth2.Token, error) {
+	var resp struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := c.postForm(ctx, client, tokenURL, params, &resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" {
+		return nil, fmt.Errorf("token response without access token")
+	}
+
+	tkn := &oauth2.Token{AccessToken: resp.AccessToken, TokenType: resp.TokenType, RefreshToken: resp.RefreshToken}
+	if resp.ExpiresIn > 0 {
+		tkn.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return tkn, nil
+}
+
+// tokenError is the error response of the issuer, see https://tools.ietf.org/html/rfc6749#section-5.2.
+type tokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *tokenError) Error() string {
+	if e.Description != "" {
+		return e.Code + ": " + e.Description
+	}
+	return e.Code
+}
+
+// postForm posts params with the client credentials to endpoint of the issuer and decodes the JSON
+// response into v.
+func (c *OIDCConfig) postForm(ctx context.Context, client *http.Client, endpoint string, params url.Values, v interface{}) error {
+	form := url.Values{"client_id": []string{c.ClientID}}
+	if c.ClientSecret != "" {
+		form.Set("client_secret", c.ClientSecret)
+	}
+	for k, vs := range params {
+		form[k] = vs
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var terr tokenError
+		if json.Unmarshal(b, &terr) == nil && terr.Code != "" {
+			return &terr
+		}
+		return fmt.Errorf("request failed with status code %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// ErrRevocationUnsupported is returned by Revoke if the issuer has no revocation endpoint.
+var ErrRevocationUnsupported = errors.New("the OIDC issuer does not support token revocation")
+
+// Revoke revokes the stored token at the revocation endpoint of the issuer, see RFC 7009: the
+// refresh token if there is one, which also revokes the access tokens issued with it, or else the
+// access token. The stored token is kept, see DiscardToken.
+func (c *OIDCConfig) Revoke(ctx context.Context) error {
+	if c.Token == nil {
+		return nil
+	}
+	token, hint := c.Token.RefreshToken, "refresh_token"
+	if token == "" {
+		token, hint = c.Token.AccessToken, "access_token"
+	}
+	if token == "" {
+		return nil
+	}
+
+	ctx, client, provider, err := c.provider(ctx)
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		RevocationEndpoint string `json:"revocation_endpoint"`
+	}
+	if err := provider.Claims(&claims); err != nil {
+		return fmt.Errorf("reading issuer metadata: %w", err)
+	}
+	if claims.RevocationEndpoint == "" {
+		return ErrRevocationUnsupported
+	}
+
+	if err := c.postForm(ctx, client, claims.RevocationEndpoint, url.Values{"token": {token}, "token_type_hint": {hint}}, nil); err != nil {
+		return fmt.Errorf("revoking token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+// Credential stores, where client secrets and tokens of OIDC configs are saved.
+const (
+	// CredentialStoreFile saves credentials in plaintext in the config file.
+	CredentialStoreFile = "file"
+	// CredentialStoreKeyring saves credentials in the keyring of the OS, i.e. the macOS Keychain, the
+	// Windows Credential Manager or the Secret Service of libsecret, while the config file only
+	// references them.
+	CredentialStoreKeyring = "keyring"
+)
+
+// CredentialStores are all credential stores.
+var CredentialStores = []string{CredentialStoreFile, CredentialStoreKeyring}
+
+const (
+	// keyringService is the service credentials are saved under in the keyring.
+	keyringService = "obsctl"
+	// keyringRefPrefix prefixes the key of credentials in the keyring in their references.
+	keyringRefPrefix = "keyring:"
+)
+
+// credentials are the secrets of an OIDC config saved in the keyring.
+type credentials struct {
+	ClientSecret string        `json:"clientSecret,omitempty"`
+	Token        *oauth2.Token `json:"token,omitempty"`
+}
+
+// SetCredentialStore sets the store credentials are saved in by Save, one of CredentialStores.
+// Credentials are moved to the new store when the config is saved.
+func (c *Config) SetCredentialStore(store string) error {
+	switch store {
+	case CredentialStoreFile:
+		c.CredentialStore = ""
+	case CredentialStoreKeyring:
+		c.CredentialStore = store
+	default:
+		return fmt.Errorf("unknown credential store %q, must be one of: %s", store, strings.Join(CredentialStores, "|"))
+	}
+	return nil
+}
+
+// loadCredentials fills in the client secrets and tokens of the OIDC configs of c referencing
+// credentials in the keyring. Client secrets set in the config file, e.g. with placeholders, are
+// kept. The credentials read are added to loaded by key, which is also used to read every key
+// only once.
+func (c *Config) loadCredentials(logger log.Logger, loaded map[string]string) error {
+	for api, a := range c.APIs {
+		for tenant, t := range a.Contexts {
+			if t.OIDC == nil || !strings.HasPrefix(t.OIDC.Credentials, keyringRefPrefix) {
+				continue
+			}
+
+			key := strings.TrimPrefix(t.OIDC.Credentials, keyringRefPrefix)
+			s, ok := loaded[key]
+			if !ok {
+				var err error
+				s, err = keyring.Get(keyringService, key)
+				if errors.Is(err, keyring.ErrNotFound) {
+					// Logging in again saves new credentials.
+					level.Warn(logger).Log("msg", "credentials of context not found in keyring", "context", Context{API: api, Tenant: tenant}, "key", key)
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("reading credentials of context %s/%s from keyring: %w", api, tenant, err)
+				}
+				loaded[key] = s
+			}
+
+			var creds credentials
+			if err := json.Unmarshal([]byte(s), &creds); err != nil {
+				return fmt.Errorf("decoding credentials of context %s/%s from keyring: %w", api, tenant, err)
+			}
+			if t.OIDC.ClientSecret == "" {
+				t.OIDC.ClientSecret = creds.ClientSecret
+			}
+			t.OIDC.Token = creds.Token
+		}
+	}
+	return nil
+}
+
+// storeCredentials moves the client secrets and tokens of the OIDC configs of toSave, a copy of c
+// about to be saved, to the keyring, and references them instead. Client secrets given with
+// placeholders in the config file stay in it. Credentials are only written to the keyring if they
+// changed since they were read. With CredentialStoreFile, only the references are dropped.
+func (c *Config) storeCredentials(toSave *Config) error {
+	prefix, err := keyringKeyPrefix()
+	if err != nil {
+		return err
+	}
+
+	for api, a := range toSave.APIs {
+		for tenant, t := range a.Contexts {
+			if t.OIDC == nil {
+				continue
+			}
+			t.OIDC.Credentials = ""
+			if c.CredentialStore != CredentialStoreKeyring {
+				continue
+			}
+
+			creds := credentials{Token: t.OIDC.Token}
+			if !c.placeholderSecret(api, tenant) {
+				creds.ClientSecret = t.OIDC.ClientSecret
+				t.OIDC.ClientSecret = ""
+			}
+			t.OIDC.Token = nil
+			if creds == (credentials{}) {
+				continue
+			}
+
+			key := prefix + api + "/" + tenant
+			b, err := json.Marshal(creds)
+			if err != nil {
+				return fmt.Errorf("encoding credentials of context %s/%s: %w", api, tenant, err)
+			}
+			if c.stored[key] != string(b) {
+				if err := keyring.Set(keyringService, key, string(b)); err != nil {
+					return fmt.Errorf("saving credentials of context %s/%s to keyring: %w", api, tenant, err)
+				}
+				if c.stored == nil {
+					c.stored = map[string]string{}
+				}
+				c.stored[key] = string(b)
+			}
+			t.OIDC.Credentials = keyringRefPrefix + key
+		}
+	}
+	return nil
+}
+
+// removeCredentials removes the credentials read from the keyring for the first config file that
+// are no longer referenced by toSave, the config saved to it, e.g. of removed contexts or after
+// switching to CredentialStoreFile.
+func (c *Config) removeCredentials(logger log.Logger, toSave *Config) {
+	referenced := map[string]bool{}
+	for _, a := range toSave.APIs {
+		for _, t := range a.Contexts {
+			if t.OIDC != nil && strings.HasPrefix(t.OIDC.Credentials, keyringRefPrefix) {
+				referenced[strings.TrimPrefix(t.OIDC.Credentials, keyringRefPrefix)] = true
+			}
+		}
+	}
+
+	for key := range c.stored {
+		if referenced[key] {
+			continue
+		}
+		if err := keyring.Delete(keyringService, key); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			level.Warn(logger).Log("msg", "failed to remove credentials from keyring", "key", key, "err", err)
+			continue
+		}
+		delete(c.stored, key)
+	}
+}
+
+// keyringKeyPrefix returns the prefix of the keys of credentials in the keyring. Keys of config
+// files other than the default one are prefixed with their path, so that the credentials of
+// isolated config files, e.g. of CI jobs or tests, are kept apart.
+func keyringKeyPrefix() (string, error) {
+	file, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+	if def, err := defaultConfigPath(); err == nil && file == def {
+		return "", nil
+	}
+
+	if file, err = filepath.Abs(file); err != nil {
+		return "", fmt.Errorf("resolving config path: %w", err)
+	}
+	return file + ":", nil
+}
+
+// placeholderSecret reports whether the client secret of the tenant is given with a placeholder in
+// the first config file, see Read.
+func (c *Config) placeholderSecret(api, tenant string) bool {
+	if c.raw == nil {
+		return false
+	}
+	for rawAPI, a := range c.raw.APIs {
+		if s, _ := expandString(rawAPI); s != api && rawAPI != api {
+			continue
+		}
+		for rawTenant, t := range a.Contexts {
+			if s, _ := expandString(rawTenant); s != tenant && rawTenant != tenant {
+				continue
+			}
+			if t.OIDC != nil && strings.Contains(t.OIDC.ClientSecret, "${") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+const (
+	// lockFileName is the lock file of the config file, see Lock. It is never removed, as the lock is
+	// held on the open file rather than by its existence.
+	lockFileName = "config.flock"
+	// lockRetryInterval is the interval at which acquiring a held lock is retried.
+	lockRetryInterval = 50 * time.Millisecond
+)
+
+// errLocked is returned by tryLock if the file is locked by another process.
+var errLocked = errors.New("file is locked")
+
+// Lock acquires a lock on the config file shared by all obsctl processes of the user, e.g. to refresh
+// a token without racing other processes refreshing it at the same time. It blocks until the lock
+// is acquired or ctx is done. The returned function releases the lock.
+//
+// The lock is an advisory lock of a lock file next to the config file, which the OS releases when
+// the process holding it exits, so that crashed processes never leave it behind.
+func Lock(ctx context.Context, logger log.Logger) (func(), error) {
+	return LockFile(ctx, logger, lockFileName)
+}
+
+// LockFile acquires the lock of the lock file with the given name in the config dir, like Lock, for
+// other files kept there, e.g. the query history. Locks of different names don't block each other.
+func LockFile(ctx context.Context, logger log.Logger, name string) (func(), error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating config dir: %w", err)
+	}
+
+	file := filepath.Join(dir, name)
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+
+	waiting := time.Now()
+	for {
+		err := tryLock(f)
+		if err == nil {
+			level.Debug(logger).Log("msg", "acquired lock", "file", file, "waited", time.Since(waiting))
+			return func() {
+				if err := unlockFile(f); err != nil {
+					level.Warn(logger).Log("msg", "failed to release lock", "file", file, "err", err)
+				}
+				f.Close()
+			}, nil
+		}
+		if !errors.Is(err, errLocked) {
+			f.Close()
+			return nil, fmt.Errorf("locking %s: %w", file, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, fmt.Errorf("waiting for lock %s: %w", file, ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// Update applies fn to the latest config and saves it while holding the config lock, so that
+// obsctl processes changing the config concurrently, e.g. refreshing tokens of a fanout in CI,
+// don't lose each other's changes. Nothing is saved if fn fails. As other processes wait for the
+// lock meanwhile, fn must not wait for users, e.g. to log in.
+func Update(ctx context.Context, logger log.Logger, fn func(*Config) error) error {
+	unlock, err := Lock(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cfg, err := Read(logger)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	if err := fn(cfg); err != nil {
+		return err
+	}
+	if err := cfg.Save(logger); err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+	return nil
+}
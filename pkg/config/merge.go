@@ -0,0 +1,206 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// EnvFiles is the environment variable listing the config files to use, separated like PATH.
+const EnvFiles = "OBSCTL_CONFIG"
+
+// Files are the config files to use, in order of precedence. If empty, the files in $OBSCTL_CONFIG are
+// used, or the config file in the user config directory if it is empty too.
+//
+// Like kubeconfig files, multiple files are merged, so that e.g. API definitions shared by a team can be
+// combined with a personal file holding credentials. Missing files are skipped. The first file setting
+// a value wins:
+//
+//   - current and credentialStore are taken from the first file setting them,
+//   - APIs are merged by name: url, grafanaURL, flavor and caFile are taken from the first file setting them, paths
+//     are merged by signal, and contexts are merged by tenant, each tenant being taken as a whole
+//     from the first file defining it,
+//   - queries are merged by name.
+//
+// Changes are only written to the first file. It only keeps what differs from the merged config of
+// the other files, so that shared files can be updated without being shadowed.
+var Files []string
+
+// files returns the config files in order of precedence, see Files.
+func files() ([]string, error) {
+	if len(Files) > 0 {
+		return Files, nil
+	}
+
+	var res []string
+	for _, f := range filepath.SplitList(os.Getenv(EnvFiles)) {
+		if f != "" {
+			res = append(res, f)
+		}
+	}
+	if len(res) > 0 {
+		return res, nil
+	}
+
+	file, err := defaultConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return []string{file}, nil
+}
+
+// readFile reads a single config file. A missing file yields nil.
+func readFile(file string) (*Config, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file %s: %w", file, err)
+	}
+
+	cfg := &Config{}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", file, err)
+	}
+	if cfg.APIs == nil {
+		cfg.APIs = map[string]APIConfig{}
+	}
+	return cfg, nil
+}
+
+// merge adds the values of o not set in c to c, see Files.
+func (c *Config) merge(o *Config) {
+	if c.Current == (Context{}) {
+		c.Current = o.Current
+	}
+	if c.CredentialStore == "" {
+		c.CredentialStore = o.CredentialStore
+	}
+
+	for name, oa := range o.APIs {
+		a, ok := c.APIs[name]
+		if !ok {
+			c.APIs[name] = oa
+			continue
+		}
+
+		if a.URL == "" {
+			a.URL = oa.URL
+		}
+		if a.GrafanaURL == "" {
+			a.GrafanaURL = oa.GrafanaURL
+		}
+		if a.Flavor == "" {
+			a.Flavor = oa.Flavor
+		}
+		if a.CAFile == "" {
+			a.CAFile = oa.CAFile
+		}
+		for signal, p := range oa.Paths {
+			if _, ok := a.Paths[signal]; !ok {
+				if a.Paths == nil {
+					a.Paths = map[string]string{}
+				}
+				a.Paths[signal] = p
+			}
+		}
+		for tenant, t := range oa.Contexts {
+			if _, ok := a.Contexts[tenant]; !ok {
+				if a.Contexts == nil {
+					a.Contexts = map[string]TenantConfig{}
+				}
+				a.Contexts[tenant] = t
+			}
+		}
+		c.APIs[name] = a
+	}
+
+	for name, q := range o.Queries {
+		if _, ok := c.Queries[name]; !ok {
+			if c.Queries == nil {
+				c.Queries = map[string]SavedQuery{}
+			}
+			c.Queries[name] = q
+		}
+	}
+}
+
+// without returns the parts of c differing from base, i.e. what has to be written to the first config
+// file for c to be the merged config of it and the files base was merged from.
+func (c *Config) without(base *Config) *Config {
+	res := &Config{APIs: map[string]APIConfig{}}
+	if c.Current != base.Current {
+		res.Current = c.Current
+	}
+	if c.CredentialStore != base.CredentialStore {
+		res.CredentialStore = c.CredentialStore
+	}
+
+	for name, a := range c.APIs {
+		b, ok := base.APIs[name]
+		if !ok {
+			res.APIs[name] = a
+			continue
+		}
+
+		d := APIConfig{Contexts: map[string]TenantConfig{}}
+		if a.URL != b.URL {
+			d.URL = a.URL
+		}
+		if a.GrafanaURL != b.GrafanaURL {
+			d.GrafanaURL = a.GrafanaURL
+		}
+		if a.Flavor != b.Flavor {
+			d.Flavor = a.Flavor
+		}
+		if a.CAFile != b.CAFile {
+			d.CAFile = a.CAFile
+		}
+		for signal, p := range a.Paths {
+			if bp, ok := b.Paths[signal]; !ok || bp != p {
+				if d.Paths == nil {
+					d.Paths = map[string]string{}
+				}
+				d.Paths[signal] = p
+			}
+		}
+		for tenant, t := range a.Contexts {
+			if bt, ok := b.Contexts[tenant]; !ok || !reflect.DeepEqual(bt, t) {
+				d.Contexts[tenant] = t
+			}
+		}
+		if d.URL != "" || d.GrafanaURL != "" || d.Flavor != "" || d.CAFile != "" || len(d.Paths) > 0 || len(d.Contexts) > 0 {
+			res.APIs[name] = d
+		}
+	}
+
+	for name, q := range c.Queries {
+		if bq, ok := base.Queries[name]; !ok || bq != q {
+			if res.Queries == nil {
+				res.Queries = map[string]SavedQuery{}
+			}
+			res.Queries[name] = q
+		}
+	}
+	return res
+}
+
+// clone returns a deep copy of c, so that changes of c don't affect it.
+func (c *Config) clone() (*Config, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	res := &Config{}
+	if err := json.Unmarshal(b, res); err != nil {
+		return nil, err
+	}
+	if res.APIs == nil {
+		res.APIs = map[string]APIConfig{}
+	}
+	return res, nil
+}
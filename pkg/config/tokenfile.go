@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// fileTokenSource reads a bearer token from a file, e.g. a projected service account token or one
+// managed by a sidecar. The file is read again whenever its modification time or size changes, so
+// that rotated tokens are picked up by long running processes.
+type fileTokenSource struct {
+	path string
+
+	mtx     sync.Mutex
+	modTime time.Time
+	size    int64
+	token   *oauth2.Token
+}
+
+// Token implements oauth2.TokenSource.
+func (s *fileTokenSource) Token() (*oauth2.Token, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("reading token file: %w", err)
+	}
+	if s.token != nil && fi.ModTime().Equal(s.modTime) && fi.Size() == s.size {
+		return s.token, nil
+	}
+
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("reading token file: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return nil, fmt.Errorf("token file %s is empty", s.path)
+	}
+
+	s.modTime, s.size = fi.ModTime(), fi.Size()
+	s.token = &oauth2.Token{AccessToken: token, TokenType: "Bearer"}
+	return s.token, nil
+}
@@ -0,0 +1,304 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/observatorium/obsctl/pkg/duration"
+)
+
+// Problem is a problem found in the config file.
+type Problem struct {
+	// Path locates the problem in the config file, e.g. apis.prod.contexts.team-a.oidc.
+	Path string
+	Msg  string
+}
+
+// Validate checks the config files for structural problems and returns all of them. It does not
+// contact any API or OIDC provider. Missing config files have no problems. With several config
+// files, the paths of problems found in a single file are prefixed with the file.
+func Validate() ([]Problem, error) {
+	paths, err := files()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		problems []Problem
+		broken   bool
+	)
+	for _, file := range paths {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("reading config file %s: %w", file, err)
+		}
+
+		prefix := ""
+		if len(paths) > 1 {
+			prefix = file + ":"
+		}
+
+		var raw interface{}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			problems = append(problems, Problem{Path: file, Msg: fmt.Sprintf("invalid JSON: %s", err)})
+			broken = true
+			continue
+		}
+		for _, p := range unknownFields(raw, reflect.TypeOf(Config{}), "") {
+			problems = append(problems, Problem{Path: prefix + p.Path, Msg: p.Msg})
+		}
+
+		cfg := &Config{}
+		if err := json.Unmarshal(b, cfg); err != nil {
+			// Fields of the wrong type.
+			problems = append(problems, Problem{Path: file, Msg: err.Error()})
+			broken = true
+			continue
+		}
+		if err := expandEnv(reflect.ValueOf(cfg).Elem(), ""); err != nil {
+			var eerr *EnvError
+			if errors.As(err, &eerr) {
+				problems = append(problems, Problem{Path: prefix + eerr.Path, Msg: fmt.Sprintf("environment variable %s is not set", eerr.Name)})
+			} else {
+				problems = append(problems, Problem{Path: file, Msg: err.Error()})
+			}
+			broken = true
+		}
+	}
+
+	// The checks of the merged config would be misleading if a file can't be parsed.
+	if !broken {
+		cfg, err := Read(log.NewNopLogger())
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, cfg.validate()...)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems, nil
+}
+
+// unknownFields returns a problem for every object key in v without a matching field in t.
+func unknownFields(v interface{}, t reflect.Type, path string) []Problem {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var problems []Problem
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+				fields[strings.ToLower(name)] = f.Type
+			}
+		}
+		for k, fv := range obj {
+			// Like encoding/json, match field names case-insensitively.
+			ft, ok := fields[strings.ToLower(k)]
+			if !ok {
+				problems = append(problems, Problem{Path: join(path, k), Msg: "unknown field"})
+				continue
+			}
+			problems = append(problems, unknownFields(fv, ft, join(path, k))...)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for k, ev := range obj {
+			problems = append(problems, unknownFields(ev, t.Elem(), join(path, k))...)
+		}
+	}
+	return problems
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (c *Config) validate() []Problem {
+	var problems []Problem
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, Problem{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case c.Current.API == "" && c.Current.Tenant == "":
+		if len(c.Contexts()) > 0 {
+			add("current", "no current context set")
+		}
+	default:
+		if _, _, err := c.GetContext(c.Current); err != nil {
+			add("current", "%s", err)
+		}
+	}
+
+	switch c.CredentialStore {
+	case "", CredentialStoreFile, CredentialStoreKeyring:
+	default:
+		add("credentialStore", "unknown credential store %q, must be one of: %s", c.CredentialStore, strings.Join(CredentialStores, "|"))
+	}
+
+	for name, a := range c.APIs {
+		path := join("apis", name)
+		if err := checkURL(a.URL); err != nil {
+			add(join(path, "url"), "%s", err)
+		}
+		if a.GrafanaURL != "" {
+			if err := checkURL(a.GrafanaURL); err != nil {
+				add(join(path, "grafanaURL"), "%s", err)
+			}
+		}
+		if a.CAFile != "" {
+			if _, err := a.Transport(TenantConfig{}); err != nil {
+				add(join(path, "caFile"), "%s", err)
+			}
+		}
+		if a.Flavor != "" && a.Flavor != FlavorObservatorium && a.Flavor != FlavorCortex {
+			add(join(path, "flavor"), "unknown flavor %s, expected one of: %s", a.Flavor, strings.Join(Flavors, "|"))
+		}
+		if len(a.Contexts) == 0 {
+			add(path, "no tenants configured")
+		}
+		for signal, p := range a.Paths {
+			if signal != "metrics" && signal != "logs" && signal != "traces" {
+				add(join(join(path, "paths"), signal), "unknown signal %s, expected metrics, logs or traces", signal)
+			} else if !strings.HasPrefix(p, "/") {
+				add(join(join(path, "paths"), signal), "path %s must start with /", p)
+			}
+		}
+
+		for tenant, t := range a.Contexts {
+			tpath := join(join(path, "contexts"), tenant)
+			if t.Tenant == "" {
+				add(join(tpath, "tenant"), "empty tenant name")
+			} else if t.Tenant != tenant {
+				add(join(tpath, "tenant"), "tenant %s does not match its key %s", t.Tenant, tenant)
+			}
+			if t.OIDC != nil {
+				problems = append(problems, t.OIDC.validate(join(tpath, "oidc"))...)
+			}
+			if t.TokenFile != "" {
+				if t.OIDC != nil {
+					add(join(tpath, "tokenFile"), "token file and OIDC are mutually exclusive")
+				}
+				if _, err := (&fileTokenSource{path: t.TokenFile}).Token(); err != nil {
+					add(join(tpath, "tokenFile"), "%s", err)
+				}
+			}
+			switch {
+			case (t.TLSCert == "") != (t.TLSKey == ""):
+				add(tpath, "tlsCert and tlsKey must be set together")
+			case t.TLSCert != "":
+				if _, err := tls.LoadX509KeyPair(t.TLSCert, t.TLSKey); err != nil {
+					add(join(tpath, "tlsCert"), "%s", err)
+				}
+			}
+			if t.Timezone != "" && !strings.EqualFold(t.Timezone, "local") && !strings.EqualFold(t.Timezone, "utc") {
+				if _, err := time.LoadLocation(t.Timezone); err != nil {
+					add(join(tpath, "timezone"), "unknown time zone %q", t.Timezone)
+				}
+			}
+			if t.DefaultRange != "" {
+				if d, err := duration.Parse(t.DefaultRange); err != nil || d <= 0 {
+					add(join(tpath, "defaultRange"), "invalid duration %q", t.DefaultRange)
+				}
+			}
+			if t.LookbackDelta != "" {
+				if d, err := duration.Parse(t.LookbackDelta); err != nil || d <= 0 {
+					add(join(tpath, "lookbackDelta"), "invalid duration %q", t.LookbackDelta)
+				}
+			}
+		}
+	}
+
+	for name, q := range c.Queries {
+		if _, err := template.New(name).Parse(q.Query); err != nil {
+			add(join(join("queries", name), "query"), "invalid template: %s", err)
+		}
+	}
+	return problems
+}
+
+func (c *OIDCConfig) validate(path string) []Problem {
+	var problems []Problem
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, Problem{Path: join(path, field), Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if err := checkURL(c.IssuerURL); err != nil {
+		add("issuerURL", "%s", err)
+	}
+	if c.ClientID == "" {
+		add("clientID", "empty client ID")
+	}
+	switch c.GrantType {
+	case "", GrantClientCredentials:
+	case GrantDeviceCode, GrantAuthorizationCode:
+		if c.Token == nil || (c.Token.RefreshToken == "" && !fresh(c.Token, 0)) {
+			add("token", "no refresh token, log in again")
+		}
+	default:
+		add("grantType", "unknown grant type %s, expected one of: %s", c.GrantType, strings.Join(GrantTypes, "|"))
+	}
+	if c.ClientSecret == "" && !c.Interactive() {
+		if c.Token != nil && !c.Token.Expiry.IsZero() && c.Token.Expiry.Before(time.Now()) {
+			add("token", "token expired at %s and cannot be refreshed without client secret", c.Token.Expiry.Format(time.RFC3339))
+		} else {
+			add("clientSecret", "empty client secret, tokens cannot be refreshed")
+		}
+	}
+	if c.Token != nil && c.Token.AccessToken == "" && !c.Interactive() {
+		add("token", "empty access token")
+	}
+	if c.WebListen != "" {
+		if err := CheckWebListen(c.WebListen); err != nil {
+			add("webListen", "%s", err)
+		}
+	}
+	if c.IssuerCAFile != "" {
+		if _, err := c.issuerClient(); err != nil {
+			add("issuerCAFile", "%s", err)
+		}
+	}
+	return problems
+}
+
+// checkURL returns an error if s is not an absolute HTTP(S) URL.
+func checkURL(s string) error {
+	if s == "" {
+		return fmt.Errorf("empty URL")
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q, expected an absolute http or https URL", s)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// Package dashboard extracts queries from Grafana dashboard JSON models.
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Query is a single query of a dashboard panel.
+type Query struct {
+	Panel string
+	RefID string
+	// Expr is the query expression as written in the dashboard, with template variables unresolved.
+	Expr string
+	// Loki is true if the query is a LogQL query, otherwise it is assumed to be PromQL.
+	Loki bool
+}
+
+type dashboard struct {
+	Title      string  `json:"title"`
+	Panels     []panel `json:"panels"`
+	Rows       []row   `json:"rows"`
+	Templating struct {
+		List []variable `json:"list"`
+	} `json:"templating"`
+}
+
+type row struct {
+	Panels []panel `json:"panels"`
+}
+
+type panel struct {
+	Title      string          `json:"title"`
+	Datasource json.RawMessage `json:"datasource"`
+	Targets    []target        `json:"targets"`
+	Panels     []panel         `json:"panels"`
+}
+
+type target struct {
+	Expr       string          `json:"expr"`
+	RefID      string          `json:"refId"`
+	Hide       bool            `json:"hide"`
+	Datasource json.RawMessage `json:"datasource"`
+}
+
+type variable struct {
+	Name    string `json:"name"`
+	Current struct {
+		Value json.RawMessage `json:"value"`
+	} `json:"current"`
+}
+
+// Dashboard is a parsed Grafana dashboard.
+type Dashboard struct {
+	Title   string
+	Queries []Query
+	// Variables holds the current values of the dashboard's template variables.
+	Variables map[string]string
+}
+
+// Parse parses a Grafana dashboard JSON model, returning all non-hidden queries of its panels.
+// Both the current (panels, nested in collapsed rows) and the legacy (rows) layouts are supported.
+func Parse(b []byte) (*Dashboard, error) {
+	var d dashboard
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, fmt.Errorf("parsing dashboard: %w", err)
+	}
+
+	res := &Dashboard{Title: d.Title, Variables: map[string]string{}}
+
+	panels := d.Panels
+	for _, r := range d.Rows {
+		panels = append(panels, r.Panels...)
+	}
+	res.Queries = collectQueries(panels, nil)
+
+	for _, v := range d.Templating.List {
+		if val, ok := variableValue(v.Current.Value); ok {
+			res.Variables[v.Name] = val
+		}
+	}
+
+	return res, nil
+}
+
+func collectQueries(panels []panel, parentDS json.RawMessage) []Query {
+	var qs []Query
+	for _, p := range panels {
+		ds := p.Datasource
+		if len(ds) == 0 {
+			ds = parentDS
+		}
+
+		for _, t := range p.Targets {
+			if t.Hide || strings.TrimSpace(t.Expr) == "" {
+				continue
+			}
+
+			tds := t.Datasource
+			if len(tds) == 0 {
+				tds = ds
+			}
+
+			qs = append(qs, Query{
+				Panel: p.Title,
+				RefID: t.RefID,
+				Expr:  t.Expr,
+				Loki:  isLoki(tds, t.Expr),
+			})
+		}
+
+		qs = append(qs, collectQueries(p.Panels, ds)...)
+	}
+	return qs
+}
+
+// isLoki guesses whether a query targets Loki, from the datasource type if it is known,
+// or otherwise from the shape of the expression.
+func isLoki(ds json.RawMessage, expr string) bool {
+	var typed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(ds, &typed); err == nil && typed.Type != "" {
+		return typed.Type == "loki"
+	}
+
+	var name string
+	if err := json.Unmarshal(ds, &name); err == nil && strings.Contains(strings.ToLower(name), "loki") {
+		return true
+	}
+
+	e := strings.TrimSpace(expr)
+	return strings.HasPrefix(e, "{") && strings.Contains(e, "|")
+}
+
+// variableValue returns the current value of a template variable. Multi-value
+// variables are joined as a regular expression alternation, as Grafana does.
+func variableValue(raw json.RawMessage) (string, bool) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if s == "$__all" {
+			return ".*", true
+		}
+		return s, true
+	}
+
+	var ss []string
+	if err := json.Unmarshal(raw, &ss); err == nil && len(ss) > 0 {
+		if len(ss) == 1 && ss[0] == "$__all" {
+			return ".*", true
+		}
+		return strings.Join(ss, "|"), true
+	}
+
+	return "", false
+}
+
+// BuiltinVariables are the values used for Grafana's global variables when resolving queries.
+var BuiltinVariables = map[string]string{
+	"__interval":      "1m",
+	"__interval_ms":   "60000",
+	"__rate_interval": "5m",
+	"__range":         "1h",
+	"__range_s":       "3600",
+	"__range_ms":      "3600000",
+	"__auto":          "1m",
+}
+
+// variableRe matches $var, ${var}, ${var:format} and the deprecated [[var]] syntax. Names starting
+// with a digit are not matched, so that label_replace references like "$1" are left alone.
+var variableRe = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)(?::[a-zA-Z]+)?\}|\[\[([a-zA-Z_][a-zA-Z0-9_]*)(?::[a-zA-Z]+)?\]\]|\$([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+// Resolve replaces template variables in expr with values from vars, falling back to
+// BuiltinVariables. The names of variables that could not be resolved are returned.
+func Resolve(expr string, vars map[string]string) (string, []string) {
+	missing := map[string]struct{}{}
+	res := variableRe.ReplaceAllStringFunc(expr, func(m string) string {
+		sub := variableRe.FindStringSubmatch(m)
+		name := sub[1] + sub[2] + sub[3]
+
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		if v, ok := BuiltinVariables[name]; ok {
+			return v
+		}
+		missing[name] = struct{}{}
+		return m
+	})
+
+	names := make([]string, 0, len(missing))
+	for n := range missing {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return res, names
+}
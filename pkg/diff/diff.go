@@ -0,0 +1,100 @@
+// Package diff computes line based differences between texts.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around changes.
+const contextLines = 3
+
+type op struct {
+	kind byte // ' ', '-' or '+'.
+	line string
+}
+
+// Lines returns a unified-style diff of a and b, with changed lines prefixed by - and +,
+// and up to three unchanged lines of context around them. It returns an empty string if
+// a and b are equal.
+func Lines(a, b string) string {
+	ops := lcs(split(a), split(b))
+
+	var sb strings.Builder
+	lastShown := -1
+	for i, o := range ops {
+		if o.kind == ' ' && !nearChange(ops, i) {
+			continue
+		}
+		if lastShown >= 0 && i > lastShown+1 {
+			sb.WriteString("...\n")
+		}
+		fmt.Fprintf(&sb, "%c %s\n", o.kind, o.line)
+		lastShown = i
+	}
+
+	if !strings.ContainsAny(sb.String(), "+-") {
+		return ""
+	}
+	return sb.String()
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func nearChange(ops []op, i int) bool {
+	for j := i - contextLines; j <= i+contextLines; j++ {
+		if j >= 0 && j < len(ops) && ops[j].kind != ' ' {
+			return true
+		}
+	}
+	return false
+}
+
+// lcs returns the edit script turning a into b, based on their longest common subsequence.
+func lcs(a, b []string) []op {
+	// n[i][j] is the length of the LCS of a[i:] and b[j:].
+	n := make([][]int, len(a)+1)
+	for i := range n {
+		n[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				n[i][j] = n[i+1][j+1] + 1
+			} else if n[i+1][j] >= n[i][j+1] {
+				n[i][j] = n[i+1][j]
+			} else {
+				n[i][j] = n[i][j+1]
+			}
+		}
+	}
+
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case n[i+1][j] >= n[i][j+1]:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, op{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, op{'+', b[j]})
+	}
+	return ops
+}
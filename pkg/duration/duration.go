@@ -0,0 +1,114 @@
+// Package duration parses and formats durations the way Prometheus does, e.g. 90s, 1h30m or 2d.
+package duration
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+	year = 365 * day
+)
+
+// units are the units a duration can consist of.
+var units = map[string]time.Duration{
+	"y":  year,
+	"w":  week,
+	"d":  day,
+	"h":  time.Hour,
+	"m":  time.Minute,
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+var (
+	durationRe = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]+)?(y|w|d|h|ms|m|s|us|µs|ns))+$`)
+	partRe     = regexp.MustCompile(`([0-9]+(?:\.[0-9]+)?)(y|w|d|h|ms|m|s|us|µs|ns)`)
+)
+
+// Parse parses a duration like 90s, 1h30m, 2d or -1w. Besides the units of time.ParseDuration,
+// days (d), weeks (w) and years (y, 365 days) are accepted, as in PromQL. A plain 0 is zero.
+func Parse(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" {
+		return 0, nil
+	}
+	if !durationRe.MatchString(s) {
+		return 0, fmt.Errorf("invalid duration %q, expected e.g. 90s, 1h30m or 2d", s)
+	}
+
+	var d float64
+	for _, m := range partRe.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		d += n * float64(units[m[2]])
+	}
+
+	if strings.HasPrefix(s, "-") {
+		d = -d
+	}
+	return time.Duration(d), nil
+}
+
+// Format formats a duration in the largest units that represent it exactly, e.g. 1d12h or 90s as 1m30s.
+// Zero is formatted as 0, which Parse accepts as well.
+func Format(d time.Duration) string {
+	if d == 0 {
+		return "0"
+	}
+
+	var sb strings.Builder
+	if d < 0 {
+		sb.WriteByte('-')
+		d = -d
+	}
+	for _, u := range []struct {
+		name string
+		d    time.Duration
+	}{{"y", year}, {"w", week}, {"d", day}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}, {"ms", time.Millisecond}, {"us", time.Microsecond}, {"ns", time.Nanosecond}} {
+		if n := d / u.d; n > 0 {
+			fmt.Fprintf(&sb, "%d%s", n, u.name)
+			d -= n * u.d
+		}
+	}
+	return sb.String()
+}
+
+// Value is a pflag.Value of a duration parsed with Parse, for flags accepting e.g. --lookback=2d.
+type Value time.Duration
+
+// NewValue sets p to the default value and returns a flag value for it.
+func NewValue(p *time.Duration, value time.Duration) *Value {
+	*p = value
+	return (*Value)(p)
+}
+
+// Set implements pflag.Value.
+func (v *Value) Set(s string) error {
+	d, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*v = Value(d)
+	return nil
+}
+
+// String implements pflag.Value.
+func (v *Value) String() string {
+	return Format(time.Duration(*v))
+}
+
+// Type implements pflag.Value.
+func (v *Value) Type() string {
+	return "duration"
+}
@@ -0,0 +1,177 @@
+// Package fanout runs the same operation against many targets, e.g. tenants, with bounded concurrency.
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Task is an operation against a single target.
+type Task struct {
+	// Name identifies the target in results and errors, e.g. a context.
+	Name string
+	// Group is the backend the target is served by, e.g. an API. Circuit breakers are kept per group.
+	Group string
+	Run   func(ctx context.Context) error
+}
+
+// Result is the outcome of a task.
+type Result struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+}
+
+// Pool runs tasks with a bounded number of workers.
+type Pool struct {
+	// Concurrency is the maximum number of tasks run at the same time. Values below 1 are treated as 1.
+	Concurrency int
+	// Timeout limits the duration of each task, if greater than zero.
+	Timeout time.Duration
+	// BreakAfter is the number of consecutive failures of tasks of a group after which the remaining
+	// tasks of the group are skipped, failing with a *BreakerError. Zero disables circuit breaking.
+	BreakAfter int
+	// OnDone, if set, is called after each task. It may be called concurrently.
+	OnDone func(Result)
+}
+
+// BreakerError is the error of tasks skipped because of an open circuit breaker.
+type BreakerError struct {
+	Group    string
+	Failures int
+}
+
+func (e *BreakerError) Error() string {
+	return fmt.Sprintf("skipped after %d consecutive failures against %s", e.Failures, e.Group)
+}
+
+// breakers tracks the consecutive failures of each group.
+type breakers struct {
+	mtx      sync.Mutex
+	failures map[string]int
+	limit    int
+}
+
+// open returns an error if the breaker of the group is open.
+func (b *breakers) open(group string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.limit > 0 && b.failures[group] >= b.limit {
+		return &BreakerError{Group: group, Failures: b.failures[group]}
+	}
+	return nil
+}
+
+func (b *breakers) record(group string, err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if err == nil {
+		b.failures[group] = 0
+		return
+	}
+	b.failures[group]++
+}
+
+// Run runs all tasks and returns their results in the order of tasks. Tasks that have not
+// started when ctx is done fail with the error of ctx.
+func (p Pool) Run(ctx context.Context, tasks []Task) []Result {
+	results := make([]Result, len(tasks))
+	next := make(chan int)
+
+	workers := p.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	b := &breakers{failures: map[string]int{}, limit: p.BreakAfter}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(tasks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range next {
+				results[idx] = p.run(ctx, b, tasks[idx])
+				if p.OnDone != nil {
+					p.OnDone(results[idx])
+				}
+			}
+		}()
+	}
+
+	for i := range tasks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
+
+func (p Pool) run(ctx context.Context, b *breakers, t Task) Result {
+	start := time.Now()
+	if err := ctx.Err(); err != nil {
+		return Result{Name: t.Name, Err: err}
+	}
+	if err := b.open(t.Group); err != nil {
+		return Result{Name: t.Name, Err: err}
+	}
+
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	err := t.Run(ctx)
+	b.record(t.Group, err)
+	return Result{Name: t.Name, Err: err, Duration: time.Since(start)}
+}
+
+// Error aggregates the failures of a fanout.
+type Error struct {
+	Failed []Result
+	Total  int
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Failed))
+	// Skipped tasks are summarized per group, listing each of them would bury the actual failures.
+	skipped := map[string]int{}
+	var groups []*BreakerError
+	for _, r := range e.Failed {
+		var berr *BreakerError
+		if errors.As(r.Err, &berr) {
+			if skipped[berr.Group] == 0 {
+				groups = append(groups, berr)
+			}
+			skipped[berr.Group]++
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %s", r.Name, r.Err))
+	}
+	for _, g := range groups {
+		msgs = append(msgs, fmt.Sprintf("%d skipped after %d consecutive failures against %s", skipped[g.Group], g.Failures, g.Group))
+	}
+	return fmt.Sprintf("%d of %d failed:\n  %s", len(e.Failed), e.Total, strings.Join(msgs, "\n  "))
+}
+
+// Err returns an *Error listing the failed results, or nil if all succeeded.
+func Err(results []Result) error {
+	e := &Error{Total: len(results)}
+	for _, r := range results {
+		if r.Err != nil {
+			e.Failed = append(e.Failed, r)
+		}
+	}
+	if len(e.Failed) == 0 {
+		return nil
+	}
+	return e
+}
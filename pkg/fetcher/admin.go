@@ -0,0 +1,17 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// DeleteSeries deletes the data of the metric series matching the selectors in params, between
+// their start and end if given, using the TSDB admin API. The data is only marked as deleted
+// until the backend compacts it.
+func (f *Fetcher) DeleteSeries(ctx context.Context, params url.Values) error {
+	if _, err := f.Do(ctx, http.MethodPost, Metrics, Metrics.queryPrefix()+"/admin/tsdb/delete_series", params, nil, ""); err != nil {
+		return queryError(err)
+	}
+	return nil
+}
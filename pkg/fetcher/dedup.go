@@ -0,0 +1,100 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// WithoutLabels returns a copy of the label set without the given labels.
+func WithoutLabels(m map[string]string, names []string) map[string]string {
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	for _, n := range names {
+		delete(res, n)
+	}
+	return res
+}
+
+// Dedup collapses series that only differ in the given replica labels, e.g. the series scraped by
+// each Prometheus of an HA pair, and removes these labels from all series. Samples of matrix series
+// are merged, preferring the series that came first for timestamps present in several of them.
+func Dedup(series []Series, replicaLabels []string) []Series {
+	res := make([]Series, 0, len(series))
+	idx := map[string]int{}
+	for _, s := range series {
+		s.Metric = WithoutLabels(s.Metric, replicaLabels)
+		key := FormatMetric(s.Metric)
+
+		i, ok := idx[key]
+		if !ok {
+			idx[key] = len(res)
+			res = append(res, s)
+			continue
+		}
+		res[i].Values = mergeSamples(res[i].Values, s.Values)
+		res[i].Histograms = mergeHistograms(res[i].Histograms, s.Histograms)
+	}
+	return res
+}
+
+// mergeHistograms is like mergeSamples for native histogram samples.
+func mergeHistograms(a, b []HistogramPair) []HistogramPair {
+	if len(b) == 0 {
+		return a
+	}
+
+	seen := make(map[float64]struct{}, len(a))
+	for _, s := range a {
+		seen[s.Timestamp] = struct{}{}
+	}
+	merged := append([]HistogramPair(nil), a...)
+	for _, s := range b {
+		if _, ok := seen[s.Timestamp]; !ok {
+			merged = append(merged, s)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Timestamp < merged[j].Timestamp })
+	return merged
+}
+
+// mergeSamples returns the union of both sample lists ordered by time, preferring a over b.
+func mergeSamples(a, b []SamplePair) []SamplePair {
+	if len(b) == 0 {
+		return a
+	}
+
+	seen := make(map[float64]struct{}, len(a))
+	for _, s := range a {
+		seen[s.Timestamp] = struct{}{}
+	}
+	merged := append([]SamplePair(nil), a...)
+	for _, s := range b {
+		if _, ok := seen[s.Timestamp]; !ok {
+			merged = append(merged, s)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Timestamp < merged[j].Timestamp })
+	return merged
+}
+
+// Dedup deduplicates the series of a vector or matrix result, see Dedup. Other results are left untouched.
+func (d *QueryData) Dedup(replicaLabels []string) error {
+	if d.ResultType != "vector" && d.ResultType != "matrix" {
+		return nil
+	}
+
+	series, err := d.Series()
+	if err != nil {
+		return err
+	}
+
+	res, err := json.Marshal(Dedup(series, replicaLabels))
+	if err != nil {
+		return fmt.Errorf("encoding %s result: %w", d.ResultType, err)
+	}
+	d.Result = res
+	return nil
+}
@@ -0,0 +1,65 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// ErrPlanUnsupported is returned if the API can't explain or analyze queries, which requires
+// Thanos with its own PromQL engine.
+var ErrPlanUnsupported = errors.New("query explain and analyze are only supported by Thanos with the Thanos PromQL engine")
+
+// PlanNode is an operator of the plan of a query of the Thanos PromQL engine. The timing and
+// sample counts are only set for analyzed queries.
+type PlanNode struct {
+	Name          string     `json:"name"`
+	ExecutionTime string     `json:"executionTime,omitempty"`
+	PeakSamples   int64      `json:"peakSamples,omitempty"`
+	TotalSamples  int64      `json:"totalSamples,omitempty"`
+	Children      []PlanNode `json:"children,omitempty"`
+}
+
+// planParams returns params asking Thanos to evaluate the query with its own engine, the only one
+// able to explain and analyze queries.
+func planParams(params url.Values) url.Values {
+	p := url.Values{}
+	for k, v := range params {
+		p[k] = v
+	}
+	p.Set("engine", "thanos")
+	return p
+}
+
+// ExplainQuery returns the plan of the instant query with the given parameters, without running it.
+func (f *Fetcher) ExplainQuery(ctx context.Context, params url.Values) (*PlanNode, error) {
+	var plan PlanNode
+	if err := f.get(ctx, Metrics, "/query_explain", planParams(params), &plan); err != nil {
+		var serr *StatusError
+		if errors.As(err, &serr) && serr.StatusCode == http.StatusNotFound {
+			return nil, ErrPlanUnsupported
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// AnalyzeQuery runs the instant query with the given parameters and returns its result with the
+// plan it was executed with, including the timing of every operator.
+func (f *Fetcher) AnalyzeQuery(ctx context.Context, params url.Values) (*QueryData, *PlanNode, error) {
+	p := planParams(params)
+	p.Set("analyze", "true")
+
+	var data struct {
+		QueryData
+		Analysis *PlanNode `json:"analysis"`
+	}
+	if err := f.get(ctx, Metrics, "/query", p, &data); err != nil {
+		return nil, nil, err
+	}
+	if data.Analysis == nil || data.Analysis.Name == "" {
+		return nil, nil, ErrPlanUnsupported
+	}
+	return &data.QueryData, data.Analysis, nil
+}
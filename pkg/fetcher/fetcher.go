@@ -0,0 +1,672 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"golang.org/x/oauth2"
+)
+
+// Signal is a type of observability data served by Observatorium.
+type Signal string
+
+const (
+	Metrics Signal = "metrics"
+	Logs    Signal = "logs"
+	// Traces are read through the Jaeger query API. They are not part of Signals, as they
+	// have no Prometheus-style API for labels, rules or build information.
+	Traces Signal = "traces"
+)
+
+// Signals are all signals served by Observatorium with a Prometheus-style query API.
+var Signals = []Signal{Metrics, Logs}
+
+// ParseSignal returns the signal with the given name.
+func ParseSignal(name string) (Signal, error) {
+	for _, s := range Signals {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown signal %q, expected one of: metrics|logs", name)
+}
+
+// queryPrefix returns the path prefix of the signal's query API, relative to the tenant path.
+func (s Signal) queryPrefix() string {
+	switch s {
+	case Logs:
+		return "/loki/api/v1"
+	case Traces:
+		return "/api"
+	}
+	return "/api/v1"
+}
+
+// Fetcher performs authenticated requests against the Observatorium API of the current context.
+type Fetcher struct {
+	api     config.APIConfig
+	tenant  string
+	context config.Context
+	cfg     *config.Config
+	logger  log.Logger
+
+	mtx    sync.Mutex
+	client *http.Client
+
+	// Params are added to the parameters of every request, e.g. to try backend features obsctl has no flags for yet.
+	Params url.Values
+
+	// OnWarnings, if set, is called with the warnings of responses of the query API, which
+	// usually mean that the response is partial. If it returns an error, the request fails with it.
+	OnWarnings func(endpoint string, warnings []string) error
+}
+
+// configMtx serializes changes of fetchers to their config, as fetchers may be used concurrently.
+var configMtx sync.Mutex
+
+// NewCustomFetcher returns a Fetcher for the current context.
+func NewCustomFetcher(ctx context.Context, logger log.Logger) (*Fetcher, error) {
+	cfg, err := config.Read(logger)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	if _, _, err := cfg.GetCurrent(); err != nil {
+		return nil, fmt.Errorf("getting current context: %w", err)
+	}
+
+	return NewContextFetcher(ctx, logger, cfg, cfg.Current)
+}
+
+// NewContextFetcher returns a Fetcher for the given context of cfg. A token fetched while
+// building the client is persisted in the config file.
+func NewContextFetcher(ctx context.Context, logger log.Logger, cfg *config.Config, c config.Context) (*Fetcher, error) {
+	configMtx.Lock()
+	api, tenant, err := cfg.GetContext(c)
+	configMtx.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fetcher{
+		api:     api,
+		tenant:  tenant.Tenant,
+		context: c,
+		cfg:     cfg,
+		logger:  logger,
+	}
+	if err := f.authenticate(ctx, false); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// authenticate (re)builds the client of the fetcher. The stored token is reused while fresh,
+// unless force is set. Tokens are shared between contexts with the same credentials, see
+// config.OIDCConfig.SameCredentials, so that fanout operations don't fetch one token per context.
+// New tokens are fetched while holding a lock of their credentials, so that obsctl processes and
+// contexts sharing credentials don't race to refresh their token, and are persisted in the config file.
+// configMtx is only held while reading and writing the config, never while waiting for the issuer.
+func (f *Fetcher) authenticate(ctx context.Context, force bool) error {
+	tenant, err := f.tenantConfig()
+	if err != nil {
+		return err
+	}
+
+	if tenant.OIDC == nil || (!force && tenant.OIDC.TokenFresh()) {
+		return f.setClient(ctx, tenant)
+	}
+
+	var oldToken string
+	if tenant.OIDC.Token != nil {
+		oldToken = tenant.OIDC.Token.AccessToken
+	}
+
+	// Another context with the same credentials may have fetched a token already, e.g. in fanout operations.
+	configMtx.Lock()
+	shared := f.cfg.SharedToken(tenant.OIDC, oldToken)
+	configMtx.Unlock()
+	if shared != nil && !force {
+		level.Debug(f.logger).Log("msg", "using token of context with same credentials", "context", f.context)
+		tenant.OIDC.Token = shared
+		configMtx.Lock()
+		err := f.cfg.UpdateTenant(f.context.API, tenant)
+		configMtx.Unlock()
+		if err != nil {
+			return err
+		}
+		return f.setClient(ctx, tenant)
+	}
+
+	// Contexts with other credentials don't wait for this lock, so a slow issuer only delays its own contexts.
+	unlock, err := config.LockFile(ctx, f.logger, "token-"+tenant.OIDC.CredentialsKey()+".flock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Another process or context may have refreshed the token while this one was waiting for the lock.
+	if stored := f.storedToken(tenant.OIDC, oldToken); stored != nil {
+		level.Debug(f.logger).Log("msg", "using token refreshed by another process", "context", f.context)
+		tenant.OIDC.Token = stored
+	} else if force {
+		tenant.OIDC.DiscardToken()
+	}
+
+	if err := f.setClient(ctx, tenant); err != nil {
+		return err
+	}
+
+	if tenant.OIDC.Token.AccessToken == oldToken {
+		return nil
+	}
+
+	configMtx.Lock()
+	f.cfg.ShareToken(tenant.OIDC, tenant.OIDC.Token)
+	configMtx.Unlock()
+
+	// Only update the token in the latest config file, so that changes by other processes are kept.
+	if err := config.Update(ctx, f.logger, func(latest *config.Config) error {
+		latest.ShareToken(tenant.OIDC, tenant.OIDC.Token)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("saving token: %w", err)
+	}
+	return nil
+}
+
+// tenantConfig returns the tenant config of the context. Its OIDC config is a copy, so that tokens
+// can be fetched into it without holding configMtx.
+func (f *Fetcher) tenantConfig() (config.TenantConfig, error) {
+	configMtx.Lock()
+	defer configMtx.Unlock()
+
+	_, tenant, err := f.cfg.GetContext(f.context)
+	if err != nil {
+		return config.TenantConfig{}, err
+	}
+	if tenant.OIDC != nil {
+		oidc := *tenant.OIDC
+		tenant.OIDC = &oidc
+	}
+	return tenant, nil
+}
+
+// storedToken returns a fresh token other than except of any context with the same credentials in the config file.
+func (f *Fetcher) storedToken(oidc *config.OIDCConfig, except string) *oauth2.Token {
+	cfg, err := config.Read(f.logger)
+	if err != nil {
+		return nil
+	}
+	return cfg.SharedToken(oidc, except)
+}
+
+func (f *Fetcher) setClient(ctx context.Context, tenant config.TenantConfig) error {
+	transport, err := f.api.Transport(tenant)
+	if err != nil {
+		return fmt.Errorf("getting client for context %s: %w", f.context, err)
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+
+	client, err := tenant.Client(ctx, f.logger)
+	if err != nil {
+		return fmt.Errorf("getting client for context %s: %w", f.context, err)
+	}
+
+	f.mtx.Lock()
+	f.client = client
+	f.mtx.Unlock()
+	return nil
+}
+
+// refreshable reports whether the context has credentials from which a new token can be obtained.
+func (f *Fetcher) refreshable() bool {
+	configMtx.Lock()
+	defer configMtx.Unlock()
+
+	_, tenant, err := f.cfg.GetContext(f.context)
+	return err == nil && tenant.OIDC != nil
+}
+
+// Tenant returns the name of the tenant requests are made for.
+func (f *Fetcher) Tenant() string {
+	return f.tenant
+}
+
+// Impersonate makes requests for the given tenant instead of the tenant of the context, still using
+// the credentials of the context. This requires credentials with access to all tenants, e.g. of an admin.
+func (f *Fetcher) Impersonate(tenant string) {
+	level.Debug(f.logger).Log("msg", "impersonating tenant", "context", f.context, "tenant", tenant)
+	f.tenant = tenant
+}
+
+// Context returns the context requests are made for.
+func (f *Fetcher) Context() config.Context {
+	return f.context
+}
+
+// APIURL returns the URL of the Observatorium API of the context.
+func (f *Fetcher) APIURL() string {
+	return f.api.URL
+}
+
+// Flavor returns the flavor of the API of the context, see config.Flavors.
+func (f *Fetcher) Flavor() string {
+	if f.api.Flavor == "" {
+		return config.FlavorObservatorium
+	}
+	return f.api.Flavor
+}
+
+// Token returns the current bearer token of the context, refreshing it if it expired, or nil if
+// the context has no credentials.
+func (f *Fetcher) Token() (*oauth2.Token, error) {
+	f.mtx.Lock()
+	client := f.client
+	f.mtx.Unlock()
+
+	t, ok := client.Transport.(*oauth2.Transport)
+	if !ok {
+		return nil, nil
+	}
+	return t.Source.Token()
+}
+
+// URL returns the full URL of an endpoint of the given signal's API for the tenant,
+// e.g. <api>/api/metrics/v1/<tenant>/api/v1/query for endpoint "/api/v1/query" of Metrics,
+// unless the API is configured with another path for the signal, see config.APIConfig.Paths.
+func (f *Fetcher) URL(signal Signal, endpoint string, params url.Values) string {
+	u := strings.TrimSuffix(f.api.URL, "/") + strings.TrimSuffix(path.Clean(f.api.Path(string(signal), f.tenant)), "/") + endpoint
+	if len(f.Params) > 0 {
+		merged := url.Values{}
+		for k, vs := range params {
+			merged[k] = append(merged[k], vs...)
+		}
+		for k, vs := range f.Params {
+			merged[k] = append(merged[k], vs...)
+		}
+		params = merged
+	}
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	return u
+}
+
+// Do performs a request against an endpoint of the given signal's API and returns the response body.
+// Responses with non-2xx status codes are returned as errors.
+func (f *Fetcher) Do(ctx context.Context, method string, signal Signal, endpoint string, params url.Values, body io.Reader, contentType string) ([]byte, error) {
+	resp, err := f.do(ctx, method, signal, endpoint, params, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if MemoryBudget <= 0 {
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading response body: %w", err)
+		}
+		return b, nil
+	}
+
+	if resp.ContentLength > MemoryBudget {
+		return nil, &BudgetError{Budget: MemoryBudget}
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, MemoryBudget+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	if int64(len(b)) > MemoryBudget {
+		return nil, &BudgetError{Budget: MemoryBudget}
+	}
+	return b, nil
+}
+
+// MemoryBudget is the maximum size in bytes of responses read into memory by Do. Responses
+// processed with Stream are not limited. Zero disables the limit.
+var MemoryBudget int64
+
+// BudgetError is returned for responses exceeding the MemoryBudget.
+type BudgetError struct {
+	Budget int64
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("response exceeds the memory budget of %d bytes, narrow down the matchers or time range, "+
+		"use a command with streaming output like 'metrics get series', or raise the budget with --memory.budget", e.Budget)
+}
+
+// do sends a request and returns the response of a successful request, with its body still to be read.
+// If the API rejects the token with 401 Unauthorized, a new token is fetched and the request is retried once.
+func (f *Fetcher) do(ctx context.Context, method string, signal Signal, endpoint string, params url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := f.URL(signal, endpoint, params)
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := f.roundTrip(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading response body: %w", err)
+		}
+
+		serr := &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(b)), RequestID: req.Header.Get(RequestIDHeader)}
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, &AuthError{Context: f.context, Err: serr}
+		}
+		return nil, serr
+	}
+
+	return resp, nil
+}
+
+// roundTrip sends a request for the tenant and returns its response, whatever its status code.
+// If the API rejects the token with 401 Unauthorized, a new token is fetched and the request is retried once.
+func (f *Fetcher) roundTrip(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if f.api.Flavor == config.FlavorCortex {
+		req.Header.Set(ScopeOrgIDHeader, f.tenant)
+	}
+
+	resp, err := f.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Requests whose body can't be replayed are not retried.
+	if resp.StatusCode == http.StatusUnauthorized && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) && f.refreshable() {
+		resp.Body.Close()
+		level.Debug(f.logger).Log("msg", "token was rejected, fetching a new one", "context", f.context)
+
+		if err := f.authenticate(ctx, true); err != nil {
+			return nil, &AuthError{Context: f.context, Err: err}
+		}
+
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, fmt.Errorf("creating request: %w", err)
+			}
+		}
+		if resp, err = f.send(req); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// RequestIDHeader is the header identifying requests in the logs of the gateway and backends.
+const RequestIDHeader = "X-Request-ID"
+
+// ScopeOrgIDHeader is the header identifying the tenant of requests to Cortex APIs.
+const ScopeOrgIDHeader = "X-Scope-OrgID"
+
+// send sends a request with a new request ID, so that every attempt can be found in the logs of the gateway.
+func (f *Fetcher) send(req *http.Request) (*http.Response, error) {
+	f.mtx.Lock()
+	client := f.client
+	f.mtx.Unlock()
+
+	id := newRequestID()
+	req.Header.Set(RequestIDHeader, id)
+	level.Debug(f.logger).Log("msg", "sending request", "method", req.Method, "url", req.URL, "request_id", id)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s (request ID %s): %w", req.Method, req.URL, id, err)
+	}
+	level.Debug(f.logger).Log("msg", "received response", "status", resp.StatusCode, "request_id", id)
+	return resp, nil
+}
+
+// newRequestID returns a random request ID of 32 hex characters, like the trace IDs of W3C trace context.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// The system random number generator never fails on supported platforms.
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// AuthError is returned when the API rejects the credentials of a context, even after fetching a new token.
+type AuthError struct {
+	Context config.Context
+	Err     error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("authenticating for context %s: %s", e.Context, e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError is returned for responses with unexpected status codes.
+type StatusError struct {
+	StatusCode int
+	Body       string
+	// RequestID is the ID the request was sent with, for operators to find it in the logs of the gateway.
+	RequestID string
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("unexpected status code %d", e.StatusCode)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg + e.requestID()
+}
+
+// requestID returns the suffix of error messages identifying the request, if its ID is known.
+func (e *StatusError) requestID() string {
+	if e.RequestID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (request ID %s)", e.RequestID)
+}
+
+// Response is the envelope of Prometheus-compatible (and Loki) API responses.
+type Response struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	// Warnings are set e.g. by Thanos for partial responses, when some stores could not be queried.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// DecodeData decodes the data of a successful API response into v.
+func DecodeData(b []byte, v interface{}) error {
+	var resp Response
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+
+	if resp.Status != "success" {
+		return fmt.Errorf("request failed: %s: %s", resp.ErrorType, resp.Error)
+	}
+
+	if err := json.Unmarshal(resp.Data, v); err != nil {
+		return fmt.Errorf("decoding response data: %w", err)
+	}
+	return nil
+}
+
+// get performs a GET request against an endpoint of the signal's query API and decodes the response data into v.
+func (f *Fetcher) get(ctx context.Context, signal Signal, endpoint string, params url.Values, v interface{}) error {
+	b, err := f.Do(ctx, http.MethodGet, signal, signal.queryPrefix()+endpoint, params, nil, "")
+	if err != nil {
+		return queryError(err)
+	}
+
+	if err := f.CheckWarnings(signal.queryPrefix()+endpoint, b); err != nil {
+		return err
+	}
+	return DecodeData(b, v)
+}
+
+// CheckWarnings passes the warnings of a response of the query API to OnWarnings.
+func (f *Fetcher) CheckWarnings(endpoint string, b []byte) error {
+	if f.OnWarnings == nil {
+		return nil
+	}
+
+	if w := Warnings(b); len(w) > 0 {
+		return f.OnWarnings(endpoint, w)
+	}
+	return nil
+}
+
+// Warnings returns the warnings of a response of the query API.
+func Warnings(b []byte) []string {
+	var resp struct {
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil
+	}
+	return resp.Warnings
+}
+
+// Stream performs a GET request against an endpoint of the signal's query API, whose response data
+// is an array, and calls fn with each element as soon as it is decoded. Unlike with get, the
+// response is never held in memory as a whole, so arbitrarily large responses can be processed.
+func (f *Fetcher) Stream(ctx context.Context, signal Signal, endpoint string, params url.Values, fn func(json.RawMessage) error) error {
+	resp, err := f.do(ctx, http.MethodGet, signal, signal.queryPrefix()+endpoint, params, nil, "")
+	if err != nil {
+		return queryError(err)
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	var envelope Response
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("decoding response: %w", err)
+		}
+
+		switch t {
+		case "data":
+			if err := streamArray(dec, fn); err != nil {
+				return err
+			}
+		case "status":
+			err = dec.Decode(&envelope.Status)
+		case "errorType":
+			err = dec.Decode(&envelope.ErrorType)
+		case "warnings":
+			err = dec.Decode(&envelope.Warnings)
+		case "error":
+			err = dec.Decode(&envelope.Error)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return fmt.Errorf("decoding response: %w", err)
+		}
+	}
+
+	if envelope.Status != "success" {
+		return fmt.Errorf("request failed: %s: %s", envelope.ErrorType, envelope.Error)
+	}
+	if len(envelope.Warnings) > 0 && f.OnWarnings != nil {
+		return f.OnWarnings(signal.queryPrefix()+endpoint, envelope.Warnings)
+	}
+	return nil
+}
+
+// streamArray decodes a JSON array (or null) element by element, calling fn for each.
+func streamArray(dec *json.Decoder, fn func(json.RawMessage) error) error {
+	t, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("decoding response data: %w", err)
+	}
+	if t == nil {
+		return nil
+	}
+	if t != json.Delim('[') {
+		return fmt.Errorf("decoding response data: expected array, got %v", t)
+	}
+
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("decoding response data: %w", err)
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	if t != d {
+		return fmt.Errorf("decoding response: expected %v, got %v", d, t)
+	}
+	return nil
+}
+
+// APIError is a failed request with an error in the Prometheus-compatible envelope.
+type APIError struct {
+	*StatusError
+	Type    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("request failed with status code %d: %s: %s%s", e.StatusCode, e.Type, e.Message, e.requestID())
+}
+
+func (e *APIError) Unwrap() error {
+	return e.StatusError
+}
+
+// queryError prefers the error of the Prometheus-compatible envelope in failed responses to the raw body.
+func queryError(err error) error {
+	var serr *StatusError
+	if errors.As(err, &serr) {
+		var resp Response
+		if json.Unmarshal([]byte(serr.Body), &resp) == nil && resp.Error != "" {
+			return &APIError{StatusError: serr, Type: resp.ErrorType, Message: resp.Error}
+		}
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Forward sends a request received for another server to the endpoint of the signal's API at the
+// path of the request, with the credentials of the tenant, and returns the response as is, whatever
+// its status code. Credentials of the request are dropped.
+func (f *Fetcher) Forward(in *http.Request, signal Signal) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(in.Context(), in.Method, f.URL(signal, in.URL.EscapedPath(), in.URL.Query()), in.Body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header = in.Header.Clone()
+	req.Header.Del("Authorization")
+	req.Header.Del("Cookie")
+	req.ContentLength = in.ContentLength
+	// Bodies of forwarded requests can't be replayed, retrying them with a new token is left to the client.
+	req.GetBody = nil
+
+	return f.roundTrip(in.Context(), req)
+}
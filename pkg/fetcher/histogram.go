@@ -0,0 +1,156 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Histogram is the value of a native histogram sample.
+type Histogram struct {
+	Count   string            `json:"count"`
+	Sum     string            `json:"sum"`
+	Buckets []HistogramBucket `json:"buckets,omitempty"`
+}
+
+// HistogramBucket is a bucket of a native histogram, encoded as [<boundaries>, "<lower>", "<upper>", "<count>"].
+// Boundaries is 0 if the bucket is open to the left, 1 if open to the right, 2 if open on both sides
+// and 3 if closed on both sides.
+type HistogramBucket struct {
+	Boundaries int
+	Lower      float64
+	Upper      float64
+	Count      float64
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *HistogramBucket) UnmarshalJSON(data []byte) error {
+	var raw [4]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	boundaries, ok := raw[0].(float64)
+	if !ok {
+		return fmt.Errorf("invalid bucket boundaries %v", raw[0])
+	}
+	b.Boundaries = int(boundaries)
+
+	for i, v := range []*float64{&b.Lower, &b.Upper, &b.Count} {
+		s, ok := raw[i+1].(string)
+		if !ok {
+			return fmt.Errorf("invalid bucket value %v", raw[i+1])
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid bucket value %q: %w", s, err)
+		}
+		*v = f
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (b HistogramBucket) MarshalJSON() ([]byte, error) {
+	format := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+	return json.Marshal([4]interface{}{b.Boundaries, format(b.Lower), format(b.Upper), format(b.Count)})
+}
+
+// HistogramPair is a native histogram sample of a series, encoded as [<unix seconds>, <histogram>].
+type HistogramPair struct {
+	Timestamp float64
+	Histogram Histogram
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (h *HistogramPair) UnmarshalJSON(b []byte) error {
+	var raw [2]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw[0], &h.Timestamp); err != nil {
+		return fmt.Errorf("invalid histogram timestamp %s", raw[0])
+	}
+	if err := json.Unmarshal(raw[1], &h.Histogram); err != nil {
+		return fmt.Errorf("invalid histogram: %w", err)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (h HistogramPair) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]interface{}{h.Timestamp, h.Histogram})
+}
+
+// Time returns the timestamp of the sample.
+func (h HistogramPair) Time() time.Time {
+	sec, frac := math.Modf(h.Timestamp)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// CountFloat returns the number of observations of the histogram.
+func (h Histogram) CountFloat() float64 {
+	f, _ := strconv.ParseFloat(h.Count, 64)
+	return f
+}
+
+// SumFloat returns the sum of observations of the histogram.
+func (h Histogram) SumFloat() float64 {
+	f, _ := strconv.ParseFloat(h.Sum, 64)
+	return f
+}
+
+// Quantile estimates the q-quantile of the observations, interpolating linearly within the bucket the
+// quantile falls into, like histogram_quantile. It returns NaN for histograms without observations.
+func (h Histogram) Quantile(q float64) float64 {
+	buckets := append([]HistogramBucket(nil), h.Buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Upper < buckets[j].Upper })
+
+	var total float64
+	for _, b := range buckets {
+		total += b.Count
+	}
+	if total == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return buckets[0].Lower
+	}
+	if q >= 1 {
+		return buckets[len(buckets)-1].Upper
+	}
+
+	rank := q * total
+	var cum float64
+	for _, b := range buckets {
+		if cum+b.Count >= rank && b.Count > 0 {
+			return b.Lower + (b.Upper-b.Lower)*(rank-cum)/b.Count
+		}
+		cum += b.Count
+	}
+	return buckets[len(buckets)-1].Upper
+}
+
+// summaryQuantiles are the quantiles estimated by Summary.
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Summary summarizes the histogram in a single line with its count, sum, number of buckets and
+// estimated quantiles, e.g. "count=12 sum=3.4 buckets=5 p50=0.1 p90=0.5 p99=0.9". Sums and
+// quantiles are formatted with format.
+func (h Histogram) Summary(format func(float64) string) string {
+	parts := []string{
+		"count=" + strconv.FormatFloat(h.CountFloat(), 'f', -1, 64),
+		"sum=" + format(h.SumFloat()),
+		"buckets=" + strconv.Itoa(len(h.Buckets)),
+	}
+	for _, q := range summaryQuantiles {
+		if v := h.Quantile(q); !math.IsNaN(v) {
+			parts = append(parts, fmt.Sprintf("p%s=%s", strconv.FormatFloat(q*100, 'f', -1, 64), format(v)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,33 @@
+package fetcher
+
+import (
+	"context"
+	"net/url"
+)
+
+// LabelNames returns the label names of the signal's series (or streams) of the tenant.
+func (f *Fetcher) LabelNames(ctx context.Context, signal Signal, params url.Values) ([]string, error) {
+	var names []string
+	if err := f.get(ctx, signal, "/labels", params, &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// LabelValues returns the values of a label of the signal's series (or streams) of the tenant.
+func (f *Fetcher) LabelValues(ctx context.Context, signal Signal, name string, params url.Values) ([]string, error) {
+	var values []string
+	if err := f.get(ctx, signal, "/label/"+url.PathEscape(name)+"/values", params, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Series returns the label sets of the signal's series (or streams) of the tenant matching the selectors in params.
+func (f *Fetcher) Series(ctx context.Context, signal Signal, params url.Values) ([]map[string]string, error) {
+	var series []map[string]string
+	if err := f.get(ctx, signal, "/series", params, &series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
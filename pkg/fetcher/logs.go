@@ -0,0 +1,114 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LogPattern is a pattern of log lines detected by Loki, with the number of matching lines over time.
+type LogPattern struct {
+	Pattern string `json:"pattern"`
+	// Samples are the numbers of matching lines, encoded as [<unix seconds>, <count>].
+	Samples [][2]int64 `json:"samples"`
+}
+
+// Total returns the number of log lines matching the pattern.
+func (p LogPattern) Total() int64 {
+	var n int64
+	for _, s := range p.Samples {
+		n += s[1]
+	}
+	return n
+}
+
+// Patterns returns the patterns detected in the log lines matching the LogQL selector in params.
+func (f *Fetcher) Patterns(ctx context.Context, params url.Values) ([]LogPattern, error) {
+	var patterns []LogPattern
+	if err := f.get(ctx, Logs, "/patterns", params, &patterns); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// DetectedField is a field Loki detected in log lines, e.g. a logfmt key or a JSON attribute.
+type DetectedField struct {
+	Label       string   `json:"label"`
+	Type        string   `json:"type"`
+	Cardinality uint64   `json:"cardinality"`
+	Parsers     []string `json:"parsers"`
+}
+
+// DetectedFields returns the fields detected in the log lines matching the LogQL query in params.
+func (f *Fetcher) DetectedFields(ctx context.Context, params url.Values) ([]DetectedField, error) {
+	endpoint := Logs.queryPrefix() + "/detected_fields"
+	b, err := f.Do(ctx, http.MethodGet, Logs, endpoint, params, nil, "")
+	if err != nil {
+		return nil, queryError(err)
+	}
+
+	// Unlike the query API, the response is not wrapped in a status envelope.
+	var resp struct {
+		Fields []DetectedField `json:"fields"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	return resp.Fields, nil
+}
+
+// LogStream is a stream of a streams query result, with its entries encoded as [<unix nanoseconds>, <line>].
+type LogStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// LogEntry is a single log line of a stream.
+type LogEntry struct {
+	Time   time.Time         `json:"timestamp"`
+	Labels map[string]string `json:"labels"`
+	Line   string            `json:"line"`
+}
+
+// Streams decodes the result of a log query.
+func (d *QueryData) Streams() ([]LogStream, error) {
+	if d.ResultType != "streams" {
+		return nil, fmt.Errorf("unexpected result type %s, expected streams", d.ResultType)
+	}
+
+	var res []LogStream
+	if err := json.Unmarshal(d.Result, &res); err != nil {
+		return nil, fmt.Errorf("decoding %s result: %w", d.ResultType, err)
+	}
+	return res, nil
+}
+
+// Entries decodes the result of a log query into the entries of all streams, ordered by time.
+func (d *QueryData) Entries() ([]LogEntry, error) {
+	streams, err := d.Streams()
+	if err != nil {
+		return nil, err
+	}
+	return streamEntries(streams)
+}
+
+// streamEntries returns the entries of all streams, ordered by time.
+func streamEntries(streams []LogStream) ([]LogEntry, error) {
+	var entries []LogEntry
+	for _, s := range streams {
+		for _, v := range s.Values {
+			ns, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log entry timestamp %q", v[0])
+			}
+			entries = append(entries, LogEntry{Time: time.Unix(0, ns), Labels: s.Stream, Line: v[1]})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
@@ -0,0 +1,23 @@
+package fetcher
+
+import (
+	"context"
+	"net/url"
+)
+
+// MetricMetadata is the metadata of a metric as exposed by its targets.
+type MetricMetadata struct {
+	Type string `json:"type"`
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+}
+
+// Metadata returns the metadata of the tenant's metrics by metric name. Metrics exposed with
+// differing metadata by different targets have multiple entries.
+func (f *Fetcher) Metadata(ctx context.Context, params url.Values) (map[string][]MetricMetadata, error) {
+	var md map[string][]MetricMetadata
+	if err := f.get(ctx, Metrics, "/metadata", params, &md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
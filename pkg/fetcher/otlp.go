@@ -0,0 +1,15 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/observatorium/obsctl/pkg/otlp"
+)
+
+// PushOTLPMetrics sends an OTLP metrics request in the JSON encoding to the OTLP receiver of the
+// metrics API, at the path of the OTLP receiver of Prometheus, and returns the response body.
+func (f *Fetcher) PushOTLPMetrics(ctx context.Context, body []byte) ([]byte, error) {
+	return f.Do(ctx, http.MethodPost, Metrics, Metrics.queryPrefix()+"/otlp/v1/metrics", nil, bytes.NewReader(body), otlp.ContentType)
+}
@@ -0,0 +1,122 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryData is the data of a query response.
+type QueryData struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// Empty reports whether the query returned no series or streams.
+func (d *QueryData) Empty() bool {
+	switch d.ResultType {
+	case "vector", "matrix", "streams":
+		var res []json.RawMessage
+		if err := json.Unmarshal(d.Result, &res); err != nil {
+			return false
+		}
+		return len(res) == 0
+	default:
+		return false
+	}
+}
+
+// SamplePair is a single sample of a series, encoded as [<unix seconds>, "<value>"].
+type SamplePair struct {
+	Timestamp float64
+	Value     string
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *SamplePair) UnmarshalJSON(b []byte) error {
+	var raw [2]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	ts, ok := raw[0].(float64)
+	if !ok {
+		return fmt.Errorf("invalid sample timestamp %v", raw[0])
+	}
+	v, ok := raw[1].(string)
+	if !ok {
+		return fmt.Errorf("invalid sample value %v", raw[1])
+	}
+
+	s.Timestamp, s.Value = ts, v
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s SamplePair) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]interface{}{s.Timestamp, s.Value})
+}
+
+// Time returns the timestamp of the sample.
+func (s SamplePair) Time() time.Time {
+	sec, frac := math.Modf(s.Timestamp)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// Float returns the sample value as a float.
+func (s SamplePair) Float() float64 {
+	f, _ := strconv.ParseFloat(s.Value, 64)
+	return f
+}
+
+// Series is a series of a vector (Value or Histogram is set) or matrix (Values or Histograms are set)
+// query result. Histogram and Histograms are native histogram samples.
+type Series struct {
+	Metric     map[string]string `json:"metric"`
+	Value      *SamplePair       `json:"value,omitempty"`
+	Values     []SamplePair      `json:"values,omitempty"`
+	Histogram  *HistogramPair    `json:"histogram,omitempty"`
+	Histograms []HistogramPair   `json:"histograms,omitempty"`
+}
+
+// FormatMetric formats a label set in the usual PromQL notation, e.g. up{job="prometheus"}.
+func FormatMetric(m map[string]string) string {
+	labels := make([]string, 0, len(m))
+	for k, v := range m {
+		if k == "__name__" {
+			continue
+		}
+		labels = append(labels, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(labels)
+	return m["__name__"] + "{" + strings.Join(labels, ", ") + "}"
+}
+
+// Series decodes the result of a vector or matrix query.
+func (d *QueryData) Series() ([]Series, error) {
+	if d.ResultType != "vector" && d.ResultType != "matrix" {
+		return nil, fmt.Errorf("unexpected result type %s, expected vector or matrix", d.ResultType)
+	}
+
+	var res []Series
+	if err := json.Unmarshal(d.Result, &res); err != nil {
+		return nil, fmt.Errorf("decoding %s result: %w", d.ResultType, err)
+	}
+	return res, nil
+}
+
+// Query runs a query against an endpoint of the signal's query API (e.g. "/query" or
+// "/query_range") and decodes the result.
+func (f *Fetcher) Query(ctx context.Context, signal Signal, endpoint string, params url.Values) (*QueryData, error) {
+	var data QueryData
+	if err := f.get(ctx, signal, endpoint, params, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
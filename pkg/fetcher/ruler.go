@@ -0,0 +1,181 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/observatorium/obsctl/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// rulerEndpoint returns the endpoint of the ruler configuration API of Cortex APIs for the signal.
+func (s Signal) rulerEndpoint() string {
+	if s == Logs {
+		return "/loki/api/v1/rules"
+	}
+	return "/config/v1/rules"
+}
+
+// RawRules returns the configured rules of the tenant for the signal as YAML. For Cortex APIs, these
+// are the rule groups of all namespaces, keyed by namespace.
+func (f *Fetcher) RawRules(ctx context.Context, signal Signal) ([]byte, error) {
+	endpoint := signal.RawRulesEndpoint()
+	if f.api.Flavor == config.FlavorCortex {
+		endpoint = signal.rulerEndpoint()
+	}
+	return f.Do(ctx, http.MethodGet, signal, endpoint, nil, nil, "")
+}
+
+// CurrentRules returns the configured metrics rules replaced by SetRules with the same namespace, as
+// rule file. Tenants without rules have empty rules.
+func (f *Fetcher) CurrentRules(ctx context.Context, namespace string) ([]byte, error) {
+	if f.api.Flavor != config.FlavorCortex {
+		return notFoundAsEmpty(f.Do(ctx, http.MethodGet, Metrics, Metrics.RawRulesEndpoint(), nil, nil, ""))
+	}
+
+	groups, err := f.namespaceGroups(ctx, namespace)
+	if err != nil || len(groups) == 0 {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(ruleFile{Groups: groups}); err != nil {
+		return nil, fmt.Errorf("encoding rules of namespace %s: %w", namespace, err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SetRules replaces configured metrics rules with those of a rule file and returns the response of
+// the API. Observatorium APIs replace all rules of the tenant. Cortex APIs replace the rule groups
+// of the namespace, one group at a time, and delete groups no longer in the file.
+func (f *Fetcher) SetRules(ctx context.Context, namespace string, rules []byte) ([]byte, error) {
+	if f.api.Flavor != config.FlavorCortex {
+		return f.Do(ctx, http.MethodPut, Metrics, Metrics.RawRulesEndpoint(), nil, bytes.NewReader(rules), "application/yaml")
+	}
+
+	if namespace == "" {
+		return nil, errors.New("rules of Cortex APIs need a namespace")
+	}
+
+	var file ruleFile
+	if err := yaml.Unmarshal(rules, &file); err != nil {
+		return nil, fmt.Errorf("parsing rule file: %w", err)
+	}
+
+	current, err := f.namespaceGroups(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := Metrics.rulerEndpoint() + "/" + url.PathEscape(namespace)
+	names := map[string]bool{}
+	for _, g := range file.Groups {
+		var meta struct {
+			Name string `yaml:"name"`
+		}
+		if err := g.Decode(&meta); err != nil || meta.Name == "" {
+			return nil, errors.New("parsing rule file: rule group without name")
+		}
+		names[meta.Name] = true
+
+		b, err := yaml.Marshal(g)
+		if err != nil {
+			return nil, fmt.Errorf("encoding rule group %s: %w", meta.Name, err)
+		}
+		if _, err := f.Do(ctx, http.MethodPost, Metrics, endpoint, nil, bytes.NewReader(b), "application/yaml"); err != nil {
+			return nil, fmt.Errorf("setting rule group %s: %w", meta.Name, err)
+		}
+	}
+
+	var deleted int
+	for _, g := range current {
+		var meta struct {
+			Name string `yaml:"name"`
+		}
+		if err := g.Decode(&meta); err != nil || names[meta.Name] {
+			continue
+		}
+		if _, err := f.Do(ctx, http.MethodDelete, Metrics, endpoint+"/"+url.PathEscape(meta.Name), nil, nil, ""); err != nil {
+			return nil, fmt.Errorf("deleting rule group %s: %w", meta.Name, err)
+		}
+		deleted++
+	}
+
+	return []byte(fmt.Sprintf("set %d and deleted %d rule groups of namespace %s", len(file.Groups), deleted, namespace)), nil
+}
+
+// MergeRules merges rule files, named by names for errors, into a single rule file with the groups
+// of all files in order, for Observatorium APIs replacing all rules of a tenant at once. Group names
+// must be unique across files.
+func MergeRules(names []string, files [][]byte) ([]byte, error) {
+	var merged ruleFile
+	seen := map[string]string{}
+	for i, b := range files {
+		var file ruleFile
+		if err := yaml.Unmarshal(b, &file); err != nil {
+			return nil, fmt.Errorf("parsing rule file %s: %w", names[i], err)
+		}
+		for _, g := range file.Groups {
+			var meta struct {
+				Name string `yaml:"name"`
+			}
+			if err := g.Decode(&meta); err != nil || meta.Name == "" {
+				return nil, fmt.Errorf("parsing rule file %s: rule group without name", names[i])
+			}
+			if other, ok := seen[meta.Name]; ok {
+				return nil, fmt.Errorf("rule group %q is defined in both %s and %s", meta.Name, other, names[i])
+			}
+			seen[meta.Name] = names[i]
+		}
+		merged.Groups = append(merged.Groups, file.Groups...)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(merged); err != nil {
+		return nil, fmt.Errorf("encoding merged rules: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ruleFile is a Prometheus rule file, with the rule groups kept as they are.
+type ruleFile struct {
+	Groups []yaml.Node `yaml:"groups"`
+}
+
+// namespaceGroups returns the rule groups of a namespace of the Cortex ruler API.
+func (f *Fetcher) namespaceGroups(ctx context.Context, namespace string) ([]yaml.Node, error) {
+	b, err := notFoundAsEmpty(f.Do(ctx, http.MethodGet, Metrics, Metrics.rulerEndpoint()+"/"+url.PathEscape(namespace), nil, nil, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces map[string][]yaml.Node
+	if err := yaml.Unmarshal(b, &namespaces); err != nil {
+		return nil, fmt.Errorf("parsing rules of namespace %s: %w", namespace, err)
+	}
+	return namespaces[namespace], nil
+}
+
+// notFoundAsEmpty returns an empty body for 404 Not Found errors, as returned for tenants or
+// namespaces without rules.
+func notFoundAsEmpty(b []byte, err error) ([]byte, error) {
+	var serr *StatusError
+	if errors.As(err, &serr) && serr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	return b, err
+}
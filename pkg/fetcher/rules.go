@@ -0,0 +1,62 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+)
+
+// RuleGroup is a group of rules as returned by the Prometheus rules API.
+type RuleGroup struct {
+	Name     string  `json:"name"`
+	File     string  `json:"file"`
+	Interval float64 `json:"interval"`
+	Rules    []Rule  `json:"rules"`
+}
+
+// Rule is an alerting or recording rule as returned by the Prometheus rules API.
+type Rule struct {
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	Query       string            `json:"query"`
+	Duration    float64           `json:"duration,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Health      string            `json:"health,omitempty"`
+	State       string            `json:"state,omitempty"`
+}
+
+// RulesEndpoint returns the endpoint of the Prometheus-compatible rules API of the signal.
+func (s Signal) RulesEndpoint() string {
+	if s == Logs {
+		return "/prometheus/api/v1/rules"
+	}
+	return "/api/v1/rules"
+}
+
+// RawRulesEndpoint returns the endpoint serving the configured rules of the signal as YAML.
+func (s Signal) RawRulesEndpoint() string {
+	if s == Logs {
+		return "/loki/api/v1/rules"
+	}
+	return "/api/v1/rules/raw"
+}
+
+// Rules returns the rule groups of the tenant for the signal, as evaluated by the rules API.
+func (f *Fetcher) Rules(ctx context.Context, signal Signal) ([]RuleGroup, error) {
+	endpoint := signal.RulesEndpoint()
+	b, err := f.Do(ctx, http.MethodGet, signal, endpoint, nil, nil, "")
+	if err != nil {
+		return nil, queryError(err)
+	}
+	if err := f.CheckWarnings(endpoint, b); err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Groups []RuleGroup `json:"groups"`
+	}
+	if err := DecodeData(b, &data); err != nil {
+		return nil, err
+	}
+	return data.Groups, nil
+}
@@ -0,0 +1,52 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// BuildInfo is the build information of a backend, as returned by the buildinfo API of Prometheus and Loki.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildUser string `json:"buildUser"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// BuildInfo returns the build information of the backend serving the signal for the tenant.
+func (f *Fetcher) BuildInfo(ctx context.Context, signal Signal) (*BuildInfo, error) {
+	var info BuildInfo
+	if err := f.get(ctx, signal, "/status/buildinfo", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Probe sends a GET request to a path of the API outside of the APIs of the tenant, e.g. the
+// readiness endpoint /-/ready. Responses with non-2xx status codes are returned as errors.
+func (f *Fetcher) Probe(ctx context.Context, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(f.api.URL, "/")+path, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := f.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(b)), RequestID: req.Header.Get(RequestIDHeader)}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+	"golang.org/x/net/websocket"
+)
+
+// TailResponse is a message of the tail API of Loki, with the entries received since the previous one.
+type TailResponse struct {
+	Streams []LogStream `json:"streams"`
+	// DroppedEntries are entries Loki dropped as the client didn't keep up with them.
+	DroppedEntries []struct {
+		Labels    map[string]string `json:"labels"`
+		Timestamp string            `json:"timestamp"`
+	} `json:"dropped_entries"`
+}
+
+// Entries returns the entries of all streams of the message, ordered by time.
+func (r TailResponse) Entries() ([]LogEntry, error) {
+	return streamEntries(r.Streams)
+}
+
+// ConnectError is returned by Tail if connecting to the tail API failed.
+type ConnectError struct {
+	URL       string
+	RequestID string
+	Err       error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("connecting to %s (request ID %s): %v", e.URL, e.RequestID, e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// ReceiveError is returned by Tail if the connection to the tail API failed after it was established.
+type ReceiveError struct {
+	Err error
+}
+
+func (e *ReceiveError) Error() string {
+	return fmt.Sprintf("receiving tailed logs: %v", e.Err)
+}
+
+func (e *ReceiveError) Unwrap() error {
+	return e.Err
+}
+
+// Tail connects to the tail websocket of Loki with the given parameters and calls fn with every
+// message received, until ctx is done, fn returns an error or the connection fails.
+func (f *Fetcher) Tail(ctx context.Context, params url.Values, fn func(TailResponse) error) error {
+	u, err := url.Parse(f.URL(Logs, Logs.queryPrefix()+"/tail", params))
+	if err != nil {
+		return fmt.Errorf("parsing tail URL: %w", err)
+	}
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+
+	wsConfig, err := websocket.NewConfig(u.String(), f.api.URL)
+	if err != nil {
+		return fmt.Errorf("creating tail request: %w", err)
+	}
+
+	configMtx.Lock()
+	_, tenant, err := f.cfg.GetContext(f.context)
+	configMtx.Unlock()
+	if err != nil {
+		return err
+	}
+	if wsConfig.TlsConfig, err = f.api.TLSConfig(tenant); err != nil {
+		return fmt.Errorf("getting client for context %s: %w", f.context, err)
+	}
+	wsConfig.Dialer = &net.Dialer{Timeout: 30 * time.Second}
+
+	// The websocket handshake doesn't go through the client of the fetcher, so it is authenticated here.
+	token, err := f.Token()
+	if err != nil {
+		return &AuthError{Context: f.context, Err: err}
+	}
+	if token != nil {
+		wsConfig.Header.Set("Authorization", token.Type()+" "+token.AccessToken)
+	}
+	if f.api.Flavor == config.FlavorCortex {
+		wsConfig.Header.Set(ScopeOrgIDHeader, f.tenant)
+	}
+	id := newRequestID()
+	wsConfig.Header.Set(RequestIDHeader, id)
+
+	level.Debug(f.logger).Log("msg", "connecting to tail API", "url", u, "request_id", id)
+	conn, err := websocket.DialConfig(wsConfig)
+	if err != nil {
+		// The URL is part of the error already.
+		var derr *websocket.DialError
+		if errors.As(err, &derr) {
+			err = derr.Err
+		}
+		return &ConnectError{URL: u.String(), RequestID: id, Err: err}
+	}
+	defer conn.Close()
+
+	// Receiving blocks until a message arrives, closing the connection unblocks it.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		var msg TailResponse
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &ReceiveError{Err: err}
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Trace is a trace in the JSON model of the Jaeger query API.
+type Trace struct {
+	TraceID   string             `json:"traceID"`
+	Spans     []Span             `json:"spans"`
+	Processes map[string]Process `json:"processes"`
+}
+
+// Span is a span of a trace. StartTime and Duration are in microseconds.
+type Span struct {
+	TraceID       string      `json:"traceID"`
+	SpanID        string      `json:"spanID"`
+	OperationName string      `json:"operationName"`
+	StartTime     int64       `json:"startTime"`
+	Duration      int64       `json:"duration"`
+	Tags          []KeyValue  `json:"tags"`
+	ProcessID     string      `json:"processID"`
+	References    []Reference `json:"references,omitempty"`
+}
+
+// Reference links a span to another span, e.g. its parent with a CHILD_OF reference.
+type Reference struct {
+	RefType string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+// ParentID returns the ID of the parent span within the same trace, or an empty string for root spans.
+func (s Span) ParentID() string {
+	for _, r := range s.References {
+		if r.RefType == "CHILD_OF" && r.TraceID == s.TraceID {
+			return r.SpanID
+		}
+	}
+	// Spans following from another span are shown below it as well if they have no parent.
+	for _, r := range s.References {
+		if r.TraceID == s.TraceID {
+			return r.SpanID
+		}
+	}
+	return ""
+}
+
+// Failed reports whether the span is marked as failed with the error tag.
+func (s Span) Failed() bool {
+	for _, kv := range s.Tags {
+		if kv.Key == "error" && fmt.Sprint(kv.Value) == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// Process is the process that emitted spans, with its service name and resource attributes.
+type Process struct {
+	ServiceName string     `json:"serviceName"`
+	Tags        []KeyValue `json:"tags"`
+}
+
+// KeyValue is an attribute of a span or process.
+type KeyValue struct {
+	Key   string      `json:"key"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// Tag returns the value of the attribute with the given key, or an empty string if there is none.
+func (p Process) Tag(key string) string {
+	for _, kv := range p.Tags {
+		if kv.Key == key {
+			return fmt.Sprint(kv.Value)
+		}
+	}
+	return ""
+}
+
+// Window returns the time range covered by the spans of the trace.
+func (t *Trace) Window() (time.Time, time.Time) {
+	var start, end int64
+	for i, s := range t.Spans {
+		if i == 0 || s.StartTime < start {
+			start = s.StartTime
+		}
+		if s.StartTime+s.Duration > end {
+			end = s.StartTime + s.Duration
+		}
+	}
+	return time.UnixMicro(start), time.UnixMicro(end)
+}
+
+// Root returns the root span of the trace, the earliest span without parent in the trace, or nil
+// if the trace has no spans.
+func (t *Trace) Root() *Span {
+	ids := make(map[string]bool, len(t.Spans))
+	for _, s := range t.Spans {
+		ids[s.SpanID] = true
+	}
+
+	var root *Span
+	for i, s := range t.Spans {
+		if ids[s.ParentID()] {
+			continue
+		}
+		if root == nil || s.StartTime < root.StartTime {
+			root = &t.Spans[i]
+		}
+	}
+	return root
+}
+
+// SpanProcesses returns the processes that emitted spans of the trace, ordered by service name.
+func (t *Trace) SpanProcesses() []Process {
+	seen := map[string]bool{}
+	var res []Process
+	for _, s := range t.Spans {
+		p, ok := t.Processes[s.ProcessID]
+		if !ok || seen[s.ProcessID] {
+			continue
+		}
+		seen[s.ProcessID] = true
+		res = append(res, p)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].ServiceName < res[j].ServiceName })
+	return res
+}
+
+// ErrTraceNotFound is returned for traces unknown to the traces backend.
+var ErrTraceNotFound = errors.New("trace not found")
+
+// Trace returns the trace with the given ID.
+func (f *Fetcher) Trace(ctx context.Context, id string) (*Trace, error) {
+	endpoint := Traces.queryPrefix() + "/traces/" + url.PathEscape(id)
+	b, err := f.Do(ctx, http.MethodGet, Traces, endpoint, nil, nil, "")
+	if err != nil {
+		var serr *StatusError
+		if errors.As(err, &serr) && serr.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrTraceNotFound, id)
+		}
+		return nil, err
+	}
+
+	traces, err := decodeTraces(b)
+	if err != nil {
+		return nil, fmt.Errorf("getting trace: %w", err)
+	}
+	if len(traces) == 0 || len(traces[0].Spans) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTraceNotFound, id)
+	}
+	return &traces[0], nil
+}
+
+// SearchTraces returns the traces matching the parameters of the search endpoint of the Jaeger
+// query API, e.g. service, operation, tags, minDuration, start and end.
+func (f *Fetcher) SearchTraces(ctx context.Context, params url.Values) ([]Trace, error) {
+	b, err := f.Do(ctx, http.MethodGet, Traces, Traces.queryPrefix()+"/traces", params, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return decodeTraces(b)
+}
+
+// decodeTraces decodes a response of the traces endpoints of the Jaeger query API.
+func decodeTraces(b []byte) ([]Trace, error) {
+	var resp struct {
+		Data   []Trace `json:"data"`
+		Errors []struct {
+			Msg string `json:"msg"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	if len(resp.Errors) > 0 {
+		return nil, errors.New(resp.Errors[0].Msg)
+	}
+	return resp.Data, nil
+}
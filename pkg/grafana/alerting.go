@@ -0,0 +1,136 @@
+package grafana
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/duration"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+)
+
+// AlertingProvisioning is a Grafana alerting provisioning file, see
+// https://grafana.com/docs/grafana/latest/alerting/set-up/provision-alerting-resources/file-provisioning/.
+type AlertingProvisioning struct {
+	APIVersion int              `yaml:"apiVersion"`
+	Groups     []AlertRuleGroup `yaml:"groups"`
+}
+
+// AlertRuleGroup is a group of Grafana-managed alert rules evaluated at the same interval.
+type AlertRuleGroup struct {
+	OrgID    int         `yaml:"orgId"`
+	Name     string      `yaml:"name"`
+	Folder   string      `yaml:"folder"`
+	Interval string      `yaml:"interval"`
+	Rules    []AlertRule `yaml:"rules"`
+}
+
+// AlertRule is a Grafana-managed alert rule.
+type AlertRule struct {
+	UID          string            `yaml:"uid"`
+	Title        string            `yaml:"title"`
+	Condition    string            `yaml:"condition"`
+	Data         []AlertQuery      `yaml:"data"`
+	NoDataState  string            `yaml:"noDataState"`
+	ExecErrState string            `yaml:"execErrState"`
+	For          string            `yaml:"for"`
+	Annotations  map[string]string `yaml:"annotations,omitempty"`
+	Labels       map[string]string `yaml:"labels,omitempty"`
+}
+
+// AlertQuery is a query or expression of an alert rule.
+type AlertQuery struct {
+	RefID             string                 `yaml:"refId"`
+	DatasourceUID     string                 `yaml:"datasourceUid"`
+	RelativeTimeRange *RelativeTimeRange     `yaml:"relativeTimeRange,omitempty"`
+	Model             map[string]interface{} `yaml:"model"`
+}
+
+// RelativeTimeRange is the time range of a query, in seconds before the evaluation time.
+type RelativeTimeRange struct {
+	From int `yaml:"from"`
+	To   int `yaml:"to"`
+}
+
+// expressionDatasourceUID is the UID of the datasource of server-side expressions.
+const expressionDatasourceUID = "__expr__"
+
+// AlertingOptions configure the conversion of Prometheus alerting rules into Grafana alert rules.
+type AlertingOptions struct {
+	OrgID int
+	// Folder is the Grafana folder the rule groups are provisioned in.
+	Folder string
+	// DatasourceUID is the UID of the Grafana datasource querying the tenant.
+	DatasourceUID string
+	// DefaultInterval is the evaluation interval of rule groups without one.
+	DefaultInterval time.Duration
+}
+
+// AlertingFromPrometheus converts the alerting rules of Prometheus rule groups into Grafana
+// alert rules with the same semantics: every series returned by the expression is an alert
+// instance, regardless of its value. Recording rules and groups without alerting rules are
+// skipped. Rule UIDs are derived from the group and rule names, so that provisioning the
+// converted rules again updates them instead of adding duplicates.
+func AlertingFromPrometheus(groups []fetcher.RuleGroup, opts AlertingOptions) AlertingProvisioning {
+	p := AlertingProvisioning{APIVersion: 1}
+	for _, g := range groups {
+		interval := time.Duration(g.Interval * float64(time.Second))
+		if interval <= 0 {
+			interval = opts.DefaultInterval
+		}
+
+		ag := AlertRuleGroup{OrgID: opts.OrgID, Name: g.Name, Folder: opts.Folder, Interval: duration.Format(interval)}
+		for i, r := range g.Rules {
+			if r.Type != "alerting" {
+				continue
+			}
+			ag.Rules = append(ag.Rules, AlertRule{
+				UID:       ruleUID(g.Name, r.Name, i),
+				Title:     r.Name,
+				Condition: "B",
+				Data: []AlertQuery{
+					{
+						RefID:         "A",
+						DatasourceUID: opts.DatasourceUID,
+						// Prometheus evaluates alerting rules as instant queries, the range only matters for Grafana.
+						RelativeTimeRange: &RelativeTimeRange{From: 600},
+						Model: map[string]interface{}{
+							"refId":   "A",
+							"expr":    r.Query,
+							"instant": true,
+							"range":   false,
+						},
+					},
+					{
+						RefID:         "B",
+						DatasourceUID: expressionDatasourceUID,
+						// Fire for every series, like Prometheus does, instead of comparing values to a threshold.
+						Model: map[string]interface{}{
+							"refId":      "B",
+							"type":       "math",
+							"expression": "is_number($A) || is_nan($A) || is_inf($A)",
+						},
+					},
+				},
+				// Prometheus alerts resolve when the expression returns nothing and don't alert on failed evaluations.
+				NoDataState:  "OK",
+				ExecErrState: "OK",
+				For:          duration.Format(time.Duration(r.Duration * float64(time.Second))),
+				Annotations:  r.Annotations,
+				Labels:       r.Labels,
+			})
+		}
+		if len(ag.Rules) > 0 {
+			p.Groups = append(p.Groups, ag)
+		}
+	}
+	return p
+}
+
+// ruleUID returns a stable UID of a rule within the 40 characters allowed by Grafana. The index of the
+// rule in its group is part of it, as alerts are often defined repeatedly with different thresholds.
+func ruleUID(group, name string, index int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", group, name, index)))
+	return hex.EncodeToString(sum[:])[:20]
+}
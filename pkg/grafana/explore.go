@@ -0,0 +1,49 @@
+// Package grafana contains helpers to interoperate with Grafana.
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type exploreQuery struct {
+	RefID string `json:"refId"`
+	Expr  string `json:"expr"`
+}
+
+type exploreRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type exploreState struct {
+	Datasource string         `json:"datasource,omitempty"`
+	Queries    []exploreQuery `json:"queries"`
+	Range      exploreRange   `json:"range"`
+}
+
+// ExploreURL returns a Grafana Explore URL pre-filled with the given query, datasource and
+// time range. The range bounds can be anything Grafana accepts, e.g. "now-1h" or Unix
+// milliseconds. If datasource is empty, Grafana falls back to its default datasource.
+func ExploreURL(grafanaURL, datasource, query, from, to string) (string, error) {
+	u, err := url.Parse(grafanaURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing grafana url %s: %w", grafanaURL, err)
+	}
+
+	state, err := json.Marshal(exploreState{
+		Datasource: datasource,
+		Queries:    []exploreQuery{{RefID: "A", Expr: query}},
+		Range:      exploreRange{From: from, To: to},
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshaling explore state: %w", err)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/explore"
+	u.RawQuery = url.Values{"left": []string{string(state)}}.Encode()
+
+	return u.String(), nil
+}
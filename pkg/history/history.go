@@ -0,0 +1,149 @@
+// Package history keeps a local record of executed queries.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/observatorium/obsctl/pkg/config"
+)
+
+const (
+	historyFileName = "history.jsonl"
+	// lockFileName is the lock file serializing updates of the history file, see config.LockFile.
+	lockFileName = "history.flock"
+	// maxEntries is the number of most recent entries kept in the history file.
+	maxEntries = 1000
+)
+
+// Entry is a query executed against a context.
+type Entry struct {
+	// ID identifies the entry, it is kept when older entries are dropped.
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Context string    `json:"context"`
+	Signal  string    `json:"signal"`
+	Query   string    `json:"query"`
+}
+
+func getHistoryPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, historyFileName), nil
+}
+
+// Read returns all entries of the history, oldest first.
+func Read(logger log.Logger) ([]Entry, error) {
+	file, err := getHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading history file %s: %w", file, err)
+	}
+
+	var entries []Entry
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for s.Scan() {
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			level.Debug(logger).Log("msg", "skipping malformed history entry", "err", err)
+			continue
+		}
+		// Entries of former versions have no ID, they are numbered in order until saved with one.
+		if e.ID == 0 {
+			e.ID = 1
+			if n := len(entries); n > 0 {
+				e.ID = entries[n-1].ID + 1
+			}
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading history file %s: %w", file, err)
+	}
+
+	return entries, nil
+}
+
+// Append records an entry in the history with the next ID, dropping the oldest entries beyond
+// maxEntries. Repeating the most recent entry only updates its time, e.g. for re-executions with
+// --watch. Concurrent processes appending entries are serialized with a lock file, and the history
+// file is replaced atomically, so that entries are neither lost nor read partially.
+func Append(ctx context.Context, logger log.Logger, e Entry) error {
+	unlock, err := config.LockFile(ctx, logger, lockFileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := Read(logger)
+	if err != nil {
+		return err
+	}
+
+	if n := len(entries); n > 0 && entries[n-1].Context == e.Context && entries[n-1].Signal == e.Signal && entries[n-1].Query == e.Query {
+		entries[n-1].Time = e.Time
+	} else {
+		e.ID = 1
+		if n > 0 {
+			e.ID = entries[n-1].ID + 1
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("encoding history entry: %w", err)
+		}
+	}
+
+	file, err := getHistoryPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("creating config dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), historyFileName+".tmp")
+	if err != nil {
+		return fmt.Errorf("creating history file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing history file %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing history file %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("writing history file %s: %w", file, err)
+	}
+	return nil
+}
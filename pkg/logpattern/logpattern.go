@@ -0,0 +1,67 @@
+// Package logpattern groups near-identical log lines, e.g. lines only differing in timestamps, IDs or numbers.
+package logpattern
+
+import (
+	"regexp"
+	"sort"
+)
+
+// Placeholder replaces the variable parts of log lines in patterns, the same as in Loki patterns.
+const Placeholder = "<_>"
+
+// variable matches the parts of log lines that usually differ between otherwise identical lines:
+// timestamps, UUIDs, IP addresses, hex IDs and numbers with optional units.
+var variable = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?` +
+	`|\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b` +
+	`|\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b` +
+	`|\b(0x)?[0-9a-fA-F]*\d[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\b` +
+	`|\b(0x)?[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\d[0-9a-fA-F]*\b` +
+	`|-?\d+(\.\d+)?([eE][+-]?\d+)?(ns|us|µs|ms|s|m|h|d|[kKMGTP]i?B|%)?`)
+
+// Pattern returns the pattern of a log line, with its variable parts replaced by the Placeholder.
+func Pattern(line string) string {
+	return variable.ReplaceAllString(line, Placeholder)
+}
+
+// Group is a set of log lines sharing a pattern.
+type Group struct {
+	Pattern string `json:"pattern"`
+	// Example is the first line of the group.
+	Example string `json:"example"`
+	Count   int    `json:"count"`
+}
+
+// Aggregate groups lines by their pattern, most frequent first. Groups of the same size are
+// ordered by the first occurrence of their pattern.
+func Aggregate(lines []string) []Group {
+	var groups []Group
+	index := map[string]int{}
+	for _, l := range lines {
+		p := Pattern(l)
+		i, ok := index[p]
+		if !ok {
+			i = len(groups)
+			index[p] = i
+			groups = append(groups, Group{Pattern: p, Example: l})
+		}
+		groups[i].Count++
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Count > groups[j].Count })
+	return groups
+}
+
+// Dedup collapses runs of consecutive lines sharing a pattern, like uniq -c does for identical lines,
+// keeping the order of the lines. Each run is returned as group of its first line.
+func Dedup(lines []string) []Group {
+	var groups []Group
+	for _, l := range lines {
+		p := Pattern(l)
+		if n := len(groups); n > 0 && groups[n-1].Pattern == p {
+			groups[n-1].Count++
+			continue
+		}
+		groups = append(groups, Group{Pattern: p, Example: l, Count: 1})
+	}
+	return groups
+}
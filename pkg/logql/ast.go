@@ -0,0 +1,199 @@
+package logql
+
+import (
+	"strings"
+)
+
+// Node is a node of the syntax tree of a LogQL expression.
+type Node interface {
+	// String returns the node in canonical notation, on a single line.
+	String() string
+	children() []Node
+}
+
+// Matcher is a label matcher of a stream selector, e.g. app="api".
+type Matcher struct {
+	Name, Op, Value string
+}
+
+func (m Matcher) String() string {
+	return m.Name + m.Op + m.Value
+}
+
+// Selector is a stream selector, e.g. {app="api", env!="dev"}.
+type Selector struct {
+	Matchers []Matcher
+}
+
+func (s *Selector) String() string {
+	ms := make([]string, 0, len(s.Matchers))
+	for _, m := range s.Matchers {
+		ms = append(ms, m.String())
+	}
+	return "{" + strings.Join(ms, ", ") + "}"
+}
+
+func (s *Selector) children() []Node { return nil }
+
+// Kinds of pipeline stages.
+const (
+	LineFilter  = "line filter"
+	Parser      = "parser"
+	LabelFilter = "label filter"
+	Formatter   = "formatter"
+	LabelsStage = "labels"
+	Unwrap      = "unwrap"
+	OtherStage  = "stage"
+)
+
+// Stage is a stage of a log pipeline, e.g. |= "error", | json or | status >= 500.
+type Stage struct {
+	Kind string
+	Text string
+}
+
+// Pipeline is a log query: a stream selector followed by pipeline stages.
+type Pipeline struct {
+	Selector *Selector
+	Stages   []Stage
+}
+
+func (p *Pipeline) String() string {
+	parts := []string{p.Selector.String()}
+	for _, s := range p.Stages {
+		parts = append(parts, s.Text)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (p *Pipeline) children() []Node { return nil }
+
+// LogRange is a log query over a time range, the argument of range aggregations, e.g. {app="api"} |= "error" [5m].
+type LogRange struct {
+	Pipeline *Pipeline
+	Range    string
+	Offset   string
+}
+
+func (r *LogRange) String() string {
+	s := r.Pipeline.String() + " [" + r.Range + "]"
+	if r.Offset != "" {
+		s += " offset " + r.Offset
+	}
+	return s
+}
+
+func (r *LogRange) children() []Node { return []Node{r.Pipeline} }
+
+// Grouping is the by or without clause of an aggregation.
+type Grouping struct {
+	Without bool
+	Labels  []string
+}
+
+func (g *Grouping) String() string {
+	if g == nil {
+		return ""
+	}
+	kw := "by"
+	if g.Without {
+		kw = "without"
+	}
+	return kw + " (" + strings.Join(g.Labels, ", ") + ")"
+}
+
+// RangeAggregation aggregates the log lines of a range into samples, e.g. rate({app="api"}[5m]).
+type RangeAggregation struct {
+	Func string
+	// Param is the parameter of quantile_over_time, nil otherwise.
+	Param    Node
+	Range    *LogRange
+	Grouping *Grouping
+}
+
+func (a *RangeAggregation) String() string {
+	args := a.Range.String()
+	if a.Param != nil {
+		args = a.Param.String() + ", " + args
+	}
+	s := a.Func + "(" + args + ")"
+	if a.Grouping != nil {
+		s += " " + a.Grouping.String()
+	}
+	return s
+}
+
+func (a *RangeAggregation) children() []Node { return []Node{a.Range} }
+
+// VectorAggregation aggregates samples, e.g. sum by (app) (...).
+type VectorAggregation struct {
+	Op string
+	// Param is the parameter of topk and bottomk, nil otherwise.
+	Param    Node
+	Inner    Node
+	Grouping *Grouping
+}
+
+func (a *VectorAggregation) String() string {
+	s := a.Op
+	if a.Grouping != nil {
+		s += " " + a.Grouping.String() + " "
+	}
+	args := a.Inner.String()
+	if a.Param != nil {
+		args = a.Param.String() + ", " + args
+	}
+	return s + "(" + args + ")"
+}
+
+func (a *VectorAggregation) children() []Node { return []Node{a.Inner} }
+
+// Call is a call of any other function, e.g. label_replace or vector.
+type Call struct {
+	Func string
+	Args []Node
+}
+
+func (c *Call) String() string {
+	args := make([]string, 0, len(c.Args))
+	for _, a := range c.Args {
+		args = append(args, a.String())
+	}
+	return c.Func + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (c *Call) children() []Node { return c.Args }
+
+// Binary is a binary operation, e.g. a / b or a > bool 1.
+type Binary struct {
+	Op string
+	// Modifiers are bool, on(...), ignoring(...), group_left(...) and group_right(...), as written.
+	Modifiers string
+	LHS, RHS  Node
+}
+
+func (b *Binary) String() string {
+	op := b.Op
+	if b.Modifiers != "" {
+		op += " " + b.Modifiers
+	}
+	return b.LHS.String() + " " + op + " " + b.RHS.String()
+}
+
+func (b *Binary) children() []Node { return []Node{b.LHS, b.RHS} }
+
+// Paren is an expression in parentheses.
+type Paren struct {
+	Inner Node
+}
+
+func (p *Paren) String() string   { return "(" + p.Inner.String() + ")" }
+func (p *Paren) children() []Node { return []Node{p.Inner} }
+
+// Literal is a number or string literal.
+type Literal struct {
+	Value string
+}
+
+func (l *Literal) String() string   { return l.Value }
+func (l *Literal) children() []Node { return nil }
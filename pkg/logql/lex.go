@@ -0,0 +1,95 @@
+package logql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tEOF tokenKind = iota
+	tIdent
+	tString
+	// tNumber are numbers, durations and byte sizes, e.g. 0.5, 5m or 20MB.
+	tNumber
+	tOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// pos and end are the byte offsets of the token in the expression.
+	pos, end int
+}
+
+// ops are the operators and punctuation of LogQL, longest first so that they match greedily.
+var ops = []string{
+	"|=", "|~", "|>", "!=", "!~", "!>", "=~", "==", ">=", "<=",
+	"=", ">", "<", "|", "{", "}", "(", ")", "[", "]", ",", "+", "-", "*", "/", "%", "^",
+}
+
+// lex splits an expression into tokens, returning a syntax error for unknown characters and unterminated strings.
+func lex(expr string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '#':
+			// Comments run until the end of the line.
+			for i < len(expr) && expr[i] != '\n' {
+				i++
+			}
+		case c == '"' || c == '`':
+			end, err := stringEnd(expr, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: tString, text: expr[i:end], pos: i, end: end})
+			i = end
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(expr) && (expr[i] == '_' || expr[i] == '.' || unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i]))) {
+				i++
+			}
+			toks = append(toks, token{kind: tIdent, text: expr[start:i], pos: start, end: i})
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(expr) && unicode.IsDigit(rune(expr[i+1]))):
+			start := i
+			for i < len(expr) && (expr[i] == '.' || unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i]))) {
+				i++
+			}
+			toks = append(toks, token{kind: tNumber, text: expr[start:i], pos: start, end: i})
+		default:
+			op := ""
+			for _, o := range ops {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &Error{Expr: expr, Start: i, End: i + 1, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+			toks = append(toks, token{kind: tOp, text: op, pos: i, end: i + len(op)})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tEOF, pos: len(expr), end: len(expr)}), nil
+}
+
+// stringEnd returns the offset after the string literal starting at start.
+func stringEnd(expr string, start int) (int, error) {
+	quote := expr[start]
+	for i := start + 1; i < len(expr); i++ {
+		switch {
+		case expr[i] == '\\' && quote == '"':
+			i++
+		case expr[i] == quote:
+			return i + 1, nil
+		}
+	}
+	return 0, &Error{Expr: expr, Start: start, End: len(expr), Msg: "unterminated string"}
+}
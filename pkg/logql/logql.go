@@ -0,0 +1,175 @@
+// Package logql checks, formats and explains LogQL expressions offline.
+package logql
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/observatorium/obsctl/pkg/promql"
+)
+
+// Error is a syntax error in an expression, with the same position reporting as PromQL errors.
+type Error = promql.Error
+
+// maxWidth is the line length above which Format splits expressions, like the PromQL and Loki formatters.
+const maxWidth = 100
+
+// Type returns the result type of an expression: streams for log queries, vector for metric queries
+// and scalar for expressions of numbers only.
+func Type(n Node) string {
+	switch n := n.(type) {
+	case *Pipeline:
+		return "streams"
+	case *Literal:
+		return "scalar"
+	case *Paren:
+		return Type(n.Inner)
+	case *Binary:
+		if Type(n.LHS) == "scalar" && Type(n.RHS) == "scalar" {
+			return "scalar"
+		}
+		return "vector"
+	default:
+		return "vector"
+	}
+}
+
+// Format returns the expression pretty-printed, split over multiple lines if it is long.
+func Format(expr string) (string, error) {
+	parsed, err := Parse(expr)
+	if err != nil {
+		return "", err
+	}
+	return format(parsed, 0), nil
+}
+
+func format(n Node, depth int) string {
+	indent := strings.Repeat("  ", depth)
+	if s := n.String(); len(indent)+len(s) <= maxWidth {
+		return indent + s
+	}
+
+	switch n := n.(type) {
+	case *Pipeline:
+		lines := []string{indent + n.Selector.String()}
+		for _, s := range n.Stages {
+			lines = append(lines, indent+"  "+s.Text)
+		}
+		return strings.Join(lines, "\n")
+	case *LogRange:
+		s := format(n.Pipeline, depth) + "\n" + indent + "[" + n.Range + "]"
+		if n.Offset != "" {
+			s += " offset " + n.Offset
+		}
+		return s
+	case *RangeAggregation:
+		s := indent + n.Func + "(\n"
+		if n.Param != nil {
+			s += format(n.Param, depth+1) + ",\n"
+		}
+		s += format(n.Range, depth+1) + "\n" + indent + ")"
+		if n.Grouping != nil {
+			s += " " + n.Grouping.String()
+		}
+		return s
+	case *VectorAggregation:
+		s := indent + n.Op
+		if n.Grouping != nil {
+			s += " " + n.Grouping.String() + " "
+		}
+		s += "(\n"
+		if n.Param != nil {
+			s += format(n.Param, depth+1) + ",\n"
+		}
+		return s + format(n.Inner, depth+1) + "\n" + indent + ")"
+	case *Call:
+		args := make([]string, 0, len(n.Args))
+		for _, a := range n.Args {
+			args = append(args, format(a, depth+1))
+		}
+		return indent + n.Func + "(\n" + strings.Join(args, ",\n") + "\n" + indent + ")"
+	case *Binary:
+		op := n.Op
+		if n.Modifiers != "" {
+			op += " " + n.Modifiers
+		}
+		return format(n.LHS, depth) + "\n" + indent + op + "\n" + format(n.RHS, depth)
+	case *Paren:
+		return indent + "(\n" + format(n.Inner, depth+1) + "\n" + indent + ")"
+	default:
+		return indent + n.String()
+	}
+}
+
+// Explain writes the type, syntax tree and selectors of the expression to w, with the stages of the
+// pipeline of every selector.
+func Explain(w io.Writer, expr string) error {
+	parsed, err := Parse(expr)
+	if err != nil {
+		return err
+	}
+
+	typ := Type(parsed)
+	kind := "metric query"
+	switch typ {
+	case "streams":
+		kind = "log query"
+	case "scalar":
+		kind = "scalar"
+	}
+	fmt.Fprintf(w, "Type: %s (%s)\n\nTree:\n", kind, typ)
+	writeTree(w, parsed, 1)
+
+	fmt.Fprintln(w, "\nSelectors:")
+	inspect(parsed, func(n Node) {
+		var (
+			pl  *Pipeline
+			rng *LogRange
+		)
+		switch n := n.(type) {
+		case *LogRange:
+			pl, rng = n.Pipeline, n
+		case *Pipeline:
+			pl = n
+		default:
+			return
+		}
+
+		fmt.Fprintf(w, "  %s\n", pl.Selector)
+		for _, m := range pl.Selector.Matchers {
+			fmt.Fprintf(w, "    matcher:      %s\n", m)
+		}
+		for _, s := range pl.Stages {
+			fmt.Fprintf(w, "    %-13s %s\n", s.Kind+":", s.Text)
+		}
+		if rng != nil {
+			fmt.Fprintf(w, "    range:        %s\n", rng.Range)
+			if rng.Offset != "" {
+				fmt.Fprintf(w, "    offset:       %s\n", rng.Offset)
+			}
+		}
+	})
+	return nil
+}
+
+// inspect calls fn for n and all its descendants, except for the pipelines of log ranges, which are
+// described with their range.
+func inspect(n Node, fn func(Node)) {
+	fn(n)
+	if _, ok := n.(*LogRange); ok {
+		return
+	}
+	for _, c := range n.children() {
+		inspect(c, fn)
+	}
+}
+
+func writeTree(w io.Writer, n Node, depth int) {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", n), "*logql.")
+	fmt.Fprintf(w, "%s%s: %s\n", strings.Repeat("  ", depth), name, n)
+
+	for _, c := range n.children() {
+		writeTree(w, c, depth+1)
+	}
+}
@@ -0,0 +1,644 @@
+package logql
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	vectorAggregations = map[string]bool{
+		"sum": true, "avg": true, "min": true, "max": true, "stddev": true, "stdvar": true, "count": true,
+		"topk": true, "bottomk": true, "sort": true, "sort_desc": true, "approx_topk": true,
+	}
+	rangeAggregations = map[string]bool{
+		"count_over_time": true, "rate": true, "rate_counter": true, "bytes_over_time": true, "bytes_rate": true,
+		"avg_over_time": true, "sum_over_time": true, "min_over_time": true, "max_over_time": true,
+		"stdvar_over_time": true, "stddev_over_time": true, "quantile_over_time": true,
+		"first_over_time": true, "last_over_time": true, "absent_over_time": true,
+	}
+	lineFilterOps = map[string]bool{"|=": true, "!=": true, "|~": true, "!~": true, "|>": true, "!>": true}
+	// binaryPrecedence is the precedence of binary operators, higher binds tighter.
+	binaryPrecedence = map[string]int{
+		"or": 1, "and": 2, "unless": 2,
+		"==": 3, "!=": 3, ">": 3, ">=": 3, "<": 3, "<=": 3,
+		"+": 4, "-": 4, "*": 5, "/": 5, "%": 5, "^": 6,
+	}
+	stageKinds = map[string]string{
+		"json": Parser, "logfmt": Parser, "regexp": Parser, "pattern": Parser, "unpack": Parser,
+		"line_format": Formatter, "label_format": Formatter,
+		"drop": LabelsStage, "keep": LabelsStage, "distinct": LabelsStage,
+		"unwrap": Unwrap, "decolorize": OtherStage,
+	}
+)
+
+type parser struct {
+	expr string
+	toks []token
+	i    int
+}
+
+// Parse parses a LogQL expression. Syntax errors are returned as *Error.
+func Parse(expr string) (Node, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{expr: expr, toks: toks}
+	n, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tEOF {
+		return nil, p.errorf(t, "unexpected %s", describe(t))
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tOp || t.kind == tIdent) && t.text == text
+}
+
+func (p *parser) expect(text string) (token, error) {
+	t := p.next()
+	if (t.kind != tOp && t.kind != tIdent) || t.text != text {
+		return t, p.errorf(t, "unexpected %s, expected %q", describe(t), text)
+	}
+	return t, nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	end := t.end
+	if end == t.pos {
+		end = t.pos + 1
+	}
+	return &Error{Expr: p.expr, Start: t.pos, End: end, Msg: fmt.Sprintf(format, args...)}
+}
+
+func describe(t token) string {
+	if t.kind == tEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// parseExpr parses binary operations with operators binding tighter than minPrec.
+func (p *parser) parseExpr(minPrec int) (Node, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		prec, ok := binaryPrecedence[t.text]
+		if !ok || (t.kind != tOp && t.kind != tIdent) || prec <= minPrec {
+			return lhs, nil
+		}
+		p.next()
+
+		modifiers, err := p.parseBinaryModifiers()
+		if err != nil {
+			return nil, err
+		}
+
+		// ^ is right-associative, all other operators are left-associative.
+		next := prec
+		if t.text == "^" {
+			next = prec - 1
+		}
+		rhs, err := p.parseExpr(next)
+		if err != nil {
+			return nil, err
+		}
+		lhs = &Binary{Op: t.text, Modifiers: modifiers, LHS: lhs, RHS: rhs}
+	}
+}
+
+// parseBinaryModifiers parses the bool, on, ignoring, group_left and group_right modifiers of binary operators.
+func (p *parser) parseBinaryModifiers() (string, error) {
+	var mods []string
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tIdent && t.text == "bool":
+			p.next()
+			mods = append(mods, "bool")
+		case t.kind == tIdent && (t.text == "on" || t.text == "ignoring" || t.text == "group_left" || t.text == "group_right"):
+			p.next()
+			mod := t.text
+			if p.is("(") {
+				labels, err := p.parseLabelList()
+				if err != nil {
+					return "", err
+				}
+				mod += " (" + strings.Join(labels, ", ") + ")"
+			}
+			mods = append(mods, mod)
+		default:
+			return strings.Join(mods, " "), nil
+		}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.is("-") || p.is("+") {
+		sign := p.next()
+		if t := p.peek(); t.kind == tNumber {
+			p.next()
+			return &Literal{Value: sign.text + t.text}, nil
+		}
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Binary{Op: "*", LHS: &Literal{Value: sign.text + "1"}, RHS: inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tNumber || t.kind == tString:
+		p.next()
+		return &Literal{Value: t.text}, nil
+	case t.kind == tOp && t.text == "{":
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		if p.is("[") {
+			return nil, p.errorf(p.peek(), "log range outside of a range aggregation, e.g. count_over_time(%s [5m])", pipeline)
+		}
+		return pipeline, nil
+	case t.kind == tOp && t.text == "(":
+		p.next()
+		inner, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &Paren{Inner: inner}, nil
+	case t.kind == tIdent && vectorAggregations[t.text]:
+		return p.parseVectorAggregation()
+	case t.kind == tIdent && rangeAggregations[t.text]:
+		return p.parseRangeAggregation()
+	case t.kind == tIdent && p.toks[p.i+1].text == "(":
+		return p.parseCall()
+	default:
+		return nil, p.errorf(t, "unexpected %s, expected a stream selector, aggregation or number", describe(t))
+	}
+}
+
+func (p *parser) parseLabelList() ([]string, error) {
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var labels []string
+	for !p.is(")") {
+		t := p.next()
+		if t.kind != tIdent {
+			return nil, p.errorf(t, "unexpected %s, expected a label name", describe(t))
+		}
+		labels = append(labels, t.text)
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+func (p *parser) parseGrouping() (*Grouping, error) {
+	if !p.is("by") && !p.is("without") {
+		return nil, nil
+	}
+	g := &Grouping{Without: p.next().text == "without"}
+	var err error
+	g.Labels, err = p.parseLabelList()
+	return g, err
+}
+
+func (p *parser) parseVectorAggregation() (Node, error) {
+	a := &VectorAggregation{Op: p.next().text}
+
+	var err error
+	if a.Grouping, err = p.parseGrouping(); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if a.Inner, err = p.parseExpr(0); err != nil {
+		return nil, err
+	}
+	if p.is(",") {
+		p.next()
+		a.Param = a.Inner
+		if a.Inner, err = p.parseExpr(0); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if a.Grouping == nil {
+		if a.Grouping, err = p.parseGrouping(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func (p *parser) parseRangeAggregation() (Node, error) {
+	a := &RangeAggregation{Func: p.next().text}
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tNumber {
+		p.next()
+		a.Param = &Literal{Value: t.text}
+		if _, err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		pipeline *Pipeline
+		err      error
+	)
+	// The log query may be in parentheses, e.g. count_over_time(({app="api"} |= "error")[5m]).
+	if p.is("(") {
+		p.next()
+		if pipeline, err = p.parsePipeline(); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	} else if pipeline, err = p.parsePipeline(); err != nil {
+		return nil, err
+	}
+
+	a.Range = &LogRange{Pipeline: pipeline}
+	if t := p.next(); t.text != "[" {
+		return nil, p.errorf(t, "unexpected %s, %s() needs a log range, add a time window to the log query, e.g. %s(%s [5m])", describe(t), a.Func, a.Func, pipeline)
+	}
+	t := p.next()
+	if t.kind != tNumber {
+		return nil, p.errorf(t, "unexpected %s, expected a duration", describe(t))
+	}
+	a.Range.Range = t.text
+	if _, err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	if p.is("offset") {
+		p.next()
+		t := p.next()
+		if t.kind != tNumber {
+			return nil, p.errorf(t, "unexpected %s, expected a duration", describe(t))
+		}
+		a.Range.Offset = t.text
+	}
+
+	if _, err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if a.Grouping, err = p.parseGrouping(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (p *parser) parseCall() (Node, error) {
+	c := &Call{Func: p.next().text}
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.is(")") {
+		arg, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		c.Args = append(c.Args, arg)
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *parser) parseSelector() (*Selector, error) {
+	if _, err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	s := &Selector{}
+	for !p.is("}") {
+		name := p.next()
+		if name.kind != tIdent {
+			return nil, p.errorf(name, "unexpected %s in stream selector, expected a label name", describe(name))
+		}
+		op := p.next()
+		if op.kind != tOp || (op.text != "=" && op.text != "!=" && op.text != "=~" && op.text != "!~") {
+			return nil, p.errorf(op, "unexpected %s in stream selector, expected one of =, !=, =~, !~", describe(op))
+		}
+		value := p.next()
+		if value.kind != tString {
+			return nil, p.errorf(value, "unexpected %s in stream selector, label values have to be quoted, e.g. %s%s%q", describe(value), name.text, op.text, value.text)
+		}
+		s.Matchers = append(s.Matchers, Matcher{Name: name.text, Op: op.text, Value: value.text})
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	if len(s.Matchers) == 0 {
+		return nil, p.errorf(p.toks[p.i-1], "stream selectors need at least one matcher")
+	}
+	return s, nil
+}
+
+func (p *parser) parsePipeline() (*Pipeline, error) {
+	sel, err := p.parseSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	pl := &Pipeline{Selector: sel}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tOp && lineFilterOps[t.text]:
+			stage, err := p.parseLineFilter()
+			if err != nil {
+				return nil, err
+			}
+			pl.Stages = append(pl.Stages, stage)
+		case t.kind == tOp && t.text == "|":
+			p.next()
+			stage, err := p.parseStage()
+			if err != nil {
+				return nil, err
+			}
+			pl.Stages = append(pl.Stages, stage)
+		default:
+			return pl, nil
+		}
+	}
+}
+
+func (p *parser) parseLineFilter() (Stage, error) {
+	op := p.next()
+	var values []string
+	for {
+		t := p.next()
+		switch {
+		case t.kind == tString:
+			values = append(values, t.text)
+		case t.kind == tIdent && t.text == "ip" && p.is("("):
+			p.next()
+			arg := p.next()
+			if arg.kind != tString {
+				return Stage{}, p.errorf(arg, "unexpected %s, expected a quoted IP or range", describe(arg))
+			}
+			if _, err := p.expect(")"); err != nil {
+				return Stage{}, err
+			}
+			values = append(values, "ip("+arg.text+")")
+		default:
+			return Stage{}, p.errorf(t, "unexpected %s, line filters need a quoted string, e.g. %s \"error\"", describe(t), op.text)
+		}
+		if !p.is("or") {
+			break
+		}
+		p.next()
+	}
+	return Stage{Kind: LineFilter, Text: op.text + " " + strings.Join(values, " or ")}, nil
+}
+
+// parseStage parses the stage after a |, consuming tokens until the next stage or the end of the pipeline.
+func (p *parser) parseStage() (Stage, error) {
+	start := p.peek()
+	if start.kind == tEOF {
+		return Stage{}, p.errorf(start, "unexpected end of input, expected a pipeline stage after |")
+	}
+
+	kind, ok := stageKinds[start.text]
+	if !ok || start.kind != tIdent {
+		kind = LabelFilter
+	}
+
+	var toks []token
+	depth := 0
+loop:
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tEOF:
+			break loop
+		case t.kind == tOp && (t.text == "(" || t.text == "["):
+			if t.text == "[" && depth == 0 {
+				break loop
+			}
+			depth++
+		case t.kind == tOp && (t.text == ")" || t.text == "]"):
+			if depth == 0 {
+				break loop
+			}
+			depth--
+		case t.kind == tOp && depth == 0 && (t.text == "|" || lineFilterOps[t.text]) && !matcherOp(kind, toks, t):
+			break loop
+		}
+		toks = append(toks, p.next())
+	}
+
+	if kind == LabelFilter {
+		if len(toks) == 1 {
+			return Stage{}, p.errorf(start, "unknown pipeline stage %s", describe(start))
+		}
+	} else if err := p.checkStage(toks[0], toks[1:]); err != nil {
+		return Stage{}, err
+	}
+	return Stage{Kind: kind, Text: "| " + join(toks)}, nil
+}
+
+// matcherOp reports whether t, the next token of a stage of the given kind after toks, is the operator
+// of a label matcher, e.g. in | level != "debug" or | drop level!~"debug|info", rather than the start
+// of a line filter.
+func matcherOp(kind string, toks []token, t token) bool {
+	if t.text != "!=" && t.text != "!~" {
+		return false
+	}
+	switch kind {
+	case LabelFilter:
+		return t.text == "!=" || (len(toks) > 0 && toks[len(toks)-1].kind == tIdent)
+	case LabelsStage:
+		// The stage name itself is no label.
+		return len(toks) > 1 && toks[len(toks)-1].kind == tIdent
+	}
+	return false
+}
+
+// labelMatchOps are the operators of label matchers in keep and drop stages.
+var labelMatchOps = map[string]bool{"=": true, "!=": true, "=~": true, "!~": true}
+
+// checkStage checks the arguments of the stage with the given name.
+func (p *parser) checkStage(name token, args []token) error {
+	switch name.text {
+	case "unpack", "decolorize":
+		if len(args) > 0 {
+			return p.errorf(args[0], "unexpected %s, %s takes no arguments", describe(args[0]), name.text)
+		}
+		return nil
+	case "regexp", "pattern", "line_format":
+		if len(args) == 0 || args[0].kind != tString {
+			return p.errorf(p.argAt(args, 0), "unexpected %s, %s needs a quoted expression", describe(p.argAt(args, 0)), name.text)
+		}
+		if len(args) > 1 {
+			return p.errorf(args[1], "unexpected %s, %s takes a single expression", describe(args[1]), name.text)
+		}
+		return nil
+	case "json":
+		return p.checkLabelParams(name, args, false, map[string]bool{"=": true}, false)
+	case "logfmt":
+		// Flags like --strict and --keep-empty come first, lexed as adjacent tokens.
+		for len(args) >= 3 && args[0].text == "-" && args[1].text == "-" && args[2].kind == tIdent {
+			i := 3
+			for i < len(args) && args[i].pos == args[i-1].end {
+				i++
+			}
+			args = args[i:]
+		}
+		return p.checkLabelParams(name, args, false, map[string]bool{"=": true}, false)
+	case "label_format":
+		return p.checkLabelParams(name, args, true, map[string]bool{"=": true}, true)
+	case "keep", "drop":
+		return p.checkLabelParams(name, args, true, labelMatchOps, false)
+	case "distinct":
+		return p.checkLabelParams(name, args, true, nil, false)
+	case "unwrap":
+		return p.checkUnwrap(args)
+	}
+	return nil
+}
+
+// checkLabelParams checks comma separated parameters of stages, which are label names, each
+// optionally followed by one of ops and a quoted value. With valueRequired, every label needs a
+// value, which may also be the name of another label, e.g. with label_format dst=src.
+func (p *parser) checkLabelParams(name token, args []token, required bool, ops map[string]bool, valueRequired bool) error {
+	if len(args) == 0 {
+		if required {
+			return p.errorf(p.argAt(args, 0), "unexpected %s, %s needs at least one label", describe(p.argAt(args, 0)), name.text)
+		}
+		return nil
+	}
+
+	for i := 0; ; {
+		if t := p.argAt(args, i); t.kind != tIdent {
+			return p.errorf(t, "unexpected %s, expected a label name", describe(t))
+		}
+		i++
+
+		op := p.argAt(args, i)
+		switch {
+		case op.kind == tOp && ops[op.text]:
+			i++
+			v := p.argAt(args, i)
+			if v.kind != tString && !(valueRequired && v.kind == tIdent) {
+				return p.errorf(v, "unexpected %s, expected a quoted value after %s", describe(v), op.text)
+			}
+			i++
+		case valueRequired:
+			return p.errorf(op, "unexpected %s, expected = after the label name", describe(op))
+		}
+
+		if i == len(args) {
+			return nil
+		}
+		if t := args[i]; t.text != "," {
+			return p.errorf(t, "unexpected %s, expected , between labels", describe(t))
+		}
+		i++
+	}
+}
+
+// checkUnwrap checks the argument of unwrap stages, a label optionally converted by a function,
+// e.g. duration(latency).
+func (p *parser) checkUnwrap(args []token) error {
+	t := p.argAt(args, 0)
+	if t.kind != tIdent {
+		return p.errorf(t, "unexpected %s, unwrap needs a label name", describe(t))
+	}
+	rest := args[1:]
+	if len(rest) > 0 && rest[0].text == "(" {
+		if arg := p.argAt(rest, 1); arg.kind != tIdent {
+			return p.errorf(arg, "unexpected %s, expected a label name", describe(arg))
+		}
+		if end := p.argAt(rest, 2); len(rest) < 3 || end.text != ")" {
+			return p.errorf(end, "unexpected %s, expected \")\"", describe(end))
+		}
+		rest = rest[3:]
+	}
+	if len(rest) > 0 {
+		return p.errorf(rest[0], "unexpected %s, unwrap takes a single label", describe(rest[0]))
+	}
+	return nil
+}
+
+// argAt returns the i-th argument of a stage, or the token following the stage if there are fewer
+// arguments, so that errors about missing arguments point at it.
+func (p *parser) argAt(args []token, i int) token {
+	if i < len(args) {
+		return args[i]
+	}
+	return p.peek()
+}
+
+// join joins tokens in canonical notation, with spaces around operators but not inside of parentheses.
+func join(toks []token) string {
+	var sb strings.Builder
+	for i, t := range toks {
+		if i > 0 {
+			prev := toks[i-1]
+			adjacent := prev.end == t.pos
+			switch {
+			case prev.text == "(" || t.text == ")" || t.text == ",":
+			case adjacent && (prev.text == "-" || t.text == "-"):
+				// Flags like --strict.
+			case t.text == "(" && prev.kind == tIdent:
+				// Calls like duration(latency).
+			default:
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(t.text)
+	}
+	return sb.String()
+}
@@ -0,0 +1,99 @@
+package logql
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		expr, want string
+	}{
+		{`{app="api"}`, `{app="api"}`},
+		{`{app="api",env!="dev"} |= "error" != "timeout"`, `{app="api", env!="dev"} |= "error" != "timeout"`},
+		{`{app="api"} |= "a" or "b" |= ip("10.0.0.0/8")`, `{app="api"} |= "a" or "b" |= ip("10.0.0.0/8")`},
+		{`{app="api"} | json`, `{app="api"} | json`},
+		{`{app="api"} | json first="a.b", second`, `{app="api"} | json first = "a.b", second`},
+		{`{app="api"} | logfmt --strict --keep-empty level`, `{app="api"} | logfmt --strict --keep-empty level`},
+		{`{app="api"} | pattern "<ip> - <_>"`, `{app="api"} | pattern "<ip> - <_>"`},
+		{`{app="api"} | regexp "(?P<x>.*)"`, `{app="api"} | regexp "(?P<x>.*)"`},
+		{`{app="api"} | line_format "{{.msg}}"`, `{app="api"} | line_format "{{.msg}}"`},
+		{`{app="api"} | label_format dst=src, b="{{.a}}"`, `{app="api"} | label_format dst = src, b = "{{.a}}"`},
+		{`{app="api"} | keep level,app`, `{app="api"} | keep level, app`},
+		{`{app="api"} | drop level!="debug", app`, `{app="api"} | drop level != "debug", app`},
+		{`{app="api"} | drop level!~"debug|info"`, `{app="api"} | drop level !~ "debug|info"`},
+		{`{app="api"} | distinct a,b`, `{app="api"} | distinct a, b`},
+		{`{app="api"} | level != "debug"`, `{app="api"} | level != "debug"`},
+		{`{app="api"} | level !~ "debug"`, `{app="api"} | level !~ "debug"`},
+		{`{app="api"} | json != "x"`, `{app="api"} | json != "x"`},
+		{`{app="api"} | status>=500 and method="GET"`, `{app="api"} | status >= 500 and method = "GET"`},
+		{`{app="api"} | unpack | decolorize`, `{app="api"} | unpack | decolorize`},
+		{`sum by (app) (rate({app="api"} |= "error" [5m]))`, `sum by (app) (rate({app="api"} |= "error" [5m]))`},
+		{`sum(rate({app="api"}[1m])) / 2`, `sum(rate({app="api"} [1m])) / 2`},
+		{
+			`quantile_over_time(0.99, {app="api"} | json | unwrap duration(latency) [5m]) by (app)`,
+			`quantile_over_time(0.99, {app="api"} | json | unwrap duration(latency) [5m]) by (app)`,
+		},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			got, err := Format(tc.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %s, want %s", got, tc.want)
+			}
+
+			// Formatting is idempotent.
+			again, err := Format(got)
+			if err != nil {
+				t.Fatalf("unexpected error formatting %s: %v", got, err)
+			}
+			if again != got {
+				t.Fatalf("formatting again got %s, want %s", again, got)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr, msg string
+	}{
+		{`{}`, "stream selectors need at least one matcher"},
+		{`{app="api"} |`, "expected a pipeline stage after |"},
+		{`{app="api"} | foo`, `unknown pipeline stage "foo"`},
+		{`{app="api"} |= error`, "line filters need a quoted string"},
+		{`{app="api"} | json a=`, "expected a quoted value after ="},
+		{`{app="api"} | json "a"`, "expected a label name"},
+		{`{app="api"} | logfmt a=b`, "expected a quoted value after ="},
+		{`{app="api"} | pattern`, "pattern needs a quoted expression"},
+		{`{app="api"} | regexp "a" "b"`, "regexp takes a single expression"},
+		{`{app="api"} | line_format`, "line_format needs a quoted expression"},
+		{`{app="api"} | label_format a=`, "expected a quoted value after ="},
+		{`{app="api"} | label_format a`, "expected = after the label name"},
+		{`{app="api"} | label_format`, "label_format needs at least one label"},
+		{`{app="api"} | keep`, "keep needs at least one label"},
+		{`{app="api"} | keep a b`, "expected , between labels"},
+		{`{app="api"} | drop a,`, "expected a label name"},
+		{`{app="api"} | distinct`, "distinct needs at least one label"},
+		{`{app="api"} | unpack a`, "unpack takes no arguments"},
+		{`sum(rate({app="api"} | unwrap [5m]))`, "unwrap needs a label name"},
+		{`sum(rate({app="api"} | unwrap a b [5m]))`, "unwrap takes a single label"},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := Parse(tc.expr)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			var perr *Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected a syntax error, got %T: %v", err, err)
+			}
+			if !strings.Contains(perr.Msg, tc.msg) {
+				t.Fatalf("got error %q, want it to contain %q", perr.Msg, tc.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+// Package otlp reads and generates OTLP metrics in the JSON encoding of the OTLP/HTTP protocol.
+package otlp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the content type of OTLP/HTTP requests in the JSON encoding.
+const ContentType = "application/json"
+
+// Summary describes the contents of an OTLP metrics request.
+type Summary struct {
+	Resources  int
+	Metrics    int
+	DataPoints int
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d data points of %d metrics from %d resources", s.DataPoints, s.Metrics, s.Resources)
+}
+
+type dataPoints struct {
+	DataPoints []json.RawMessage `json:"dataPoints"`
+}
+
+// Summarize checks that b is an OTLP metrics request with at least one data point and describes it.
+func Summarize(b []byte) (Summary, error) {
+	var req struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name                 string      `json:"name"`
+					Gauge                *dataPoints `json:"gauge"`
+					Sum                  *dataPoints `json:"sum"`
+					Histogram            *dataPoints `json:"histogram"`
+					ExponentialHistogram *dataPoints `json:"exponentialHistogram"`
+					Summary              *dataPoints `json:"summary"`
+				} `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal(b, &req); err != nil {
+		return Summary{}, fmt.Errorf("decoding OTLP metrics: %w", err)
+	}
+
+	s := Summary{Resources: len(req.ResourceMetrics)}
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name == "" {
+					return Summary{}, errors.New("invalid OTLP metrics: metric without name")
+				}
+
+				var points *dataPoints
+				for _, p := range []*dataPoints{m.Gauge, m.Sum, m.Histogram, m.ExponentialHistogram, m.Summary} {
+					if p != nil {
+						points = p
+					}
+				}
+				if points == nil {
+					return Summary{}, fmt.Errorf("invalid OTLP metrics: metric %s has no data", m.Name)
+				}
+
+				s.Metrics++
+				s.DataPoints += len(points.DataPoints)
+			}
+		}
+	}
+
+	if s.DataPoints == 0 {
+		return Summary{}, errors.New("invalid OTLP metrics: no data points, expected an object with resourceMetrics")
+	}
+	return s, nil
+}
+
+// PartialSuccess is returned by receivers that accepted only some of the data points of a request.
+type PartialSuccess struct {
+	RejectedDataPoints int64
+	ErrorMessage       string
+}
+
+// ParseResponse returns the partial success of an OTLP metrics response, if any. Empty bodies
+// and bodies of other formats are treated as full success.
+func ParseResponse(b []byte) *PartialSuccess {
+	var resp struct {
+		PartialSuccess *struct {
+			// An int64, encoded as string by the protocol and as number by some receivers.
+			RejectedDataPoints json.RawMessage `json:"rejectedDataPoints"`
+			ErrorMessage       string          `json:"errorMessage"`
+		} `json:"partialSuccess"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil || resp.PartialSuccess == nil {
+		return nil
+	}
+
+	ps := &PartialSuccess{ErrorMessage: resp.PartialSuccess.ErrorMessage}
+	if raw := strings.Trim(string(resp.PartialSuccess.RejectedDataPoints), `"`); raw != "" {
+		ps.RejectedDataPoints, _ = strconv.ParseInt(raw, 10, 64)
+	}
+	if ps.RejectedDataPoints == 0 && ps.ErrorMessage == "" {
+		return nil
+	}
+	return ps
+}
+
+// Names of the synthetic metrics and their attributes.
+const (
+	SyntheticGauge   = "obsctl_synthetic"
+	SyntheticCounter = "obsctl_synthetic_pushes"
+	// RunAttribute identifies the data points of one invocation, to query them back.
+	RunAttribute    = "obsctl_run"
+	SeriesAttribute = "series"
+)
+
+type attribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func newAttribute(key, value string) attribute {
+	a := attribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+type numberDataPoint struct {
+	Attributes        []attribute `json:"attributes"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string      `json:"timeUnixNano"`
+	AsDouble          float64     `json:"asDouble"`
+}
+
+type metric struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Unit        string      `json:"unit"`
+	Gauge       interface{} `json:"gauge,omitempty"`
+	Sum         interface{} `json:"sum,omitempty"`
+}
+
+// aggregationTemporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE of the OTLP protocol.
+const aggregationTemporalityCumulative = 2
+
+// Synthetic returns an OTLP metrics request with a gauge and a counter of the given number of
+// series, all labelled with the run, at time now.
+func Synthetic(run string, series int, now time.Time) ([]byte, error) {
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+
+	var gauge, counter []numberDataPoint
+	for i := 0; i < series; i++ {
+		attrs := []attribute{newAttribute(RunAttribute, run), newAttribute(SeriesAttribute, strconv.Itoa(i))}
+		gauge = append(gauge, numberDataPoint{Attributes: attrs, TimeUnixNano: ts, AsDouble: float64(i)})
+		counter = append(counter, numberDataPoint{Attributes: attrs, StartTimeUnixNano: ts, TimeUnixNano: ts, AsDouble: 1})
+	}
+
+	req := map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []attribute{newAttribute("service.name", "obsctl")},
+			},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "obsctl"},
+				"metrics": []metric{
+					{
+						Name:        SyntheticGauge,
+						Description: "Synthetic gauge pushed by obsctl to test ingestion, with the number of the series as value.",
+						Unit:        "1",
+						Gauge:       map[string]interface{}{"dataPoints": gauge},
+					},
+					{
+						Name:        SyntheticCounter,
+						Description: "Synthetic counter pushed by obsctl to test ingestion.",
+						Unit:        "1",
+						Sum: map[string]interface{}{
+							"aggregationTemporality": aggregationTemporalityCumulative,
+							"isMonotonic":            true,
+							"dataPoints":             counter,
+						},
+					},
+				},
+			}},
+		}},
+	}
+	return json.Marshal(req)
+}
@@ -0,0 +1,224 @@
+// Package printer prints the results of read commands as an aligned table for humans, or as JSON
+// or YAML for scripts.
+package printer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats results can be printed in.
+const (
+	Table = "table"
+	JSON  = "json"
+	YAML  = "yaml"
+	// GoTemplate executes the Go template following it, like go-template={{.name}}, with the JSON
+	// encoding of results as data.
+	GoTemplate = "go-template"
+)
+
+// Formats are all formats, the default first.
+var Formats = []string{Table, JSON, YAML, GoTemplate + "=<template>"}
+
+// Printer prints results in one of the formats.
+type Printer struct {
+	format string
+	tmpl   *template.Template
+}
+
+// New returns a printer of the given format.
+func New(format string) (*Printer, error) {
+	if IsGoTemplate(format) {
+		tmpl, err := template.New("output").Parse(strings.TrimPrefix(format, GoTemplate+"="))
+		if err != nil {
+			return nil, fmt.Errorf("parsing go-template: %w", err)
+		}
+		return &Printer{format: GoTemplate, tmpl: tmpl}, nil
+	}
+
+	switch format {
+	case Table, JSON, YAML:
+		return &Printer{format: format}, nil
+	}
+	return nil, fmt.Errorf("unsupported output format %q, must be one of: %s", format, strings.Join(Formats, "|"))
+}
+
+// IsGoTemplate reports whether format is a go-template format.
+func IsGoTemplate(format string) bool {
+	return strings.HasPrefix(format, GoTemplate+"=")
+}
+
+// Format returns the format of the printer.
+func (p *Printer) Format() string {
+	return p.format
+}
+
+// Print prints v to w. JSON, YAML and templates use the JSON encoding of v, so that all have the
+// same fields, e.g. json.RawMessage prints API responses as they are. Tables are built by table
+// from a header and rows, whose columns are aligned. A nil header prints the rows only.
+func (p *Printer) Print(w io.Writer, v interface{}, table func() (header []string, rows [][]string)) error {
+	switch p.format {
+	case JSON:
+		b, err := marshalJSON(v, "")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	case YAML:
+		n, err := yamlNode(v)
+		if err != nil {
+			return err
+		}
+		return encodeYAML(w, n)
+	case GoTemplate:
+		return p.execute(w, v)
+	}
+
+	header, rows := table()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if header != nil {
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// execute executes the template of the printer with the JSON encoding of v as data, so that
+// templates refer to fields by their JSON names, e.g. {{.metric.instance}}.
+func (p *Printer) execute(w io.Writer, v interface{}) error {
+	b, err := marshalJSON(v, "")
+	if err != nil {
+		return err
+	}
+
+	// Numbers are kept as they were encoded, rather than printed as floats like 1e+06.
+	var data interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return fmt.Errorf("decoding JSON: %w", err)
+	}
+	if err := p.tmpl.Execute(w, data); err != nil {
+		return fmt.Errorf("executing go-template: %w", err)
+	}
+	return nil
+}
+
+// List prints the items of a list to w as they are added, so that large lists are not kept in
+// memory. It must be closed to complete the list.
+func (p *Printer) List(w io.Writer) *List {
+	return &List{p: p, w: w}
+}
+
+// List is a list printed item by item, see Printer.List.
+type List struct {
+	p *Printer
+	w io.Writer
+	n int
+}
+
+// Add prints an item of the list. Tables print line, one per item, JSON and YAML print v, and
+// templates are executed for every item.
+func (l *List) Add(v interface{}, line string) error {
+	defer func() { l.n++ }()
+
+	switch l.p.format {
+	case JSON:
+		b, err := marshalJSON(v, "  ")
+		if err != nil {
+			return err
+		}
+		sep := ",\n"
+		if l.n == 0 {
+			sep = "[\n"
+		}
+		_, err = fmt.Fprintf(l.w, "%s  %s", sep, b)
+		return err
+	case YAML:
+		n, err := yamlNode(v)
+		if err != nil {
+			return err
+		}
+		return encodeYAML(l.w, &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{n}})
+	case GoTemplate:
+		return l.p.execute(l.w, v)
+	}
+
+	_, err := fmt.Fprintln(l.w, line)
+	return err
+}
+
+// Len returns the number of items added to the list.
+func (l *List) Len() int {
+	return l.n
+}
+
+// Close completes the list, e.g. closes JSON arrays.
+func (l *List) Close() error {
+	var err error
+	switch {
+	case l.p.format == JSON && l.n == 0:
+		_, err = fmt.Fprintln(l.w, "[]")
+	case l.p.format == JSON:
+		_, err = fmt.Fprintln(l.w, "\n]")
+	case l.p.format == YAML && l.n == 0:
+		_, err = fmt.Fprintln(l.w, "[]")
+	}
+	return err
+}
+
+// marshalJSON returns the indented JSON encoding of v, without escaping HTML characters, which are
+// common in queries and log lines.
+func marshalJSON(v interface{}, prefix string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(prefix, "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("encoding JSON: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// yamlNode returns the YAML node of the JSON encoding of v. Decoding JSON as YAML keeps the order
+// of fields, and clearing the styles of the nodes prints them in block style like YAML files.
+func yamlNode(v interface{}) (*yaml.Node, error) {
+	b, err := marshalJSON(v, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("encoding YAML: %w", err)
+	}
+	n := doc.Content[0]
+	clearStyle(n)
+	return n, nil
+}
+
+func clearStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		clearStyle(c)
+	}
+}
+
+func encodeYAML(w io.Writer, n *yaml.Node) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return fmt.Errorf("encoding YAML: %w", err)
+	}
+	return enc.Close()
+}
@@ -0,0 +1,176 @@
+// Package progress shows spinners and progress bars for long running operations on terminals.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// delay is how long an operation has to run before its indicator is shown, to avoid flickering for fast operations.
+	delay    = 300 * time.Millisecond
+	interval = 100 * time.Millisecond
+	barWidth = 30
+)
+
+var frames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Indicator renders the progress of an operation on a single, continuously redrawn line, or
+// emits it as JSON events. Terminal indicators for files other than terminals do nothing, so
+// that they never end up in logs or pipes.
+type Indicator struct {
+	w       io.Writer
+	enabled bool
+	json    bool
+
+	mtx     sync.Mutex
+	msg     string
+	total   int
+	done    int
+	started time.Time
+	running bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Event is a progress event emitted by JSON indicators, one per line.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Event is one of "start", "progress" or "end".
+	Event     string `json:"event"`
+	Operation string `json:"operation"`
+	Total     int    `json:"total,omitempty"`
+	Done      int    `json:"done"`
+	// Item and Status describe the item completed by a "progress" event.
+	Item     string  `json:"item,omitempty"`
+	Status   string  `json:"status,omitempty"`
+	Duration float64 `json:"durationSeconds,omitempty"`
+}
+
+// New returns an Indicator writing to f, which is only enabled if f is a terminal.
+func New(f *os.File) *Indicator {
+	return &Indicator{w: f, enabled: term.IsTerminal(int(f.Fd()))}
+}
+
+// NewJSON returns an Indicator emitting progress events as JSON lines to w, for tooling wrapping obsctl.
+func NewJSON(w io.Writer) *Indicator {
+	return &Indicator{w: w, enabled: true, json: true}
+}
+
+// Disabled returns an Indicator that never renders anything.
+func Disabled() *Indicator {
+	return &Indicator{}
+}
+
+// Start shows a spinner with msg. If total is greater than zero, a progress bar over total items is shown as well.
+// Any running operation is stopped first.
+func (i *Indicator) Start(msg string, total int) {
+	i.Stop()
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	i.msg, i.total, i.done, i.started, i.running = msg, total, 0, time.Now(), true
+	if !i.enabled {
+		return
+	}
+
+	if i.json {
+		i.emit(Event{Event: "start"})
+		return
+	}
+
+	i.stop, i.stopped = make(chan struct{}), make(chan struct{})
+	go i.render(i.stop, i.stopped)
+}
+
+// Increment marks an item of the operation as done, with a short status like "ok" or "failed".
+func (i *Indicator) Increment(item, status string) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	i.done++
+	if i.enabled && i.json {
+		i.emit(Event{Event: "progress", Item: item, Status: status})
+	}
+}
+
+// Stop stops the running operation and clears its line.
+func (i *Indicator) Stop() {
+	i.mtx.Lock()
+	if i.running && i.enabled && i.json {
+		i.emit(Event{Event: "end", Duration: time.Since(i.started).Seconds()})
+	}
+	i.running = false
+
+	stop, stopped := i.stop, i.stopped
+	i.stop, i.stopped = nil, nil
+	i.mtx.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+}
+
+// emit writes a JSON event for the running operation. It must be called with i.mtx held.
+func (i *Indicator) emit(e Event) {
+	e.Time, e.Operation, e.Total, e.Done = time.Now(), i.msg, i.total, i.done
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(i.w, string(b))
+}
+
+func (i *Indicator) render(stop, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	shown := false
+	for frame := 0; ; frame++ {
+		select {
+		case <-stop:
+			if shown {
+				fmt.Fprint(i.w, "\r\033[K")
+			}
+			return
+		case <-ticker.C:
+		}
+
+		i.mtx.Lock()
+		line := i.line(frames[frame%len(frames)])
+		started := i.started
+		i.mtx.Unlock()
+
+		if time.Since(started) < delay {
+			continue
+		}
+		shown = true
+		fmt.Fprint(i.w, "\r\033[K"+line)
+	}
+}
+
+func (i *Indicator) line(frame string) string {
+	if i.total <= 0 {
+		return fmt.Sprintf("%s %s", frame, i.msg)
+	}
+
+	filled := barWidth * i.done / i.total
+	if filled > barWidth {
+		filled = barWidth
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+	return fmt.Sprintf("%s %s [%s] %d/%d", frame, i.msg, bar, i.done, i.total)
+}
@@ -0,0 +1,193 @@
+// Package promql checks, formats and explains PromQL expressions offline, using the upstream parser.
+package promql
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Error is a syntax error in an expression.
+type Error struct {
+	Expr string
+	// Start and End are the byte offsets of the erroneous part of Expr.
+	Start, End int
+	Msg        string
+	// Hints suggest fixes for common mistakes that may have caused the error.
+	Hints []string
+}
+
+func (e *Error) Error() string {
+	line, col := e.position()
+	return fmt.Sprintf("parse error at line %d, char %d: %s", line, col, e.Msg)
+}
+
+// position returns the 1-based line and column of the start of the error.
+func (e *Error) position() (int, int) {
+	before := e.Expr[:e.Start]
+	line := strings.Count(before, "\n") + 1
+	return line, e.Start - strings.LastIndex(before, "\n")
+}
+
+// Pointed returns the line of the expression the error is in, with the erroneous part marked below it, e.g.
+//
+//	sum(rate(foo[5m])
+//	                 ^
+func (e *Error) Pointed() string {
+	lineStart := strings.LastIndex(e.Expr[:e.Start], "\n") + 1
+	lineEnd := strings.Index(e.Expr[e.Start:], "\n")
+	if lineEnd < 0 {
+		lineEnd = len(e.Expr)
+	} else {
+		lineEnd += e.Start
+	}
+
+	width := 1
+	if e.End > e.Start {
+		width = e.End - e.Start
+	}
+	if e.Start+width > lineEnd {
+		width = lineEnd - e.Start
+		if width < 1 {
+			width = 1
+		}
+	}
+
+	return e.Expr[lineStart:lineEnd] + "\n" + strings.Repeat(" ", e.Start-lineStart) + strings.Repeat("^", width)
+}
+
+// Parse parses an expression. Syntax errors are returned as *Error.
+func Parse(expr string) (parser.Expr, error) {
+	parsed, err := parser.ParseExpr(expr)
+	if err == nil {
+		return parsed, nil
+	}
+
+	var perrs parser.ParseErrors
+	if errors.As(err, &perrs) && len(perrs) > 0 {
+		return nil, newError(expr, perrs[0])
+	}
+	var perr *parser.ParseErr
+	if errors.As(err, &perr) {
+		return nil, newError(expr, *perr)
+	}
+	return nil, err
+}
+
+func newError(expr string, perr parser.ParseErr) *Error {
+	clamp := func(p parser.Pos) int {
+		if int(p) > len(expr) {
+			return len(expr)
+		}
+		if p < 0 {
+			return 0
+		}
+		return int(p)
+	}
+	e := &Error{Expr: expr, Start: clamp(perr.PositionRange.Start), End: clamp(perr.PositionRange.End), Msg: perr.Err.Error()}
+	e.Hints = hints(e)
+	return e
+}
+
+var (
+	// unquotedValueRe matches label matchers with unquoted values, e.g. {job=api}.
+	unquotedValueRe = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*([^"'\x60\s,}][^,}]*)`)
+	// rangeFuncRe matches errors of functions called without a range vector, e.g. rate(foo).
+	rangeFuncRe = regexp.MustCompile(`expected type range vector in call to function "([a-z_]+)"`)
+)
+
+// hints returns suggestions for common mistakes that may have caused the error.
+func hints(e *Error) []string {
+	var res []string
+
+	if strings.Contains(e.Msg, "in label matching") {
+		if m := unquotedValueRe.FindStringSubmatch(e.Expr[strings.LastIndex(e.Expr[:e.Start], "{")+1:]); m != nil {
+			res = append(res, fmt.Sprintf("label values have to be quoted, e.g. %s%s%q", m[1], m[2], strings.TrimSpace(m[3])))
+		}
+	}
+
+	if m := rangeFuncRe.FindStringSubmatch(e.Msg); m != nil {
+		res = append(res, fmt.Sprintf("%s() needs a range vector, add a time window to the selector, e.g. %s(http_requests_total[5m])", m[1], m[1]))
+	}
+
+	if strings.Contains(e.Msg, "unclosed left parenthesis") || strings.Contains(e.Msg, "unexpected right parenthesis") {
+		res = append(res, fmt.Sprintf("the expression has %d opening and %d closing parentheses", strings.Count(e.Expr, "("), strings.Count(e.Expr, ")")))
+	}
+
+	if strings.Contains(e.Msg, `unexpected "="`) {
+		res = append(res, "use == to compare values, = is only valid in label matchers")
+	}
+
+	return res
+}
+
+// Format returns the expression pretty-printed, split over multiple lines if it is long.
+func Format(expr string) (string, error) {
+	parsed, err := Parse(expr)
+	if err != nil {
+		return "", err
+	}
+	return parser.Prettify(parsed), nil
+}
+
+// Explain writes the type, syntax tree and selectors of the expression to w.
+func Explain(w io.Writer, expr string) error {
+	parsed, err := Parse(expr)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Type: %s\n\nTree:\n", parsed.Type())
+	writeTree(w, parsed, 1)
+
+	fmt.Fprintln(w, "\nSelectors:")
+	parser.Inspect(parsed, func(node parser.Node, path []parser.Node) error {
+		var rng model.Duration
+		vs, ok := node.(*parser.VectorSelector)
+		if ms, isMatrix := node.(*parser.MatrixSelector); isMatrix {
+			vs, ok, rng = ms.VectorSelector.(*parser.VectorSelector), true, model.Duration(ms.Range)
+		} else if len(path) > 0 {
+			// Vector selectors of matrix selectors are described with their matrix selector.
+			if _, parentMatrix := path[len(path)-1].(*parser.MatrixSelector); parentMatrix {
+				return nil
+			}
+		}
+		if !ok {
+			return nil
+		}
+
+		fmt.Fprintf(w, "  %s\n", node)
+		for _, m := range vs.LabelMatchers {
+			fmt.Fprintf(w, "    matcher: %s\n", m)
+		}
+		if rng > 0 {
+			fmt.Fprintf(w, "    range:   %s\n", rng)
+		}
+		if vs.OriginalOffset != 0 {
+			fmt.Fprintf(w, "    offset:  %s\n", model.Duration(vs.OriginalOffset))
+		}
+		if vs.Timestamp != nil {
+			fmt.Fprintf(w, "    at:      %d\n", *vs.Timestamp)
+		}
+		return nil
+	})
+	return nil
+}
+
+func writeTree(w io.Writer, node parser.Node, depth int) {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*parser.")
+	fmt.Fprintf(w, "%s%s: %s\n", strings.Repeat("  ", depth), name, node)
+
+	if _, ok := node.(*parser.MatrixSelector); ok {
+		// The vector selector of a matrix selector adds nothing but noise.
+		return
+	}
+	for _, c := range parser.Children(node) {
+		writeTree(w, c, depth+1)
+	}
+}
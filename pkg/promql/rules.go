@@ -0,0 +1,234 @@
+package promql
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/template"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+type ruleGroups struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name     string `yaml:"name"`
+	Interval string `yaml:"interval,omitempty"`
+	Limit    int    `yaml:"limit,omitempty"`
+	Rules    []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// templateDefs are the variables Prometheus defines for the templates of alerting rules.
+const templateDefs = "{{$labels := .Labels}}{{$externalLabels := .ExternalLabels}}{{$externalURL := .ExternalURL}}{{$value := .Value}}"
+
+// templateFuncs are the names of the functions Prometheus provides to the templates of alerting
+// rules. Only their names matter to check the syntax of templates.
+var templateFuncs = []string{
+	"query", "first", "label", "value", "strvalue", "args", "reReplaceAll", "safeHtml", "match",
+	"title", "toUpper", "toLower", "graphLink", "tableLink", "sortByLabel", "stripPort", "stripDomain",
+	"humanize", "humanize1024", "humanizeDuration", "humanizePercentage", "humanizeTimestamp",
+	"pathPrefix", "externalURL", "parseDuration", "toTime",
+}
+
+// RuleError is a problem of a rule file at the given line.
+type RuleError struct {
+	Line int
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// CheckRules checks that b is a valid file of Prometheus rule groups, like Prometheus does when
+// loading it, and returns all problems found. Problems of groups and rules are *RuleError.
+// Templates of labels and annotations are only checked for syntax.
+func CheckRules(b []byte) []error {
+	// Unknown fields are not rejected, as backends extend rule files with their own, e.g. Thanos with
+	// partial_response_strategy or Cortex with source_tenants.
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+
+	var groups ruleGroups
+	if err := dec.Decode(&groups); err != nil && !errors.Is(err, io.EOF) {
+		return []error{err}
+	}
+
+	// Decoding succeeded, so does decoding the nodes, which are only needed for their lines.
+	var doc yaml.Node
+	_ = yaml.Unmarshal(b, &doc)
+	root := &doc
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	groupNodes := sequence(root, "groups")
+
+	funcs := template.FuncMap{}
+	for _, name := range templateFuncs {
+		funcs[name] = func(...interface{}) interface{} { return nil }
+	}
+
+	var errs []error
+	names := map[string]struct{}{}
+	for i, g := range groups.Groups {
+		// Nodes may be missing where the decoded structure doesn't mirror the document, e.g. with merge
+		// keys, problems are then reported at the enclosing node.
+		groupNode := item(groupNodes, i, root)
+		if g.Name == "" {
+			errs = append(errs, &RuleError{Line: groupNode.Line, Err: errors.New("group name must not be empty")})
+			continue
+		}
+		if _, ok := names[g.Name]; ok {
+			errs = append(errs, &RuleError{Line: line(groupNode, "name"), Err: fmt.Errorf("%q: repeated group name", g.Name)})
+		}
+		names[g.Name] = struct{}{}
+
+		if g.Interval != "" {
+			if _, err := model.ParseDuration(g.Interval); err != nil {
+				errs = append(errs, &RuleError{Line: line(groupNode, "interval"), Err: fmt.Errorf("%q: invalid interval: %w", g.Name, err)})
+			}
+		}
+
+		ruleNodes := sequence(groupNode, "rules")
+		for j, r := range g.Rules {
+			for _, err := range r.check(funcs, item(ruleNodes, j, groupNode)) {
+				err.Err = fmt.Errorf("group %q, rule %d, %q: %w", g.Name, j+1, r.Record+r.Alert, err.Err)
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// sequence returns the items of the sequence under key in the mapping n.
+func sequence(n *yaml.Node, key string) []*yaml.Node {
+	if v := value(n, key); v != nil && v.Kind == yaml.SequenceNode {
+		return v.Content
+	}
+	return nil
+}
+
+// item returns the i-th node of nodes, or fallback if there are fewer.
+func item(nodes []*yaml.Node, i int, fallback *yaml.Node) *yaml.Node {
+	if i < len(nodes) {
+		return resolve(nodes[i])
+	}
+	return fallback
+}
+
+// value returns the value of key in the mapping n, or nil if it has none.
+func value(n *yaml.Node, key string) *yaml.Node {
+	n = resolve(n)
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return resolve(n.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// resolve returns the node an alias like *rules refers to, or n if it is no alias.
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// line returns the line of the value of key in the mapping n, or of n if it has none.
+func line(n *yaml.Node, key string) int {
+	if v := value(n, key); v != nil {
+		return v.Line
+	}
+	return n.Line
+}
+
+// check returns the problems of the rule, located in its node n.
+func (r rule) check(funcs template.FuncMap, n *yaml.Node) []*RuleError {
+	var errs []*RuleError
+	add := func(key string, err error) {
+		errs = append(errs, &RuleError{Line: line(n, key), Err: err})
+	}
+
+	switch {
+	case r.Record != "" && r.Alert != "":
+		add("", errors.New("only one of 'record' and 'alert' must be set"))
+	case r.Record == "" && r.Alert == "":
+		add("", errors.New("one of 'record' or 'alert' must be set"))
+	}
+
+	if r.Expr == "" {
+		add("", errors.New("field 'expr' must be set in rule"))
+	} else if _, err := Parse(r.Expr); err != nil {
+		add("expr", fmt.Errorf("could not parse expression: %w", err))
+	}
+
+	if r.Record != "" {
+		if len(r.Annotations) > 0 {
+			add("annotations", errors.New("invalid field 'annotations' in recording rule"))
+		}
+		if r.For != "" {
+			add("for", errors.New("invalid field 'for' in recording rule"))
+		}
+		if !model.IsValidMetricName(model.LabelValue(r.Record)) {
+			add("record", fmt.Errorf("invalid recording rule name: %s", r.Record))
+		}
+	}
+	if r.For != "" {
+		if _, err := model.ParseDuration(r.For); err != nil {
+			add("for", fmt.Errorf("invalid field 'for': %w", err))
+		}
+	}
+
+	labels, annotations := value(n, "labels"), value(n, "annotations")
+	if labels == nil {
+		labels = n
+	}
+	if annotations == nil {
+		annotations = n
+	}
+	for name, v := range r.Labels {
+		if !model.LabelName(name).IsValid() || name == model.MetricNameLabel {
+			errs = append(errs, &RuleError{Line: line(labels, name), Err: fmt.Errorf("invalid label name: %s", name)})
+		}
+		if err := checkTemplate(funcs, name, v); err != nil {
+			errs = append(errs, &RuleError{Line: line(labels, name), Err: fmt.Errorf("label %q: %w", name, err)})
+		}
+	}
+	for name, v := range r.Annotations {
+		if !model.LabelName(name).IsValid() {
+			errs = append(errs, &RuleError{Line: line(annotations, name), Err: fmt.Errorf("invalid annotation name: %s", name)})
+		}
+		if err := checkTemplate(funcs, name, v); err != nil {
+			errs = append(errs, &RuleError{Line: line(annotations, name), Err: fmt.Errorf("annotation %q: %w", name, err)})
+		}
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	return errs
+}
+
+// checkTemplate checks the syntax of a template of an alerting rule.
+func checkTemplate(funcs template.FuncMap, name, text string) error {
+	_, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(templateDefs + text)
+	return err
+}
@@ -0,0 +1,110 @@
+package promql
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckRules(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file string
+		// errs are substrings of the expected problems, in order, with their lines.
+		errs  []string
+		lines []int
+	}{
+		{
+			name: "valid",
+			file: `groups:
+- name: a
+  rules:
+  - record: job:up:sum
+    expr: sum by (job) (up)
+`,
+		},
+		{
+			name: "thanos and cortex fields",
+			file: `groups:
+- name: a
+  interval: 30s
+  partial_response_strategy: warn
+  query_offset: 1m
+  source_tenants: [team-a, team-b]
+  rules:
+  - alert: Down
+    expr: up == 0
+    for: 5m
+    keep_firing_for: 10m
+`,
+		},
+		{
+			name: "aliased rules",
+			file: `groups:
+- name: a
+  rules: &r
+  - alert: Down
+    expr: up == 0
+    for: 5m
+- name: b
+  rules: *r
+`,
+		},
+		{
+			name: "invalid rule in aliased rules",
+			file: `groups:
+- name: a
+  rules: &r
+  - alert: Down
+    expr: up ==
+- name: b
+  rules: *r
+`,
+			errs:  []string{`group "a", rule 1, "Down": could not parse expression`, `group "b", rule 1, "Down": could not parse expression`},
+			lines: []int{5, 5},
+		},
+		{
+			name: "merged group",
+			file: `groups:
+- &a
+  name: a
+  interval: 1x
+  rules: []
+- <<: *a
+  name: b
+`,
+			errs:  []string{`"a": invalid interval`, `"b": invalid interval`},
+			lines: []int{4, 6},
+		},
+		{
+			name: "repeated group name",
+			file: `groups:
+- name: a
+  rules: []
+- name: a
+  rules: []
+`,
+			errs:  []string{`"a": repeated group name`},
+			lines: []int{4},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := CheckRules([]byte(tc.file))
+			if len(errs) != len(tc.errs) {
+				t.Fatalf("got %d problems %v, want %d", len(errs), errs, len(tc.errs))
+			}
+			for i, err := range errs {
+				var rerr *RuleError
+				if !errors.As(err, &rerr) {
+					t.Fatalf("problem %d: expected a rule error, got %T: %v", i, err, err)
+				}
+				if !strings.Contains(rerr.Err.Error(), tc.errs[i]) {
+					t.Errorf("problem %d: got %q, want it to contain %q", i, rerr.Err, tc.errs[i])
+				}
+				if rerr.Line != tc.lines[i] {
+					t.Errorf("problem %d: got line %d, want %d", i, rerr.Line, tc.lines[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Package remoteread serves the Prometheus remote read protocol, answering queries with range vector
+// selectors against a query API.
+package remoteread
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// Path is the path remote read endpoints are conventionally served at.
+const Path = "/api/v1/read"
+
+// QueryFunc evaluates a PromQL expression at time t and returns the series of its matrix result.
+type QueryFunc func(ctx context.Context, expr string, t time.Time) ([]fetcher.Series, error)
+
+// ErrBadRequest marks errors caused by the queries of a request, answered with 400 Bad Request.
+var ErrBadRequest = errors.New("bad request")
+
+// Handler answers remote read requests with the raw samples returned by query for a range vector
+// selector of every query, evaluated at its end. Responses are of the SAMPLES response type, which
+// all remote read clients accept.
+func Handler(query QueryFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "remote read requests have to be POST requests", http.StatusMethodNotAllowed)
+			return
+		}
+
+		req, err := decodeRequest(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := &prompb.ReadResponse{Results: make([]*prompb.QueryResult, 0, len(req.Queries))}
+		for _, q := range req.Queries {
+			result, err := read(r.Context(), query, q)
+			if err != nil {
+				status := http.StatusBadGateway
+				if errors.Is(err, ErrBadRequest) {
+					status = http.StatusBadRequest
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+			resp.Results = append(resp.Results, result)
+		}
+
+		b, err := proto.Marshal(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Header().Set("Content-Encoding", "snappy")
+		_, _ = w.Write(snappy.Encode(nil, b))
+	})
+}
+
+func decodeRequest(body io.Reader) (*prompb.ReadRequest, error) {
+	compressed, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("reading request: %w", err)
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing request: %w", err)
+	}
+
+	var req prompb.ReadRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return nil, fmt.Errorf("decoding request: %w", err)
+	}
+	return &req, nil
+}
+
+// read answers a single query of a remote read request.
+func read(ctx context.Context, query QueryFunc, q *prompb.Query) (*prompb.QueryResult, error) {
+	rangeMs := q.EndTimestampMs - q.StartTimestampMs
+	if rangeMs <= 0 {
+		return &prompb.QueryResult{}, nil
+	}
+
+	expr, err := Selector(q.Matchers, rangeMs)
+	if err != nil {
+		return nil, err
+	}
+
+	series, err := query(ctx, expr, time.UnixMilli(q.EndTimestampMs))
+	if err != nil {
+		return nil, fmt.Errorf("querying %s: %w", expr, err)
+	}
+
+	result := &prompb.QueryResult{Timeseries: make([]*prompb.TimeSeries, 0, len(series))}
+	for _, s := range series {
+		ts := &prompb.TimeSeries{
+			Labels:  make([]prompb.Label, 0, len(s.Metric)),
+			Samples: make([]prompb.Sample, 0, len(s.Values)),
+		}
+		for name, value := range s.Metric {
+			ts.Labels = append(ts.Labels, prompb.Label{Name: name, Value: value})
+		}
+		sort.Slice(ts.Labels, func(i, j int) bool { return ts.Labels[i].Name < ts.Labels[j].Name })
+
+		for _, v := range s.Values {
+			ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(math.Round(v.Timestamp * 1000)), Value: v.Float()})
+		}
+		result.Timeseries = append(result.Timeseries, ts)
+	}
+	return result, nil
+}
+
+// Selector returns a range vector selector of the series matched by matchers, over rangeMs milliseconds.
+func Selector(matchers []*prompb.LabelMatcher, rangeMs int64) (string, error) {
+	if len(matchers) == 0 {
+		return "", fmt.Errorf("%w: query without matchers", ErrBadRequest)
+	}
+
+	parts := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		var op string
+		switch m.Type {
+		case prompb.LabelMatcher_EQ:
+			op = "="
+		case prompb.LabelMatcher_NEQ:
+			op = "!="
+		case prompb.LabelMatcher_RE:
+			op = "=~"
+		case prompb.LabelMatcher_NRE:
+			op = "!~"
+		default:
+			return "", fmt.Errorf("%w: unknown matcher type %d", ErrBadRequest, m.Type)
+		}
+		parts = append(parts, m.Name+op+strconv.Quote(m.Value))
+	}
+	return "{" + strings.Join(parts, ",") + "}[" + strconv.FormatInt(rangeMs, 10) + "ms]", nil
+}
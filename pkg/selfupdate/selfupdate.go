@@ -0,0 +1,208 @@
+// Package selfupdate downloads obsctl releases, verifies them and replaces the running binary with them.
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	// DefaultAPIURL is the URL of the GitHub API releases are looked up in.
+	DefaultAPIURL = "https://api.github.com"
+	// DefaultRepo is the repository obsctl is released from.
+	DefaultRepo = "observatorium/obsctl"
+
+	// ChecksumsAsset is the name of the release asset with the SHA-256 checksums of all binaries, in
+	// the format of sha256sum.
+	ChecksumsAsset = "checksums.txt"
+	// SignatureAsset is the name of the release asset with the base64-encoded signature of the
+	// checksums, e.g. made with 'cosign sign-blob'.
+	SignatureAsset = ChecksumsAsset + ".sig"
+
+	// maxBinarySize is the maximum size of downloaded binaries.
+	maxBinarySize = 256 << 20
+)
+
+// ReleasePublicKey is the base64-encoded PEM public key the checksums of releases are signed with.
+// Release builds set it with -ldflags "-X github.com/observatorium/obsctl/pkg/selfupdate.ReleasePublicKey=<key>",
+// see 'make crossbuild', so that they verify the signature of releases they update to by default.
+var ReleasePublicKey = ""
+
+// DefaultPublicKey returns the PEM-encoded ReleasePublicKey, or nil if the build has none.
+func DefaultPublicKey() ([]byte, error) {
+	if ReleasePublicKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(ReleasePublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding release public key: %w", err)
+	}
+	return key, nil
+}
+
+// Release is a GitHub release.
+type Release struct {
+	TagName string  `json:"tag_name"`
+	HTMLURL string  `json:"html_url"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// Asset returns the asset with the given name.
+func (r *Release) Asset(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// BinaryAsset returns the name of the binary asset for an OS and architecture, e.g. obsctl-linux-amd64.
+func BinaryAsset(goos, goarch string) string {
+	name := fmt.Sprintf("obsctl-%s-%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Client looks up and downloads releases.
+type Client struct {
+	HTTP   *http.Client
+	APIURL string
+	Repo   string
+	// Token authenticates requests to the GitHub API, to avoid the rate limits of anonymous requests.
+	Token string
+}
+
+// Release returns the release with the given tag, or the latest release if tag is empty.
+func (c *Client) Release(ctx context.Context, tag string) (*Release, error) {
+	u := fmt.Sprintf("%s/repos/%s/releases/latest", strings.TrimSuffix(c.APIURL, "/"), c.Repo)
+	if tag != "" {
+		u = fmt.Sprintf("%s/repos/%s/releases/tags/%s", strings.TrimSuffix(c.APIURL, "/"), c.Repo, tag)
+	}
+
+	b, err := c.get(ctx, u, "application/vnd.github+json", 1<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Release
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("decoding release: %w", err)
+	}
+	return &r, nil
+}
+
+// Download returns the content of an asset.
+func (c *Client) Download(ctx context.Context, a Asset) ([]byte, error) {
+	return c.get(ctx, a.URL, "application/octet-stream", maxBinarySize)
+}
+
+func (c *Client) get(ctx context.Context, u, accept string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", accept)
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("getting %s: unexpected status code %d", u, resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", u, err)
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("getting %s: response exceeds %d bytes", u, limit)
+	}
+	return b, nil
+}
+
+// VerifyChecksum checks that the SHA-256 checksum of data is the checksum of the named file in checksums.
+func VerifyChecksum(checksums []byte, name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+
+	s := bufio.NewScanner(bytes.NewReader(checksums))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		// Binary mode entries of sha256sum are prefixed with an asterisk.
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		if !strings.EqualFold(fields[0], actual) {
+			return fmt.Errorf("checksum mismatch of %s: expected %s, got %s", name, fields[0], actual)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum of %s in %s", name, ChecksumsAsset)
+}
+
+// Replace atomically replaces the executable at path with data, keeping its permissions. The new binary
+// is written next to it first, so that a failed update leaves the old binary in place.
+func Replace(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".obsctl-update-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing new binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing new binary: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		// Running executables can't be overwritten on Windows, but they can be renamed.
+		old := path + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return fmt.Errorf("moving old binary: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing binary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// Package signature verifies detached signatures of files made with cosign or minisign.
+package signature
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Extensions of detached signature files, appended to the name of the signed file.
+const (
+	// CosignExtension is the extension of signatures made by 'cosign sign-blob', verified with PEM-encoded keys.
+	CosignExtension = ".sig"
+	// MinisignExtension is the extension of signatures made by minisign, verified with minisign keys.
+	MinisignExtension = ".minisig"
+)
+
+// ErrUnsigned is returned by VerifyFile for files without a signature file.
+var ErrUnsigned = errors.New("no signature found")
+
+// Verify checks the detached signature of msg. PEM-encoded public keys verify base64-encoded signatures
+// as made by 'cosign sign-blob', over the SHA-256 digest of msg for ECDSA keys. Other keys are
+// read as minisign public keys, verifying minisign signature files.
+func Verify(publicKey, msg, signature []byte) error {
+	if block, _ := pem.Decode(publicKey); block != nil {
+		return verifyPKIX(block, msg, signature)
+	}
+	return verifyMinisign(publicKey, msg, signature)
+}
+
+// CheckPublicKey returns an error if publicKey is neither a PEM-encoded ECDSA or Ed25519 key nor a
+// minisign public key.
+func CheckPublicKey(publicKey []byte) error {
+	if block, _ := pem.Decode(publicKey); block != nil {
+		_, err := parsePKIX(block)
+		return err
+	}
+	_, _, err := parseMinisignKey(publicKey)
+	return err
+}
+
+// VerifyFile checks the signature of the file at path, with contents data, in the signature file
+// next to it, see CosignExtension and MinisignExtension.
+func VerifyFile(publicKey []byte, path string, data []byte) error {
+	sigFile := path + MinisignExtension
+	if block, _ := pem.Decode(publicKey); block != nil {
+		sigFile = path + CosignExtension
+	}
+
+	sig, err := os.ReadFile(sigFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s: %w, expected %s", path, ErrUnsigned, sigFile)
+	}
+	if err != nil {
+		return fmt.Errorf("reading signature: %w", err)
+	}
+	if err := Verify(publicKey, data, sig); err != nil {
+		return fmt.Errorf("verifying %s: %w", sigFile, err)
+	}
+	return nil
+}
+
+func parsePKIX(block *pem.Block) (interface{}, error) {
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T, expected ECDSA or Ed25519", key)
+	}
+}
+
+func verifyPKIX(block *pem.Block, msg, signature []byte) error {
+	key, err := parsePKIX(block)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(msg)
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, msg, sig) {
+			return errors.New("invalid signature")
+		}
+	}
+	return nil
+}
+
+// Minisign signature algorithms: legacy signatures of the message itself, and signatures of its
+// BLAKE2b-512 digest, the default of minisign since 0.8.
+var (
+	minisignLegacy    = []byte("Ed")
+	minisignPrehashed = []byte("ED")
+)
+
+// parseMinisignKey returns the ID and key of a minisign public key.
+func parseMinisignKey(publicKey []byte) ([]byte, ed25519.PublicKey, error) {
+	pk, err := decodeMinisign(publicKey, 1)
+	if err != nil || len(pk[0]) != 42 || !bytes.Equal(pk[0][:2], minisignLegacy) {
+		return nil, nil, errors.New("invalid public key, expected a PEM-encoded key or a minisign public key")
+	}
+	return pk[0][2:10], ed25519.PublicKey(pk[0][10:]), nil
+}
+
+// verifyMinisign checks a minisign signature file, including its trusted comment.
+func verifyMinisign(publicKey, msg, signature []byte) error {
+	keyID, key, err := parseMinisignKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	parts, err := decodeMinisign(signature, 2)
+	if err != nil {
+		return fmt.Errorf("decoding minisign signature: %w", err)
+	}
+	sig, globalSig := parts[0], parts[1]
+	if len(sig) != 74 || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+	if !bytes.Equal(sig[2:10], keyID) {
+		return fmt.Errorf("signed with key %X, expected key %X", reverse(sig[2:10]), reverse(keyID))
+	}
+
+	switch {
+	case bytes.Equal(sig[:2], minisignPrehashed):
+		digest := blake2b.Sum512(msg)
+		msg = digest[:]
+	case !bytes.Equal(sig[:2], minisignLegacy):
+		return fmt.Errorf("unsupported minisign signature algorithm %q", sig[:2])
+	}
+	if !ed25519.Verify(key, msg, sig[10:]) {
+		return errors.New("invalid signature")
+	}
+
+	// The trusted comment is signed together with the signature.
+	comment := trustedComment(signature)
+	if !ed25519.Verify(key, append(append([]byte{}, sig[10:]...), comment...), globalSig) {
+		return errors.New("invalid signature of trusted comment")
+	}
+	return nil
+}
+
+// decodeMinisign returns the first n base64-encoded lines of a minisign file, skipping comments.
+func decodeMinisign(b []byte, n int) ([][]byte, error) {
+	var parts [][]byte
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") || strings.HasPrefix(line, "trusted comment:") {
+			continue
+		}
+		d, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, err
+		}
+		if parts = append(parts, d); len(parts) == n {
+			return parts, nil
+		}
+	}
+	return nil, fmt.Errorf("expected %d base64-encoded lines, got %d", n, len(parts))
+}
+
+func trustedComment(signature []byte) []byte {
+	for _, line := range strings.Split(string(signature), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "trusted comment: ") {
+			return []byte(strings.TrimPrefix(line, "trusted comment: "))
+		}
+	}
+	return nil
+}
+
+// reverse returns a reversed copy of b, as minisign prints key IDs as little-endian numbers.
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
@@ -0,0 +1,156 @@
+// Package slo reads service level objectives and computes their compliance and error budget.
+package slo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/observatorium/obsctl/pkg/duration"
+	"gopkg.in/yaml.v3"
+)
+
+// StepPlaceholder is replaced by the step the queries of an SLI are evaluated at, so that range
+// vectors cover the time between two samples exactly.
+const StepPlaceholder = "$step"
+
+// File is a file of SLO definitions.
+type File struct {
+	SLOs []SLO `yaml:"slos"`
+}
+
+// SLO is a service level objective on the ratio of good events.
+type SLO struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	// Objective is the percentage of events that have to be good over the window, e.g. 99.9.
+	Objective float64 `yaml:"objective"`
+	// Window is the duration the objective applies to, e.g. 30d.
+	Window string `yaml:"window"`
+	SLI    SLI    `yaml:"sli"`
+}
+
+// SLI is a service level indicator, as PromQL queries of the per-second rates of all events and of
+// bad events, e.g. requests and failed requests.
+type SLI struct {
+	ErrorQuery string `yaml:"errorQuery"`
+	TotalQuery string `yaml:"totalQuery"`
+}
+
+// Load reads and validates SLO definitions from a file.
+func Load(path string) (*File, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading SLOs: %w", err)
+	}
+
+	var f File
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parsing SLOs %s: %w", path, err)
+	}
+	if len(f.SLOs) == 0 {
+		return nil, fmt.Errorf("%s defines no SLOs, expected a list of slos", path)
+	}
+	for _, s := range f.SLOs {
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("invalid SLO %q in %s: %w", s.Name, path, err)
+		}
+	}
+	return &f, nil
+}
+
+func (s SLO) validate() error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if s.Objective <= 0 || s.Objective >= 100 {
+		return fmt.Errorf("objective must be a percentage between 0 and 100, got %g", s.Objective)
+	}
+	if _, err := s.WindowDuration(); err != nil {
+		return err
+	}
+	if s.SLI.ErrorQuery == "" || s.SLI.TotalQuery == "" {
+		return errors.New("sli.errorQuery and sli.totalQuery are required")
+	}
+	return nil
+}
+
+// WindowDuration returns the parsed window of the SLO.
+func (s SLO) WindowDuration() (time.Duration, error) {
+	w, err := duration.Parse(s.Window)
+	if err != nil {
+		return 0, fmt.Errorf("parsing window: %w", err)
+	}
+	if w <= 0 {
+		return 0, fmt.Errorf("window must be positive, got %s", s.Window)
+	}
+	return w, nil
+}
+
+// Queries returns the error and total queries of the SLI, evaluated at the given step.
+func (s SLO) Queries(step time.Duration) (string, string) {
+	d := duration.Format(step)
+	return strings.ReplaceAll(s.SLI.ErrorQuery, StepPlaceholder, d), strings.ReplaceAll(s.SLI.TotalQuery, StepPlaceholder, d)
+}
+
+// Sample is a per-second rate of events at a point in time.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Report is the state of an SLO at the end of its window.
+type Report struct {
+	Name      string  `json:"name"`
+	Objective float64 `json:"objective"`
+	Window    string  `json:"window"`
+	// Compliance is the percentage of good events over the window.
+	Compliance float64 `json:"compliance"`
+	// BudgetRemaining is the percentage of the error budget of the window left, negative if it is overspent.
+	BudgetRemaining float64 `json:"budgetRemaining"`
+	// BurnRate is the rate at which the error budget was spent over the burn rate window, relative to
+	// the rate spending it exactly over the SLO window.
+	BurnRate float64 `json:"burnRate"`
+	// NoData is set if there were no events in the window, in which case the SLO is considered met.
+	NoData bool `json:"noData,omitempty"`
+}
+
+// Evaluate computes the report of an SLO from the error and total rates sampled over its window, at
+// a constant step. Samples missing from the error rates count as no errors. The burn rate is computed
+// over the samples in burnWindow before end, or the latest sample if there are none.
+func Evaluate(s SLO, errorRates, totalRates []Sample, end time.Time, burnWindow time.Duration) Report {
+	r := Report{Name: s.Name, Objective: s.Objective, Window: s.Window, Compliance: 100, BudgetRemaining: 100}
+	budget := 1 - s.Objective/100
+
+	errs := map[int64]float64{}
+	for _, e := range errorRates {
+		errs[e.Time.UnixNano()] += e.Value
+	}
+
+	var bad, total, recentBad, recentTotal float64
+	burnStart := end.Add(-burnWindow)
+	for i, t := range totalRates {
+		e := errs[t.Time.UnixNano()]
+		bad += e
+		total += t.Value
+		if t.Time.After(burnStart) || (i == len(totalRates)-1 && recentTotal == 0) {
+			recentBad += e
+			recentTotal += t.Value
+		}
+	}
+
+	if total <= 0 {
+		r.NoData = true
+		return r
+	}
+
+	ratio := bad / total
+	r.Compliance = (1 - ratio) * 100
+	r.BudgetRemaining = (1 - ratio/budget) * 100
+	if recentTotal > 0 {
+		r.BurnRate = recentBad / recentTotal / budget
+	}
+	return r
+}
@@ -0,0 +1,137 @@
+package tui
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/observatorium/obsctl/pkg/fetcher"
+)
+
+const maxCompletions = 20
+
+var (
+	// identRe matches the metric or label name being typed at the end of the input.
+	identRe = regexp.MustCompile(`[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	// labelValueRe matches a label value being typed at the end of the input, e.g. `{job="pro`.
+	labelValueRe = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)\s*(?:=|!=|=~|!~)\s*"([^"]*)$`)
+	// metricRe matches the last metric name before a selector or the end of the input.
+	metricRe = regexp.MustCompile(`([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(?:\{[^}]*\}?)?\s*(?:\[[^\]]*\]?)?$`)
+)
+
+// Completer completes PromQL queries with the metric names, label names and label values of a tenant.
+type Completer struct {
+	ctx     context.Context
+	fetcher *fetcher.Fetcher
+	// OnError, if set, is called with errors of lazily loaded completions.
+	OnError func(error)
+
+	mtx sync.Mutex
+	// completions caches metric names (key "__name__"), label names (key "") and label values.
+	completions map[string][]string
+	metadata    map[string][]fetcher.MetricMetadata
+}
+
+// NewCompleter returns a Completer for the tenant of f, preloading metric and label names and the metadata of metrics.
+func NewCompleter(ctx context.Context, f *fetcher.Fetcher) *Completer {
+	c := &Completer{ctx: ctx, fetcher: f, completions: map[string][]string{}}
+
+	if names, err := f.LabelValues(ctx, fetcher.Metrics, "__name__", nil); err == nil {
+		c.completions["__name__"] = names
+	}
+	if names, err := f.LabelNames(ctx, fetcher.Metrics, nil); err == nil {
+		c.completions[""] = names
+	}
+	// Not all backends serve metadata, completions work without it.
+	if md, err := f.Metadata(ctx, nil); err == nil {
+		c.metadata = md
+	}
+	return c
+}
+
+// Metrics returns the number of known metric names.
+func (c *Completer) Metrics() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return len(c.completions["__name__"])
+}
+
+// Complete returns completions for the metric name, label name or label value at the end of text.
+// Label values are loaded lazily, so their completions show up on a later call.
+func (c *Completer) Complete(text string) []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var key, prefix string
+	if m := labelValueRe.FindStringSubmatch(text); m != nil && insideSelector(text) {
+		key, prefix = m[1], m[2]
+		if _, ok := c.completions[key]; !ok {
+			c.completions[key] = nil
+			go c.loadLabelValues(key)
+			return nil
+		}
+	} else {
+		prefix = identRe.FindString(text)
+		if prefix == "" {
+			return nil
+		}
+		key = "__name__"
+		if insideSelector(text) {
+			key = ""
+		}
+	}
+
+	var res []string
+	for _, v := range c.completions[key] {
+		if strings.HasPrefix(v, prefix) && v != prefix {
+			res = append(res, text[:len(text)-len(prefix)]+v)
+			if len(res) == maxCompletions {
+				break
+			}
+		}
+	}
+	return res
+}
+
+func (c *Completer) loadLabelValues(name string) {
+	values, err := c.fetcher.LabelValues(c.ctx, fetcher.Metrics, name, nil)
+	if err != nil {
+		c.mtx.Lock()
+		delete(c.completions, name)
+		c.mtx.Unlock()
+		if c.OnError != nil {
+			c.OnError(err)
+		}
+		return
+	}
+
+	c.mtx.Lock()
+	c.completions[name] = values
+	c.mtx.Unlock()
+}
+
+// Help describes the metric last referenced in text with its type and help from the metadata,
+// e.g. "http_requests_total (counter): Total number of HTTP requests.". It returns an empty
+// string if there is no metadata for the metric.
+func (c *Completer) Help(text string) string {
+	m := metricRe.FindStringSubmatch(text)
+	if m == nil {
+		return ""
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	md := c.metadata[m[1]]
+	if len(md) == 0 {
+		return ""
+	}
+	return m[1] + " (" + md[0].Type + "): " + md[0].Help
+}
+
+// insideSelector reports whether the end of text is within curly braces.
+func insideSelector(text string) bool {
+	return strings.LastIndex(text, "{") > strings.LastIndex(text, "}")
+}
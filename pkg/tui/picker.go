@@ -0,0 +1,135 @@
+package tui
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ErrAborted is returned when the user exits a picker or prompt without choosing an item.
+var ErrAborted = errors.New("aborted")
+
+// PickerItem is an item that can be chosen in a picker.
+type PickerItem struct {
+	// Text is matched against the filter and returned when chosen.
+	Text string
+	// Detail is shown next to the text, e.g. a status.
+	Detail string
+}
+
+// Pick shows a full screen fuzzy finder over the items and returns the text of the chosen one.
+// Typing filters the items to those containing the typed characters in order, best matches first.
+func Pick(title string, items []PickerItem, selected string) (string, error) {
+	app := tview.NewApplication()
+
+	list := tview.NewList().ShowSecondaryText(false).SetHighlightFullLine(true)
+	list.SetBorder(true).SetTitle(" " + title + " ")
+
+	var chosen string
+	var shown []PickerItem
+	refresh := func(filter string) {
+		list.Clear()
+		shown = fuzzyFilter(items, filter)
+		for i, it := range shown {
+			list.AddItem(tview.Escape(it.Text)+"  [gray]"+tview.Escape(it.Detail)+"[-]", "", 0, nil)
+			if filter == "" && it.Text == selected {
+				list.SetCurrentItem(i)
+			}
+		}
+	}
+
+	input := tview.NewInputField().SetLabel("> ").SetFieldWidth(0)
+	input.SetChangedFunc(refresh)
+	input.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+		switch ev.Key() {
+		case tcell.KeyUp, tcell.KeyDown, tcell.KeyPgUp, tcell.KeyPgDn:
+			// Let the list handle navigation while the input keeps focus.
+			if h := list.InputHandler(); h != nil {
+				h(ev, nil)
+			}
+			return nil
+		case tcell.KeyEnter:
+			if len(shown) > 0 {
+				chosen = shown[list.GetCurrentItem()].Text
+				app.Stop()
+			}
+			return nil
+		case tcell.KeyEscape:
+			app.Stop()
+			return nil
+		}
+		return ev
+	})
+	refresh("")
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(input, 1, 0, true).
+		AddItem(list, 0, 1, false)
+
+	if err := app.SetRoot(layout, true).SetFocus(input).Run(); err != nil {
+		return "", err
+	}
+
+	if chosen == "" {
+		return "", ErrAborted
+	}
+	return chosen, nil
+}
+
+// fuzzyFilter returns the items whose text contains all characters of filter in order (case-insensitive),
+// sorted by how compact the match is.
+func fuzzyFilter(items []PickerItem, filter string) []PickerItem {
+	if filter == "" {
+		return items
+	}
+
+	type match struct {
+		item  PickerItem
+		score int
+	}
+
+	var matches []match
+	for _, it := range items {
+		if score, ok := fuzzyScore(it.Text, filter); ok {
+			matches = append(matches, match{item: it, score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score < matches[j].score })
+
+	res := make([]PickerItem, 0, len(matches))
+	for _, m := range matches {
+		res = append(res, m.item)
+	}
+	return res
+}
+
+// fuzzyScore reports whether the runes of pattern appear in text in order, and the length
+// of the span they were found in (lower is better). Whitespace in pattern is ignored.
+func fuzzyScore(text, pattern string) (int, bool) {
+	t := []rune(strings.ToLower(text))
+	var p []rune
+	for _, r := range strings.ToLower(pattern) {
+		if !unicode.IsSpace(r) {
+			p = append(p, r)
+		}
+	}
+
+	start, pi := -1, 0
+	for ti := 0; ti < len(t) && pi < len(p); ti++ {
+		if t[ti] == p[pi] {
+			if start < 0 {
+				start = ti
+			}
+			pi++
+			if pi == len(p) {
+				return ti - start, true
+			}
+		}
+	}
+	return 0, pi == len(p)
+}
@@ -0,0 +1,63 @@
+package tui
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/rivo/tview"
+)
+
+// Prompt asks for a PromQL query, completing metric names, label names and label values of the
+// tenant of f as well as showing the metadata of the metric being typed. It returns ErrAborted if
+// the user leaves the prompt with Esc or Ctrl-C.
+func Prompt(ctx context.Context, f *fetcher.Fetcher, initial string) (string, error) {
+	app := tview.NewApplication()
+	completer := NewCompleter(ctx, f)
+
+	help := tview.NewTextView().SetDynamicColors(true)
+	help.SetText("[yellow]Enter[-] run query  [yellow]Esc[-] abort")
+	completer.OnError = func(err error) {
+		app.QueueUpdateDraw(func() { help.SetText("[red]" + tview.Escape(err.Error()) + "[-]") })
+	}
+
+	var query string
+	input := tview.NewInputField().SetLabel("Query: ").SetFieldWidth(0).SetText(initial)
+	input.SetAutocompleteFunc(completer.Complete)
+	input.SetChangedFunc(func(text string) {
+		if h := completer.Help(text); h != "" {
+			help.SetText("[gray]" + tview.Escape(h) + "[-]")
+		}
+	})
+	input.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			if strings.TrimSpace(input.GetText()) == "" {
+				return
+			}
+			query = input.GetText()
+			app.Stop()
+		case tcell.KeyEscape:
+			app.Stop()
+		}
+	})
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(input, 1, 0, true).
+		AddItem(help, 1, 0, false).
+		AddItem(nil, 0, 1, false)
+
+	go func() {
+		<-ctx.Done()
+		app.Stop()
+	}()
+
+	if err := app.SetRoot(layout, true).SetFocus(input).Run(); err != nil {
+		return "", err
+	}
+	if query == "" {
+		return "", ErrAborted
+	}
+	return query, nil
+}
@@ -0,0 +1,304 @@
+// Package tui implements an interactive terminal UI for exploring the metrics of a tenant.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/go-kit/log"
+	"github.com/observatorium/obsctl/pkg/config"
+	"github.com/observatorium/obsctl/pkg/fetcher"
+	"github.com/rivo/tview"
+)
+
+const (
+	graphPoints    = 100
+	maxGraphSeries = 20
+)
+
+// Browser is an interactive query browser for the configured contexts.
+type Browser struct {
+	ctx    context.Context
+	logger log.Logger
+	cfg    *config.Config
+	// Range is the time range shown in the graph pane.
+	Range time.Duration
+
+	app      *tview.Application
+	contexts *tview.DropDown
+	input    *tview.InputField
+	table    *tview.Table
+	graph    *tview.TextView
+	status   *tview.TextView
+
+	mtx       sync.Mutex
+	fetcher   *fetcher.Fetcher
+	completer *Completer
+}
+
+// New returns a Browser for the contexts of cfg, starting with the current one.
+func New(ctx context.Context, logger log.Logger, cfg *config.Config) *Browser {
+	return &Browser{ctx: ctx, logger: logger, cfg: cfg, Range: time.Hour}
+}
+
+// Run starts the UI and blocks until the user exits it with Ctrl-C.
+func (b *Browser) Run() error {
+	contexts := b.cfg.Contexts()
+	if len(contexts) == 0 {
+		return fmt.Errorf("no contexts configured, use 'obsctl login' to add one")
+	}
+
+	b.app = tview.NewApplication()
+
+	b.status = tview.NewTextView().SetDynamicColors(true)
+	b.status.SetText("[yellow]Enter[-] run query  [yellow]Tab[-] switch pane  [yellow]Ctrl-C[-] quit")
+
+	b.contexts = tview.NewDropDown().SetLabel("Context: ")
+	current := 0
+	for i, c := range contexts {
+		if c == b.cfg.Current {
+			current = i
+		}
+		b.contexts.AddOption(c.String(), nil)
+	}
+
+	b.input = tview.NewInputField().SetLabel("Query: ").SetFieldWidth(0)
+	b.input.SetAutocompleteFunc(b.complete)
+	b.input.SetChangedFunc(b.showHelp)
+	b.input.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			go b.runQuery(b.input.GetText())
+		}
+	})
+
+	b.table = tview.NewTable().SetBorders(false).SetFixed(1, 0).SetSelectable(true, false)
+	b.table.SetBorder(true).SetTitle(" Result ")
+
+	b.graph = tview.NewTextView().SetDynamicColors(true).SetWrap(false)
+	b.graph.SetBorder(true).SetTitle(fmt.Sprintf(" Graph (last %s) ", b.Range))
+
+	// Select the context only after all widgets exist, as selecting triggers the switch.
+	b.contexts.SetCurrentOption(current)
+	b.contexts.SetSelectedFunc(func(_ string, i int) {
+		go b.switchContext(contexts[i])
+		b.app.SetFocus(b.input)
+	})
+	go b.switchContext(contexts[current])
+
+	top := tview.NewFlex().
+		AddItem(b.contexts, 0, 1, false).
+		AddItem(b.input, 0, 4, true)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(top, 1, 0, true).
+		AddItem(b.table, 0, 1, false).
+		AddItem(b.graph, 0, 1, false).
+		AddItem(b.status, 1, 0, false)
+
+	panes := []tview.Primitive{b.input, b.contexts, b.table, b.graph}
+	b.app.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+		if ev.Key() != tcell.KeyTab {
+			return ev
+		}
+		for i, p := range panes {
+			if p.HasFocus() {
+				b.app.SetFocus(panes[(i+1)%len(panes)])
+				return nil
+			}
+		}
+		b.app.SetFocus(b.input)
+		return nil
+	})
+
+	return b.app.SetRoot(layout, true).SetFocus(b.input).Run()
+}
+
+func (b *Browser) setStatus(format string, args ...interface{}) {
+	b.app.QueueUpdateDraw(func() {
+		b.status.SetText(fmt.Sprintf(format, args...))
+	})
+}
+
+// switchContext creates a fetcher for the context and preloads metric and label names for completion.
+func (b *Browser) switchContext(c config.Context) {
+	b.setStatus("Switching to %s...", c)
+
+	f, err := fetcher.NewContextFetcher(b.ctx, b.logger, b.cfg, c)
+	if err != nil {
+		b.setStatus("[red]%s[-]", tview.Escape(err.Error()))
+		return
+	}
+
+	completer := NewCompleter(b.ctx, f)
+	completer.OnError = func(err error) { b.setStatus("[red]%s[-]", tview.Escape(err.Error())) }
+
+	b.mtx.Lock()
+	b.fetcher = f
+	b.completer = completer
+	b.mtx.Unlock()
+
+	b.setStatus("Using context [green]%s[-] (%d metrics)", c, completer.Metrics())
+}
+
+// complete returns completions for the metric name, label name or label value at the end of text.
+func (b *Browser) complete(text string) []string {
+	b.mtx.Lock()
+	c := b.completer
+	b.mtx.Unlock()
+
+	if c == nil {
+		return nil
+	}
+	return c.Complete(text)
+}
+
+// showHelp shows the metadata of the metric being typed in the status bar.
+func (b *Browser) showHelp(text string) {
+	b.mtx.Lock()
+	c := b.completer
+	b.mtx.Unlock()
+
+	if c == nil {
+		return
+	}
+	if help := c.Help(text); help != "" {
+		b.status.SetText("[gray]" + tview.Escape(help) + "[-]")
+	}
+}
+
+// runQuery runs the query as instant query for the result table and as range query for the graph.
+func (b *Browser) runQuery(query string) {
+	b.mtx.Lock()
+	f := b.fetcher
+	b.mtx.Unlock()
+
+	if f == nil || strings.TrimSpace(query) == "" {
+		return
+	}
+
+	b.setStatus("Running query...")
+	start := time.Now()
+
+	instant, err := f.Query(b.ctx, fetcher.Metrics, "/query", url.Values{"query": []string{query}})
+	if err != nil {
+		b.setStatus("[red]%s[-]", tview.Escape(err.Error()))
+		return
+	}
+
+	now := time.Now()
+	step := b.Range / graphPoints
+	ranged, err := f.Query(b.ctx, fetcher.Metrics, "/query_range", url.Values{
+		"query": []string{query},
+		"start": []string{strconv.FormatInt(now.Add(-b.Range).Unix(), 10)},
+		"end":   []string{strconv.FormatInt(now.Unix(), 10)},
+		"step":  []string{strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	})
+	if err != nil {
+		b.setStatus("[red]%s[-]", tview.Escape(err.Error()))
+		return
+	}
+
+	b.app.QueueUpdateDraw(func() {
+		b.renderTable(instant)
+		b.renderGraph(ranged)
+		b.status.SetText(fmt.Sprintf("Query took %s", time.Since(start).Round(time.Millisecond)))
+	})
+}
+
+func (b *Browser) renderTable(data *fetcher.QueryData) {
+	b.table.Clear()
+	b.table.SetCell(0, 0, tview.NewTableCell("SERIES").SetTextColor(tcell.ColorYellow).SetSelectable(false))
+	b.table.SetCell(0, 1, tview.NewTableCell("VALUE").SetTextColor(tcell.ColorYellow).SetSelectable(false))
+
+	if data.ResultType == "scalar" || data.ResultType == "string" {
+		var s fetcher.SamplePair
+		if err := s.UnmarshalJSON(data.Result); err == nil {
+			b.table.SetCell(1, 0, tview.NewTableCell(data.ResultType))
+			b.table.SetCell(1, 1, tview.NewTableCell(s.Value))
+		}
+		return
+	}
+
+	series, err := data.Series()
+	if err != nil {
+		b.status.SetText(fmt.Sprintf("[red]%s[-]", tview.Escape(err.Error())))
+		return
+	}
+
+	for i, s := range series {
+		b.table.SetCell(i+1, 0, tview.NewTableCell(tview.Escape(fetcher.FormatMetric(s.Metric))).SetExpansion(1))
+		if s.Value != nil {
+			b.table.SetCell(i+1, 1, tview.NewTableCell(s.Value.Value))
+		}
+		if s.Histogram != nil {
+			b.table.SetCell(i+1, 1, tview.NewTableCell(s.Histogram.Histogram.Summary(func(f float64) string {
+				return strconv.FormatFloat(f, 'g', 4, 64)
+			})))
+		}
+	}
+}
+
+// sparks are the characters used to draw sparklines, from lowest to highest.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+func (b *Browser) renderGraph(data *fetcher.QueryData) {
+	b.graph.Clear()
+
+	series, err := data.Series()
+	if err != nil {
+		return
+	}
+
+	for i, s := range series {
+		if i == maxGraphSeries {
+			fmt.Fprintf(b.graph, "... %d more series\n", len(series)-maxGraphSeries)
+			break
+		}
+		fmt.Fprintf(b.graph, "%s [green]%s[-]\n", sparkline(s.Values), tview.Escape(fetcher.FormatMetric(s.Metric)))
+	}
+}
+
+// sparkline renders the values as a single line of block characters, scaled between their minimum and maximum.
+func sparkline(values []fetcher.SamplePair) string {
+	// Infinite values are drawn at the bounds rather than stretching the scale of the others.
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if f := v.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			min, max = math.Min(min, f), math.Max(max, f)
+		}
+	}
+
+	var sb strings.Builder
+	for _, v := range values {
+		f := v.Float()
+		if math.IsNaN(f) {
+			sb.WriteRune(' ')
+			continue
+		}
+		pos := 0.0
+		switch {
+		case math.IsInf(f, 1):
+			pos = 1
+		case math.IsInf(f, -1):
+			pos = 0
+		case max > min:
+			pos = (f - min) / (max - min)
+		}
+		idx := int(pos * float64(len(sparks)-1))
+		if idx < 0 {
+			idx = 0
+		}
+		if idx > len(sparks)-1 {
+			idx = len(sparks) - 1
+		}
+		sb.WriteRune(sparks[idx])
+	}
+	return sb.String()
+}
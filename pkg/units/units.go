@@ -0,0 +1,136 @@
+// Package units formats sample values, and parses sizes, for humans.
+package units
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Units values can be formatted in.
+const (
+	Auto    = "auto"
+	None    = "none"
+	Bytes   = "bytes"
+	Seconds = "seconds"
+	Ratio   = "ratio"
+	SI      = "si"
+)
+
+// Valid lists all units accepted by Format, in the order they are documented.
+var Valid = []string{Auto, Bytes, Seconds, Ratio, SI, None}
+
+// IsValid reports whether unit is one of the Valid units.
+func IsValid(unit string) bool {
+	for _, u := range Valid {
+		if u == unit {
+			return true
+		}
+	}
+	return false
+}
+
+// suffixRe matches the unit suffix of a metric name following the Prometheus naming conventions.
+var suffixRe = regexp.MustCompile(`_(bytes|seconds|ratio)(?:_total|_sum|_count|_bucket)?\b`)
+
+// Guess returns the unit of a metric from the suffix of its name, following the Prometheus
+// naming conventions, or None if it has no known unit suffix. Any text containing metric
+// names can be passed, e.g. a PromQL query, in which case the first unit found is returned.
+func Guess(text string) string {
+	m := suffixRe.FindStringSubmatch(text)
+	if m == nil || strings.HasSuffix(m[0], "_count") {
+		return None
+	}
+	return m[1]
+}
+
+// Format formats a sample value in the given unit: bytes with IEC prefixes (e.g. 1.2Gi),
+// seconds as durations (e.g. 450ms), ratios as percentages and anything else with SI
+// prefixes (e.g. 12.3k). With None, or for non-finite values, the raw value is returned.
+func Format(v float64, unit string) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	switch unit {
+	case Bytes:
+		return prefixed(v, 1024, []string{"", "Ki", "Mi", "Gi", "Ti", "Pi", "Ei"})
+	case Seconds:
+		return Duration(v)
+	case Ratio:
+		return trim(v*100) + "%"
+	case SI:
+		return prefixed(v, 1000, []string{"", "k", "M", "G", "T", "P", "E"})
+	default:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
+
+// Duration formats seconds as a human readable duration, e.g. 450ms, 12.5s or 1h2m3s.
+func Duration(seconds float64) string {
+	abs := math.Abs(seconds)
+	switch {
+	case abs == 0:
+		return "0s"
+	case abs < 1e-6:
+		return trim(seconds*1e9) + "ns"
+	case abs < 1e-3:
+		return trim(seconds*1e6) + "µs"
+	case abs < 1:
+		return trim(seconds*1e3) + "ms"
+	case abs < 60:
+		return trim(seconds) + "s"
+	default:
+		return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+	}
+}
+
+func prefixed(v, base float64, prefixes []string) string {
+	i := 0
+	for math.Abs(v) >= base && i < len(prefixes)-1 {
+		v /= base
+		i++
+	}
+	return trim(v) + prefixes[i]
+}
+
+// trim formats v with up to three significant digits, e.g. 1.23 or 45.6. Larger values are rounded to integers.
+func trim(v float64) string {
+	if v == 0 {
+		return "0"
+	}
+	if math.Abs(v) >= 100 {
+		return strconv.FormatFloat(math.Round(v), 'f', -1, 64)
+	}
+
+	p := math.Pow(10, float64(2-int(math.Floor(math.Log10(math.Abs(v))))))
+	return strconv.FormatFloat(math.Round(v*p)/p, 'f', -1, 64)
+}
+
+// byteSizeRe matches sizes like 512MiB, 1.5GB or 1024.
+var byteSizeRe = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([KMGTP]i?)?B?$`)
+
+// ParseBytes parses a size in bytes with an optional IEC (e.g. 512MiB) or SI (e.g. 1GB) prefix.
+func ParseBytes(s string) (int64, error) {
+	m := byteSizeRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 512MiB or 1GB", s)
+	}
+
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+
+	if m[2] != "" {
+		base := 1000.0
+		if strings.HasSuffix(m[2], "i") {
+			base = 1024
+		}
+		v *= math.Pow(base, float64(strings.Index("KMGTP", m[2][:1])+1))
+	}
+	return int64(v), nil
+}
@@ -1,4 +1,13 @@
 package version
 
+import "runtime"
+
 // Version returns 'obsctl' version.
 const Version = "v0.1.0-dev"
+
+// Revision is the commit obsctl was built from, set at build time with
+// -ldflags "-X github.com/observatorium/obsctl/pkg/version.Revision=<commit>".
+var Revision = "unknown"
+
+// GoVersion is the version of Go obsctl was built with.
+var GoVersion = runtime.Version()